@@ -0,0 +1,155 @@
+package admin
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/bornholm/calli/internal/authz"
+	"github.com/bornholm/calli/internal/store"
+	"github.com/bornholm/calli/internal/ui"
+	"github.com/bornholm/calli/pkg/log"
+	"github.com/dustin/go-humanize"
+	"github.com/pkg/errors"
+)
+
+// auditTimeLayout is the layout of the datetime-local inputs
+const auditTimeLayout = "2006-01-02T15:04"
+
+const auditPageSize = 50
+
+// serveAudit handles requests for the audit trail search page
+func (h *Handler) serveAudit(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Get current authenticated user from context
+	authUser, err := authz.ContextUser(ctx)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	storeUser, ok := authUser.(*store.User)
+	if !ok || !storeUser.IsAdmin {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	values := r.URL.Query()
+
+	data := AuditTemplateData{
+		HeadTemplateData: ui.HeadTemplateData{
+			PageTitle: "Audit - Admin",
+		},
+		NavbarTemplateData: ui.NavbarTemplateData{
+			NavbarItems: []ui.NavbarItem{ui.NavbarItemLogout},
+		},
+		Username: getUserDisplayName(storeUser),
+		IsAdmin:  storeUser.IsAdmin,
+		Entries:  []AuditEntryTemplateData{},
+		User:     values.Get("user"),
+		Search:   values.Get("path"),
+		Since:    values.Get("since"),
+		Until:    values.Get("until"),
+		Path:     "audit",
+	}
+
+	page, err := strconv.Atoi(values.Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	query := store.AuditQuery{
+		User: data.User,
+		Path: data.Search,
+		// Fetch one more entry to know if there is a next page
+		Limit:  auditPageSize + 1,
+		Offset: (page - 1) * auditPageSize,
+	}
+
+	if data.Since != "" {
+		since, err := time.ParseInLocation(auditTimeLayout, data.Since, time.Local)
+		if err != nil {
+			data.ErrorMessage = "Invalid start date"
+		}
+
+		query.Since = since
+	}
+
+	if data.Until != "" {
+		until, err := time.ParseInLocation(auditTimeLayout, data.Until, time.Local)
+		if err != nil {
+			data.ErrorMessage = "Invalid end date"
+		}
+
+		// Include the whole minute
+		query.Until = until.Add(time.Minute - time.Second)
+	}
+
+	if data.ErrorMessage == "" {
+		entries, err := h.store.SearchAuditEntries(ctx, query)
+		if err != nil {
+			slog.ErrorContext(ctx, "could not search audit entries", log.Error(errors.WithStack(err)))
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if len(entries) > auditPageSize {
+			entries = entries[:auditPageSize]
+			data.NextPageURL = auditPageURL(values, page+1)
+		}
+
+		if page > 1 {
+			data.PreviousPageURL = auditPageURL(values, page-1)
+		}
+
+		for _, e := range entries {
+			data.Entries = append(data.Entries, NewAuditEntryTemplateData(e))
+		}
+	}
+
+	// Render template
+	if err := templates.ExecuteTemplate(w, "index", data); err != nil {
+		slog.ErrorContext(ctx, "could not execute template", log.Error(errors.WithStack(err)))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+func auditPageURL(values url.Values, page int) string {
+	query := url.Values{}
+	for key, v := range values {
+		query[key] = v
+	}
+
+	query.Set("page", strconv.Itoa(page))
+
+	return "/admin/audit?" + query.Encode()
+}
+
+// NewAuditEntryTemplateData creates a new audit entry template data from a store.AuditEntry
+func NewAuditEntryTemplateData(entry *store.AuditEntry) AuditEntryTemplateData {
+	user := entry.Email
+	if user == "" {
+		user = entry.Subject
+	}
+
+	return AuditEntryTemplateData{
+		ID:                entry.ID,
+		CreatedAt:         entry.CreatedAt,
+		HumanCreatedAt:    humanize.Time(entry.CreatedAt),
+		User:              user,
+		Provider:          entry.Provider,
+		Operation:         entry.Operation,
+		Name:              entry.Name,
+		NewName:           entry.NewName,
+		Flag:              entry.Flag,
+		HumanBytesRead:    humanize.Bytes(uint64(entry.BytesRead)),
+		HumanBytesWritten: humanize.Bytes(uint64(entry.BytesWritten)),
+		Decision:          entry.Decision,
+		Rule:              entry.Rule,
+		Error:             entry.Error,
+	}
+}
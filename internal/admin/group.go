@@ -0,0 +1,430 @@
+package admin
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/bornholm/calli/internal/authz"
+	"github.com/bornholm/calli/internal/store"
+	"github.com/bornholm/calli/internal/ui"
+	"github.com/bornholm/calli/pkg/log"
+	"github.com/dustin/go-humanize"
+	"github.com/pkg/errors"
+)
+
+// serveNewGroup handles requests for the new group form
+func (h *Handler) serveNewGroup(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Get current authenticated user from context
+	authUser, err := authz.ContextUser(ctx)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	storeUser, ok := authUser.(*store.User)
+	if !ok || !storeUser.IsAdmin {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	data := h.newGroupFormData(storeUser, &store.Group{}, false)
+
+	// Render template
+	if err := templates.ExecuteTemplate(w, "index", data); err != nil {
+		slog.ErrorContext(ctx, "could not execute template", log.Error(errors.WithStack(err)))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// serveCreateGroup handles POST requests to create a group
+func (h *Handler) serveCreateGroup(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Get current authenticated user from context
+	authUser, err := authz.ContextUser(ctx)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	storeUser, ok := authUser.(*store.User)
+	if !ok || !storeUser.IsAdmin {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	group, err := parseGroupForm(r)
+
+	var createdGroup *store.Group
+	if err == nil {
+		createdGroup, err = h.store.CreateGroup(ctx, group)
+	}
+
+	if err != nil {
+		slog.ErrorContext(ctx, "could not create group", log.Error(errors.WithStack(err)))
+
+		data := h.newGroupFormData(storeUser, group, false)
+		data.ErrorMessage = err.Error()
+
+		w.WriteHeader(http.StatusBadRequest)
+
+		if err := templates.ExecuteTemplate(w, "index", data); err != nil {
+			slog.ErrorContext(ctx, "could not execute template", log.Error(errors.WithStack(err)))
+		}
+
+		return
+	}
+
+	// Redirect to group edit form
+	http.Redirect(w, r, fmt.Sprintf("%s/groups/%d/edit", h.prefix, createdGroup.ID), http.StatusSeeOther)
+}
+
+// serveEditGroup handles requests for the edit group form
+func (h *Handler) serveEditGroup(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Get current authenticated user from context
+	authUser, err := authz.ContextUser(ctx)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	storeUser, ok := authUser.(*store.User)
+	if !ok || !storeUser.IsAdmin {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	// Get group ID from URL
+	path := r.URL.Path
+	var groupID int64
+	_, err = fmt.Sscanf(path, h.prefix+"/groups/%d/edit", &groupID)
+	if err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	// Get group from database
+	groups, err := h.store.GetGroups(ctx, groupID)
+	if err != nil || len(groups) == 0 {
+		slog.ErrorContext(ctx, "could not get group", log.Error(errors.WithStack(err)))
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	data := h.newGroupFormData(storeUser, groups[0], true)
+
+	// Render template
+	if err := templates.ExecuteTemplate(w, "index", data); err != nil {
+		slog.ErrorContext(ctx, "could not execute template", log.Error(errors.WithStack(err)))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// serveUpdateGroup handles POST requests to update a group
+func (h *Handler) serveUpdateGroup(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Get current authenticated user from context
+	authUser, err := authz.ContextUser(ctx)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	storeUser, ok := authUser.(*store.User)
+	if !ok || !storeUser.IsAdmin {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	// Get group ID from URL
+	path := r.URL.Path
+	var groupID int64
+	_, err = fmt.Sscanf(path, h.prefix+"/groups/%d/edit", &groupID)
+	if err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	// Parse form
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	group, err := parseGroupForm(r)
+	group.ID = groupID
+
+	if err == nil {
+		_, err = h.store.UpdateGroup(ctx, group)
+	}
+
+	if err != nil {
+		if errors.Is(err, store.ErrGroupNotFound) {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+
+		if errors.Is(err, store.ErrGroupManaged) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		slog.ErrorContext(ctx, "could not update group", log.Error(errors.WithStack(err)))
+
+		data := h.newGroupFormData(storeUser, group, true)
+		data.ErrorMessage = err.Error()
+
+		w.WriteHeader(http.StatusBadRequest)
+
+		if err := templates.ExecuteTemplate(w, "index", data); err != nil {
+			slog.ErrorContext(ctx, "could not execute template", log.Error(errors.WithStack(err)))
+		}
+
+		return
+	}
+
+	// Redirect to group edit form
+	http.Redirect(w, r, fmt.Sprintf("%s/groups/%d/edit", h.prefix, groupID), http.StatusSeeOther)
+}
+
+// serveDeleteGroup handles requests for the delete group confirmation
+func (h *Handler) serveDeleteGroup(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Get current authenticated user from context
+	authUser, err := authz.ContextUser(ctx)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	storeUser, ok := authUser.(*store.User)
+	if !ok || !storeUser.IsAdmin {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	// Get group ID from URL
+	path := r.URL.Path
+	var groupID int64
+	_, err = fmt.Sscanf(path, h.prefix+"/groups/%d/delete", &groupID)
+	if err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	// Get group from database
+	groups, err := h.store.GetGroups(ctx, groupID)
+	if err != nil || len(groups) == 0 {
+		slog.ErrorContext(ctx, "could not get group", log.Error(errors.WithStack(err)))
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	data := h.newGroupDeleteData(storeUser, groups[0])
+
+	// Render template
+	if err := templates.ExecuteTemplate(w, "index", data); err != nil {
+		slog.ErrorContext(ctx, "could not execute template", log.Error(errors.WithStack(err)))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// serveDeleteGroupConfirm handles POST requests to delete a group
+func (h *Handler) serveDeleteGroupConfirm(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Get current authenticated user from context
+	authUser, err := authz.ContextUser(ctx)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	storeUser, ok := authUser.(*store.User)
+	if !ok || !storeUser.IsAdmin {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	// Get group ID from URL
+	path := r.URL.Path
+	var groupID int64
+	_, err = fmt.Sscanf(path, h.prefix+"/groups/%d/delete", &groupID)
+	if err != nil {
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return
+	}
+
+	// Get group from database
+	groups, err := h.store.GetGroups(ctx, groupID)
+	if err != nil || len(groups) == 0 {
+		slog.ErrorContext(ctx, "could not get group", log.Error(errors.WithStack(err)))
+		http.Error(w, "Not Found", http.StatusNotFound)
+		return
+	}
+
+	// Delete group from database
+	if err := h.store.DeleteGroups(ctx, groupID); err != nil {
+		data := h.newGroupDeleteData(storeUser, groups[0])
+
+		switch {
+		case errors.Is(err, store.ErrGroupInUse):
+			data.ErrorMessage = "This group is still assigned to users and can not be deleted."
+		case errors.Is(err, store.ErrGroupManaged):
+			// Error message is already set for managed groups
+		default:
+			slog.ErrorContext(ctx, "could not delete group", log.Error(errors.WithStack(err)))
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.WriteHeader(http.StatusConflict)
+
+		if err := templates.ExecuteTemplate(w, "index", data); err != nil {
+			slog.ErrorContext(ctx, "could not execute template", log.Error(errors.WithStack(err)))
+		}
+
+		return
+	}
+
+	// Redirect to groups list
+	http.Redirect(w, r, h.prefix+"/groups", http.StatusSeeOther)
+}
+
+// newGroupFormData creates template data for the group create/edit form
+func (h *Handler) newGroupFormData(user *store.User, group *store.Group, isEdit bool) GroupFormTemplateData {
+	data := GroupFormTemplateData{
+		HeadTemplateData: ui.HeadTemplateData{
+			PageTitle: "New Group - Admin",
+		},
+		NavbarTemplateData: ui.NavbarTemplateData{
+			NavbarItems: []ui.NavbarItem{ui.NavbarItemLogout},
+		},
+		Username:      getUserDisplayName(user),
+		IsAdmin:       user.IsAdmin,
+		Group:         NewGroupTemplateData(group),
+		Rules:         make([]RuleTemplateData, 0, len(group.Rules)),
+		Strategies:    []string{string(authz.StrategyDenyOverrides), string(authz.StrategyFirstMatch)},
+		Effects:       []string{string(authz.EffectAllow), string(authz.EffectDeny)},
+		IsEdit:        isEdit,
+		FormAction:    fmt.Sprintf("%s/groups/new", h.prefix),
+		FormTitle:     "New Group",
+		SubmitBtnText: "Create Group",
+		Path:          "groups-new",
+	}
+
+	if isEdit {
+		data.PageTitle = "Edit Group - Admin"
+		data.FormAction = fmt.Sprintf("%s/groups/%d/edit", h.prefix, group.ID)
+		data.FormTitle = "Edit Group"
+		data.SubmitBtnText = "Update Group"
+		data.Path = "groups-edit"
+	}
+
+	for i, r := range group.Rules {
+		rule := NewRuleTemplateData(r)
+		rule.SortOrder = i + 1
+		data.Rules = append(data.Rules, rule)
+	}
+
+	data.NextSortOrder = len(data.Rules) + 1
+
+	return data
+}
+
+// newGroupDeleteData creates template data for the group delete confirmation
+func (h *Handler) newGroupDeleteData(user *store.User, group *store.Group) GroupDeleteTemplateData {
+	data := GroupDeleteTemplateData{
+		HeadTemplateData: ui.HeadTemplateData{
+			PageTitle: "Delete Group - Admin",
+		},
+		NavbarTemplateData: ui.NavbarTemplateData{
+			NavbarItems: []ui.NavbarItem{ui.NavbarItemLogout},
+		},
+		Username: getUserDisplayName(user),
+		IsAdmin:  user.IsAdmin,
+		Group:    NewGroupTemplateData(group),
+		Path:     "groups-delete",
+	}
+
+	if group.Managed {
+		data.ErrorMessage = "This group is managed by the configuration and can not be deleted."
+	}
+
+	return data
+}
+
+// parseGroupForm creates a group from the submitted form, its rules being
+// sorted by their submitted order. Empty rules are ignored. The group is
+// returned along with the error if its quota is not a valid size.
+func parseGroupForm(r *http.Request) (*store.Group, error) {
+	group := &store.Group{
+		Name:     strings.TrimSpace(r.Form.Get("name")),
+		Strategy: authz.Strategy(r.Form.Get("strategy")),
+		QuotaDir: strings.TrimSpace(r.Form.Get("quota_dir")),
+		Rules:    make([]*store.Rule, 0),
+	}
+
+	scripts := r.Form["rule_script"]
+	orders := r.Form["rule_order"]
+	effects := r.Form["rule_effect"]
+
+	for i, script := range scripts {
+		script = strings.TrimSpace(script)
+		if script == "" {
+			continue
+		}
+
+		sortOrder := i + 1
+		if i < len(orders) {
+			if order, err := strconv.Atoi(strings.TrimSpace(orders[i])); err == nil {
+				sortOrder = order
+			}
+		}
+
+		var effect authz.Effect
+		if i < len(effects) {
+			effect = authz.Effect(effects[i])
+		}
+
+		group.Rules = append(group.Rules, &store.Rule{
+			Script:    script,
+			Effect:    effect,
+			SortOrder: sortOrder,
+		})
+	}
+
+	slices.SortStableFunc(group.Rules, func(a, b *store.Rule) int {
+		return a.SortOrder - b.SortOrder
+	})
+
+	if rawQuota := strings.TrimSpace(r.Form.Get("quota")); rawQuota != "" {
+		quota, err := humanize.ParseBytes(rawQuota)
+		if err != nil {
+			return group, errors.Wrapf(store.ErrInvalidGroup, "quota '%s' is not a valid size", rawQuota)
+		}
+
+		group.Quota = int64(quota)
+	}
+
+	return group, nil
+}
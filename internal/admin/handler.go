@@ -4,13 +4,17 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/bornholm/calli/internal/authz/denial"
 	"github.com/bornholm/calli/internal/store"
+	"github.com/bornholm/calli/pkg/webdav/filesystem/dedup"
 )
 
 type Handler struct {
-	prefix string
-	store  *store.Store
-	mux    *http.ServeMux
+	prefix  string
+	store   *store.Store
+	denials *denial.Recorder
+	dedup   *dedup.Collector
+	mux     *http.ServeMux
 }
 
 // ServeHTTP implements http.Handler.
@@ -18,11 +22,13 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	h.mux.ServeHTTP(w, r)
 }
 
-func NewHandler(prefix string, store *store.Store) *Handler {
+func NewHandler(prefix string, store *store.Store, denials *denial.Recorder, dedup *dedup.Collector) *Handler {
 	handler := &Handler{
-		prefix: prefix,
-		store:  store,
-		mux:    &http.ServeMux{},
+		prefix:  prefix,
+		store:   store,
+		denials: denials,
+		dedup:   dedup,
+		mux:     &http.ServeMux{},
 	}
 
 	// Register routes
@@ -36,6 +42,22 @@ func NewHandler(prefix string, store *store.Store) *Handler {
 	handler.mux.HandleFunc(fmt.Sprintf("GET %s/users/{id}/delete", prefix), handler.serveDeleteUser)
 	handler.mux.HandleFunc(fmt.Sprintf("POST %s/users/{id}/delete", prefix), handler.serveDeleteUserConfirm)
 
+	// Group CRUD routes
+	handler.mux.HandleFunc(fmt.Sprintf("GET %s/groups/new", prefix), handler.serveNewGroup)
+	handler.mux.HandleFunc(fmt.Sprintf("POST %s/groups/new", prefix), handler.serveCreateGroup)
+	handler.mux.HandleFunc(fmt.Sprintf("GET %s/groups/{id}/edit", prefix), handler.serveEditGroup)
+	handler.mux.HandleFunc(fmt.Sprintf("POST %s/groups/{id}/edit", prefix), handler.serveUpdateGroup)
+	handler.mux.HandleFunc(fmt.Sprintf("GET %s/groups/{id}/delete", prefix), handler.serveDeleteGroup)
+	handler.mux.HandleFunc(fmt.Sprintf("POST %s/groups/{id}/delete", prefix), handler.serveDeleteGroupConfirm)
+
+	// Audit trail routes
+	handler.mux.HandleFunc(fmt.Sprintf("GET %s/audit", prefix), handler.serveAudit)
+
+	// Policy simulator routes
+	handler.mux.HandleFunc(fmt.Sprintf("GET %s/simulator", prefix), handler.serveSimulator)
+	handler.mux.HandleFunc(fmt.Sprintf("POST %s/simulator", prefix), handler.serveSimulator)
+	handler.mux.HandleFunc(fmt.Sprintf("POST %s/api/simulate", prefix), handler.serveSimulateAPI)
+
 	return handler
 }
 
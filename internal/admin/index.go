@@ -7,6 +7,7 @@ import (
 	"time"
 
 	"github.com/bornholm/calli/internal/authz"
+	"github.com/bornholm/calli/internal/authz/denial"
 	"github.com/bornholm/calli/internal/store"
 	"github.com/bornholm/calli/internal/ui"
 	"github.com/bornholm/calli/pkg/log"
@@ -127,9 +128,40 @@ func (h *Handler) getDashboardData(ctx context.Context, user *store.User) AdminD
 		return nil
 	})
 
+	if h.denials != nil {
+		data.DenialCount = h.denials.Total()
+		data.DenialsByUser = topDenialCounts(h.denials.UserCounts(), dashboardTopCounts)
+		data.DenialsByGroup = topDenialCounts(h.denials.GroupCounts(), dashboardTopCounts)
+
+		for _, evt := range h.denials.Events() {
+			data.RecentDenials = append(data.RecentDenials, NewDenialTemplateData(evt))
+		}
+	}
+
+	if h.dedup != nil && h.dedup.Enabled() {
+		stats, err := h.dedup.Stats(ctx)
+		if err != nil {
+			slog.ErrorContext(ctx, "could not get deduplication stats", log.Error(errors.WithStack(err)))
+		} else {
+			data.Dedup = NewDedupTemplateData(stats)
+		}
+	}
+
 	return data
 }
 
+// dashboardTopCounts is the number of users and groups
+// listed in the denials summary of the dashboard
+const dashboardTopCounts = 5
+
+func topDenialCounts(counts []denial.Count, max int) []denial.Count {
+	if len(counts) > max {
+		return counts[:max]
+	}
+
+	return counts
+}
+
 // getGroupsData creates template data for the groups page
 func (h *Handler) getGroupsData(ctx context.Context, user *store.User) GroupsTemplateData {
 	data := GroupsTemplateData{
@@ -146,36 +178,14 @@ func (h *Handler) getGroupsData(ctx context.Context, user *store.User) GroupsTem
 	}
 
 	// Get groups from store
-	_ = h.store.Do(ctx, func(conn *sqlite.Conn) error {
-		query := "SELECT g.id, g.name, g.created_at, g.updated_at, " +
-			"(SELECT COUNT(*) FROM rules r WHERE r.group_id = g.id) AS rule_count " +
-			"FROM groups g ORDER BY g.id"
-
-		err := sqlitex.Execute(conn, query, &sqlitex.ExecOptions{
-			ResultFunc: func(stmt *sqlite.Stmt) error {
-				// Create group from row
-				group := &store.Group{
-					ID:        stmt.ColumnInt64(0),
-					Name:      stmt.ColumnText(1),
-					CreatedAt: sqliteTimeToTime(stmt.ColumnInt64(2)),
-					UpdatedAt: sqliteTimeToTime(stmt.ColumnInt64(3)),
-				}
-
-				// Create template data
-				groupData := NewGroupTemplateData(group)
-				groupData.RuleCount = int(stmt.ColumnInt64(4))
-
-				// Add to template data
-				data.Groups = append(data.Groups, groupData)
-				return nil
-			},
-		})
-		if err != nil {
-			slog.ErrorContext(ctx, "could not get groups", log.Error(errors.WithStack(err)))
+	groups, err := h.store.GetGroups(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "could not get groups", log.Error(errors.WithStack(err)))
+	} else {
+		for _, group := range groups {
+			data.Groups = append(data.Groups, NewGroupTemplateData(group))
 		}
-
-		return nil
-	})
+	}
 
 	return data
 }
@@ -0,0 +1,402 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bornholm/calli/internal/authz"
+	"github.com/bornholm/calli/internal/authz/expr"
+	"github.com/bornholm/calli/internal/store"
+	"github.com/bornholm/calli/internal/ui"
+	"github.com/bornholm/calli/pkg/log"
+	"github.com/pkg/errors"
+)
+
+var (
+	errInvalidSimulation = errors.New("invalid simulation")
+	errUserNotFound      = errors.New("user not found")
+)
+
+var simulationOperations = []authz.Operation{
+	authz.OperationOpen,
+	authz.OperationStat,
+	authz.OperationMkdir,
+	authz.OperationRemove,
+	authz.OperationRename,
+}
+
+var simulationFlags = map[string]int{
+	"O_RDONLY": os.O_RDONLY,
+	"O_WRONLY": os.O_WRONLY,
+	"O_RDWR":   os.O_RDWR,
+	"O_APPEND": os.O_APPEND,
+	"O_CREATE": os.O_CREATE,
+	"O_EXCL":   os.O_EXCL,
+	"O_SYNC":   os.O_SYNC,
+	"O_TRUNC":  os.O_TRUNC,
+}
+
+var simulationFlagNames = []string{"O_RDONLY", "O_WRONLY", "O_RDWR", "O_APPEND", "O_CREATE", "O_EXCL", "O_SYNC", "O_TRUNC"}
+
+// SimulationRequest describes an operation to evaluate against the
+// rules of a user or of a set of groups
+type SimulationRequest struct {
+	UserID    int64    `json:"userId"`
+	GroupIDs  []int64  `json:"groupIds"`
+	Operation string   `json:"operation"`
+	Path      string   `json:"path"`
+	NewPath   string   `json:"newPath"`
+	Flags     []string `json:"flags"`
+	// IP and Method describe the simulated HTTP request, if any
+	IP     string `json:"ip"`
+	Method string `json:"method"`
+}
+
+// SimulationResult is the outcome of a simulation
+type SimulationResult struct {
+	Allowed       bool                   `json:"allowed"`
+	Operation     string                 `json:"operation"`
+	Matched       *SimulationEvaluation  `json:"matched"`
+	Evaluations   []SimulationEvaluation `json:"evaluations"`
+	CompileErrors []SimulationEvaluation `json:"compileErrors"`
+	Error         string                 `json:"error,omitempty"`
+	Env           map[string]any         `json:"env"`
+}
+
+// SimulationEvaluation is the outcome of a single rule in a simulation
+type SimulationEvaluation struct {
+	Index  int    `json:"index"`
+	Group  string `json:"group"`
+	Rule   string `json:"rule"`
+	Effect string `json:"effect"`
+	Result bool   `json:"result"`
+	Error  string `json:"error,omitempty"`
+}
+
+// serveSimulator handles requests for the policy simulator page
+func (h *Handler) serveSimulator(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Get current authenticated user from context
+	authUser, err := authz.ContextUser(ctx)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	storeUser, ok := authUser.(*store.User)
+	if !ok || !storeUser.IsAdmin {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	data := h.getSimulatorData(ctx, storeUser)
+	data.Request = SimulationRequest{
+		Operation: string(authz.OperationOpen),
+		Path:      "/",
+		Flags:     []string{"O_RDONLY"},
+	}
+
+	if r.Method == http.MethodPost {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		req := parseSimulationForm(r)
+		data.Request = req
+
+		result, err := h.simulate(ctx, req)
+		if err != nil {
+			data.ErrorMessage = err.Error()
+		} else {
+			data.Result = result
+		}
+	}
+
+	// Render template
+	if err := templates.ExecuteTemplate(w, "index", data); err != nil {
+		slog.ErrorContext(ctx, "could not execute template", log.Error(errors.WithStack(err)))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+}
+
+// serveSimulateAPI handles JSON simulation requests
+func (h *Handler) serveSimulateAPI(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	// Get current authenticated user from context
+	authUser, err := authz.ContextUser(ctx)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	storeUser, ok := authUser.(*store.User)
+	if !ok || !storeUser.IsAdmin {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	var req SimulationRequest
+
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, errors.Wrap(err, "could not parse request"))
+		return
+	}
+
+	result, err := h.simulate(ctx, req)
+	if err != nil {
+		switch {
+		case errors.Is(err, errInvalidSimulation):
+			writeJSONError(w, http.StatusBadRequest, err)
+		case errors.Is(err, errUserNotFound):
+			writeJSONError(w, http.StatusNotFound, err)
+		default:
+			slog.ErrorContext(ctx, "could not simulate request", log.Error(errors.WithStack(err)))
+			writeJSONError(w, http.StatusInternalServerError, errors.New("internal server error"))
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(result); err != nil {
+		slog.ErrorContext(ctx, "could not encode simulation result", log.Error(errors.WithStack(err)))
+	}
+}
+
+// simulate evaluates the given request with the same logic
+// as the authorization filesystem
+func (h *Handler) simulate(ctx context.Context, req SimulationRequest) (*SimulationResult, error) {
+	operation, err := parseSimulationOperation(req.Operation)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	user, err := h.getSimulatedUser(ctx, req)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	flag := 0
+	for _, name := range req.Flags {
+		value, exists := simulationFlags[strings.TrimSpace(name)]
+		if !exists {
+			return nil, errors.Wrapf(errInvalidSimulation, "unknown flag '%s'", name)
+		}
+
+		flag |= value
+	}
+
+	// Use the same operation specific attributes as authz.FileSystem
+	var env map[string]any
+	switch operation {
+	case authz.OperationOpen:
+		env = map[string]any{"name": req.Path, "flag": flag, "perm": os.FileMode(0)}
+	case authz.OperationMkdir:
+		env = map[string]any{"name": req.Path, "perm": os.ModePerm}
+	case authz.OperationRename:
+		env = map[string]any{"oldName": req.Path, "newName": req.NewPath}
+	default:
+		env = map[string]any{"name": req.Path}
+	}
+
+	// Do not expose the administrator's own request to the rules
+	ctx = authz.WithContextRequest(ctx, &authz.Request{
+		IP:     req.IP,
+		Method: strings.ToUpper(req.Method),
+		Time:   time.Now(),
+	})
+
+	decision := authz.Evaluate(ctx, user, operation, env)
+
+	result := &SimulationResult{
+		Allowed:       decision.Allowed(),
+		Operation:     string(operation),
+		Evaluations:   make([]SimulationEvaluation, 0, len(decision.Evaluations)),
+		CompileErrors: make([]SimulationEvaluation, 0),
+		Env:           decision.Env,
+	}
+
+	if err := decision.Err(); err != nil {
+		result.Error = err.Error()
+	}
+
+	for _, e := range decision.Evaluations {
+		evaluation := newSimulationEvaluation(e)
+		result.Evaluations = append(result.Evaluations, evaluation)
+
+		if decision.Matched != nil && decision.Matched.Index == e.Index {
+			result.Matched = &evaluation
+		}
+	}
+
+	// Report the rules which do not compile, even if they were not evaluated,
+	// with the same indexes as the evaluations
+	policies := append([]*authz.Group{authz.NewGroup("", authz.StrategyDenyOverrides, user.FileSystemRules()...)}, user.FileSystemGroups()...)
+
+	index := 0
+	for _, g := range policies {
+		for _, r := range g.Rules() {
+			i := index
+			index++
+
+			rule, ok := r.(*expr.Rule)
+			if !ok {
+				continue
+			}
+
+			if err := expr.Validate(rule.String()); err != nil {
+				result.CompileErrors = append(result.CompileErrors, SimulationEvaluation{
+					Index:  i,
+					Group:  g.Name(),
+					Rule:   rule.String(),
+					Effect: string(rule.Effect()),
+					Error:  err.Error(),
+				})
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// getSimulatedUser returns the requested user, or a fictive user belonging
+// to the requested groups
+func (h *Handler) getSimulatedUser(ctx context.Context, req SimulationRequest) (*store.User, error) {
+	if req.UserID != 0 {
+		users, err := h.store.GetUsers(ctx, req.UserID)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		if len(users) == 0 {
+			return nil, errors.Wrapf(errUserNotFound, "user '%d' does not exist", req.UserID)
+		}
+
+		return users[0], nil
+	}
+
+	if len(req.GroupIDs) == 0 {
+		return nil, errors.Wrap(errInvalidSimulation, "a user or at least one group must be selected")
+	}
+
+	groups, err := h.store.GetGroups(ctx, req.GroupIDs...)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	user := &store.User{
+		Subject:  "simulator",
+		Provider: "simulator",
+	}
+
+	user.SetGroups(groups...)
+
+	return user, nil
+}
+
+// getSimulatorData creates template data for the simulator page
+func (h *Handler) getSimulatorData(ctx context.Context, user *store.User) SimulatorTemplateData {
+	data := SimulatorTemplateData{
+		HeadTemplateData: ui.HeadTemplateData{
+			PageTitle: "Simulator - Admin",
+		},
+		NavbarTemplateData: ui.NavbarTemplateData{
+			NavbarItems: []ui.NavbarItem{ui.NavbarItemLogout},
+		},
+		Username:   getUserDisplayName(user),
+		IsAdmin:    user.IsAdmin,
+		Users:      []UserTemplateData{},
+		Groups:     h.getAllGroups(ctx),
+		Operations: simulationOperations,
+		Flags:      simulationFlagNames,
+		Path:       "simulator",
+	}
+
+	users, err := h.store.GetUsers(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "could not get users", log.Error(errors.WithStack(err)))
+	} else {
+		for _, u := range users {
+			data.Users = append(data.Users, NewUserTemplateData(u))
+		}
+	}
+
+	return data
+}
+
+func parseSimulationForm(r *http.Request) SimulationRequest {
+	req := SimulationRequest{
+		Operation: r.Form.Get("operation"),
+		Path:      r.Form.Get("path"),
+		NewPath:   r.Form.Get("newPath"),
+		Flags:     r.Form["flags"],
+		GroupIDs:  make([]int64, 0),
+		IP:        strings.TrimSpace(r.Form.Get("ip")),
+		Method:    strings.TrimSpace(r.Form.Get("method")),
+	}
+
+	if userID, err := strconv.ParseInt(r.Form.Get("user"), 10, 64); err == nil {
+		req.UserID = userID
+	}
+
+	for _, raw := range r.Form["groups"] {
+		if groupID, err := strconv.ParseInt(raw, 10, 64); err == nil {
+			req.GroupIDs = append(req.GroupIDs, groupID)
+		}
+	}
+
+	return req
+}
+
+// parseSimulationOperation accepts either the operation (i.e. "open")
+// or its rule constant (i.e. "OP_OPEN")
+func parseSimulationOperation(raw string) (authz.Operation, error) {
+	name := strings.ToLower(strings.TrimPrefix(strings.TrimSpace(raw), "OP_"))
+
+	for _, op := range simulationOperations {
+		if string(op) == name {
+			return op, nil
+		}
+	}
+
+	return "", errors.Wrapf(errInvalidSimulation, "unknown operation '%s'", raw)
+}
+
+func newSimulationEvaluation(e authz.RuleEvaluation) SimulationEvaluation {
+	evaluation := SimulationEvaluation{
+		Index:  e.Index,
+		Group:  e.Group,
+		Rule:   e.String(),
+		Effect: string(e.Rule.Effect()),
+		Result: e.Result,
+	}
+
+	if e.Error != nil {
+		evaluation.Error = e.Error.Error()
+	}
+
+	return evaluation
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	_ = json.NewEncoder(w).Encode(map[string]string{
+		"error": fmt.Sprintf("%v", err),
+	})
+}
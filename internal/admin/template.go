@@ -2,11 +2,15 @@ package admin
 
 import (
 	"embed"
+	"fmt"
 	"html/template"
 	"time"
 
+	"github.com/bornholm/calli/internal/authz"
+	"github.com/bornholm/calli/internal/authz/denial"
 	"github.com/bornholm/calli/internal/store"
 	"github.com/bornholm/calli/internal/ui"
+	"github.com/bornholm/calli/pkg/webdav/filesystem/dedup"
 	"github.com/dustin/go-humanize"
 	"github.com/pkg/errors"
 )
@@ -51,12 +55,17 @@ type GroupTemplateData struct {
 	HumanCreatedAt string
 	HumanUpdatedAt string
 	RuleCount      int
+	Managed        bool
+	Strategy       string
+	Quota          string
+	QuotaDir       string
 }
 
 // RuleTemplateData contains information about a rule
 type RuleTemplateData struct {
 	ID             int64
 	Script         string
+	Effect         string
 	SortOrder      int
 	GroupID        int64
 	GroupName      string
@@ -70,12 +79,37 @@ type RuleTemplateData struct {
 type AdminDashboardTemplateData struct {
 	ui.HeadTemplateData
 	ui.NavbarTemplateData
-	Username   string
-	IsAdmin    bool
-	UserCount  int
-	GroupCount int
-	RuleCount  int
-	Path       string
+	Username       string
+	IsAdmin        bool
+	UserCount      int
+	GroupCount     int
+	RuleCount      int
+	DenialCount    uint64
+	DenialsByUser  []denial.Count
+	DenialsByGroup []denial.Count
+	RecentDenials  []DenialTemplateData
+	Dedup          *DedupTemplateData
+	Path           string
+}
+
+// DedupTemplateData contains the stats of the deduplicated filesystems
+type DedupTemplateData struct {
+	Ratio            string
+	HumanLogicalSize string
+	HumanStoredSize  string
+	Chunks           int64
+}
+
+// DenialTemplateData contains information about a denied operation
+type DenialTemplateData struct {
+	Time        time.Time
+	HumanTime   string
+	User        string
+	Groups      []string
+	Operation   string
+	Target      string
+	Env         map[string]any
+	Evaluations []SimulationEvaluation
 }
 
 // UsersTemplateData contains the data needed to render the users page
@@ -127,6 +161,87 @@ type GroupsTemplateData struct {
 	Path     string
 }
 
+// GroupFormTemplateData contains the data needed to render the group create/edit form
+type GroupFormTemplateData struct {
+	ui.HeadTemplateData
+	ui.NavbarTemplateData
+	Username      string
+	IsAdmin       bool
+	Group         GroupTemplateData
+	Rules         []RuleTemplateData
+	Strategies    []string
+	Effects       []string
+	NextSortOrder int
+	IsEdit        bool
+	FormAction    string
+	FormTitle     string
+	SubmitBtnText string
+	ErrorMessage  string
+	Path          string
+}
+
+// GroupDeleteTemplateData contains the data needed to render the group delete confirmation
+type GroupDeleteTemplateData struct {
+	ui.HeadTemplateData
+	ui.NavbarTemplateData
+	Username     string
+	IsAdmin      bool
+	Group        GroupTemplateData
+	Path         string
+	ErrorMessage string
+}
+
+// SimulatorTemplateData contains the data needed to render the policy simulator
+type SimulatorTemplateData struct {
+	ui.HeadTemplateData
+	ui.NavbarTemplateData
+	Username     string
+	IsAdmin      bool
+	Users        []UserTemplateData
+	Groups       []GroupTemplateData
+	Operations   []authz.Operation
+	Flags        []string
+	Request      SimulationRequest
+	Result       *SimulationResult
+	ErrorMessage string
+	Path         string
+}
+
+// AuditEntryTemplateData contains information about an audit entry
+type AuditEntryTemplateData struct {
+	ID                int64
+	CreatedAt         time.Time
+	HumanCreatedAt    string
+	User              string
+	Provider          string
+	Operation         string
+	Name              string
+	NewName           string
+	Flag              int
+	HumanBytesRead    string
+	HumanBytesWritten string
+	Decision          string
+	Rule              string
+	Error             string
+}
+
+// AuditTemplateData contains the data needed to render the audit trail page
+type AuditTemplateData struct {
+	ui.HeadTemplateData
+	ui.NavbarTemplateData
+	Username        string
+	IsAdmin         bool
+	Entries         []AuditEntryTemplateData
+	User            string
+	Search          string
+	Since           string
+	Until           string
+	PreviousPageURL string
+	NextPageURL     string
+	ErrorMessage    string
+	Path            string
+}
+
 // RulesTemplateData contains the data needed to render the rules page
 type RulesTemplateData struct {
 	ui.HeadTemplateData
@@ -156,8 +271,44 @@ func NewUserTemplateData(user *store.User) UserTemplateData {
 	}
 }
 
+// NewDenialTemplateData creates a new denial template data from a denial.Event
+func NewDenialTemplateData(evt denial.Event) DenialTemplateData {
+	data := DenialTemplateData{
+		Time:        evt.Time,
+		HumanTime:   humanize.Time(evt.Time),
+		User:        evt.Provider + "/" + evt.Subject,
+		Groups:      evt.Groups,
+		Operation:   string(evt.Operation),
+		Env:         evt.Env,
+		Evaluations: make([]SimulationEvaluation, 0, len(evt.Evaluations)),
+	}
+
+	if email, ok := evt.Env["email"].(string); ok && email != "" {
+		data.User = email
+	}
+
+	if name, ok := evt.Env["name"].(string); ok {
+		data.Target = name
+	} else {
+		oldName, _ := evt.Env["oldName"].(string)
+		newName, _ := evt.Env["newName"].(string)
+		data.Target = oldName + " → " + newName
+	}
+
+	for _, e := range evt.Evaluations {
+		data.Evaluations = append(data.Evaluations, newSimulationEvaluation(e))
+	}
+
+	return data
+}
+
 // NewGroupTemplateData creates a new group template data from a store.Group
 func NewGroupTemplateData(group *store.Group) GroupTemplateData {
+	quota := ""
+	if group.Quota > 0 {
+		quota = humanize.Bytes(uint64(group.Quota))
+	}
+
 	return GroupTemplateData{
 		ID:             group.ID,
 		Name:           group.Name,
@@ -166,6 +317,20 @@ func NewGroupTemplateData(group *store.Group) GroupTemplateData {
 		HumanCreatedAt: humanize.Time(group.CreatedAt),
 		HumanUpdatedAt: humanize.Time(group.UpdatedAt),
 		RuleCount:      len(group.Rules),
+		Managed:        group.Managed,
+		Strategy:       string(group.Strategy),
+		Quota:          quota,
+		QuotaDir:       group.QuotaDir,
+	}
+}
+
+// NewDedupTemplateData creates a new deduplication template data from dedup.Stats
+func NewDedupTemplateData(stats dedup.Stats) *DedupTemplateData {
+	return &DedupTemplateData{
+		Ratio:            fmt.Sprintf("%.2f", stats.Ratio()),
+		HumanLogicalSize: humanize.Bytes(uint64(stats.LogicalSize)),
+		HumanStoredSize:  humanize.Bytes(uint64(stats.StoredSize)),
+		Chunks:           stats.Chunks,
 	}
 }
 
@@ -182,6 +347,7 @@ func NewRuleTemplateData(rule *store.Rule) RuleTemplateData {
 	return RuleTemplateData{
 		ID:             rule.ID,
 		Script:         rule.Script,
+		Effect:         string(rule.Effect),
 		SortOrder:      rule.SortOrder,
 		GroupID:        groupID,
 		GroupName:      groupName,
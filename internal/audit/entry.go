@@ -0,0 +1,37 @@
+package audit
+
+import (
+	"time"
+)
+
+const (
+	DecisionAllow = "allow"
+	DecisionDeny  = "deny"
+	DecisionError = "error"
+)
+
+// Entry is a record of the audit trail
+type Entry struct {
+	Time time.Time `json:"time"`
+
+	Subject  string `json:"subject"`
+	Provider string `json:"provider"`
+	Email    string `json:"email,omitempty"`
+
+	Operation string `json:"operation"`
+	Name      string `json:"name"`
+	NewName   string `json:"newName,omitempty"`
+	Flag      int    `json:"flag,omitempty"`
+
+	// BytesRead and BytesWritten are the number of bytes transferred
+	// before the file was closed
+	BytesRead    int64 `json:"bytesRead,omitempty"`
+	BytesWritten int64 `json:"bytesWritten,omitempty"`
+
+	// Decision is the authorization decision, empty if none was made
+	Decision string `json:"decision,omitempty"`
+	// Rule is the rule which allowed or denied the operation, if any
+	Rule string `json:"rule,omitempty"`
+
+	Error string `json:"error,omitempty"`
+}
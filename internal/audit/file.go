@@ -0,0 +1,60 @@
+package audit
+
+import (
+	"encoding/xml"
+	"sync"
+
+	"github.com/bornholm/calli/pkg/webdav/filesystem"
+	"golang.org/x/net/webdav"
+)
+
+// File counts the bytes transferred through the wrapped file
+type File struct {
+	webdav.File
+
+	read    int64
+	written int64
+
+	closeOnce sync.Once
+	onClose   func(read, written int64, err error)
+}
+
+// Read implements webdav.File.
+func (f *File) Read(p []byte) (int, error) {
+	n, err := f.File.Read(p)
+	f.read += int64(n)
+	return n, err
+}
+
+// Write implements webdav.File.
+func (f *File) Write(p []byte) (int, error) {
+	n, err := f.File.Write(p)
+	f.written += int64(n)
+	return n, err
+}
+
+// Close implements webdav.File.
+func (f *File) Close() error {
+	err := f.File.Close()
+
+	f.closeOnce.Do(func() {
+		f.onClose(f.read, f.written, err)
+	})
+
+	return err
+}
+
+// DeadProps implements webdav.DeadPropsHolder.
+func (f *File) DeadProps() (map[xml.Name]webdav.Property, error) {
+	return filesystem.DeadProps(f.File)
+}
+
+// Patch implements webdav.DeadPropsHolder.
+func (f *File) Patch(patches []webdav.Proppatch) ([]webdav.Propstat, error) {
+	return filesystem.Patch(f.File, patches)
+}
+
+var (
+	_ webdav.File            = &File{}
+	_ webdav.DeadPropsHolder = &File{}
+)
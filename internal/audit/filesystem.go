@@ -0,0 +1,173 @@
+package audit
+
+import (
+	"context"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/bornholm/calli/internal/authz"
+	"github.com/bornholm/calli/pkg/log"
+	"github.com/pkg/errors"
+	"golang.org/x/net/webdav"
+)
+
+type contextKey string
+
+const contextKeyRecord contextKey = "auditRecord"
+
+// record collects the authorization decision made
+// during a filesystem operation
+type record struct {
+	mutex    sync.Mutex
+	decision *authz.Decision
+}
+
+// RecordDecision attaches the decision to the operation being audited, if any.
+// It should be registered as a decision handler of the authz.FileSystem
+// wrapped by the audit FileSystem.
+func RecordDecision(ctx context.Context, decision *authz.Decision) {
+	rec, ok := ctx.Value(contextKeyRecord).(*record)
+	if !ok {
+		return
+	}
+
+	rec.mutex.Lock()
+	defer rec.mutex.Unlock()
+
+	// Keep the decision of the operation itself
+	if rec.decision == nil {
+		rec.decision = decision
+	}
+}
+
+var _ authz.DecisionHandler = RecordDecision
+
+// FileSystem records each operation of its backend in the audit trail
+type FileSystem struct {
+	backend webdav.FileSystem
+	sink    Sink
+}
+
+// Mkdir implements webdav.FileSystem.
+func (fs *FileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	ctx, rec := withRecord(ctx)
+
+	err := fs.backend.Mkdir(ctx, name, perm)
+
+	fs.record(ctx, rec, Entry{Operation: authz.OperationMkdir, Name: name}, err)
+
+	return err
+}
+
+// OpenFile implements webdav.FileSystem.
+func (fs *FileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	ctx, rec := withRecord(ctx)
+
+	entry := Entry{Operation: authz.OperationOpen, Name: name, Flag: flag}
+
+	file, err := fs.backend.OpenFile(ctx, name, flag, perm)
+	if err != nil {
+		fs.record(ctx, rec, entry, err)
+		return nil, err
+	}
+
+	// The entry is recorded when the file is closed to
+	// report the transferred bytes
+	return &File{
+		File: file,
+		onClose: func(read, written int64, err error) {
+			entry.BytesRead = read
+			entry.BytesWritten = written
+			fs.record(context.WithoutCancel(ctx), rec, entry, err)
+		},
+	}, nil
+}
+
+// RemoveAll implements webdav.FileSystem.
+func (fs *FileSystem) RemoveAll(ctx context.Context, name string) error {
+	ctx, rec := withRecord(ctx)
+
+	err := fs.backend.RemoveAll(ctx, name)
+
+	fs.record(ctx, rec, Entry{Operation: authz.OperationRemove, Name: name}, err)
+
+	return err
+}
+
+// Rename implements webdav.FileSystem.
+func (fs *FileSystem) Rename(ctx context.Context, oldName string, newName string) error {
+	ctx, rec := withRecord(ctx)
+
+	err := fs.backend.Rename(ctx, oldName, newName)
+
+	fs.record(ctx, rec, Entry{Operation: authz.OperationRename, Name: oldName, NewName: newName}, err)
+
+	return err
+}
+
+// Stat implements webdav.FileSystem.
+func (fs *FileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	ctx, rec := withRecord(ctx)
+
+	info, err := fs.backend.Stat(ctx, name)
+
+	fs.record(ctx, rec, Entry{Operation: authz.OperationStat, Name: name}, err)
+
+	return info, err
+}
+
+func (fs *FileSystem) record(ctx context.Context, rec *record, entry Entry, err error) {
+	entry.Time = time.Now()
+
+	if user, userErr := authz.ContextUser(ctx); userErr == nil {
+		entry.Subject = user.UserSubject()
+		entry.Provider = user.UserProvider()
+
+		if profile, ok := user.(authz.Profile); ok {
+			entry.Email = profile.UserEmail()
+		}
+	}
+
+	rec.mutex.Lock()
+	decision := rec.decision
+	rec.mutex.Unlock()
+
+	if decision != nil {
+		switch {
+		case decision.Err() != nil:
+			entry.Decision = DecisionError
+		case decision.Allowed():
+			entry.Decision = DecisionAllow
+			entry.Rule = decision.Matched.String()
+		default:
+			entry.Decision = DecisionDeny
+			if decision.Matched != nil {
+				entry.Rule = decision.Matched.String()
+			}
+		}
+	}
+
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	if err := fs.sink.Record(ctx, entry); err != nil {
+		slog.ErrorContext(ctx, "could not record audit entry", log.Error(errors.WithStack(err)))
+	}
+}
+
+func withRecord(ctx context.Context) (context.Context, *record) {
+	rec := &record{}
+	return context.WithValue(ctx, contextKeyRecord, rec), rec
+}
+
+func NewFileSystem(backend webdav.FileSystem, sink Sink) *FileSystem {
+	return &FileSystem{
+		backend: backend,
+		sink:    sink,
+	}
+}
+
+var _ webdav.FileSystem = &FileSystem{}
@@ -0,0 +1,96 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/bornholm/calli/internal/authz"
+	"github.com/bornholm/calli/internal/store"
+	pkgerrors "github.com/pkg/errors"
+	"golang.org/x/net/webdav"
+)
+
+func TestFileSystem(t *testing.T) {
+	var (
+		mutex   sync.Mutex
+		entries []Entry
+	)
+
+	sink := SinkFunc(func(ctx context.Context, entry Entry) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		entries = append(entries, entry)
+		return nil
+	})
+
+	fs := NewFileSystem(
+		authz.NewFileSystem(webdav.NewMemFS(), authz.WithDecisionHandlers(RecordDecision)),
+		sink,
+	)
+
+	user := &store.User{ID: 1, Subject: "jdoe", Provider: "test", Email: "jdoe@example.net"}
+	user.SetGroups(&store.Group{
+		Name: "writers",
+		Rules: []*store.Rule{
+			{Script: `operation == OP_OPEN && inDir(name, "/shared")`},
+			{Script: `operation == OP_STAT`},
+		},
+	})
+
+	ctx := authz.WithContextUser(context.Background(), user)
+
+	file, err := fs.OpenFile(ctx, "/shared", os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		t.Fatalf("%+v", pkgerrors.WithStack(err))
+	}
+
+	if _, err := io.WriteString(file, "hello world"); err != nil {
+		t.Fatalf("%+v", pkgerrors.WithStack(err))
+	}
+
+	if err := file.Close(); err != nil {
+		t.Fatalf("%+v", pkgerrors.WithStack(err))
+	}
+
+	if err := fs.Mkdir(ctx, "/private", os.ModePerm); !errors.Is(err, os.ErrPermission) {
+		t.Fatalf("mkdir: expected '%v', got '%v'", os.ErrPermission, err)
+	}
+
+	if _, err := fs.Stat(ctx, "/missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("stat: expected '%v', got '%v'", os.ErrNotExist, err)
+	}
+
+	expected := []Entry{
+		{Operation: authz.OperationOpen, Name: "/shared", Flag: os.O_RDWR | os.O_CREATE, BytesWritten: 11, Decision: DecisionAllow, Rule: `operation == OP_OPEN && inDir(name, "/shared")`},
+		{Operation: authz.OperationMkdir, Name: "/private", Decision: DecisionDeny, Error: os.ErrPermission.Error()},
+		{Operation: authz.OperationStat, Name: "/missing", Decision: DecisionAllow, Rule: "operation == OP_STAT"},
+	}
+
+	if e, g := len(expected), len(entries); e != g {
+		t.Fatalf("len(entries): expected '%v', got '%v'", e, g)
+	}
+
+	for i, e := range expected {
+		g := entries[i]
+
+		if g.Subject != user.Subject || g.Provider != user.Provider || g.Email != user.Email {
+			t.Errorf("entries[%d]: unexpected user '%s/%s/%s'", i, g.Subject, g.Provider, g.Email)
+		}
+
+		if g.Time.IsZero() {
+			t.Errorf("entries[%d].Time: expected non zero time", i)
+		}
+
+		if e.Operation != g.Operation || e.Name != g.Name || e.Flag != g.Flag || e.BytesWritten != g.BytesWritten || e.Decision != g.Decision || e.Rule != g.Rule {
+			t.Errorf("entries[%d]: expected '%+v', got '%+v'", i, e, g)
+		}
+
+		if e.Error != "" && e.Error != g.Error {
+			t.Errorf("entries[%d].Error: expected '%v', got '%v'", i, e.Error, g.Error)
+		}
+	}
+}
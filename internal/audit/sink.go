@@ -0,0 +1,124 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+
+	"github.com/bornholm/calli/internal/store"
+	"github.com/pkg/errors"
+)
+
+// Sink persists the entries of the audit trail
+type Sink interface {
+	Record(ctx context.Context, entry Entry) error
+}
+
+type SinkFunc func(ctx context.Context, entry Entry) error
+
+// Record implements Sink.
+func (fn SinkFunc) Record(ctx context.Context, entry Entry) error {
+	return fn(ctx, entry)
+}
+
+var _ Sink = SinkFunc(nil)
+
+// MultiSink records the entries in each of its sinks, a failing
+// sink does not prevent the others from recording the entry
+type MultiSink []Sink
+
+// Record implements Sink.
+func (s MultiSink) Record(ctx context.Context, entry Entry) error {
+	var firstErr error
+
+	for _, sink := range s {
+		if err := sink.Record(ctx, entry); err != nil && firstErr == nil {
+			firstErr = errors.WithStack(err)
+		}
+	}
+
+	return firstErr
+}
+
+var _ Sink = MultiSink{}
+
+// StoreSink records the entries in the store's audit table
+type StoreSink struct {
+	store *store.Store
+}
+
+// Record implements Sink.
+func (s *StoreSink) Record(ctx context.Context, entry Entry) error {
+	err := s.store.CreateAuditEntry(ctx, &store.AuditEntry{
+		CreatedAt:    entry.Time,
+		Subject:      entry.Subject,
+		Provider:     entry.Provider,
+		Email:        entry.Email,
+		Operation:    entry.Operation,
+		Name:         entry.Name,
+		NewName:      entry.NewName,
+		Flag:         entry.Flag,
+		BytesRead:    entry.BytesRead,
+		BytesWritten: entry.BytesWritten,
+		Decision:     entry.Decision,
+		Rule:         entry.Rule,
+		Error:        entry.Error,
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+func NewStoreSink(store *store.Store) *StoreSink {
+	return &StoreSink{store: store}
+}
+
+var _ Sink = &StoreSink{}
+
+// FileSink appends the entries to a JSON lines file
+type FileSink struct {
+	mutex   sync.Mutex
+	file    *os.File
+	encoder *json.Encoder
+}
+
+// Record implements Sink.
+func (s *FileSink) Record(ctx context.Context, entry Entry) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.encoder.Encode(entry); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Close closes the underlying file
+func (s *FileSink) Close() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if err := s.file.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+func NewFileSink(path string) (*FileSink, error) {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o640)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &FileSink{
+		file:    file,
+		encoder: json.NewEncoder(file),
+	}, nil
+}
+
+var _ Sink = &FileSink{}
@@ -1,6 +1,7 @@
 package basic
 
 import (
+	"bytes"
 	"context"
 	"log/slog"
 	"net/http"
@@ -12,6 +13,24 @@ import (
 
 type UserProvider interface {
 	Authenticate(ctx context.Context, username, password string) (authn.User, error)
+	// FindBasicUser returns the current state of the user of the given
+	// username, whose credentials were previously verified
+	FindBasicUser(ctx context.Context, username string) (authn.User, error)
+}
+
+// PasswordHasher is implemented by the users exposing the hash of their
+// password, the cached credentials being rejected as soon as it changes
+type PasswordHasher interface {
+	BasicPasswordHash() []byte
+}
+
+func passwordHash(user authn.User) []byte {
+	hasher, ok := user.(PasswordHasher)
+	if !ok {
+		return nil
+	}
+
+	return hasher.BasicPasswordHash()
 }
 
 type UserProviderFunc func(username, password string) (authn.User, error)
@@ -20,12 +39,41 @@ func (fn UserProviderFunc) Authenticate(username, password string) (authn.User,
 	return fn(username, password)
 }
 
-func NewAuthenticator(userProvider UserProvider) authn.Authenticator {
+func NewAuthenticator(userProvider UserProvider, funcs ...OptionFunc) authn.Authenticator {
+	opts := NewOptions(funcs...)
+
+	var cache *credentialCache
+	if opts.CacheTTL > 0 {
+		cache = newCredentialCache(opts.CacheTTL)
+	}
+
 	return authn.AuthenticateFunc(func(w http.ResponseWriter, r *http.Request) (authn.User, error) {
 		ctx := r.Context()
 		username, password, ok := r.BasicAuth()
 		if ok {
-			user, err := userProvider.Authenticate(ctx, username, password)
+			var (
+				user authn.User
+				err  error
+			)
+
+			if cache != nil {
+				// The credentials stay verified as long as the user's password is unchanged
+				if hash, exists := cache.Get(username, password); exists {
+					user, err = userProvider.FindBasicUser(ctx, username)
+					if err != nil || user == nil || !bytes.Equal(hash, passwordHash(user)) {
+						cache.Delete(username, password)
+						user, err = nil, nil
+					}
+				}
+			}
+
+			if user == nil {
+				user, err = userProvider.Authenticate(ctx, username, password)
+				if err == nil && user != nil && cache != nil {
+					cache.Set(username, password, passwordHash(user))
+				}
+			}
+
 			if err != nil {
 				slog.ErrorContext(ctx, "could not authenticate user", log.Error(errors.WithStack(err)))
 			}
@@ -0,0 +1,161 @@
+package basic
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bornholm/calli/internal/authn"
+	"github.com/pkg/errors"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type testUser struct {
+	subject string
+	hash    []byte
+}
+
+func (u *testUser) UserSubject() string       { return u.subject }
+func (u *testUser) UserProvider() string      { return "basic" }
+func (u *testUser) BasicPasswordHash() []byte { return u.hash }
+
+type testUserProvider struct {
+	mutex   sync.Mutex
+	hash    []byte
+	calls   atomic.Int64
+	lookups atomic.Int64
+}
+
+// Authenticate implements UserProvider.
+func (p *testUserProvider) Authenticate(ctx context.Context, username string, password string) (authn.User, error) {
+	p.calls.Add(1)
+
+	hash := p.passwordHash()
+
+	if username != "user" || bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil {
+		return nil, errors.WithStack(authn.ErrUnauthenticated)
+	}
+
+	return &testUser{subject: username, hash: hash}, nil
+}
+
+// FindBasicUser implements UserProvider.
+func (p *testUserProvider) FindBasicUser(ctx context.Context, username string) (authn.User, error) {
+	p.lookups.Add(1)
+
+	if username != "user" {
+		return nil, errors.WithStack(authn.ErrUnauthenticated)
+	}
+
+	return &testUser{subject: username, hash: p.passwordHash()}, nil
+}
+
+func (p *testUserProvider) setPassword(tb testing.TB, password string) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		tb.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.hash = hash
+}
+
+func (p *testUserProvider) passwordHash() []byte {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	return p.hash
+}
+
+func newTestUserProvider(tb testing.TB) *testUserProvider {
+	provider := &testUserProvider{}
+	provider.setPassword(tb, "password")
+
+	return provider
+}
+
+func authenticate(authenticator authn.Authenticator, username, password string) (authn.User, error) {
+	r := httptest.NewRequest("PROPFIND", "/", nil)
+	r.SetBasicAuth(username, password)
+
+	return authenticator.Authenticate(httptest.NewRecorder(), r)
+}
+
+func TestAuthenticatorCache(t *testing.T) {
+	provider := newTestUserProvider(t)
+	authenticator := NewAuthenticator(provider)
+
+	for range 3 {
+		if _, err := authenticate(authenticator, "user", "password"); err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+	}
+
+	if e, g := int64(1), provider.calls.Load(); e != g {
+		t.Errorf("provider calls: expected '%v', got '%v'", e, g)
+	}
+
+	// The users of the cached credentials are loaded again
+	if e, g := int64(2), provider.lookups.Load(); e != g {
+		t.Errorf("provider lookups: expected '%v', got '%v'", e, g)
+	}
+
+	// Invalid credentials are always verified
+	for range 2 {
+		if _, err := authenticate(authenticator, "user", "wrong"); !errors.Is(err, authn.ErrCancel) {
+			t.Fatalf("authenticate with wrong password: expected '%v', got '%v'", authn.ErrCancel, err)
+		}
+	}
+
+	if e, g := int64(3), provider.calls.Load(); e != g {
+		t.Errorf("provider calls: expected '%v', got '%v'", e, g)
+	}
+}
+
+func TestAuthenticatorCacheRegeneratedPassword(t *testing.T) {
+	provider := newTestUserProvider(t)
+	authenticator := NewAuthenticator(provider)
+
+	if _, err := authenticate(authenticator, "user", "password"); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	provider.setPassword(t, "regenerated")
+
+	// The cached credentials are rejected at once
+	if _, err := authenticate(authenticator, "user", "password"); !errors.Is(err, authn.ErrCancel) {
+		t.Fatalf("authenticate with previous password: expected '%v', got '%v'", authn.ErrCancel, err)
+	}
+
+	if _, err := authenticate(authenticator, "user", "regenerated"); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+}
+
+func BenchmarkAuthenticator(b *testing.B) {
+	provider := newTestUserProvider(b)
+
+	b.Run("uncached", func(b *testing.B) {
+		authenticator := NewAuthenticator(provider, WithCacheTTL(0))
+
+		for b.Loop() {
+			if _, err := authenticate(authenticator, "user", "password"); err != nil {
+				b.Fatalf("%+v", errors.WithStack(err))
+			}
+		}
+	})
+
+	b.Run("cached", func(b *testing.B) {
+		authenticator := NewAuthenticator(provider)
+
+		for b.Loop() {
+			if _, err := authenticate(authenticator, "user", "password"); err != nil {
+				b.Fatalf("%+v", errors.WithStack(err))
+			}
+		}
+	})
+}
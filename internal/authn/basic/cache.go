@@ -0,0 +1,105 @@
+package basic
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// credentialCache keeps the recently verified credentials, sparing the
+// password hash comparison on each request of a client. Only the check is
+// cached along with the hash it was made against, the users being loaded
+// again with their current policy and password hash.
+type credentialCache struct {
+	ttl time.Duration
+	// key is a per process secret, the cache never holding the passwords
+	// nor a hash which could be reversed from a memory dump
+	key []byte
+
+	mutex   sync.Mutex
+	entries map[[sha256.Size]byte]cachedCredential
+	sweep   time.Time
+}
+
+type cachedCredential struct {
+	// Hash of the password the credentials were verified against
+	Hash    []byte
+	Expires time.Time
+}
+
+// Get returns the password hash the given credentials were verified
+// against, if verified less than the cache lifetime ago
+func (c *credentialCache) Get(username, password string) ([]byte, bool) {
+	id := c.id(username, password)
+	now := time.Now()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	cached, exists := c.entries[id]
+	if !exists {
+		return nil, false
+	}
+
+	if !cached.Expires.After(now) {
+		delete(c.entries, id)
+		return nil, false
+	}
+
+	return cached.Hash, true
+}
+
+func (c *credentialCache) Set(username, password string, hash []byte) {
+	id := c.id(username, password)
+	now := time.Now()
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	// Expired entries are purged at most once per lifetime
+	if now.After(c.sweep) {
+		for id, cached := range c.entries {
+			if !cached.Expires.After(now) {
+				delete(c.entries, id)
+			}
+		}
+
+		c.sweep = now.Add(c.ttl)
+	}
+
+	c.entries[id] = cachedCredential{
+		Hash:    hash,
+		Expires: now.Add(c.ttl),
+	}
+}
+
+func (c *credentialCache) Delete(username, password string) {
+	id := c.id(username, password)
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.entries, id)
+}
+
+func (c *credentialCache) id(username, password string) [sha256.Size]byte {
+	mac := hmac.New(sha256.New, c.key)
+	mac.Write([]byte(username))
+	mac.Write([]byte{0})
+	mac.Write([]byte(password))
+
+	var id [sha256.Size]byte
+	copy(id[:], mac.Sum(nil))
+
+	return id
+}
+
+func newCredentialCache(ttl time.Duration) *credentialCache {
+	return &credentialCache{
+		ttl:     ttl,
+		key:     []byte(rand.Text()),
+		entries: make(map[[sha256.Size]byte]cachedCredential),
+	}
+}
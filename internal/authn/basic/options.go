@@ -0,0 +1,35 @@
+package basic
+
+import "time"
+
+// DefaultCacheTTL is the default lifetime of a verified credential
+const DefaultCacheTTL = 30 * time.Second
+
+type Options struct {
+	// CacheTTL is the duration during which verified credentials are
+	// not checked again against the user provider, 0 disabling the cache.
+	// The users are still loaded on each request, the cached credentials
+	// being rejected as soon as the password of their user changes.
+	CacheTTL time.Duration
+}
+
+type OptionFunc func(opts *Options)
+
+func NewOptions(funcs ...OptionFunc) *Options {
+	opts := &Options{
+		CacheTTL: DefaultCacheTTL,
+	}
+
+	for _, fn := range funcs {
+		fn(opts)
+	}
+
+	return opts
+}
+
+// WithCacheTTL sets the lifetime of the verified credentials
+func WithCacheTTL(ttl time.Duration) OptionFunc {
+	return func(opts *Options) {
+		opts.CacheTTL = ttl
+	}
+}
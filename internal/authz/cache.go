@@ -0,0 +1,54 @@
+package authz
+
+import (
+	"context"
+	"net/http"
+	"sync"
+)
+
+const contextKeyDecisionCache contextKey = "authzDecisionCache"
+
+// decisionCache keeps the stat decisions made during a request,
+// the rules being evaluated again for each listed child otherwise
+type decisionCache struct {
+	mutex     sync.Mutex
+	decisions map[string]*Decision
+}
+
+func (c *decisionCache) LoadOrEvaluate(name string, evaluate func() *Decision) *Decision {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if decision, exists := c.decisions[name]; exists {
+		return decision
+	}
+
+	decision := evaluate()
+	c.decisions[name] = decision
+
+	return decision
+}
+
+func newDecisionCache() *decisionCache {
+	return &decisionCache{
+		decisions: make(map[string]*Decision),
+	}
+}
+
+// WithDecisionCache returns a context sharing the stat decisions
+// between the filesystem operations using it
+func WithDecisionCache(parent context.Context) context.Context {
+	return context.WithValue(parent, contextKeyDecisionCache, newDecisionCache())
+}
+
+func contextDecisionCache(ctx context.Context) *decisionCache {
+	cache, _ := ctx.Value(contextKeyDecisionCache).(*decisionCache)
+	return cache
+}
+
+// Middleware shares the stat decisions made during each request
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(WithDecisionCache(r.Context())))
+	})
+}
@@ -0,0 +1,186 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+)
+
+// RuleEvaluation is the result of the execution of a single rule
+type RuleEvaluation struct {
+	// Index is the position of the rule among the user's own rules
+	// followed by the rules of each of its groups
+	Index int
+	// Group is the name of the rule's group, empty for the user's own rules
+	Group  string
+	Rule   Rule
+	Result bool
+	Error  error
+}
+
+// Decision is the outcome of the evaluation of a user's rules
+type Decision struct {
+	User        User
+	Operation   Operation
+	Env         map[string]any
+	Evaluations []RuleEvaluation
+	// Matched is the evaluation of the rule deciding the outcome, nil if
+	// no rule matched
+	Matched *RuleEvaluation
+}
+
+// Allowed returns true if an allow rule matched without being overridden
+// by a deny rule and without any rule failing
+func (d *Decision) Allowed() bool {
+	return d.Matched != nil && d.Matched.Rule.Effect() == EffectAllow && d.Err() == nil
+}
+
+// Err returns the first error raised by an evaluated rule
+func (d *Decision) Err() error {
+	for _, e := range d.Evaluations {
+		if e.Error != nil {
+			return e.Error
+		}
+	}
+
+	return nil
+}
+
+// NewEnv returns the environment exposed to the rules when the given
+// user executes the given operation during the context's request
+func NewEnv(ctx context.Context, user User, operation Operation, env map[string]any) map[string]any {
+	// The map is sized once for the variables below and the rules' constants
+	sized := make(map[string]any, len(env)+32)
+	maps.Copy(sized, env)
+	env = sized
+
+	env["operation"] = string(operation)
+	env["subject"] = user.UserSubject()
+	env["provider"] = user.UserProvider()
+	env["email"] = ""
+	env["nickname"] = ""
+	env["basicUsername"] = ""
+	env["home"] = ""
+
+	if profile, ok := user.(Profile); ok {
+		env["email"] = profile.UserEmail()
+		env["nickname"] = profile.UserNickname()
+		env["basicUsername"] = profile.UserBasicUsername()
+		env["home"] = profile.UserHome()
+	}
+
+	env["groups"] = slices.Collect(func(yield func(string) bool) {
+		for _, g := range user.FileSystemGroups() {
+			if !yield(g.Name()) {
+				return
+			}
+		}
+	})
+
+	env["ip"] = ""
+	env["method"] = ""
+	env["depth"] = ""
+	env["userAgent"] = ""
+	env["tls"] = false
+	env["time"] = time.Now()
+
+	if req := ContextRequest(ctx); req != nil {
+		env["ip"] = req.IP
+		env["method"] = req.Method
+		env["depth"] = req.Depth
+		env["userAgent"] = req.UserAgent
+		env["tls"] = req.TLS
+		env["time"] = req.Time
+	}
+
+	env["OP_MKDIR"] = string(OperationMkdir)
+	env["OP_OPEN"] = string(OperationOpen)
+	env["OP_REMOVE"] = string(OperationRemove)
+	env["OP_RENAME"] = string(OperationRename)
+	env["OP_STAT"] = string(OperationStat)
+
+	return env
+}
+
+// Evaluate executes the user's rules against the environment of the given
+// operation. The user's own rules and each group are combined with
+// the deny-overrides strategy: the operation is denied if any of them
+// denies it, allowed if any of them allows it and denied otherwise.
+// A failing rule does not stop the evaluation, its error is recorded
+// in the decision and prevents the operation.
+func Evaluate(ctx context.Context, user User, operation Operation, env map[string]any) *Decision {
+	decision := &Decision{
+		User:        user,
+		Operation:   operation,
+		Env:         NewEnv(ctx, user, operation, env),
+		Evaluations: make([]RuleEvaluation, 0),
+	}
+
+	policies := append([]*Group{NewGroup("", StrategyDenyOverrides, user.FileSystemRules()...)}, user.FileSystemGroups()...)
+
+	index := 0
+	allowed, denied := -1, -1
+
+policies:
+	for _, g := range policies {
+		for _, r := range g.Rules() {
+			idx := index
+			index++
+
+			// Once the operation is allowed, only a deny rule can change
+			// the outcome of a deny-overrides group
+			if allowed != -1 && g.Strategy() == StrategyDenyOverrides && r.Effect() != EffectDeny {
+				continue
+			}
+
+			slog.DebugContext(ctx, "executing rule", slog.Any("rule", r), slog.Any("env", decision.Env))
+
+			matched, err := r.Exec(decision.Env)
+
+			slog.DebugContext(ctx, "rule result", slog.Any("rule", r), slog.Bool("result", matched), slog.Any("error", err))
+
+			decision.Evaluations = append(decision.Evaluations, RuleEvaluation{
+				Index:  idx,
+				Group:  g.Name(),
+				Rule:   r,
+				Result: matched && err == nil,
+				Error:  err,
+			})
+
+			if !matched || err != nil {
+				continue
+			}
+
+			if r.Effect() == EffectDeny {
+				// Nothing can override a deny
+				denied = len(decision.Evaluations) - 1
+				break policies
+			}
+
+			if allowed == -1 {
+				allowed = len(decision.Evaluations) - 1
+			}
+
+			if g.Strategy() == StrategyFirstMatch {
+				continue policies
+			}
+		}
+	}
+
+	switch {
+	case denied != -1:
+		decision.Matched = &decision.Evaluations[denied]
+	case allowed != -1:
+		decision.Matched = &decision.Evaluations[allowed]
+	}
+
+	return decision
+}
+
+// String returns the rule's textual representation, if any
+func (e RuleEvaluation) String() string {
+	return fmt.Sprint(e.Rule)
+}
@@ -0,0 +1,210 @@
+package denial
+
+import (
+	"context"
+	"log/slog"
+	"maps"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bornholm/calli/internal/authz"
+)
+
+// DefaultBufferSize is the default number of denials kept in memory
+const DefaultBufferSize = 100
+
+// Event describes an operation denied by the authorization rules
+type Event struct {
+	Time        time.Time
+	Subject     string
+	Provider    string
+	Groups      []string
+	Operation   authz.Operation
+	Env         map[string]any
+	Evaluations []authz.RuleEvaluation
+}
+
+// Count is the number of denials of a user or a group
+type Count struct {
+	Name  string
+	Count uint64
+}
+
+// Recorder keeps track of the denied operations
+type Recorder struct {
+	mutex sync.RWMutex
+
+	// events is a ring buffer of the most recent denials
+	events []Event
+	next   int
+	full   bool
+
+	total   uint64
+	byUser  map[string]uint64
+	byGroup map[string]uint64
+
+	logSampleRate float64
+	logger        *slog.Logger
+}
+
+// HandleDecision records the decision if it denies the operation.
+// It should be registered as a decision handler of the authz.FileSystem.
+func (r *Recorder) HandleDecision(ctx context.Context, decision *authz.Decision) {
+	// Failing rules are reported as errors, not as denials
+	if decision.Allowed() || decision.Err() != nil {
+		return
+	}
+
+	evt := newEvent(decision)
+
+	r.mutex.Lock()
+	r.events[r.next] = evt
+	r.next = (r.next + 1) % len(r.events)
+	if r.next == 0 {
+		r.full = true
+	}
+
+	r.total++
+	r.byUser[userKey(evt.Subject, evt.Provider)]++
+	for _, g := range evt.Groups {
+		r.byGroup[g]++
+	}
+	r.mutex.Unlock()
+
+	if r.logSampleRate > 0 && (r.logSampleRate >= 1 || rand.Float64() < r.logSampleRate) {
+		rules := make([]string, 0, len(evt.Evaluations))
+		for _, e := range evt.Evaluations {
+			rules = append(rules, e.String())
+		}
+
+		r.logger.WarnContext(ctx, "operation denied",
+			slog.String("subject", evt.Subject),
+			slog.String("provider", evt.Provider),
+			slog.Any("groups", evt.Groups),
+			slog.String("operation", string(evt.Operation)),
+			slog.Any("env", evt.Env),
+			slog.Any("rules", rules),
+		)
+	}
+}
+
+// Events returns the most recent denials, newest first
+func (r *Recorder) Events() []Event {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	size := r.next
+	if r.full {
+		size = len(r.events)
+	}
+
+	events := make([]Event, 0, size)
+	for i := 1; i <= size; i++ {
+		idx := (r.next - i + len(r.events)) % len(r.events)
+		events = append(events, r.events[idx])
+	}
+
+	return events
+}
+
+// Total returns the number of denials since the recorder creation
+func (r *Recorder) Total() uint64 {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.total
+}
+
+// UserCounts returns the number of denials per user ("provider/subject"),
+// in descending order
+func (r *Recorder) UserCounts() []Count {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return sortedCounts(r.byUser)
+}
+
+// GroupCounts returns the number of denials per group, in descending order
+func (r *Recorder) GroupCounts() []Count {
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return sortedCounts(r.byGroup)
+}
+
+func newEvent(decision *authz.Decision) Event {
+	evt := Event{
+		Time:        time.Now(),
+		Operation:   decision.Operation,
+		Env:         make(map[string]any, len(decision.Env)),
+		Evaluations: slices.Clone(decision.Evaluations),
+		Groups:      make([]string, 0),
+	}
+
+	if decision.User != nil {
+		evt.Subject = decision.User.UserSubject()
+		evt.Provider = decision.User.UserProvider()
+
+		for _, g := range decision.User.FileSystemGroups() {
+			evt.Groups = append(evt.Groups, g.Name())
+		}
+	}
+
+	// Omit the constants shared by all the rules
+	for key, value := range decision.Env {
+		if strings.HasPrefix(key, "O_") || strings.HasPrefix(key, "OP_") {
+			continue
+		}
+
+		evt.Env[key] = value
+	}
+
+	return evt
+}
+
+func userKey(subject, provider string) string {
+	return provider + "/" + subject
+}
+
+func sortedCounts(counts map[string]uint64) []Count {
+	sorted := make([]Count, 0, len(counts))
+	for _, name := range slices.Sorted(maps.Keys(counts)) {
+		sorted = append(sorted, Count{Name: name, Count: counts[name]})
+	}
+
+	slices.SortStableFunc(sorted, func(a, b Count) int {
+		switch {
+		case a.Count > b.Count:
+			return -1
+		case a.Count < b.Count:
+			return 1
+		default:
+			return 0
+		}
+	})
+
+	return sorted
+}
+
+// NewRecorder creates a recorder keeping the given number of denials in memory
+// and logging the given ratio (between 0 and 1) of them
+func NewRecorder(bufferSize int, logSampleRate float64, logger *slog.Logger) *Recorder {
+	if bufferSize <= 0 {
+		bufferSize = DefaultBufferSize
+	}
+
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return &Recorder{
+		events:        make([]Event, bufferSize),
+		byUser:        make(map[string]uint64),
+		byGroup:       make(map[string]uint64),
+		logSampleRate: logSampleRate,
+		logger:        logger,
+	}
+}
@@ -0,0 +1,107 @@
+package denial
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/bornholm/calli/internal/authz"
+	"github.com/bornholm/calli/internal/authz/expr"
+)
+
+type testUser struct {
+	subject string
+	groups  []*authz.Group
+}
+
+func (u *testUser) UserSubject() string  { return u.subject }
+func (u *testUser) UserProvider() string { return "test" }
+
+func (u *testUser) FileSystemGroups() []*authz.Group { return u.groups }
+
+func (u *testUser) FileSystemRules() []authz.Rule { return nil }
+
+var _ authz.User = &testUser{}
+
+func TestRecorder(t *testing.T) {
+	ctx := context.Background()
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+
+	recorder := NewRecorder(3, 1, logger)
+
+	readers := authz.NewGroup("readers", authz.StrategyDenyOverrides, expr.NewRule("operation == OP_STAT"))
+
+	alice := &testUser{subject: "alice", groups: []*authz.Group{readers}}
+	bob := &testUser{subject: "bob"}
+
+	// Allowed decisions are ignored
+	recorder.HandleDecision(ctx, authz.Evaluate(ctx, alice, authz.OperationStat, map[string]any{"name": "/"}))
+
+	for i := range 4 {
+		recorder.HandleDecision(ctx, authz.Evaluate(ctx, alice, authz.OperationMkdir, map[string]any{"name": fmt.Sprintf("/dir%d", i)}))
+	}
+
+	recorder.HandleDecision(ctx, authz.Evaluate(ctx, bob, authz.OperationRemove, map[string]any{"name": "/file"}))
+
+	if e, g := uint64(5), recorder.Total(); e != g {
+		t.Errorf("recorder.Total(): expected '%v', got '%v'", e, g)
+	}
+
+	events := recorder.Events()
+
+	if e, g := 3, len(events); e != g {
+		t.Fatalf("len(events): expected '%v', got '%v'", e, g)
+	}
+
+	expectedNames := []string{"/file", "/dir3", "/dir2"}
+	for i, e := range expectedNames {
+		if g := events[i].Env["name"]; e != g {
+			t.Errorf("events[%d].Env[\"name\"]: expected '%v', got '%v'", i, e, g)
+		}
+
+		if _, exists := events[i].Env["OP_STAT"]; exists {
+			t.Errorf("events[%d].Env: constants should be omitted", i)
+		}
+	}
+
+	if e, g := 1, len(events[1].Evaluations); e != g {
+		t.Errorf("len(events[1].Evaluations): expected '%v', got '%v'", e, g)
+	}
+
+	userCounts := recorder.UserCounts()
+	if e, g := "test/alice:4,test/bob:1", formatCounts(userCounts); e != g {
+		t.Errorf("recorder.UserCounts(): expected '%v', got '%v'", e, g)
+	}
+
+	groupCounts := recorder.GroupCounts()
+	if e, g := "readers:4", formatCounts(groupCounts); e != g {
+		t.Errorf("recorder.GroupCounts(): expected '%v', got '%v'", e, g)
+	}
+
+	if e, g := 5, strings.Count(logs.String(), "operation denied"); e != g {
+		t.Errorf("logged denials: expected '%v', got '%v'", e, g)
+	}
+
+	logs.Reset()
+
+	silent := NewRecorder(3, 0, logger)
+	silent.HandleDecision(ctx, authz.Evaluate(ctx, bob, authz.OperationRemove, map[string]any{"name": "/file"}))
+
+	if logs.Len() != 0 {
+		t.Errorf("expected no log with a sample rate of 0, got '%s'", logs.String())
+	}
+}
+
+func formatCounts(counts []Count) string {
+	formatted := make([]string, 0, len(counts))
+	for _, c := range counts {
+		formatted = append(formatted, fmt.Sprintf("%s:%d", c.Name, c.Count))
+	}
+
+	return strings.Join(formatted, ",")
+}
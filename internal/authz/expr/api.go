@@ -1,22 +1,190 @@
 package expr
 
 import (
+	"net/netip"
+	"os"
+	"path"
 	"reflect"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
 	"github.com/expr-lang/expr/builtin"
 	"github.com/expr-lang/expr/conf"
+	"github.com/pkg/errors"
 )
 
+// flagWrite groups the open flags implying a modification of the file
+const flagWrite = os.O_WRONLY | os.O_APPEND | os.O_RDWR | os.O_TRUNC | os.O_CREATE
+
+// clock returns the current time, overridden in tests
+var clock = time.Now
+
 var functions = []builtin.Function{
 	{
+		// isRead(flag) returns true if the open flag does not imply any modification
 		Name: "isRead",
 		Func: func(args ...any) (any, error) {
-			return nil, nil
+			flag, err := cast[int](args[0])
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			return flag&flagWrite == 0, nil
+		},
+		Types: types(new(func(int) bool)),
+	},
+	{
+		// isWrite(flag) returns true if the open flag implies a modification
+		Name: "isWrite",
+		Func: func(args ...any) (any, error) {
+			flag, err := cast[int](args[0])
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			return flag&flagWrite != 0, nil
 		},
-		Types: []reflect.Type{
-			reflect.TypeFor[int](),
+		Types: types(new(func(int) bool)),
+	},
+	{
+		// isCreate(flag) returns true if the open flag may create the file
+		Name: "isCreate",
+		Func: func(args ...any) (any, error) {
+			flag, err := cast[int](args[0])
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			return flag&os.O_CREATE != 0, nil
 		},
+		Types: types(new(func(int) bool)),
+	},
+	{
+		// inDir(name, dir) returns true if name is dir or one of its descendants
+		Name: "inDir",
+		Func: func(args ...any) (any, error) {
+			name, err := cast[string](args[0])
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			dir, err := cast[string](args[1])
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			return inDir(name, dir), nil
+		},
+		Types: types(new(func(string, string) bool)),
+	},
+	{
+		// glob(name, pattern) returns true if the cleaned name matches the pattern,
+		// see https://pkg.go.dev/path#Match
+		Name: "glob",
+		Func: func(args ...any) (any, error) {
+			name, err := cast[string](args[0])
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			pattern, err := cast[string](args[1])
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			matched, err := path.Match(pattern, clean(name))
+			if err != nil {
+				return nil, errors.Wrapf(err, "invalid pattern '%s'", pattern)
+			}
+
+			return matched, nil
+		},
+		Types: types(new(func(string, string) bool)),
+	},
+	{
+		// ext(name) returns the lowercased extension of name, including the dot
+		Name: "ext",
+		Func: func(args ...any) (any, error) {
+			name, err := cast[string](args[0])
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			return strings.ToLower(path.Ext(clean(name))), nil
+		},
+		Types: types(new(func(string) string)),
+	},
+	{
+		// inGroup(groups, name) returns true if name is one of the groups.
+		// Rules use the inGroup(name) shorthand, see groupsPatcher.
+		Name: "inGroup",
+		Func: func(args ...any) (any, error) {
+			groups, err := castSlice[string](args[0])
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			name, err := cast[string](args[1])
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			return slices.Contains(groups, name), nil
+		},
+		Types: types(new(func([]string, string) bool), new(func([]any, string) bool)),
+	},
+	{
+		// now() returns the current time
+		Name: "now",
+		Func: func(args ...any) (any, error) {
+			return clock(), nil
+		},
+		Types: types(new(func() time.Time)),
+	},
+	{
+		// weekday() returns the current day of the week (i.e. "Monday"),
+		// weekday(t) the one of the given time
+		Name: "weekday",
+		Func: func(args ...any) (any, error) {
+			if len(args) == 0 {
+				return clock().Weekday().String(), nil
+			}
+
+			t, err := cast[time.Time](args[0])
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			return t.Weekday().String(), nil
+		},
+		Types: types(new(func() string), new(func(time.Time) string)),
+	},
+	{
+		// cidr(ip, network) returns true if ip belongs to the network (i.e. "10.0.0.0/8"),
+		// cidr(ip, networks) if it belongs to one of them
+		Name: "cidr",
+		Func: func(args ...any) (any, error) {
+			ip, err := cast[string](args[0])
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			networks, err := castSlice[string](args[1])
+			if err != nil {
+				network, err := cast[string](args[1])
+				if err != nil {
+					return nil, errors.WithStack(err)
+				}
+
+				networks = []string{network}
+			}
+
+			return inNetworks(ip, networks)
+		},
+		Types: types(new(func(string, string) bool), new(func(string, []any) bool), new(func(string, []string) bool)),
 	},
 }
 
@@ -25,9 +193,103 @@ func WithRuleAPI() expr.Option {
 		for _, fn := range functions {
 			c.Functions[fn.Name] = &fn
 		}
+
+		expr.Patch(&groupsPatcher{})(c)
+	}
+}
+
+// groupsPatcher rewrites the inGroup(name) shorthand to inGroup(groups, name)
+// so that the function can access the user's groups from the environment
+type groupsPatcher struct{}
+
+// Visit implements ast.Visitor.
+func (p *groupsPatcher) Visit(node *ast.Node) {
+	call, ok := (*node).(*ast.CallNode)
+	if !ok || len(call.Arguments) != 1 {
+		return
+	}
+
+	callee, ok := call.Callee.(*ast.IdentifierNode)
+	if !ok || callee.Value != "inGroup" {
+		return
+	}
+
+	call.Arguments = append([]ast.Node{&ast.IdentifierNode{Value: "groups"}}, call.Arguments...)
+}
+
+var _ ast.Visitor = &groupsPatcher{}
+
+func inDir(name string, dir string) bool {
+	name = clean(name)
+	dir = clean(dir)
+
+	if dir == "/" {
+		return true
+	}
+
+	return name == dir || strings.HasPrefix(name, dir+"/")
+}
+
+// inNetworks returns true if ip belongs to one of the networks,
+// false if it is not a valid address (i.e. unknown)
+func inNetworks(ip string, networks []string) (bool, error) {
+	addr, addrErr := netip.ParseAddr(ip)
+
+	for _, n := range networks {
+		prefix, err := netip.ParsePrefix(n)
+		if err != nil {
+			return false, errors.Wrapf(err, "invalid network '%s'", n)
+		}
+
+		if addrErr == nil && prefix.Contains(addr.Unmap()) {
+			return true, nil
+		}
 	}
+
+	return false, nil
+}
+
+// clean returns the absolute, lexically cleaned form of the given path,
+// resolving any ".." element against the root
+func clean(name string) string {
+	return path.Clean("/" + name)
 }
 
 func cast[T any](v any) (T, error) {
-	return *new(T), nil
+	t, ok := v.(T)
+	if !ok {
+		return *new(T), errors.Errorf("unexpected type '%T', expected '%T'", v, *new(T))
+	}
+
+	return t, nil
+}
+
+func castSlice[T any](v any) ([]T, error) {
+	switch values := v.(type) {
+	case []T:
+		return values, nil
+	case []any:
+		slice := make([]T, 0, len(values))
+		for _, v := range values {
+			t, err := cast[T](v)
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			slice = append(slice, t)
+		}
+
+		return slice, nil
+	default:
+		return nil, errors.Errorf("unexpected type '%T', expected '%T'", v, []T{})
+	}
+}
+
+func types(funcs ...any) []reflect.Type {
+	types := make([]reflect.Type, 0, len(funcs))
+	for _, fn := range funcs {
+		types = append(types, reflect.TypeOf(fn).Elem())
+	}
+
+	return types
 }
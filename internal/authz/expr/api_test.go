@@ -0,0 +1,96 @@
+package expr
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestRuleAPI(t *testing.T) {
+	type testCase struct {
+		Name     string
+		Script   string
+		Env      map[string]any
+		Expected bool
+		Error    bool
+	}
+
+	testCases := []testCase{
+		// isRead
+		{Name: "isRead/rdonly", Script: "isRead(flag)", Env: map[string]any{"flag": os.O_RDONLY}, Expected: true},
+		{Name: "isRead/wronly", Script: "isRead(flag)", Env: map[string]any{"flag": os.O_WRONLY}, Expected: false},
+		{Name: "isRead/rdwr", Script: "isRead(flag)", Env: map[string]any{"flag": os.O_RDWR}, Expected: false},
+		{Name: "isRead/trunc", Script: "isRead(flag)", Env: map[string]any{"flag": os.O_RDONLY | os.O_TRUNC}, Expected: false},
+		// isWrite
+		{Name: "isWrite/rdonly", Script: "isWrite(flag)", Env: map[string]any{"flag": os.O_RDONLY}, Expected: false},
+		{Name: "isWrite/append", Script: "isWrite(flag)", Env: map[string]any{"flag": os.O_APPEND}, Expected: true},
+		{Name: "isWrite/rdwr", Script: "isWrite(flag)", Env: map[string]any{"flag": os.O_RDWR}, Expected: true},
+		// isCreate
+		{Name: "isCreate/create", Script: "isCreate(flag)", Env: map[string]any{"flag": os.O_WRONLY | os.O_CREATE | os.O_TRUNC}, Expected: true},
+		{Name: "isCreate/wronly", Script: "isCreate(flag)", Env: map[string]any{"flag": os.O_WRONLY}, Expected: false},
+		{Name: "isCreate/invalid", Script: "isCreate(flag)", Env: map[string]any{"flag": "foo"}, Error: true},
+		// inDir
+		{Name: "inDir/child", Script: `inDir(name, "/shared")`, Env: map[string]any{"name": "/shared/foo.txt"}, Expected: true},
+		{Name: "inDir/self", Script: `inDir(name, "/shared/")`, Env: map[string]any{"name": "/shared"}, Expected: true},
+		{Name: "inDir/sibling", Script: `inDir(name, "/shared")`, Env: map[string]any{"name": "/shared-private/foo.txt"}, Expected: false},
+		{Name: "inDir/traversal", Script: `inDir(name, "/shared")`, Env: map[string]any{"name": "/shared/../private/foo.txt"}, Expected: false},
+		{Name: "inDir/above-root", Script: `inDir(name, "/shared")`, Env: map[string]any{"name": "../../shared/foo.txt"}, Expected: true},
+		{Name: "inDir/root", Script: `inDir(name, "/")`, Env: map[string]any{"name": "/foo"}, Expected: true},
+		// glob
+		{Name: "glob/match", Script: `glob(name, "/photos/*.jpg")`, Env: map[string]any{"name": "/photos/cat.jpg"}, Expected: true},
+		{Name: "glob/nested", Script: `glob(name, "/photos/*.jpg")`, Env: map[string]any{"name": "/photos/2024/cat.jpg"}, Expected: false},
+		{Name: "glob/traversal", Script: `glob(name, "/photos/*")`, Env: map[string]any{"name": "/photos/../secret"}, Expected: false},
+		{Name: "glob/invalid", Script: `glob(name, "[")`, Env: map[string]any{"name": "/foo"}, Error: true},
+		// ext
+		{Name: "ext/lowercase", Script: `ext(name) == ".pdf"`, Env: map[string]any{"name": "/docs/Report.PDF"}, Expected: true},
+		{Name: "ext/none", Script: `ext(name) == ""`, Env: map[string]any{"name": "/docs/README"}, Expected: true},
+		// inGroup
+		{Name: "inGroup/member", Script: `inGroup("admins")`, Env: map[string]any{"groups": []string{"users", "admins"}}, Expected: true},
+		{Name: "inGroup/not-member", Script: `inGroup("admins")`, Env: map[string]any{"groups": []string{"users"}}, Expected: false},
+		{Name: "inGroup/explicit", Script: `inGroup(groups, "users")`, Env: map[string]any{"groups": []string{"users"}}, Expected: true},
+		// now & weekday
+		{Name: "now/hour", Script: `now().Hour() >= 8 && now().Hour() < 18`, Env: map[string]any{}, Expected: true},
+		{Name: "weekday/current", Script: `weekday() == "Wednesday"`, Env: map[string]any{}, Expected: true},
+		{Name: "weekday/time", Script: `weekday(now().AddDate(0, 0, 3)) in ["Saturday", "Sunday"]`, Env: map[string]any{}, Expected: true},
+		// cidr
+		{Name: "cidr/ipv4", Script: `cidr(ip, "10.0.0.0/8")`, Env: map[string]any{"ip": "10.1.2.3"}, Expected: true},
+		{Name: "cidr/outside", Script: `cidr(ip, "10.0.0.0/8")`, Env: map[string]any{"ip": "192.168.1.1"}, Expected: false},
+		{Name: "cidr/ipv6", Script: `cidr(ip, "2001:db8::/32")`, Env: map[string]any{"ip": "2001:db8::1"}, Expected: true},
+		{Name: "cidr/list", Script: `cidr(ip, ["10.0.0.0/8", "192.168.0.0/16"])`, Env: map[string]any{"ip": "192.168.1.1"}, Expected: true},
+		{Name: "cidr/unknown-ip", Script: `cidr(ip, "0.0.0.0/0")`, Env: map[string]any{"ip": ""}, Expected: false},
+		{Name: "cidr/invalid-network", Script: `cidr(ip, "10.0.0.0")`, Env: map[string]any{"ip": "10.1.2.3"}, Error: true},
+	}
+
+	clock = func() time.Time {
+		return time.Date(2025, time.January, 15, 10, 30, 0, 0, time.UTC)
+	}
+	defer func() {
+		clock = time.Now
+	}()
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("Case #%d: %s", idx, tc.Name), func(t *testing.T) {
+			rule := NewRule(tc.Script)
+
+			allowed, err := rule.Exec(tc.Env)
+			if tc.Error {
+				if err == nil {
+					t.Fatalf("expected an error, got nil")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			if e, g := tc.Expected, allowed; e != g {
+				t.Errorf("rule '%s': expected '%v', got '%v'", tc.Script, e, g)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package expr
 
 import (
 	"os"
+	"sync"
 
 	"github.com/bornholm/calli/internal/authz"
 	"github.com/expr-lang/expr"
@@ -11,6 +12,17 @@ import (
 
 type Rule struct {
 	script string
+	effect authz.Effect
+
+	// The program is compiled once for the lifetime of the rule
+	compile sync.Once
+	program *vm.Program
+	err     error
+}
+
+// Effect implements authz.Rule.
+func (r *Rule) Effect() authz.Effect {
+	return r.effect
 }
 
 // Exec implements authz.Rule.
@@ -20,18 +32,10 @@ func (r *Rule) Exec(env map[string]any) (bool, error) {
 		return false, errors.WithStack(err)
 	}
 
-	env["O_APPEND"] = os.O_APPEND
-	env["O_RDONLY"] = os.O_RDONLY
-	env["O_WRONLY"] = os.O_WRONLY
-	env["O_RDWR"] = os.O_RDWR
-	env["O_APPEND"] = os.O_APPEND
-	env["O_CREATE"] = os.O_CREATE
-	env["O_EXCL"] = os.O_EXCL
-	env["O_SYNC"] = os.O_SYNC
-	env["O_TRUNC"] = os.O_TRUNC
-
-	// Meta
-	env["O_WRITE"] = os.O_WRONLY | os.O_APPEND | os.O_RDWR | os.O_TRUNC | os.O_CREATE
+	// The constants are shared by the rules evaluated against the same env
+	if _, exists := env["O_WRITE"]; !exists {
+		setConstants(env)
+	}
 
 	result, err := expr.Run(program, env)
 	if err != nil {
@@ -46,21 +50,54 @@ func (r *Rule) Exec(env map[string]any) (bool, error) {
 	return allowed, nil
 }
 
+func setConstants(env map[string]any) {
+	env["O_APPEND"] = os.O_APPEND
+	env["O_RDONLY"] = os.O_RDONLY
+	env["O_WRONLY"] = os.O_WRONLY
+	env["O_RDWR"] = os.O_RDWR
+	env["O_CREATE"] = os.O_CREATE
+	env["O_EXCL"] = os.O_EXCL
+	env["O_SYNC"] = os.O_SYNC
+	env["O_TRUNC"] = os.O_TRUNC
+
+	// Meta
+	env["O_WRITE"] = flagWrite
+}
+
 func (r *Rule) getProgram() (*vm.Program, error) {
-	program, err := defaultCache.Get(r.script)
-	if err != nil {
-		return nil, errors.WithStack(err)
+	r.compile.Do(func() {
+		r.program, r.err = defaultCache.Get(r.script)
+	})
+
+	if r.err != nil {
+		return nil, errors.WithStack(r.err)
 	}
 
-	return program, nil
+	return r.program, nil
 }
 
 func (r *Rule) String() string {
 	return r.script
 }
 
+// Validate checks that the given script compiles to a valid rule
+func Validate(script string) error {
+	if _, err := defaultCache.Get(script); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// NewRule returns a rule allowing the operations matching the script
 func NewRule(script string) *Rule {
-	return &Rule{script: script}
+	return NewRuleWithEffect(script, authz.EffectAllow)
+}
+
+// NewRuleWithEffect returns a rule applying the given effect
+// to the operations matching the script
+func NewRuleWithEffect(script string, effect authz.Effect) *Rule {
+	return &Rule{script: script, effect: effect}
 }
 
 var _ authz.Rule = &Rule{}
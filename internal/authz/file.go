@@ -0,0 +1,120 @@
+package authz
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"io/fs"
+	"path"
+
+	"github.com/bornholm/calli/pkg/webdav/filesystem"
+	"github.com/pkg/errors"
+	"golang.org/x/net/webdav"
+)
+
+// File hides the children the user is not allowed to stat
+// from the directory listings and reports the user's privileges
+// as WebDAV properties
+type File struct {
+	webdav.File
+	ctx   context.Context
+	user  User
+	name  string
+	cache *decisionCache
+}
+
+// Readdir implements webdav.File.
+func (f *File) Readdir(count int) ([]fs.FileInfo, error) {
+	if count <= 0 {
+		infos, err := f.File.Readdir(count)
+		if err != nil {
+			return nil, err
+		}
+
+		return f.filter(infos), nil
+	}
+
+	filtered := make([]fs.FileInfo, 0, count)
+
+	// Read until enough children are allowed to fill the requested count
+	for len(filtered) < count {
+		infos, err := f.File.Readdir(count - len(filtered))
+		filtered = append(filtered, f.filter(infos)...)
+
+		if err != nil {
+			if errors.Is(err, io.EOF) && len(filtered) > 0 {
+				return filtered, nil
+			}
+
+			return filtered, err
+		}
+	}
+
+	return filtered, nil
+}
+
+// filter evaluates the stat rules against each child. The decisions are
+// not passed to the decision handlers: the children are not requested by
+// the user and their denials would flood the reports.
+func (f *File) filter(infos []fs.FileInfo) []fs.FileInfo {
+	filtered := make([]fs.FileInfo, 0, len(infos))
+
+	for _, info := range infos {
+		name := path.Join(f.name, info.Name())
+
+		decision := f.cache.LoadOrEvaluate(name, func() *Decision {
+			return Evaluate(f.ctx, f.user, OperationStat, map[string]any{
+				"name": name,
+			})
+		})
+
+		if !decision.Allowed() {
+			continue
+		}
+
+		filtered = append(filtered, info)
+	}
+
+	return filtered
+}
+
+// DeadProps implements webdav.DeadPropsHolder.
+func (f *File) DeadProps() (map[xml.Name]webdav.Property, error) {
+	props, err := filesystem.DeadProps(f.File)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if props == nil {
+		props = make(map[xml.Name]webdav.Property)
+	}
+
+	// The privileges are evaluated only when requested, the rules
+	// being evaluated several times for each resource otherwise
+	if filesystem.PropRequested(f.ctx, PropCurrentUserPrivilegeSet) {
+		info, err := f.File.Stat()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		// As for the listings, the privileges decisions are not passed to the
+		// decision handlers, the user not requesting the operations
+		props[PropCurrentUserPrivilegeSet] = privilegeSetProperty(Privileges(f.ctx, f.user, f.name, info.IsDir()))
+	}
+
+	if owner, ok := HomeOwner(f.name); ok {
+		props[PropOwner] = ownerProperty(owner)
+	}
+
+	return props, nil
+}
+
+// Patch implements webdav.DeadPropsHolder.
+func (f *File) Patch(patches []webdav.Proppatch) ([]webdav.Propstat, error) {
+	return filesystem.PatchProtected(f.File, patches, PropCurrentUserPrivilegeSet, PropOwner)
+}
+
+var (
+	_ webdav.File            = &File{}
+	_ webdav.DeadPropsHolder = &File{}
+)
@@ -0,0 +1,112 @@
+package authz
+
+import (
+	"context"
+	"os"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/webdav"
+)
+
+type testRule func(env map[string]any) (bool, error)
+
+func (r testRule) Exec(env map[string]any) (bool, error) { return r(env) }
+func (r testRule) Effect() Effect                        { return EffectAllow }
+
+type testUser struct {
+	rules []Rule
+}
+
+func (u *testUser) UserSubject() string        { return "jdoe" }
+func (u *testUser) UserProvider() string       { return "test" }
+func (u *testUser) FileSystemGroups() []*Group { return nil }
+func (u *testUser) FileSystemRules() []Rule    { return u.rules }
+
+var _ User = &testUser{}
+
+func TestFileReaddir(t *testing.T) {
+	backend := webdav.NewMemFS()
+
+	for _, name := range []string{"/public", "/private", "/public/a", "/public/b", "/private/c"} {
+		if err := backend.Mkdir(context.Background(), name, os.ModePerm); err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+	}
+
+	var (
+		evaluations atomic.Int64
+		decisions   atomic.Int64
+	)
+
+	user := &testUser{
+		rules: []Rule{
+			testRule(func(env map[string]any) (bool, error) {
+				evaluations.Add(1)
+
+				if env["operation"] == OperationOpen {
+					return true, nil
+				}
+
+				name, _ := env["name"].(string)
+
+				return !strings.HasPrefix(name, "/private"), nil
+			}),
+		},
+	}
+
+	fs := NewFileSystem(backend, WithDecisionHandlers(func(ctx context.Context, decision *Decision) {
+		decisions.Add(1)
+	}))
+
+	ctx := WithDecisionCache(WithContextUser(context.Background(), user))
+
+	names := func(count int) []string {
+		file, err := fs.OpenFile(ctx, "/", os.O_RDONLY, 0)
+		if err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		defer file.Close()
+
+		infos, err := file.Readdir(count)
+		if err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		names := make([]string, 0, len(infos))
+		for _, info := range infos {
+			names = append(names, info.Name())
+		}
+
+		slices.Sort(names)
+
+		return names
+	}
+
+	if e, g := []string{"public"}, names(-1); !slices.Equal(e, g) {
+		t.Errorf("Readdir(-1): expected '%v', got '%v'", e, g)
+	}
+
+	// The denied child must not take the place of an allowed one
+	if e, g := []string{"public"}, names(1); !slices.Equal(e, g) {
+		t.Errorf("Readdir(1): expected '%v', got '%v'", e, g)
+	}
+
+	if _, err := fs.Stat(ctx, "/public"); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	// 2 opens and 2 children stat decisions, reused by the following stat
+	if e, g := int64(4), evaluations.Load(); e != g {
+		t.Errorf("evaluations: expected '%v', got '%v'", e, g)
+	}
+
+	// Only the opens and the stat are reported
+	if e, g := int64(3), decisions.Load(); e != g {
+		t.Errorf("decisions: expected '%v', got '%v'", e, g)
+	}
+}
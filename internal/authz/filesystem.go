@@ -2,9 +2,7 @@ package authz
 
 import (
 	"context"
-	"log/slog"
 	"os"
-	"slices"
 
 	"github.com/pkg/errors"
 	"golang.org/x/net/webdav"
@@ -21,7 +19,8 @@ const (
 )
 
 type FileSystem struct {
-	backend webdav.FileSystem
+	backend          webdav.FileSystem
+	decisionHandlers []DecisionHandler
 }
 
 // Mkdir implements webdav.FileSystem.
@@ -48,7 +47,28 @@ func (f *FileSystem) OpenFile(ctx context.Context, name string, flag int, perm o
 		return nil, err
 	}
 
-	return f.backend.OpenFile(ctx, name, flag, perm)
+	file, err := f.backend.OpenFile(ctx, name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := ContextUser(ctx)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	cache := contextDecisionCache(ctx)
+	if cache == nil {
+		cache = newDecisionCache()
+	}
+
+	return &File{
+		File:  file,
+		ctx:   ctx,
+		user:  user,
+		name:  name,
+		cache: cache,
+	}, nil
 }
 
 // RemoveAll implements webdav.FileSystem.
@@ -78,10 +98,26 @@ func (f *FileSystem) Rename(ctx context.Context, oldName string, newName string)
 
 // Stat implements webdav.FileSystem.
 func (f *FileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
-	err := f.assertAuthorization(ctx, OperationStat, map[string]any{
-		"name": name,
-	})
+	user, err := ContextUser(ctx)
 	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	evaluate := func() *Decision {
+		return Evaluate(ctx, user, OperationStat, map[string]any{
+			"name": name,
+		})
+	}
+
+	// Reuse the decision made while listing the parent directory, if any
+	var decision *Decision
+	if cache := contextDecisionCache(ctx); cache != nil {
+		decision = cache.LoadOrEvaluate(name, evaluate)
+	} else {
+		decision = evaluate()
+	}
+
+	if err := f.handleDecision(ctx, decision); err != nil {
 		return nil, err
 	}
 
@@ -94,48 +130,31 @@ func (f *FileSystem) assertAuthorization(ctx context.Context, operation Operatio
 		return errors.WithStack(err)
 	}
 
-	if env == nil {
-		env = map[string]any{}
-	}
-
-	env["operation"] = string(operation)
-	env["subject"] = user.UserSubject()
-	env["provider"] = user.UserProvider()
-	env["groups"] = slices.Collect(func(yield func(string) bool) {
-		for _, g := range user.FileSystemGroups() {
-			if !yield(g.Name()) {
-				return
-			}
-		}
-	})
-
-	env["OP_MKDIR"] = string(OperationMkdir)
-	env["OP_OPEN"] = string(OperationOpen)
-	env["OP_REMOVE"] = string(OperationRemove)
-	env["OP_RENAME"] = string(OperationRename)
-	env["OP_STAT"] = string(OperationStat)
-
-	for _, r := range user.FileSystemRules() {
-		slog.DebugContext(ctx, "executing rule", slog.Any("rule", r), slog.Any("env", env))
+	return f.handleDecision(ctx, Evaluate(ctx, user, operation, env))
+}
 
-		allowed, err := r.Exec(env)
-		if err != nil {
-			return errors.WithStack(err)
-		}
+func (f *FileSystem) handleDecision(ctx context.Context, decision *Decision) error {
+	for _, h := range f.decisionHandlers {
+		h(ctx, decision)
+	}
 
-		slog.DebugContext(ctx, "rule result", slog.Any("rule", r), slog.Bool("result", allowed))
+	if err := decision.Err(); err != nil {
+		return errors.WithStack(err)
+	}
 
-		if allowed {
-			return nil
-		}
+	if decision.Allowed() {
+		return nil
 	}
 
 	return os.ErrPermission
 }
 
-func NewFileSystem(backend webdav.FileSystem) *FileSystem {
+func NewFileSystem(backend webdav.FileSystem, funcs ...OptionFunc) *FileSystem {
+	opts := NewOptions(funcs...)
+
 	return &FileSystem{
-		backend: backend,
+		backend:          backend,
+		decisionHandlers: opts.DecisionHandlers,
 	}
 }
 
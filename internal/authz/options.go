@@ -0,0 +1,31 @@
+package authz
+
+import "context"
+
+// DecisionHandler is called with each decision made by the filesystem
+type DecisionHandler func(ctx context.Context, decision *Decision)
+
+type Options struct {
+	DecisionHandlers []DecisionHandler
+}
+
+type OptionFunc func(opts *Options)
+
+func NewOptions(funcs ...OptionFunc) *Options {
+	opts := &Options{
+		DecisionHandlers: make([]DecisionHandler, 0),
+	}
+
+	for _, fn := range funcs {
+		fn(opts)
+	}
+
+	return opts
+}
+
+// WithDecisionHandlers appends handlers called with each authorization decision
+func WithDecisionHandlers(handlers ...DecisionHandler) OptionFunc {
+	return func(opts *Options) {
+		opts.DecisionHandlers = append(opts.DecisionHandlers, handlers...)
+	}
+}
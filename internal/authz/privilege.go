@@ -0,0 +1,121 @@
+package authz
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"os"
+	"path"
+	"strings"
+
+	"golang.org/x/net/webdav"
+)
+
+// Privilege is a WebDAV ACL privilege, see RFC 3744
+type Privilege string
+
+const (
+	PrivilegeRead   Privilege = "read"
+	PrivilegeWrite  Privilege = "write"
+	PrivilegeBind   Privilege = "bind"
+	PrivilegeUnbind Privilege = "unbind"
+)
+
+var (
+	PropCurrentUserPrivilegeSet = xml.Name{Space: "DAV:", Local: "current-user-privilege-set"}
+	PropOwner                   = xml.Name{Space: "DAV:", Local: "owner"}
+)
+
+// Privileges evaluates the user's rules for each privilege on the named
+// resource: read opens it for reading and write opens it for writing as a
+// PUT does. The members of a collection being unknown, its bind and unbind
+// privileges are evaluated against the collection's name followed by a
+// slash, write being granted with both of them.
+func Privileges(ctx context.Context, user User, name string, isDir bool) []Privilege {
+	allowed := func(operation Operation, env map[string]any) bool {
+		return Evaluate(ctx, user, operation, env).Allowed()
+	}
+
+	privileges := make([]Privilege, 0, 4)
+
+	read := allowed(OperationOpen, map[string]any{
+		"name": name,
+		"flag": os.O_RDONLY,
+		"perm": os.FileMode(0),
+	})
+	if read {
+		privileges = append(privileges, PrivilegeRead)
+	}
+
+	if !isDir {
+		write := allowed(OperationOpen, map[string]any{
+			"name": name,
+			"flag": os.O_RDWR | os.O_CREATE | os.O_TRUNC,
+			"perm": os.FileMode(0666),
+		})
+		if write {
+			privileges = append(privileges, PrivilegeWrite)
+		}
+
+		return privileges
+	}
+
+	member := strings.TrimSuffix(name, "/") + "/"
+
+	bind := allowed(OperationOpen, map[string]any{
+		"name": member,
+		"flag": os.O_RDWR | os.O_CREATE | os.O_TRUNC,
+		"perm": os.FileMode(0666),
+	}) || allowed(OperationMkdir, map[string]any{
+		"name": member,
+		"perm": os.FileMode(0777),
+	})
+
+	unbind := allowed(OperationRemove, map[string]any{
+		"name": member,
+	})
+
+	if bind && unbind {
+		privileges = append(privileges, PrivilegeWrite)
+	}
+
+	if bind {
+		privileges = append(privileges, PrivilegeBind)
+	}
+
+	if unbind {
+		privileges = append(privileges, PrivilegeUnbind)
+	}
+
+	return privileges
+}
+
+// HomeOwner returns the identifier of the user owning the home
+// directory containing the named resource, if any
+func HomeOwner(name string) (string, bool) {
+	rel, ok := strings.CutPrefix(path.Clean(name), HomeRoot+"/")
+	if !ok {
+		return "", false
+	}
+
+	id, _, _ := strings.Cut(rel, "/")
+
+	return id, true
+}
+
+func privilegeSetProperty(privileges []Privilege) webdav.Property {
+	var inner strings.Builder
+	for _, p := range privileges {
+		fmt.Fprintf(&inner, `<D:privilege xmlns:D="DAV:"><D:%s/></D:privilege>`, p)
+	}
+
+	return webdav.Property{XMLName: PropCurrentUserPrivilegeSet, InnerXML: []byte(inner.String())}
+}
+
+// ownerProperty identifies the owner with an URN, the users
+// not being exposed as WebDAV principals
+func ownerProperty(id string) webdav.Property {
+	inner := fmt.Sprintf(`<D:href xmlns:D="DAV:">urn:calli:user:%s</D:href>`, html.EscapeString(id))
+	return webdav.Property{XMLName: PropOwner, InnerXML: []byte(inner)}
+}
@@ -0,0 +1,203 @@
+package authz
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bornholm/calli/pkg/webdav/filesystem"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/webdav"
+)
+
+func TestPrivileges(t *testing.T) {
+	ctx := context.Background()
+	backend := webdav.NewMemFS()
+
+	for _, name := range []string{"/home", "/home/42", "/shared"} {
+		if err := backend.Mkdir(ctx, name, os.ModePerm); err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+	}
+
+	file, err := backend.OpenFile(ctx, "/shared/notes.txt", os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if err := file.Close(); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	user := &testUser{
+		rules: []Rule{
+			testRule(func(env map[string]any) (bool, error) {
+				name, _ := env["name"].(string)
+				flag, _ := env["flag"].(int)
+
+				switch env["operation"] {
+				case OperationStat:
+					return true, nil
+				case OperationOpen:
+					return flag&(os.O_WRONLY|os.O_RDWR) == 0 || strings.HasPrefix(name, "/home/42/"), nil
+				default:
+					return strings.HasPrefix(name, "/home/42/"), nil
+				}
+			}),
+		},
+	}
+
+	handler := &webdav.Handler{
+		FileSystem: NewFileSystem(backend),
+		LockSystem: webdav.NewMemLS(),
+	}
+
+	propfind := func(name string) string {
+		body := `<?xml version="1.0"?><propfind xmlns="DAV:"><prop><current-user-privilege-set/><owner/></prop></propfind>`
+
+		r := httptest.NewRequest("PROPFIND", name, strings.NewReader(body))
+		r.Header.Set("Depth", "0")
+		r = r.WithContext(WithContextUser(r.Context(), user))
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if e, g := http.StatusMultiStatus, w.Code; e != g {
+			t.Fatalf("PROPFIND %s: expected status '%v', got '%v'", name, e, g)
+		}
+
+		return w.Body.String()
+	}
+
+	type testCase struct {
+		Name    string
+		Granted []Privilege
+		Denied  []Privilege
+		// Owner is the expected owner, none if empty
+		Owner string
+	}
+
+	testCases := []testCase{
+		{
+			Name:    "/home/42",
+			Granted: []Privilege{PrivilegeRead, PrivilegeWrite, PrivilegeBind, PrivilegeUnbind},
+			Owner:   "urn:calli:user:42",
+		},
+		{
+			Name:    "/shared",
+			Granted: []Privilege{PrivilegeRead},
+			Denied:  []Privilege{PrivilegeWrite, PrivilegeBind, PrivilegeUnbind},
+		},
+		{
+			Name:    "/shared/notes.txt",
+			Granted: []Privilege{PrivilegeRead},
+			Denied:  []Privilege{PrivilegeWrite},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.Name, func(t *testing.T) {
+			body := propfind(tc.Name)
+
+			for _, p := range tc.Granted {
+				if !strings.Contains(body, "<D:"+string(p)+"/>") {
+					t.Errorf("privilege '%s' should be granted, got '%s'", p, body)
+				}
+			}
+
+			for _, p := range tc.Denied {
+				if strings.Contains(body, "<D:"+string(p)+"/>") {
+					t.Errorf("privilege '%s' should not be granted, got '%s'", p, body)
+				}
+			}
+
+			switch {
+			case tc.Owner != "" && !strings.Contains(body, tc.Owner):
+				t.Errorf("owner '%s' should be reported, got '%s'", tc.Owner, body)
+			case tc.Owner == "" && strings.Contains(body, "urn:calli:user:"):
+				t.Errorf("no owner should be reported, got '%s'", body)
+			}
+		})
+	}
+}
+
+func TestPrivilegesNotRequested(t *testing.T) {
+	ctx := context.Background()
+	backend := webdav.NewMemFS()
+
+	for i := range 10 {
+		file, err := backend.OpenFile(ctx, fmt.Sprintf("/file-%d.txt", i), os.O_RDWR|os.O_CREATE, 0666)
+		if err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		if err := file.Close(); err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+	}
+
+	var evaluations atomic.Int64
+
+	user := &testUser{
+		rules: []Rule{
+			testRule(func(env map[string]any) (bool, error) {
+				// Only the privileges probe the writes, the PROPFIND reading the files
+				flag, _ := env["flag"].(int)
+				if env["operation"] == OperationOpen && flag&os.O_CREATE != 0 {
+					evaluations.Add(1)
+				}
+
+				return true, nil
+			}),
+		},
+	}
+
+	handler := filesystem.RequestedPropsMiddleware(&webdav.Handler{
+		FileSystem: NewFileSystem(backend),
+		LockSystem: webdav.NewMemLS(),
+	})
+
+	propfind := func(body string) string {
+		r := httptest.NewRequest("PROPFIND", "/", strings.NewReader(body))
+		r.Header.Set("Depth", "1")
+		r = r.WithContext(WithContextUser(r.Context(), user))
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		if e, g := http.StatusMultiStatus, w.Code; e != g {
+			t.Fatalf("PROPFIND: expected status '%v', got '%v'", e, g)
+		}
+
+		return w.Body.String()
+	}
+
+	for _, body := range []string{
+		``,
+		`<?xml version="1.0"?><propfind xmlns="DAV:"><allprop/></propfind>`,
+		`<?xml version="1.0"?><propfind xmlns="DAV:"><prop><getcontentlength/></prop></propfind>`,
+	} {
+		if result := propfind(body); strings.Contains(result, "current-user-privilege-set") {
+			t.Errorf("privileges should not be reported, got '%s'", result)
+		}
+	}
+
+	if e, g := int64(0), evaluations.Load(); e != g {
+		t.Errorf("evaluations: expected '%v', got '%v'", e, g)
+	}
+
+	result := propfind(`<?xml version="1.0"?><propfind xmlns="DAV:"><prop><current-user-privilege-set/></prop></propfind>`)
+	if !strings.Contains(result, "<D:"+string(PrivilegeWrite)+"/>") {
+		t.Errorf("privileges should be reported, got '%s'", result)
+	}
+
+	if evaluations.Load() == 0 {
+		t.Errorf("privileges should be evaluated")
+	}
+}
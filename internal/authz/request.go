@@ -0,0 +1,127 @@
+package authz
+
+import (
+	"context"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+const contextKeyRequest contextKey = "authzRequest"
+
+// Request describes the HTTP request at the origin of the filesystem operations
+type Request struct {
+	// IP is the client's address, empty if unknown
+	IP        string
+	Method    string
+	Depth     string
+	UserAgent string
+	TLS       bool
+	Time      time.Time
+}
+
+func WithContextRequest(parent context.Context, req *Request) context.Context {
+	return context.WithValue(parent, contextKeyRequest, req)
+}
+
+// ContextRequest returns the request attached to the context, or nil if none
+func ContextRequest(ctx context.Context) *Request {
+	req, _ := ctx.Value(contextKeyRequest).(*Request)
+	return req
+}
+
+// RequestMiddleware attaches the request's metadata to its context, exposing
+// it to the rules. The client's address and scheme are read from the
+// X-Forwarded-For and X-Forwarded-Proto headers when the request comes
+// from one of the trusted proxies.
+func RequestMiddleware(trustedProxies []netip.Prefix) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			req := &Request{
+				IP:        ClientIP(r, trustedProxies),
+				Method:    r.Method,
+				Depth:     r.Header.Get("Depth"),
+				UserAgent: r.UserAgent(),
+				TLS:       ClientTLS(r, trustedProxies),
+				Time:      time.Now(),
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithContextRequest(r.Context(), req)))
+		})
+	}
+}
+
+// ClientIP returns the address of the client, skipping the trusted proxies
+// from the right of the X-Forwarded-For header
+func ClientIP(r *http.Request, trustedProxies []netip.Prefix) string {
+	remote, err := parseAddr(r.RemoteAddr)
+	if err != nil {
+		return ""
+	}
+
+	if !isTrusted(remote, trustedProxies) {
+		return remote.String()
+	}
+
+	client := remote
+
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(forwarded) - 1; i >= 0; i-- {
+		addr, err := parseAddr(strings.TrimSpace(forwarded[i]))
+		if err != nil {
+			// The header can not be trusted beyond this point
+			break
+		}
+
+		client = addr
+
+		if !isTrusted(addr, trustedProxies) {
+			break
+		}
+	}
+
+	return client.String()
+}
+
+// ClientTLS returns true if the client uses HTTPS, as reported by the
+// X-Forwarded-Proto header when the peer is a trusted proxy
+func ClientTLS(r *http.Request, trustedProxies []netip.Prefix) bool {
+	if r.TLS != nil {
+		return true
+	}
+
+	remote, err := parseAddr(r.RemoteAddr)
+	if err != nil || !isTrusted(remote, trustedProxies) {
+		return false
+	}
+
+	// The rightmost value is set by the closest proxy
+	forwarded := strings.Split(strings.Join(r.Header.Values("X-Forwarded-Proto"), ","), ",")
+
+	return strings.EqualFold(strings.TrimSpace(forwarded[len(forwarded)-1]), "https")
+}
+
+func isTrusted(addr netip.Addr, trustedProxies []netip.Prefix) bool {
+	for _, p := range trustedProxies {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// parseAddr parses an address with or without port
+func parseAddr(s string) (netip.Addr, error) {
+	if addrPort, err := netip.ParseAddrPort(s); err == nil {
+		return addrPort.Addr().Unmap(), nil
+	}
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+
+	return addr.Unmap(), nil
+}
@@ -0,0 +1,90 @@
+package authz
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	type testCase struct {
+		RemoteAddr    string
+		XForwardedFor []string
+		Expected      string
+	}
+
+	trustedProxies := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("::1/128"),
+	}
+
+	testCases := []testCase{
+		{RemoteAddr: "192.168.1.10:5678", Expected: "192.168.1.10"},
+		// The header is ignored if the peer is not a trusted proxy
+		{RemoteAddr: "192.168.1.10:5678", XForwardedFor: []string{"1.2.3.4"}, Expected: "192.168.1.10"},
+		{RemoteAddr: "10.0.0.1:5678", XForwardedFor: []string{"1.2.3.4"}, Expected: "1.2.3.4"},
+		// The spoofed leftmost address is ignored
+		{RemoteAddr: "10.0.0.1:5678", XForwardedFor: []string{"6.6.6.6, 1.2.3.4, 10.0.0.2"}, Expected: "1.2.3.4"},
+		{RemoteAddr: "10.0.0.1:5678", XForwardedFor: []string{"6.6.6.6", "1.2.3.4"}, Expected: "1.2.3.4"},
+		{RemoteAddr: "10.0.0.1:5678", XForwardedFor: []string{"10.0.0.3"}, Expected: "10.0.0.3"},
+		{RemoteAddr: "10.0.0.1:5678", XForwardedFor: []string{"garbage, 1.2.3.4"}, Expected: "1.2.3.4"},
+		{RemoteAddr: "10.0.0.1:5678", XForwardedFor: []string{"garbage"}, Expected: "10.0.0.1"},
+		{RemoteAddr: "[::1]:5678", XForwardedFor: []string{"2001:db8::1"}, Expected: "2001:db8::1"},
+		{RemoteAddr: "[::ffff:192.168.1.10]:5678", Expected: "192.168.1.10"},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("Case #%d", idx), func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tc.RemoteAddr
+
+			for _, v := range tc.XForwardedFor {
+				r.Header.Add("X-Forwarded-For", v)
+			}
+
+			if e, g := tc.Expected, ClientIP(r, trustedProxies); e != g {
+				t.Errorf("ClientIP(%s, %v): expected '%v', got '%v'", tc.RemoteAddr, tc.XForwardedFor, e, g)
+			}
+		})
+	}
+}
+
+func TestClientTLS(t *testing.T) {
+	type testCase struct {
+		RemoteAddr      string
+		XForwardedProto []string
+		Expected        bool
+	}
+
+	trustedProxies := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+	}
+
+	testCases := []testCase{
+		{RemoteAddr: "10.0.0.1:5678", Expected: false},
+		{RemoteAddr: "10.0.0.1:5678", XForwardedProto: []string{"https"}, Expected: true},
+		{RemoteAddr: "10.0.0.1:5678", XForwardedProto: []string{"HTTPS"}, Expected: true},
+		{RemoteAddr: "10.0.0.1:5678", XForwardedProto: []string{"http"}, Expected: false},
+		// The value set by the closest proxy prevails
+		{RemoteAddr: "10.0.0.1:5678", XForwardedProto: []string{"https, http"}, Expected: false},
+		{RemoteAddr: "10.0.0.1:5678", XForwardedProto: []string{"http", "https"}, Expected: true},
+		// The header is ignored if the peer is not a trusted proxy
+		{RemoteAddr: "192.168.1.10:5678", XForwardedProto: []string{"https"}, Expected: false},
+	}
+
+	for idx, tc := range testCases {
+		t.Run(fmt.Sprintf("Case #%d", idx), func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/", nil)
+			r.RemoteAddr = tc.RemoteAddr
+
+			for _, v := range tc.XForwardedProto {
+				r.Header.Add("X-Forwarded-Proto", v)
+			}
+
+			if e, g := tc.Expected, ClientTLS(r, trustedProxies); e != g {
+				t.Errorf("ClientTLS(%s, %v): expected '%v', got '%v'", tc.RemoteAddr, tc.XForwardedProto, e, g)
+			}
+		})
+	}
+}
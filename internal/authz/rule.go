@@ -1,9 +1,61 @@
 package authz
 
+import "github.com/pkg/errors"
+
+var ErrInvalidPolicy = errors.New("invalid policy")
+
+// Effect is the outcome of a matching rule
+type Effect string
+
+const (
+	EffectAllow Effect = "allow"
+	EffectDeny  Effect = "deny"
+)
+
+// ParseEffect returns the effect with the given name, EffectAllow if empty
+func ParseEffect(raw string) (Effect, error) {
+	switch Effect(raw) {
+	case "", EffectAllow:
+		return EffectAllow, nil
+	case EffectDeny:
+		return EffectDeny, nil
+	default:
+		return "", errors.Wrapf(ErrInvalidPolicy, "unknown effect '%s'", raw)
+	}
+}
+
+// Strategy defines how the decisions of a group's rules are combined
+type Strategy string
+
+const (
+	// StrategyDenyOverrides denies the operation if any rule of the group
+	// denies it, and allows it if any other rule allows it
+	StrategyDenyOverrides Strategy = "deny-overrides"
+	// StrategyFirstMatch applies the effect of the first matching rule
+	// of the group, in order
+	StrategyFirstMatch Strategy = "first-match"
+)
+
+// ParseStrategy returns the strategy with the given name,
+// StrategyDenyOverrides if empty
+func ParseStrategy(raw string) (Strategy, error) {
+	switch Strategy(raw) {
+	case "", StrategyDenyOverrides:
+		return StrategyDenyOverrides, nil
+	case StrategyFirstMatch:
+		return StrategyFirstMatch, nil
+	default:
+		return "", errors.Wrapf(ErrInvalidPolicy, "unknown strategy '%s'", raw)
+	}
+}
+
 type Rules interface {
 	Rules() []Rule
 }
 
 type Rule interface {
+	// Exec returns true if the rule matches the environment
 	Exec(env map[string]any) (bool, error)
+	// Effect returns the effect of the rule when it matches
+	Effect() Effect
 }
@@ -1,29 +1,64 @@
 package authz
 
-import "github.com/bornholm/calli/internal/authn"
+import (
+	"path"
+
+	"github.com/bornholm/calli/internal/authn"
+)
+
+// HomeRoot is the directory containing the users home directories
+const HomeRoot = "/home"
 
 type User interface {
 	authn.User
+	// FileSystemRules returns the user's own rules, not belonging to
+	// any group (i.e. the administrators' full access)
 	FileSystemRules() []Rule
 	FileSystemGroups() []*Group
 }
 
+// Profile is implemented by the users exposing additional
+// attributes to the rules
+type Profile interface {
+	UserEmail() string
+	UserNickname() string
+	UserBasicUsername() string
+	// UserHome returns the user's home directory, or an empty string
+	// if the user has none
+	UserHome() string
+}
+
+// HomeDir returns the home directory associated with the given identifier
+func HomeDir(id string) string {
+	return path.Join(HomeRoot, id)
+}
+
 type Group struct {
-	name  string
-	rules []Rule
+	name     string
+	strategy Strategy
+	rules    []Rule
 }
 
 func (g *Group) Name() string {
 	return g.name
 }
 
+// Strategy returns how the decisions of the group's rules are combined
+func (g *Group) Strategy() Strategy {
+	return g.strategy
+}
+
 // Rules implements Rules.
 func (g *Group) Rules() []Rule {
 	return g.rules
 }
 
-func NewGroup(name string, rules ...Rule) *Group {
-	return &Group{name, rules}
+func NewGroup(name string, strategy Strategy, rules ...Rule) *Group {
+	if strategy == "" {
+		strategy = StrategyDenyOverrides
+	}
+
+	return &Group{name, strategy, rules}
 }
 
 var _ Rules = &Group{}
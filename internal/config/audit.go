@@ -0,0 +1,23 @@
+package config
+
+import "github.com/goccy/go-yaml"
+
+type Audit struct {
+	Store InterpolatedBool   `yaml:"store"`
+	File  InterpolatedString `yaml:"file"`
+}
+
+func NewDefaultAuditConfig() Audit {
+	return Audit{
+		Store: false,
+		File:  "${CALLI_AUDIT_FILE:-}",
+	}
+}
+
+func NewAuditConfigCommentMap() yaml.CommentMap {
+	return yaml.CommentMap{
+		"":       []*yaml.Comment{yaml.HeadComment(" Audit trail of the filesystem operations")},
+		".store": []*yaml.Comment{yaml.HeadComment(" Record the operations in the database, searchable in the admin interface")},
+		".file":  []*yaml.Comment{yaml.HeadComment(" Append the operations to the given JSON lines file, disabled if empty")},
+	}
+}
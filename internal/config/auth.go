@@ -1,11 +1,15 @@
 package config
 
-import "github.com/goccy/go-yaml"
+import (
+	"github.com/goccy/go-yaml"
+	"github.com/pkg/errors"
+)
 
 type Auth struct {
-	Providers AuthProviders `yaml:"providers"`
-	Groups    []Group       `yaml:"groups"`
-	Admins    []User        `yaml:"admins"`
+	Providers   AuthProviders    `yaml:"providers"`
+	Groups      []Group          `yaml:"groups"`
+	PruneGroups InterpolatedBool `yaml:"pruneGroups"`
+	Admins      []User           `yaml:"admins"`
 }
 
 type User struct {
@@ -14,10 +18,56 @@ type User struct {
 }
 
 type Group struct {
-	Name  InterpolatedString       `yaml:"name"`
-	Rules *InterpolatedStringSlice `yaml:"rules"`
+	Name     InterpolatedString `yaml:"name"`
+	Strategy InterpolatedString `yaml:"strategy,omitempty"`
+	// Quota is a size such as '10GB', each member's home directory
+	// or QuotaDir being limited to it
+	Quota    InterpolatedString `yaml:"quota,omitempty"`
+	QuotaDir InterpolatedString `yaml:"quotaDir,omitempty"`
+	Rules    []Rule             `yaml:"rules"`
 }
 
+// Rule is either a script allowing the operations it matches,
+// or a mapping with the script and its effect
+type Rule struct {
+	Effect InterpolatedString `yaml:"effect"`
+	Script InterpolatedString `yaml:"script"`
+}
+
+type rawRule Rule
+
+// UnmarshalYAML implements yaml.InterfaceUnmarshaler.
+func (r *Rule) UnmarshalYAML(unmarshal func(any) error) error {
+	var script InterpolatedString
+	if err := unmarshal(&script); err == nil {
+		*r = Rule{Script: script}
+		return nil
+	}
+
+	var raw rawRule
+	if err := unmarshal(&raw); err != nil {
+		return errors.WithStack(err)
+	}
+
+	*r = Rule(raw)
+
+	return nil
+}
+
+// MarshalYAML implements yaml.InterfaceMarshaler.
+func (r Rule) MarshalYAML() (any, error) {
+	if r.Effect == "" || r.Effect == "allow" {
+		return string(r.Script), nil
+	}
+
+	return rawRule(r), nil
+}
+
+var (
+	_ yaml.InterfaceUnmarshaler = new(Rule)
+	_ yaml.InterfaceMarshaler   = Rule{}
+)
+
 type AuthProviders struct {
 	Google OAuth2Provider `yaml:"google"`
 	Github OAuth2Provider `yaml:"github"`
@@ -63,15 +113,15 @@ func NewDefaultAuthConfig() Auth {
 		Groups: []Group{
 			{
 				Name: "read-only",
-				Rules: &InterpolatedStringSlice{
-					"operation == OP_OPEN && bitand(flag, O_WRITE) == 0",
-					"operation == OP_STAT",
+				Rules: []Rule{
+					{Script: "operation == OP_OPEN && isRead(flag)"},
+					{Script: "operation == OP_STAT"},
 				},
 			},
 			{
 				Name: "read-write",
-				Rules: &InterpolatedStringSlice{
-					"true",
+				Rules: []Rule{
+					{Script: "true"},
 				},
 			},
 		},
@@ -84,7 +134,23 @@ func NewAuthConfigCommentMap() yaml.CommentMap {
 		".admins":             []*yaml.Comment{yaml.HeadComment(" List of users with admin privileges")},
 		".admins[0].email":    []*yaml.Comment{yaml.HeadComment(" Admin's email address")},
 		".admins[0].provider": []*yaml.Comment{yaml.HeadComment(" Admin's identify provider (see 'providers' section)")},
-		".groups":             []*yaml.Comment{yaml.HeadComment(" Authorization groups")},
-		".groups[0].rules":    []*yaml.Comment{yaml.HeadComment(" Groups authorization rules", " See https://expr-lang.org/docs/language-definition")},
+		".pruneGroups":        []*yaml.Comment{yaml.HeadComment(" Delete the groups previously declared in the configuration and now removed from it")},
+		".groups": []*yaml.Comment{
+			yaml.HeadComment(
+				" Authorization groups",
+				" Declared groups are synchronized at startup and read-only in the admin interface",
+				" Add 'quota: 10GB' to a group to limit the size of each member's home directory,",
+				" or of the directory shared by its members with 'quotaDir: /shared/dir'",
+			),
+		},
+		".groups[0].rules": []*yaml.Comment{
+			yaml.HeadComment(
+				" Groups authorization rules, allowing the operations they match",
+				" Use '{ effect: deny, script: \"...\" }' to deny them instead",
+				" Add 'strategy: first-match' to the group to apply the first matching rule,",
+				" instead of letting any matching deny rule prevail ('deny-overrides')",
+				" See https://expr-lang.org/docs/language-definition",
+			),
+		},
 	}
 }
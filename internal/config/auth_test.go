@@ -0,0 +1,61 @@
+package config
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/goccy/go-yaml"
+	"github.com/pkg/errors"
+)
+
+func TestGroupRules(t *testing.T) {
+	raw := `
+name: legal
+strategy: first-match
+rules:
+  - effect: deny
+    script: inDir(name, "/legal")
+  - "true"
+`
+
+	var group Group
+	if err := yaml.NewDecoder(strings.NewReader(raw)).Decode(&group); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := InterpolatedString("first-match"), group.Strategy; e != g {
+		t.Errorf("group.Strategy: expected '%v', got '%v'", e, g)
+	}
+
+	expected := []Rule{
+		{Effect: "deny", Script: `inDir(name, "/legal")`},
+		{Script: "true"},
+	}
+
+	if e, g := len(expected), len(group.Rules); e != g {
+		t.Fatalf("len(group.Rules): expected '%v', got '%v'", e, g)
+	}
+
+	for i, r := range group.Rules {
+		if e, g := expected[i], r; e != g {
+			t.Errorf("group.Rules[%d]: expected '%v', got '%v'", i, e, g)
+		}
+	}
+
+	var buff bytes.Buffer
+	if err := yaml.NewEncoder(&buff).Encode(group); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	var decoded Group
+	if err := yaml.NewDecoder(&buff).Decode(&decoded); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	for i, r := range decoded.Rules {
+		if e, g := expected[i], r; e != g {
+			t.Errorf("decoded.Rules[%d]: expected '%v', got '%v'", i, e, g)
+		}
+	}
+}
@@ -10,20 +10,32 @@ import (
 )
 
 type Config struct {
-	Logger     Logger     `yaml:"logger"`
-	HTTP       HTTP       `yaml:"http"`
-	Filesystem Filesystem `yaml:"filesystem"`
-	Auth       Auth       `yaml:"auth"`
-	Store      Store      `yaml:"store"`
+	Logger  Logger  `yaml:"logger"`
+	HTTP    HTTP    `yaml:"http"`
+	Mounts  []Mount `yaml:"mounts"`
+	Lock    Lock    `yaml:"lock"`
+	Homes   Homes   `yaml:"homes"`
+	Trash   Trash   `yaml:"trash"`
+	Audit   Audit   `yaml:"audit"`
+	Denials Denials `yaml:"denials"`
+	Metrics Metrics `yaml:"metrics"`
+	Auth    Auth    `yaml:"auth"`
+	Store   Store   `yaml:"store"`
 }
 
 func NewDefaultConfig() *Config {
 	return &Config{
-		Logger:     NewDefaultLoggerConfig(),
-		HTTP:       NewDefaultHTTPConfig(),
-		Filesystem: NewDefaultFilesystemConfig(),
-		Auth:       NewDefaultAuthConfig(),
-		Store:      NewDefaultStoreConfig(),
+		Logger:  NewDefaultLoggerConfig(),
+		HTTP:    NewDefaultHTTPConfig(),
+		Mounts:  NewDefaultMountsConfig(),
+		Lock:    NewDefaultLockConfig(),
+		Homes:   NewDefaultHomesConfig(),
+		Trash:   NewDefaultTrashConfig(),
+		Audit:   NewDefaultAuditConfig(),
+		Denials: NewDefaultDenialsConfig(),
+		Metrics: NewDefaultMetricsConfig(),
+		Auth:    NewDefaultAuthConfig(),
+		Store:   NewDefaultStoreConfig(),
 	}
 }
 
@@ -57,9 +69,16 @@ func LoadFile(path string, conf *Config) error {
 }
 
 func Load(r io.Reader, conf *Config) error {
-	decoder := yaml.NewDecoder(r)
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := yaml.NewDecoder(bytes.NewReader(data)).Decode(conf); err != nil {
+		return errors.WithStack(err)
+	}
 
-	if err := decoder.Decode(conf); err != nil {
+	if err := loadLegacyFilesystem(data, conf); err != nil {
 		return errors.WithStack(err)
 	}
 
@@ -67,10 +86,16 @@ func Load(r io.Reader, conf *Config) error {
 }
 
 var sections = map[string]yaml.CommentMap{
-	"$.http":       NewHTTPConfigCommentMap(),
-	"$.filesystem": NewFilesystemConfigCommentMap(),
-	"$.logger":     NewLoggerConfigCommentMap(),
-	"$.auth":       NewAuthConfigCommentMap(),
+	"$.http":    NewHTTPConfigCommentMap(),
+	"$.mounts":  NewMountsConfigCommentMap(),
+	"$.lock":    NewLockConfigCommentMap(),
+	"$.homes":   NewHomesConfigCommentMap(),
+	"$.trash":   NewTrashConfigCommentMap(),
+	"$.audit":   NewAuditConfigCommentMap(),
+	"$.denials": NewDenialsConfigCommentMap(),
+	"$.metrics": NewMetricsConfigCommentMap(),
+	"$.logger":  NewLoggerConfigCommentMap(),
+	"$.auth":    NewAuthConfigCommentMap(),
 }
 
 func Dump(w io.Writer, conf *Config) error {
@@ -0,0 +1,25 @@
+package config
+
+import "github.com/goccy/go-yaml"
+
+type Denials struct {
+	BufferSize    InterpolatedInt   `yaml:"bufferSize"`
+	LogSampleRate InterpolatedFloat `yaml:"logSampleRate"`
+}
+
+func NewDefaultDenialsConfig() Denials {
+	return Denials{
+		BufferSize:    100,
+		LogSampleRate: 1,
+	}
+}
+
+func NewDenialsConfigCommentMap() yaml.CommentMap {
+	return yaml.CommentMap{
+		"":            []*yaml.Comment{yaml.HeadComment(" Authorization denials reporting")},
+		".bufferSize": []*yaml.Comment{yaml.HeadComment(" Number of recent denials displayed on the admin dashboard")},
+		".logSampleRate": []*yaml.Comment{
+			yaml.HeadComment(" Ratio of denials logged with the 'warn' level, between 0 (none) and 1 (all)"),
+		},
+	}
+}
@@ -0,0 +1,25 @@
+package config
+
+import "github.com/goccy/go-yaml"
+
+type Homes struct {
+	Enabled InterpolatedBool `yaml:"enabled"`
+}
+
+func NewDefaultHomesConfig() Homes {
+	return Homes{
+		Enabled: false,
+	}
+}
+
+func NewHomesConfigCommentMap() yaml.CommentMap {
+	return yaml.CommentMap{
+		"": []*yaml.Comment{yaml.HeadComment(" Users home directories configuration")},
+		".enabled": []*yaml.Comment{
+			yaml.HeadComment(
+				" Create the user's home directory (/home/<id>) when they log in",
+				" Rules can reference it with the 'home' variable, see the 'own-home-only' group",
+			),
+		},
+	}
+}
@@ -7,9 +7,10 @@ import (
 )
 
 type HTTP struct {
-	BaseURL InterpolatedString `yaml:"baseUrl"`
-	Address InterpolatedString `yaml:"address"`
-	Session Session            `yaml:"session"`
+	BaseURL        InterpolatedString      `yaml:"baseUrl"`
+	Address        InterpolatedString      `yaml:"address"`
+	Session        Session                 `yaml:"session"`
+	TrustedProxies InterpolatedStringSlice `yaml:"trustedProxies"`
 }
 
 type Session struct {
@@ -26,8 +27,9 @@ type Cookie struct {
 
 func NewDefaultHTTPConfig() HTTP {
 	return HTTP{
-		BaseURL: "${CALLI_HTTP_BASE_URL:-http://localhost:8081}",
-		Address: "${CALLI_HTTP_ADDRESS:-:8081}",
+		BaseURL:        "${CALLI_HTTP_BASE_URL:-http://localhost:8081}",
+		Address:        "${CALLI_HTTP_ADDRESS:-:8081}",
+		TrustedProxies: InterpolatedStringSlice{},
 		Session: Session{
 			Cookie: Cookie{
 				Path:     "/",
@@ -43,5 +45,12 @@ func NewHTTPConfigCommentMap() yaml.CommentMap {
 	return yaml.CommentMap{
 		"":         []*yaml.Comment{yaml.HeadComment(" Webserver configuration")},
 		".address": []*yaml.Comment{yaml.HeadComment(" Webserver's listening address")},
+		".trustedProxies": []*yaml.Comment{
+			yaml.HeadComment(
+				" Addresses or networks (i.e. 10.0.0.0/8) of the reverse proxies allowed",
+				" to set the client's address and scheme with the X-Forwarded-For",
+				" and X-Forwarded-Proto headers",
+			),
+		},
 	}
 }
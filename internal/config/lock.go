@@ -0,0 +1,44 @@
+package config
+
+import (
+	"time"
+
+	"github.com/goccy/go-yaml"
+)
+
+const (
+	LockTypeMemory = "memory"
+	LockTypeStore  = "store"
+)
+
+type Lock struct {
+	Type          InterpolatedString    `yaml:"type"`
+	HoldTimeout   *InterpolatedDuration `yaml:"holdTimeout"`
+	MaxTimeout    *InterpolatedDuration `yaml:"maxTimeout"`
+	SweepInterval *InterpolatedDuration `yaml:"sweepInterval"`
+}
+
+func NewDefaultLockConfig() Lock {
+	return Lock{
+		Type:          "${CALLI_LOCK_TYPE:-memory}",
+		HoldTimeout:   NewInterpolatedDuration(time.Hour),
+		MaxTimeout:    NewInterpolatedDuration(24 * time.Hour),
+		SweepInterval: NewInterpolatedDuration(time.Minute * 5),
+	}
+}
+
+func NewLockConfigCommentMap() yaml.CommentMap {
+	return yaml.CommentMap{
+		"":      []*yaml.Comment{yaml.HeadComment(" WebDAV locks configuration")},
+		".type": []*yaml.Comment{yaml.HeadComment(" Lock system type", " Available: [memory store]", " 'store' persists the locks in the database and survives restarts")},
+		".holdTimeout": []*yaml.Comment{
+			yaml.HeadComment(" Maximum duration a lock can stay held by a single request (store only)"),
+		},
+		".maxTimeout": []*yaml.Comment{
+			yaml.HeadComment(" Maximum duration of a lock, the infinite ones included (store only)"),
+		},
+		".sweepInterval": []*yaml.Comment{
+			yaml.HeadComment(" Interval between the removal of expired locks (store only)"),
+		},
+	}
+}
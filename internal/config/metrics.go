@@ -0,0 +1,22 @@
+package config
+
+import "github.com/goccy/go-yaml"
+
+type Metrics struct {
+	Enabled InterpolatedBool `yaml:"enabled"`
+}
+
+func NewDefaultMetricsConfig() Metrics {
+	return Metrics{
+		Enabled: false,
+	}
+}
+
+func NewMetricsConfigCommentMap() yaml.CommentMap {
+	return yaml.CommentMap{
+		"": []*yaml.Comment{yaml.HeadComment(" Metrics configuration")},
+		".enabled": []*yaml.Comment{
+			yaml.HeadComment(" Expose the metrics in the Prometheus text format on /metrics"),
+		},
+	}
+}
@@ -0,0 +1,103 @@
+package config
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/bornholm/calli/pkg/webdav/filesystem"
+	"github.com/bornholm/calli/pkg/webdav/filesystem/local"
+	"github.com/bornholm/calli/pkg/webdav/filesystem/s3"
+	"github.com/goccy/go-yaml"
+	"github.com/pkg/errors"
+)
+
+type Mount struct {
+	Path    InterpolatedString `yaml:"path"`
+	Type    InterpolatedString `yaml:"type"`
+	Options *InterpolatedMap   `yaml:"options"`
+}
+
+// Filesystem is the section configuring the single filesystem
+// served before the mounts were introduced
+type Filesystem struct {
+	Type    InterpolatedString `yaml:"type"`
+	Options *InterpolatedMap   `yaml:"options"`
+}
+
+// loadLegacyFilesystem maps the deprecated 'filesystem' section
+// of the given configuration to a single mount on '/'
+func loadLegacyFilesystem(data []byte, conf *Config) error {
+	var legacy struct {
+		Filesystem *Filesystem `yaml:"filesystem"`
+		Mounts     []Mount     `yaml:"mounts"`
+	}
+
+	if err := yaml.NewDecoder(bytes.NewReader(data)).Decode(&legacy); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if legacy.Filesystem == nil {
+		return nil
+	}
+
+	if legacy.Mounts != nil {
+		return errors.New("the deprecated 'filesystem' section can not be used with the 'mounts' section, move it to a mount on '/'")
+	}
+
+	conf.Mounts = []Mount{
+		{
+			Path:    "/",
+			Type:    legacy.Filesystem.Type,
+			Options: legacy.Filesystem.Options,
+		},
+	}
+
+	return nil
+}
+
+func NewDefaultMountsConfig() []Mount {
+	return []Mount{
+		{
+			Path: "/",
+			Type: InterpolatedString(fmt.Sprintf("${CALLI_FILESYSTEM_TYPE:-%s}", local.Type)),
+			Options: &InterpolatedMap{
+				Data: map[string]any{
+					"dir": "${CALLI_FILESYSTEM_DIR:-./data}",
+				},
+			},
+		},
+	}
+}
+
+func NewMountsConfigCommentMap() yaml.CommentMap {
+	return yaml.CommentMap{
+		"": []*yaml.Comment{
+			yaml.HeadComment(
+				" Mounted filesystems",
+				" Each mount exposes a filesystem under the given path prefix",
+				fmt.Sprintf(" Available types: %v", filesystem.Registered()),
+			),
+			getFilesystemOptionComment("S3 filesystem", s3.Options{}),
+		},
+	}
+}
+
+func getFilesystemOptionComment(message string, opts any) *yaml.Comment {
+	rawOpts, err := yaml.Marshal(opts)
+	if err != nil {
+		panic(errors.WithStack(err))
+	}
+
+	comments := []string{message, "- path: /archive", "  type: s3", "  options:"}
+	comments = append(comments, slices.Collect(func(yield func(string) bool) {
+		for _, str := range strings.Split(string(rawOpts), "\n") {
+			if !yield("    " + str) {
+				return
+			}
+		}
+	})...)
+
+	return yaml.FootComment(comments...)
+}
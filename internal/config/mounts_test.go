@@ -0,0 +1,55 @@
+package config
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+)
+
+func TestLegacyFilesystem(t *testing.T) {
+	raw := `
+filesystem:
+  type: s3
+  options:
+    bucket: calli
+`
+
+	conf := NewDefaultConfig()
+	if err := Load(strings.NewReader(raw), conf); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := 1, len(conf.Mounts); e != g {
+		t.Fatalf("len(conf.Mounts): expected '%v', got '%v'", e, g)
+	}
+
+	mount := conf.Mounts[0]
+
+	if e, g := InterpolatedString("/"), mount.Path; e != g {
+		t.Errorf("mount.Path: expected '%v', got '%v'", e, g)
+	}
+
+	if e, g := InterpolatedString("s3"), mount.Type; e != g {
+		t.Errorf("mount.Type: expected '%v', got '%v'", e, g)
+	}
+
+	if mount.Options == nil {
+		t.Fatalf("mount.Options: expected options, got nil")
+	}
+
+	if e, g := "calli", mount.Options.Data["bucket"]; e != g {
+		t.Errorf("mount.Options.Data[\"bucket\"]: expected '%v', got '%v'", e, g)
+	}
+
+	// Both sections are ambiguous
+	raw += `
+mounts:
+  - path: /
+    type: local
+`
+
+	if err := Load(strings.NewReader(raw), NewDefaultConfig()); err == nil {
+		t.Errorf("expected an error when both the 'filesystem' and 'mounts' sections are given")
+	}
+}
@@ -0,0 +1,41 @@
+package config
+
+import (
+	"time"
+
+	"github.com/goccy/go-yaml"
+)
+
+type Trash struct {
+	Enabled       InterpolatedBool      `yaml:"enabled"`
+	Dir           InterpolatedString    `yaml:"dir"`
+	MaxAge        *InterpolatedDuration `yaml:"maxAge"`
+	PurgeInterval *InterpolatedDuration `yaml:"purgeInterval"`
+}
+
+func NewDefaultTrashConfig() Trash {
+	return Trash{
+		Enabled:       false,
+		Dir:           "/.trash",
+		MaxAge:        NewInterpolatedDuration(30 * 24 * time.Hour),
+		PurgeInterval: NewInterpolatedDuration(time.Hour),
+	}
+}
+
+func NewTrashConfigCommentMap() yaml.CommentMap {
+	return yaml.CommentMap{
+		"": []*yaml.Comment{yaml.HeadComment(" Trash of the removed files and directories")},
+		".enabled": []*yaml.Comment{
+			yaml.HeadComment(" Move the resources removed by the users to their trash instead of deleting them"),
+		},
+		".dir": []*yaml.Comment{
+			yaml.HeadComment(" Directory of the trash in each mount, hidden from the clients"),
+		},
+		".maxAge": []*yaml.Comment{
+			yaml.HeadComment(" Duration the removed resources are kept in the trash for, forever if 0"),
+		},
+		".purgeInterval": []*yaml.Comment{
+			yaml.HeadComment(" Interval between the deletion of the expired resources"),
+		},
+	}
+}
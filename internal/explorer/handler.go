@@ -7,6 +7,7 @@ import (
 
 	"github.com/bornholm/calli/internal/authz"
 	"github.com/bornholm/calli/internal/store"
+	"github.com/bornholm/calli/internal/trash"
 	"github.com/bornholm/calli/pkg/log"
 	"github.com/pkg/errors"
 	"golang.org/x/net/webdav"
@@ -17,6 +18,7 @@ type Handler struct {
 	fs      webdav.FileSystem
 	mux     *http.ServeMux
 	store   *store.Store
+	trash   *trash.FileSystem
 }
 
 // ServeHTTP implements http.Handler.
@@ -24,17 +26,28 @@ func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	h.mux.ServeHTTP(w, r)
 }
 
-func NewHandler(baseURL string, fs webdav.FileSystem, store *store.Store) *Handler {
+// NewHandler returns the file explorer's handler, the
+// trash pages being disabled if trash is nil
+func NewHandler(baseURL string, fs webdav.FileSystem, store *store.Store, trash *trash.FileSystem) *Handler {
 	handler := &Handler{
 		baseURL: baseURL,
 		fs:      fs,
 		mux:     &http.ServeMux{},
 		store:   store,
+		trash:   trash,
 	}
 
 	// Register routes
 	handler.mux.HandleFunc("GET /", handler.serveIndex)
 	handler.mux.HandleFunc("POST /actions/regenerate-password", handler.regeneratePassword)
+	handler.mux.HandleFunc("POST /actions/restore-version", handler.restoreVersion)
+
+	if trash != nil {
+		handler.mux.HandleFunc("GET /actions/trash", handler.serveTrash)
+		handler.mux.HandleFunc("POST /actions/trash/restore", handler.restoreTrashEntry)
+		handler.mux.HandleFunc("POST /actions/trash/empty", handler.emptyTrash)
+	}
+
 	return handler
 }
 
@@ -8,7 +8,6 @@ import (
 	"net/url"
 	"os"
 	"path"
-	"path/filepath"
 	"sort"
 	"strings"
 
@@ -32,6 +31,18 @@ func (h *Handler) serveIndex(w http.ResponseWriter, r *http.Request) {
 
 	ctx := r.Context()
 
+	query := r.URL.Query()
+
+	if query.Has("versions") {
+		h.serveVersions(w, r, fsPath)
+		return
+	}
+
+	if query.Has("removed") {
+		h.serveRemoved(w, r, fsPath)
+		return
+	}
+
 	// Open the directory
 	dirFile, err := h.fs.OpenFile(ctx, fsPath, os.O_RDONLY, 0)
 	if err != nil {
@@ -69,27 +80,85 @@ func (h *Handler) serveIndex(w http.ResponseWriter, r *http.Request) {
 	// Get explorer data for the directory
 	data := h.getExplorerData(ctx, fsPath, dirFile, fileInfo)
 
+	h.renderIndex(w, r, data)
+}
+
+// renderIndex renders the explorer's page with the
+// flash and error messages of the query parameters
+func (h *Handler) renderIndex(w http.ResponseWriter, r *http.Request, data FileExplorerTemplateData) {
+	query := r.URL.Query()
+
 	// Check for flash message in query parameters
-	if flashMsg := r.URL.Query().Get("flash"); flashMsg != "" {
+	if flashMsg := query.Get("flash"); flashMsg != "" {
 		data.FlashMessage = flashMsg
 	}
 
+	if errorMsg := query.Get("error"); errorMsg != "" {
+		data.ErrorMessage = errorMsg
+	}
+
 	// Render the full template
 	if err := templates.ExecuteTemplate(w, "index", data); err != nil {
-		slog.ErrorContext(ctx, "could not execute template", log.Error(errors.WithStack(err)))
+		slog.ErrorContext(r.Context(), "could not execute template", log.Error(errors.WithStack(err)))
 		return
 	}
 }
 
 // getExplorerData retrieves directory contents and creates template data
 func (h *Handler) getExplorerData(ctx context.Context, fsPath string, dirFile webdav.File, fileInfo fs.FileInfo) FileExplorerTemplateData {
+	data := h.newExplorerData(ctx)
+
+	// List directory contents
+	files, err := dirFile.Readdir(-1)
+	if err != nil {
+		slog.ErrorContext(ctx, "could not read directory", log.Error(errors.WithStack(err)), slog.String("path", fsPath))
+		return data
+	}
+
+	// Create template data
+	dirs := []FileTemplateData{}
+	regularFiles := []FileTemplateData{}
+
+	for _, file := range files {
+		// Skip hidden files
+		if strings.HasPrefix(file.Name(), ".") {
+			continue
+		}
+
+		fileData := NewFileTemplateData(file, fsPath)
+
+		if file.IsDir() {
+			dirs = append(dirs, fileData)
+		} else {
+			regularFiles = append(regularFiles, fileData)
+		}
+	}
+
+	// Sort directories and files alphabetically
+	sort.Slice(dirs, func(i, j int) bool {
+		return dirs[i].Name < dirs[j].Name
+	})
+	sort.Slice(regularFiles, func(i, j int) bool {
+		return regularFiles[i].Name < regularFiles[j].Name
+	})
+
+	data.setPath(fsPath)
+	data.Directories = dirs
+	data.Files = regularFiles
+
+	return data
+}
+
+// newExplorerData creates the template data common to the explorer's
+// pages, describing the context's user
+func (h *Handler) newExplorerData(ctx context.Context) FileExplorerTemplateData {
 	// Default to empty data structure
 	data := FileExplorerTemplateData{
 		NavbarTemplateData: ui.NavbarTemplateData{
 			NavbarItems: []ui.NavbarItem{ui.NavbarItemLogout},
 			Username:    "",
 		},
-		Path:            fileInfo.Name(),
+		Path:            "/",
 		ParentPath:      "/",
 		BreadcrumbItems: []string{},
 		Directories:     []FileTemplateData{},
@@ -113,6 +182,15 @@ func (h *Handler) getExplorerData(ctx context.Context, fsPath string, dirFile we
 				data.Username = "User"
 			}
 
+			if h.trash != nil {
+				data.NavbarItems = append([]ui.NavbarItem{{
+					Label:    "Trash",
+					URL:      "/actions/trash",
+					Icon:     "fa-trash-can",
+					Position: "left",
+				}}, data.NavbarItems...)
+			}
+
 			if data.IsAdmin {
 				// Add admin panel menu item (only visible to admins)
 				data.NavbarItems = append([]ui.NavbarItem{{
@@ -136,65 +214,5 @@ func (h *Handler) getExplorerData(ctx context.Context, fsPath string, dirFile we
 		}
 	}
 
-	// List directory contents
-	files, err := dirFile.Readdir(-1)
-	if err != nil {
-		slog.ErrorContext(ctx, "could not read directory", log.Error(errors.WithStack(err)), slog.String("path", fsPath))
-		return data
-	}
-
-	// Create template data
-	dirs := []FileTemplateData{}
-	regularFiles := []FileTemplateData{}
-
-	for _, file := range files {
-		// Skip hidden files
-		if strings.HasPrefix(file.Name(), ".") {
-			continue
-		}
-
-		fileData := NewFileTemplateData(file, fsPath)
-
-		if file.IsDir() {
-			dirs = append(dirs, fileData)
-		} else {
-			regularFiles = append(regularFiles, fileData)
-		}
-	}
-
-	// Sort directories and files alphabetically
-	sort.Slice(dirs, func(i, j int) bool {
-		return dirs[i].Name < dirs[j].Name
-	})
-	sort.Slice(regularFiles, func(i, j int) bool {
-		return regularFiles[i].Name < regularFiles[j].Name
-	})
-
-	// Calculate parent path for navigation
-	parentPath := "/"
-	if fsPath != "/" {
-		parentPath = filepath.Dir(fsPath)
-		if parentPath == "." {
-			parentPath = "/"
-		}
-	}
-
-	// Generate breadcrumb items
-	breadcrumbs := []string{}
-	if fsPath != "/" {
-		parts := strings.Split(strings.Trim(fsPath, "/"), "/")
-		currentPath := ""
-		for _, part := range parts {
-			currentPath = path.Join(currentPath, part)
-			breadcrumbs = append(breadcrumbs, part)
-		}
-	}
-
-	data.BreadcrumbItems = breadcrumbs
-	data.Path = fsPath
-	data.Directories = dirs
-	data.Files = regularFiles
-	data.ParentPath = parentPath
-
 	return data
 }
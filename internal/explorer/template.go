@@ -58,6 +58,61 @@ type FileExplorerTemplateData struct {
 	Username        string
 	WebDAVURL       string
 	FlashMessage    string
+	ErrorMessage    string
+	// Revisions of the file or removed directory at Path, if displayed
+	ShowVersions bool
+	Versions     []VersionTemplateData
+	// Resources removed from the directory at Path, if displayed
+	ShowRemoved bool
+	Removed     []string
+	// Entries of the user's trash, if displayed
+	ShowTrash    bool
+	TrashEntries []TrashEntryTemplateData
+}
+
+// TrashEntryTemplateData contains information about a trash entry to be
+// displayed in the file explorer
+type TrashEntryTemplateData struct {
+	ID        int64
+	Path      string
+	HumanSize string
+	IsDir     bool
+	DeletedAt time.Time
+	// Conflict is true if the entry could not be restored to
+	// its original path, SuggestedPath being proposed instead
+	Conflict      bool
+	SuggestedPath string
+}
+
+// VersionTemplateData contains information about a revision to be displayed
+// in the file explorer
+type VersionTemplateData struct {
+	ID        string
+	Time      time.Time
+	HumanSize string
+	IsDir     bool
+}
+
+// setPath sets the displayed path, its parent and breadcrumb items
+func (d *FileExplorerTemplateData) setPath(fsPath string) {
+	// Calculate parent path for navigation
+	parentPath := "/"
+	if fsPath != "/" {
+		parentPath = filepath.Dir(fsPath)
+		if parentPath == "." {
+			parentPath = "/"
+		}
+	}
+
+	// Generate breadcrumb items
+	breadcrumbs := []string{}
+	if fsPath != "/" {
+		breadcrumbs = strings.Split(strings.Trim(fsPath, "/"), "/")
+	}
+
+	d.BreadcrumbItems = breadcrumbs
+	d.Path = fsPath
+	d.ParentPath = parentPath
 }
 
 // NewFileTemplateData creates a new file data structure from an os.FileInfo
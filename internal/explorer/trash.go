@@ -0,0 +1,123 @@
+package explorer
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/bornholm/calli/internal/trash"
+	"github.com/bornholm/calli/internal/ui"
+	"github.com/bornholm/calli/pkg/log"
+	"github.com/dustin/go-humanize"
+	"github.com/pkg/errors"
+)
+
+// serveTrash lists the entries of the user's trash
+func (h *Handler) serveTrash(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	entries, err := h.trash.Entries(ctx)
+	if err != nil {
+		slog.ErrorContext(ctx, "could not list trash entries", log.Error(errors.WithStack(err)))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	conflict, _ := strconv.ParseInt(r.URL.Query().Get("conflict"), 10, 64)
+
+	data := h.newExplorerData(ctx)
+	data.HeadTemplateData = ui.HeadTemplateData{PageTitle: "Trash"}
+	data.ShowTrash = true
+	data.TrashEntries = make([]TrashEntryTemplateData, 0, len(entries))
+
+	for _, e := range entries {
+		entryData := TrashEntryTemplateData{
+			ID:        e.ID,
+			Path:      e.Path,
+			HumanSize: humanize.Bytes(uint64(e.Size)),
+			IsDir:     e.IsDir,
+			DeletedAt: e.DeletedAt,
+		}
+
+		if e.ID == conflict {
+			entryData.Conflict = true
+			entryData.SuggestedPath = suggestPath(e.Path)
+		}
+
+		data.TrashEntries = append(data.TrashEntries, entryData)
+	}
+
+	h.renderIndex(w, r, data)
+}
+
+// restoreTrashEntry handles the trash entries restoration requests
+func (h *Handler) restoreTrashEntry(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	id, err := strconv.ParseInt(r.FormValue("id"), 10, 64)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	name := r.FormValue("path")
+
+	query := url.Values{}
+
+	err = h.trash.Restore(ctx, id, name)
+	switch {
+	case err == nil:
+		query.Set("flash", "Removed resource restored.")
+	case errors.Is(err, trash.ErrNotFound):
+		http.NotFound(w, r)
+		return
+	case errors.Is(err, trash.ErrConflict):
+		query.Set("error", "A resource with the same name already exists, choose another path.")
+		query.Set("conflict", strconv.FormatInt(id, 10))
+	case errors.Is(err, os.ErrNotExist):
+		query.Set("error", "The parent directory does not exist anymore, choose another path.")
+		query.Set("conflict", strconv.FormatInt(id, 10))
+	case errors.Is(err, os.ErrPermission):
+		query.Set("error", "You are not allowed to restore this resource there.")
+		query.Set("conflict", strconv.FormatInt(id, 10))
+	default:
+		slog.ErrorContext(ctx, "could not restore trash entry", log.Error(errors.WithStack(err)), slog.Int64("id", id))
+		query.Set("error", "The resource could not be restored.")
+	}
+
+	http.Redirect(w, r, "/actions/trash?"+query.Encode(), http.StatusFound)
+}
+
+// emptyTrash handles the requests to empty the user's trash
+func (h *Handler) emptyTrash(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	query := url.Values{}
+
+	if err := h.trash.Empty(ctx); err != nil {
+		slog.ErrorContext(ctx, "could not empty trash", log.Error(errors.WithStack(err)))
+		query.Set("error", "The trash could not be emptied.")
+	} else {
+		query.Set("flash", "Trash emptied.")
+	}
+
+	http.Redirect(w, r, "/actions/trash?"+query.Encode(), http.StatusFound)
+}
+
+// suggestPath returns an alternative path to restore
+// the resource removed from the given path to
+func suggestPath(name string) string {
+	ext := path.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+
+	return base + " (restored)" + ext
+}
@@ -0,0 +1,121 @@
+package explorer
+
+import (
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+
+	"github.com/bornholm/calli/internal/ui"
+	"github.com/bornholm/calli/pkg/log"
+	"github.com/bornholm/calli/pkg/webdav/filesystem/versioned"
+	"github.com/dustin/go-humanize"
+	"github.com/pkg/errors"
+)
+
+// serveVersions lists the revisions of a file, or of a removed directory
+func (h *Handler) serveVersions(w http.ResponseWriter, r *http.Request, fsPath string) {
+	ctx := r.Context()
+
+	if fsPath == "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	versions, err := versioned.Versions(ctx, h.fs, fsPath)
+	if err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		slog.ErrorContext(ctx, "could not list versions", log.Error(errors.WithStack(err)), slog.String("path", fsPath))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	data := h.newExplorerData(ctx)
+	data.HeadTemplateData = ui.HeadTemplateData{PageTitle: "Revisions of " + path.Base(fsPath)}
+	data.setPath(fsPath)
+	data.ShowVersions = true
+	data.Versions = make([]VersionTemplateData, 0, len(versions))
+
+	for _, v := range versions {
+		data.Versions = append(data.Versions, VersionTemplateData{
+			ID:        v.ID,
+			Time:      v.Time,
+			HumanSize: humanize.Bytes(uint64(v.Size)),
+			IsDir:     v.IsDir,
+		})
+	}
+
+	h.renderIndex(w, r, data)
+}
+
+// serveRemoved lists the resources removed from a directory
+// which have revisions
+func (h *Handler) serveRemoved(w http.ResponseWriter, r *http.Request, fsPath string) {
+	ctx := r.Context()
+
+	removed, err := versioned.Removed(ctx, h.fs, fsPath)
+	if err != nil {
+		if errors.Is(err, os.ErrPermission) {
+			http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+			return
+		}
+
+		slog.ErrorContext(ctx, "could not list removed resources", log.Error(errors.WithStack(err)), slog.String("path", fsPath))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	data := h.newExplorerData(ctx)
+	data.setPath(fsPath)
+	data.ShowRemoved = true
+	data.Removed = removed
+
+	h.renderIndex(w, r, data)
+}
+
+// restoreVersion handles the revisions restoration requests
+func (h *Handler) restoreVersion(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	}
+
+	name := path.Clean("/" + r.FormValue("path"))
+	id := r.FormValue("version")
+
+	redirectURL := &url.URL{Path: name}
+	query := url.Values{}
+
+	err := versioned.Restore(ctx, h.fs, name, id)
+	switch {
+	case err == nil:
+		redirectURL.Path = path.Dir(name)
+		query.Set("flash", "Revision of '"+path.Base(name)+"' restored.")
+	case errors.Is(err, versioned.ErrInvalidVersion):
+		http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		return
+	case errors.Is(err, os.ErrPermission):
+		query.Set("error", "You are not allowed to restore this revision.")
+	case errors.Is(err, os.ErrExist):
+		query.Set("error", "A directory can not be restored over an existing resource.")
+	default:
+		slog.ErrorContext(ctx, "could not restore version", log.Error(errors.WithStack(err)), slog.String("path", name), slog.String("version", id))
+		query.Set("error", "The revision could not be restored.")
+	}
+
+	if err != nil {
+		// Back to the revisions
+		query.Set("versions", "")
+	}
+
+	redirectURL.RawQuery = query.Encode()
+
+	http.Redirect(w, r, redirectURL.String(), http.StatusFound)
+}
@@ -0,0 +1,32 @@
+package metrics
+
+import (
+	"context"
+
+	"github.com/bornholm/calli/internal/authz"
+)
+
+const (
+	decisionAllow = "allow"
+	decisionDeny  = "deny"
+	decisionError = "error"
+)
+
+// HandleDecision counts the authorization decisions.
+// It should be registered as a decision handler of the authz.FileSystem.
+func (m *Metrics) HandleDecision(ctx context.Context, decision *authz.Decision) {
+	var label string
+
+	switch {
+	case decision.Err() != nil:
+		label = decisionError
+	case decision.Allowed():
+		label = decisionAllow
+	default:
+		label = decisionDeny
+	}
+
+	m.authzDecisions.WithLabelValues(string(decision.Operation), label).Inc()
+}
+
+var _ authz.DecisionHandler = (&Metrics{}).HandleDecision
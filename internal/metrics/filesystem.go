@@ -0,0 +1,136 @@
+package metrics
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/bornholm/calli/internal/authz"
+	"github.com/bornholm/calli/pkg/webdav/filesystem"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/net/webdav"
+)
+
+const (
+	statusOK       = "ok"
+	statusNotFound = "not_found"
+	statusError    = "error"
+)
+
+// SizedFileSystem is implemented by the filesystems limiting their size,
+// i.e. the capped filesystem
+type SizedFileSystem interface {
+	Size() int64
+	MaxSize() int64
+	Evictions() uint64
+}
+
+// FileSystem records the operations duration of its backend
+type FileSystem struct {
+	backend  webdav.FileSystem
+	duration prometheus.ObserverVec
+}
+
+// Mkdir implements webdav.FileSystem.
+func (fs *FileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	start := time.Now()
+	err := fs.backend.Mkdir(ctx, name, perm)
+	fs.observe(authz.OperationMkdir, start, err)
+	return err
+}
+
+// OpenFile implements webdav.FileSystem.
+func (fs *FileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	start := time.Now()
+	file, err := fs.backend.OpenFile(ctx, name, flag, perm)
+	fs.observe(authz.OperationOpen, start, err)
+	return file, err
+}
+
+// RemoveAll implements webdav.FileSystem.
+func (fs *FileSystem) RemoveAll(ctx context.Context, name string) error {
+	start := time.Now()
+	err := fs.backend.RemoveAll(ctx, name)
+	fs.observe(authz.OperationRemove, start, err)
+	return err
+}
+
+// Rename implements webdav.FileSystem.
+func (fs *FileSystem) Rename(ctx context.Context, oldName string, newName string) error {
+	start := time.Now()
+	err := fs.backend.Rename(ctx, oldName, newName)
+	fs.observe(authz.OperationRename, start, err)
+	return err
+}
+
+// Stat implements webdav.FileSystem.
+func (fs *FileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	start := time.Now()
+	info, err := fs.backend.Stat(ctx, name)
+	fs.observe(authz.OperationStat, start, err)
+	return info, err
+}
+
+func (fs *FileSystem) observe(operation string, start time.Time, err error) {
+	status := statusOK
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		status = statusNotFound
+	case err != nil:
+		status = statusError
+	}
+
+	fs.duration.WithLabelValues(operation, status).Observe(time.Since(start).Seconds())
+}
+
+var _ webdav.FileSystem = &FileSystem{}
+
+// Decorate wraps the filesystem to record its operations duration and,
+// if it implements SizedFileSystem, exposes its size and evictions.
+// It should be registered with filesystem.Decorate.
+func (m *Metrics) Decorate(fsType filesystem.Type, fs webdav.FileSystem) webdav.FileSystem {
+	if sized, ok := fs.(SizedFileSystem); ok {
+		m.registerSizedFileSystem(fsType, sized)
+	}
+
+	return &FileSystem{
+		backend:  fs,
+		duration: m.filesystemOperationDuration.MustCurryWith(prometheus.Labels{"type": string(fsType)}),
+	}
+}
+
+var _ filesystem.Decorator = (&Metrics{}).Decorate
+
+func (m *Metrics) registerSizedFileSystem(fsType filesystem.Type, fs SizedFileSystem) {
+	labels := prometheus.Labels{
+		"type": string(fsType),
+		// Filesystems are numbered in their creation order
+		"id": strconv.FormatInt(m.sizedFileSystems.Add(1)-1, 10),
+	}
+
+	m.registry.MustRegister(
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   "filesystem",
+			Name:        "size_bytes",
+			Help:        "Current size of the size limited filesystems.",
+			ConstLabels: labels,
+		}, func() float64 { return float64(fs.Size()) }),
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace:   namespace,
+			Subsystem:   "filesystem",
+			Name:        "max_size_bytes",
+			Help:        "Maximum size of the size limited filesystems.",
+			ConstLabels: labels,
+		}, func() float64 { return float64(fs.MaxSize()) }),
+		prometheus.NewCounterFunc(prometheus.CounterOpts{
+			Namespace:   namespace,
+			Subsystem:   "filesystem",
+			Name:        "evictions_total",
+			Help:        "Number of files deleted to respect the size limit of the size limited filesystems.",
+			ConstLabels: labels,
+		}, func() float64 { return float64(fs.Evictions()) }),
+	)
+}
@@ -0,0 +1,106 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Middleware records the requests count, duration and transferred bytes
+func (m *Metrics) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		body := &countingReader{ReadCloser: r.Body}
+		if r.Body != nil {
+			r.Body = body
+		}
+
+		rw := &responseWriter{ResponseWriter: w, status: http.StatusOK}
+
+		next.ServeHTTP(rw, r)
+
+		method := methodLabel(r.Method)
+
+		m.httpRequests.WithLabelValues(method, strconv.Itoa(rw.status)).Inc()
+		m.httpRequestDuration.WithLabelValues(method).Observe(time.Since(start).Seconds())
+		m.httpBytesIn.WithLabelValues(method).Add(float64(body.read))
+		m.httpBytesOut.WithLabelValues(method).Add(float64(rw.written))
+	})
+}
+
+// methodOther is the label of the methods not known by the server
+const methodOther = "other"
+
+// knownMethods are the HTTP and WebDAV methods labelled by their name,
+// the clients being able to send any method
+var knownMethods = map[string]struct{}{
+	http.MethodGet:     {},
+	http.MethodHead:    {},
+	http.MethodPost:    {},
+	http.MethodPut:     {},
+	http.MethodPatch:   {},
+	http.MethodDelete:  {},
+	http.MethodOptions: {},
+	"PROPFIND":         {},
+	"PROPPATCH":        {},
+	"MKCOL":            {},
+	"COPY":             {},
+	"MOVE":             {},
+	"LOCK":             {},
+	"UNLOCK":           {},
+}
+
+func methodLabel(method string) string {
+	if _, known := knownMethods[method]; known {
+		return method
+	}
+
+	return methodOther
+}
+
+type countingReader struct {
+	io.ReadCloser
+	read int64
+}
+
+// Read implements io.Reader.
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.read += int64(n)
+	return n, err
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	status      int
+	written     int64
+	wroteHeader bool
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (w *responseWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status = status
+		w.wroteHeader = true
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write implements http.ResponseWriter.
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+
+	n, err := w.ResponseWriter.Write(b)
+	w.written += int64(n)
+	return n, err
+}
+
+// Unwrap allows the http.ResponseController to access the original writer
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+var _ http.ResponseWriter = &responseWriter{}
@@ -0,0 +1,105 @@
+package metrics
+
+import (
+	"net/http"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "calli"
+
+// Metrics collects the server's metrics and exposes them
+// in the Prometheus text format
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests        *prometheus.CounterVec
+	httpRequestDuration *prometheus.HistogramVec
+	httpBytesIn         *prometheus.CounterVec
+	httpBytesOut        *prometheus.CounterVec
+
+	filesystemOperationDuration *prometheus.HistogramVec
+
+	// Number of decorated filesystems exposing their size,
+	// used to identify them
+	sizedFileSystems atomic.Int64
+
+	rateLimited    prometheus.Counter
+	authzDecisions *prometheus.CounterVec
+}
+
+// Handler returns the HTTP handler exposing the metrics
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{
+		Registry: m.registry,
+	})
+}
+
+func New() *Metrics {
+	registry := prometheus.NewRegistry()
+
+	m := &Metrics{
+		registry: registry,
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "requests_total",
+			Help:      "Number of WebDAV requests, by method and status code.",
+		}, []string{"method", "code"}),
+		httpRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "request_duration_seconds",
+			Help:      "Duration of the WebDAV requests, by method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method"}),
+		httpBytesIn: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "request_bytes_total",
+			Help:      "Number of bytes read from the WebDAV requests bodies, by method.",
+		}, []string{"method"}),
+		httpBytesOut: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "http",
+			Name:      "response_bytes_total",
+			Help:      "Number of bytes written in the WebDAV responses bodies, by method.",
+		}, []string{"method"}),
+		filesystemOperationDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "filesystem",
+			Name:      "operation_duration_seconds",
+			Help:      "Duration of the filesystems operations, by filesystem type, operation and status.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"type", "operation", "status"}),
+		rateLimited: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "ratelimit",
+			Name:      "rejected_requests_total",
+			Help:      "Number of requests rejected by the rate limiter.",
+		}),
+		authzDecisions: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "authz",
+			Name:      "decisions_total",
+			Help:      "Number of authorization decisions, by operation and decision (allow, deny or error).",
+		}, []string{"operation", "decision"}),
+	}
+
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.httpRequestDuration,
+		m.httpBytesIn,
+		m.httpBytesOut,
+		m.filesystemOperationDuration,
+		m.rateLimited,
+		m.authzDecisions,
+	)
+
+	return m
+}
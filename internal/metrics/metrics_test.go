@@ -0,0 +1,87 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/bornholm/calli/internal/authz"
+	"github.com/bornholm/calli/internal/store"
+	"github.com/bornholm/calli/pkg/webdav/filesystem/capped"
+	"github.com/pkg/errors"
+	"golang.org/x/net/webdav"
+)
+
+func TestMetrics(t *testing.T) {
+	m := New()
+
+	backend := m.Decorate("capped", capped.NewFileSystem(webdav.NewMemFS(), 1024))
+
+	user := &store.User{ID: 1, Subject: "jdoe", Provider: "test"}
+	user.SetGroups(&store.Group{
+		Name:  "writers",
+		Rules: []*store.Rule{{Script: `operation == OP_STAT || operation == OP_OPEN`}},
+	})
+
+	fs := authz.NewFileSystem(backend, authz.WithDecisionHandlers(m.HandleDecision))
+
+	handler := m.Middleware(&webdav.Handler{
+		FileSystem: fs,
+		LockSystem: webdav.NewMemLS(),
+	})
+
+	ctx := authz.WithContextUser(context.Background(), user)
+
+	requests := []*http.Request{
+		httptest.NewRequestWithContext(ctx, http.MethodPut, "/hello.txt", strings.NewReader("hello world")),
+		httptest.NewRequestWithContext(ctx, http.MethodGet, "/hello.txt", nil),
+		httptest.NewRequestWithContext(ctx, "MKCOL", "/private", nil),
+		httptest.NewRequestWithContext(ctx, "RANDOM-1234", "/", nil),
+	}
+
+	for _, req := range requests {
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	if _, err := backend.Stat(ctx, "/missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("stat: expected '%v', got '%v'", os.ErrNotExist, err)
+	}
+
+	m.HandleRejected(httptest.NewRequest(http.MethodGet, "/", nil), "test-jdoe")
+
+	res := httptest.NewRecorder()
+	m.Handler().ServeHTTP(res, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	expected := []string{
+		`calli_http_requests_total{code="201",method="PUT"} 1`,
+		`calli_http_requests_total{code="200",method="GET"} 1`,
+		`calli_http_request_bytes_total{method="PUT"} 11`,
+		`calli_http_response_bytes_total{method="GET"} 11`,
+		`calli_http_request_duration_seconds_count{method="MKCOL"} 1`,
+		`calli_http_request_duration_seconds_count{method="other"} 1`,
+		`calli_authz_decisions_total{decision="deny",operation="mkdir"} 1`,
+		`calli_filesystem_operation_duration_seconds_count{operation="stat",status="not_found",type="capped"} 1`,
+		`calli_filesystem_size_bytes{id="0",type="capped"} 11`,
+		`calli_filesystem_evictions_total{id="0",type="capped"} 0`,
+		`calli_ratelimit_rejected_requests_total 1`,
+	}
+
+	for _, e := range expected {
+		if !strings.Contains(string(body), e) {
+			t.Errorf("expected metrics to contain '%s'", e)
+		}
+	}
+
+	if t.Failed() {
+		t.Logf("metrics:\n%s", body)
+	}
+}
@@ -0,0 +1,15 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/bornholm/calli/internal/ratelimit"
+)
+
+// HandleRejected counts the requests rejected by the rate limiter.
+// It should be registered as a rejected handler of the ratelimit.RateLimiter.
+func (m *Metrics) HandleRejected(r *http.Request, userKey string) {
+	m.rateLimited.Inc()
+}
+
+var _ ratelimit.RejectedHandler = (&Metrics{}).HandleRejected
@@ -0,0 +1,141 @@
+package quota
+
+import (
+	"context"
+	"encoding/xml"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+
+	"github.com/bornholm/calli/pkg/log"
+	"github.com/bornholm/calli/pkg/webdav/filesystem"
+	"github.com/pkg/errors"
+	"golang.org/x/net/webdav"
+)
+
+// File rejects the writes exceeding the allowance computed at opening,
+// updates the usages once closed and reports the user's quota as
+// WebDAV properties
+type File struct {
+	webdav.File
+	fs   *FileSystem
+	ctx  context.Context
+	name string
+
+	write     bool
+	previous  int64 // Size of the file before its opening
+	size      int64 // Expected size of the file once written
+	offset    int64
+	allowance int64
+
+	closeOnce sync.Once
+}
+
+// Write implements webdav.File.
+func (f *File) Write(p []byte) (int, error) {
+	if end := f.offset + int64(len(p)); end > f.size && end-f.previous > f.allowance {
+		markExceeded(f.ctx)
+		return 0, errors.Wrapf(ErrExceeded, "could not write to '%s'", f.name)
+	}
+
+	n, err := f.File.Write(p)
+
+	f.offset += int64(n)
+	f.size = max(f.size, f.offset)
+
+	return n, err
+}
+
+// Seek implements webdav.File.
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	position, err := f.File.Seek(offset, whence)
+	if err != nil {
+		return position, err
+	}
+
+	f.offset = position
+
+	return position, nil
+}
+
+// Close implements webdav.File.
+func (f *File) Close() error {
+	err := f.File.Close()
+
+	if !f.write {
+		return err
+	}
+
+	f.closeOnce.Do(func() {
+		ctx := context.WithoutCancel(f.ctx)
+
+		info, statErr := f.fs.backend.Stat(ctx, f.name)
+		if statErr != nil {
+			if !errors.Is(statErr, os.ErrNotExist) {
+				slog.ErrorContext(ctx, "could not stat written file", log.Error(errors.WithStack(statErr)))
+			}
+
+			return
+		}
+
+		if info.IsDir() {
+			return
+		}
+
+		if trackErr := f.fs.track(ctx, f.name, info.Size()-f.previous); trackErr != nil {
+			slog.ErrorContext(ctx, "could not track quota usage", log.Error(errors.WithStack(trackErr)))
+		}
+	})
+
+	return err
+}
+
+// DeadProps implements webdav.DeadPropsHolder.
+func (f *File) DeadProps() (map[xml.Name]webdav.Property, error) {
+	props, err := filesystem.DeadProps(f.File)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	// As the other live properties of RFC 4331, the quota is
+	// only reported when requested by name
+	if !filesystem.PropRequested(f.ctx, PropQuotaUsedBytes) && !filesystem.PropRequested(f.ctx, PropQuotaAvailableBytes) {
+		return props, nil
+	}
+
+	limit, used, ok, err := f.fs.limit(f.ctx, f.name)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if !ok {
+		return props, nil
+	}
+
+	if props == nil {
+		props = make(map[xml.Name]webdav.Property)
+	}
+
+	props[PropQuotaUsedBytes] = webdav.Property{
+		XMLName:  PropQuotaUsedBytes,
+		InnerXML: []byte(strconv.FormatInt(used, 10)),
+	}
+
+	props[PropQuotaAvailableBytes] = webdav.Property{
+		XMLName:  PropQuotaAvailableBytes,
+		InnerXML: []byte(strconv.FormatInt(max(limit.Bytes-used, 0), 10)),
+	}
+
+	return props, nil
+}
+
+// Patch implements webdav.DeadPropsHolder.
+func (f *File) Patch(patches []webdav.Proppatch) ([]webdav.Propstat, error) {
+	return filesystem.PatchProtected(f.File, patches, PropQuotaAvailableBytes, PropQuotaUsedBytes)
+}
+
+var (
+	_ webdav.File            = &File{}
+	_ webdav.DeadPropsHolder = &File{}
+)
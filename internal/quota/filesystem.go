@@ -0,0 +1,381 @@
+package quota
+
+import (
+	"context"
+	"math"
+	"os"
+	"path"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/webdav"
+)
+
+// FileSystem enforces the limits of the context's user and tracks the
+// bytes used under the limited directories, whoever writes them. The usage
+// of a directory is computed from its content the first time it is needed.
+type FileSystem struct {
+	backend webdav.FileSystem
+	store   Store
+}
+
+// Mkdir implements webdav.FileSystem.
+func (f *FileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	return f.backend.Mkdir(ctx, name, perm)
+}
+
+// OpenFile implements webdav.FileSystem.
+func (f *FileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	name = clean(name)
+
+	write := flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC) != 0
+
+	var (
+		previous  int64
+		allowance int64 = math.MaxInt64
+	)
+
+	if write {
+		info, err := f.backend.Stat(ctx, name)
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+
+		if err == nil && !info.IsDir() {
+			previous = info.Size()
+		}
+
+		allowance, err = f.allowance(ctx, name, "")
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	file, err := f.backend.OpenFile(ctx, name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	quotaFile := &File{
+		File:      file,
+		fs:        f,
+		ctx:       ctx,
+		name:      name,
+		write:     write,
+		previous:  previous,
+		allowance: allowance,
+	}
+
+	if flag&os.O_TRUNC == 0 {
+		quotaFile.size = previous
+	}
+
+	return quotaFile, nil
+}
+
+// RemoveAll implements webdav.FileSystem.
+func (f *FileSystem) RemoveAll(ctx context.Context, name string) error {
+	name = clean(name)
+
+	usages, err := f.store.QuotaUsages(ctx)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	var containing, contained []string
+
+	for dir := range usages {
+		switch {
+		case inDir(dir, name):
+			contained = append(contained, dir)
+		case inDir(name, dir):
+			containing = append(containing, dir)
+		}
+	}
+
+	var size int64
+
+	if len(containing) > 0 {
+		size, err = f.size(ctx, name)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if err := f.backend.RemoveAll(ctx, name); err != nil {
+		return err
+	}
+
+	// The usages of the removed directories are computed again when needed
+	if err := f.store.DeleteQuotaUsages(ctx, contained...); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := f.store.AddQuotaUsage(ctx, -size, containing...); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Rename implements webdav.FileSystem.
+func (f *FileSystem) Rename(ctx context.Context, oldName string, newName string) error {
+	oldName = clean(oldName)
+	newName = clean(newName)
+
+	// Computing the allowance first tracks the limited directories
+	// the resource enters
+	allowance, err := f.allowance(ctx, newName, oldName)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	usages, err := f.store.QuotaUsages(ctx)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	var left, entered, moved []string
+
+	for dir := range usages {
+		switch {
+		case inDir(dir, oldName) || inDir(dir, newName):
+			moved = append(moved, dir)
+		case inDir(oldName, dir) && !inDir(newName, dir):
+			left = append(left, dir)
+		case inDir(newName, dir) && !inDir(oldName, dir):
+			entered = append(entered, dir)
+		}
+	}
+
+	var size int64
+
+	if len(left) > 0 || len(entered) > 0 || allowance != math.MaxInt64 {
+		size, err = f.size(ctx, oldName)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	if size > allowance {
+		markExceeded(ctx)
+		return errors.Wrapf(ErrExceeded, "could not move '%s' to '%s'", oldName, newName)
+	}
+
+	if err := f.backend.Rename(ctx, oldName, newName); err != nil {
+		return err
+	}
+
+	if err := f.store.DeleteQuotaUsages(ctx, moved...); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := f.store.AddQuotaUsage(ctx, -size, left...); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := f.store.AddQuotaUsage(ctx, size, entered...); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Stat implements webdav.FileSystem.
+func (f *FileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	return f.backend.Stat(ctx, name)
+}
+
+// allowance returns the bytes the user can still write to the named
+// resource, the limits also applying to the except resource being ignored
+func (f *FileSystem) allowance(ctx context.Context, name string, except string) (int64, error) {
+	allowance := int64(math.MaxInt64)
+
+	limits := contextLimits(ctx)
+	if len(limits) == 0 {
+		return allowance, nil
+	}
+
+	usages, err := f.store.QuotaUsages(ctx)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	for _, l := range limits {
+		dir := clean(l.Dir)
+
+		if !inDir(name, dir) || (except != "" && inDir(except, dir)) {
+			continue
+		}
+
+		used, err := f.usage(ctx, dir, usages)
+		if err != nil {
+			return 0, errors.WithStack(err)
+		}
+
+		allowance = min(allowance, max(l.Bytes-used, 0))
+	}
+
+	return allowance, nil
+}
+
+// limit returns the most specific limit of the user applying
+// to the named resource and the bytes used under its directory
+func (f *FileSystem) limit(ctx context.Context, name string) (Limit, int64, bool, error) {
+	var (
+		found Limit
+		ok    bool
+	)
+
+	for _, l := range contextLimits(ctx) {
+		l.Dir = clean(l.Dir)
+
+		if !inDir(name, l.Dir) {
+			continue
+		}
+
+		if !ok || len(l.Dir) > len(found.Dir) {
+			found, ok = l, true
+		}
+	}
+
+	if !ok {
+		return Limit{}, 0, false, nil
+	}
+
+	used, err := f.reportedUsage(ctx, found.Dir)
+	if err != nil {
+		return Limit{}, 0, false, errors.WithStack(err)
+	}
+
+	return found, used, true, nil
+}
+
+// reportedUsage returns the bytes used under the given directory, the
+// usages being loaded once per request if shared by the Middleware
+func (f *FileSystem) reportedUsage(ctx context.Context, dir string) (int64, error) {
+	reported := contextReportedUsages(ctx)
+	if reported == nil {
+		reported = &reportedUsages{}
+	}
+
+	reported.mutex.Lock()
+	defer reported.mutex.Unlock()
+
+	if reported.usages == nil {
+		usages, err := f.store.QuotaUsages(ctx)
+		if err != nil {
+			return 0, errors.WithStack(err)
+		}
+
+		reported.usages = usages
+	}
+
+	used, err := f.usage(ctx, dir, reported.usages)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	return used, nil
+}
+
+// usage returns the bytes used under the given directory, computing
+// and tracking them if the directory is not tracked yet
+func (f *FileSystem) usage(ctx context.Context, dir string, usages map[string]int64) (int64, error) {
+	if used, exists := usages[dir]; exists {
+		return used, nil
+	}
+
+	used, err := f.size(ctx, dir)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	if err := f.store.SetQuotaUsage(ctx, dir, used); err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	usages[dir] = used
+
+	return used, nil
+}
+
+// track adds the delta to the usages of the tracked
+// directories containing the named resource
+func (f *FileSystem) track(ctx context.Context, name string, delta int64) error {
+	if delta == 0 {
+		return nil
+	}
+
+	usages, err := f.store.QuotaUsages(ctx)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	dirs := make([]string, 0)
+	for dir := range usages {
+		if inDir(name, dir) {
+			dirs = append(dirs, dir)
+		}
+	}
+
+	if err := f.store.AddQuotaUsage(ctx, delta, dirs...); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// size returns the size of the named file, or of the
+// files under the named directory
+func (f *FileSystem) size(ctx context.Context, name string) (int64, error) {
+	info, err := f.backend.Stat(ctx, name)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+
+		return 0, errors.WithStack(err)
+	}
+
+	if !info.IsDir() {
+		return info.Size(), nil
+	}
+
+	dir, err := f.backend.OpenFile(ctx, name, os.O_RDONLY, 0)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	children, err := dir.Readdir(-1)
+	dir.Close()
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	var total int64
+
+	for _, child := range children {
+		if !child.IsDir() {
+			total += child.Size()
+			continue
+		}
+
+		size, err := f.size(ctx, path.Join(name, child.Name()))
+		if err != nil {
+			return 0, errors.WithStack(err)
+		}
+
+		total += size
+	}
+
+	return total, nil
+}
+
+func NewFileSystem(backend webdav.FileSystem, store Store) *FileSystem {
+	return &FileSystem{
+		backend: backend,
+		store:   store,
+	}
+}
+
+var _ webdav.FileSystem = &FileSystem{}
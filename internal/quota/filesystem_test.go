@@ -0,0 +1,290 @@
+package quota
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/bornholm/calli/internal/authz"
+	"github.com/bornholm/calli/pkg/webdav/filesystem"
+	"github.com/pkg/errors"
+	"golang.org/x/net/webdav"
+)
+
+type testUser struct {
+	limits []Limit
+}
+
+func (u *testUser) UserSubject() string              { return "jdoe" }
+func (u *testUser) UserProvider() string             { return "test" }
+func (u *testUser) FileSystemGroups() []*authz.Group { return nil }
+func (u *testUser) FileSystemRules() []authz.Rule    { return nil }
+func (u *testUser) QuotaLimits() []Limit             { return u.limits }
+
+var (
+	_ authz.User = &testUser{}
+	_ User       = &testUser{}
+)
+
+type testStore struct {
+	mutex   sync.Mutex
+	usages  map[string]int64
+	queries atomic.Int64
+}
+
+func (s *testStore) QuotaUsages(ctx context.Context) (map[string]int64, error) {
+	s.queries.Add(1)
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	usages := make(map[string]int64, len(s.usages))
+	for dir, used := range s.usages {
+		usages[dir] = used
+	}
+
+	return usages, nil
+}
+
+func (s *testStore) SetQuotaUsage(ctx context.Context, dir string, used int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.usages[dir] = used
+
+	return nil
+}
+
+func (s *testStore) AddQuotaUsage(ctx context.Context, delta int64, dirs ...string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, dir := range dirs {
+		if _, exists := s.usages[dir]; exists {
+			s.usages[dir] = max(s.usages[dir]+delta, 0)
+		}
+	}
+
+	return nil
+}
+
+func (s *testStore) DeleteQuotaUsages(ctx context.Context, dirs ...string) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, dir := range dirs {
+		delete(s.usages, dir)
+	}
+
+	return nil
+}
+
+func (s *testStore) usage(dir string) (int64, bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	used, exists := s.usages[dir]
+
+	return used, exists
+}
+
+var _ Store = &testStore{}
+
+func newTestFileSystem(t *testing.T) (*FileSystem, *testStore, context.Context) {
+	backend := webdav.NewMemFS()
+
+	for _, name := range []string{"/home", "/home/jdoe", "/shared"} {
+		if err := backend.Mkdir(context.Background(), name, os.ModePerm); err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+	}
+
+	store := &testStore{usages: map[string]int64{}}
+
+	user := &testUser{
+		limits: []Limit{
+			{Dir: "/home/jdoe", Bytes: 10},
+		},
+	}
+
+	return NewFileSystem(backend, store), store, authz.WithContextUser(context.Background(), user)
+}
+
+func writeFile(ctx context.Context, fs webdav.FileSystem, name string, data string) error {
+	file, err := fs.OpenFile(ctx, name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if _, err := file.Write([]byte(data)); err != nil {
+		file.Close()
+		return errors.WithStack(err)
+	}
+
+	return errors.WithStack(file.Close())
+}
+
+func TestFileSystemWrite(t *testing.T) {
+	fs, store, ctx := newTestFileSystem(t)
+
+	if err := writeFile(ctx, fs, "/home/jdoe/a.txt", "123456"); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if used, _ := store.usage("/home/jdoe"); used != 6 {
+		t.Errorf("usage: expected 6, got %d", used)
+	}
+
+	if err := writeFile(ctx, fs, "/home/jdoe/b.txt", "123456"); !errors.Is(err, ErrExceeded) {
+		t.Errorf("expected ErrExceeded, got %v", err)
+	}
+
+	// Overwriting a file only counts the difference
+	if err := writeFile(ctx, fs, "/home/jdoe/a.txt", "1234567890"); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if used, _ := store.usage("/home/jdoe"); used != 10 {
+		t.Errorf("usage: expected 10, got %d", used)
+	}
+
+	// Writes outside of the limited directory are not restricted
+	if err := writeFile(ctx, fs, "/shared/c.txt", "123456789012"); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+}
+
+func TestFileSystemRenameRemove(t *testing.T) {
+	fs, store, ctx := newTestFileSystem(t)
+
+	if err := writeFile(ctx, fs, "/shared/a.txt", "12345678"); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if err := writeFile(ctx, fs, "/shared/b.txt", "1234"); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if err := fs.Rename(ctx, "/shared/a.txt", "/home/jdoe/a.txt"); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if used, _ := store.usage("/home/jdoe"); used != 8 {
+		t.Errorf("usage: expected 8, got %d", used)
+	}
+
+	if err := fs.Rename(ctx, "/shared/b.txt", "/home/jdoe/b.txt"); !errors.Is(err, ErrExceeded) {
+		t.Errorf("expected ErrExceeded, got %v", err)
+	}
+
+	if err := fs.RemoveAll(ctx, "/home/jdoe/a.txt"); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if used, _ := store.usage("/home/jdoe"); used != 0 {
+		t.Errorf("usage: expected 0, got %d", used)
+	}
+
+	if err := fs.RemoveAll(ctx, "/home"); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if _, exists := store.usage("/home/jdoe"); exists {
+		t.Errorf("usage of '/home/jdoe' should not be tracked anymore")
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	fs, _, ctx := newTestFileSystem(t)
+
+	handler := Middleware(&webdav.Handler{
+		FileSystem: fs,
+		LockSystem: webdav.NewMemLS(),
+	})
+
+	serve := func(method string, target string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body)).WithContext(ctx)
+		res := httptest.NewRecorder()
+
+		handler.ServeHTTP(res, req)
+
+		return res
+	}
+
+	if res := serve(http.MethodPut, "/home/jdoe/a.txt", "1234"); res.Code != http.StatusCreated {
+		t.Fatalf("PUT: expected status %d, got %d", http.StatusCreated, res.Code)
+	}
+
+	if res := serve(http.MethodPut, "/home/jdoe/b.txt", "12345678"); res.Code != http.StatusInsufficientStorage {
+		t.Errorf("PUT: expected status %d, got %d", http.StatusInsufficientStorage, res.Code)
+	}
+
+	res := serve("PROPFIND", "/home/jdoe/a.txt", `<?xml version="1.0" encoding="utf-8"?>
+		<propfind xmlns="DAV:"><prop><quota-available-bytes/><quota-used-bytes/></prop></propfind>`)
+
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	for _, expected := range []string{"quota-used-bytes>4<", "quota-available-bytes>6<"} {
+		if !strings.Contains(string(body), expected) {
+			t.Errorf("PROPFIND: expected '%s' in %s", expected, body)
+		}
+	}
+}
+
+func TestPropfindUsages(t *testing.T) {
+	fs, store, ctx := newTestFileSystem(t)
+
+	handler := Middleware(filesystem.RequestedPropsMiddleware(&webdav.Handler{
+		FileSystem: fs,
+		LockSystem: webdav.NewMemLS(),
+	}))
+
+	serve := func(method string, target string, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body)).WithContext(ctx)
+		req.Header.Set("Depth", "1")
+
+		res := httptest.NewRecorder()
+
+		handler.ServeHTTP(res, req)
+
+		return res
+	}
+
+	for _, name := range []string{"a.txt", "b.txt", "c.txt"} {
+		if res := serve(http.MethodPut, "/home/jdoe/"+name, "12"); res.Code != http.StatusCreated {
+			t.Fatalf("PUT: expected status %d, got %d", http.StatusCreated, res.Code)
+		}
+	}
+
+	store.queries.Store(0)
+
+	// The usages are not queried if not requested
+	if res := serve("PROPFIND", "/home/jdoe", ""); res.Code != http.StatusMultiStatus {
+		t.Fatalf("PROPFIND: expected status %d, got %d", http.StatusMultiStatus, res.Code)
+	}
+
+	if e, g := int64(0), store.queries.Load(); e != g {
+		t.Errorf("queries: expected '%v', got '%v'", e, g)
+	}
+
+	res := serve("PROPFIND", "/home/jdoe", `<?xml version="1.0" encoding="utf-8"?>
+		<propfind xmlns="DAV:"><prop><quota-available-bytes/><quota-used-bytes/></prop></propfind>`)
+
+	if strings.Count(res.Body.String(), "quota-used-bytes>6<") != 4 {
+		t.Errorf("PROPFIND: expected the usage of each resource in %s", res.Body.String())
+	}
+
+	// The usages are queried once for all the listed resources
+	if e, g := int64(1), store.queries.Load(); e != g {
+		t.Errorf("queries: expected '%v', got '%v'", e, g)
+	}
+}
@@ -0,0 +1,102 @@
+package quota
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+type contextKey string
+
+const (
+	contextKeyExceeded contextKey = "quotaExceeded"
+	contextKeyUsages   contextKey = "quotaUsages"
+)
+
+// Middleware answers 507 Insufficient Storage to the requests failing
+// because of an exceeded quota, the WebDAV handler not being able to
+// tell them apart from the other failures. It also shares the usages
+// reported as properties during each request.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		exceeded := &atomic.Bool{}
+
+		rw := &responseWriter{ResponseWriter: w, exceeded: exceeded}
+
+		ctx := context.WithValue(r.Context(), contextKeyExceeded, exceeded)
+		ctx = context.WithValue(ctx, contextKeyUsages, &reportedUsages{})
+
+		next.ServeHTTP(rw, r.WithContext(ctx))
+	})
+}
+
+// reportedUsages keeps the usages reported during a request, the
+// store being queried once for all the resources of a listing
+type reportedUsages struct {
+	mutex  sync.Mutex
+	usages map[string]int64
+}
+
+func contextReportedUsages(ctx context.Context) *reportedUsages {
+	usages, _ := ctx.Value(contextKeyUsages).(*reportedUsages)
+	return usages
+}
+
+// markExceeded flags the request of the context as failing
+// because of an exceeded quota
+func markExceeded(ctx context.Context) {
+	exceeded, ok := ctx.Value(contextKeyExceeded).(*atomic.Bool)
+	if !ok {
+		return
+	}
+
+	exceeded.Store(true)
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	exceeded    *atomic.Bool
+	wroteHeader bool
+	replaced    bool
+}
+
+// WriteHeader implements http.ResponseWriter.
+func (w *responseWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	w.wroteHeader = true
+
+	if status < http.StatusBadRequest || !w.exceeded.Load() {
+		w.ResponseWriter.WriteHeader(status)
+		return
+	}
+
+	// The handler's body describes the replaced status
+	w.replaced = true
+
+	w.ResponseWriter.Header().Del("Content-Length")
+	w.ResponseWriter.WriteHeader(http.StatusInsufficientStorage)
+	w.ResponseWriter.Write([]byte(http.StatusText(http.StatusInsufficientStorage)))
+}
+
+// Write implements http.ResponseWriter.
+func (w *responseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+
+	if w.replaced {
+		return len(b), nil
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap allows the http.ResponseController to access the original writer
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+var _ http.ResponseWriter = &responseWriter{}
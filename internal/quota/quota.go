@@ -0,0 +1,73 @@
+package quota
+
+import (
+	"context"
+	"encoding/xml"
+	"path"
+	"strings"
+
+	"github.com/bornholm/calli/internal/authz"
+	"github.com/pkg/errors"
+)
+
+// ErrExceeded is returned by the operations which would exceed
+// one of the user's limits
+var ErrExceeded = errors.New("quota exceeded")
+
+// Quota properties, see RFC 4331
+var (
+	PropQuotaAvailableBytes = xml.Name{Space: "DAV:", Local: "quota-available-bytes"}
+	PropQuotaUsedBytes      = xml.Name{Space: "DAV:", Local: "quota-used-bytes"}
+)
+
+// Limit caps the size of the files under a directory
+type Limit struct {
+	Dir   string
+	Bytes int64
+}
+
+// User is implemented by the users whose writes are limited
+type User interface {
+	QuotaLimits() []Limit
+}
+
+// Store tracks the bytes used under the directories with limits
+type Store interface {
+	// QuotaUsages returns the bytes used under each tracked directory
+	QuotaUsages(ctx context.Context) (map[string]int64, error)
+	// SetQuotaUsage tracks the directory with the given usage
+	SetQuotaUsage(ctx context.Context, dir string, used int64) error
+	// AddQuotaUsage adds the delta to the usage of the given directories
+	AddQuotaUsage(ctx context.Context, delta int64, dirs ...string) error
+	// DeleteQuotaUsages stops tracking the given directories
+	DeleteQuotaUsages(ctx context.Context, dirs ...string) error
+}
+
+// contextLimits returns the limits of the context's user
+func contextLimits(ctx context.Context) []Limit {
+	user, err := authz.ContextUser(ctx)
+	if err != nil {
+		return nil
+	}
+
+	limited, ok := user.(User)
+	if !ok {
+		return nil
+	}
+
+	return limited.QuotaLimits()
+}
+
+// inDir returns true if the named resource is the given directory
+// or one of its descendants
+func inDir(name string, dir string) bool {
+	if dir == "/" {
+		return true
+	}
+
+	return name == dir || strings.HasPrefix(name, dir+"/")
+}
+
+func clean(name string) string {
+	return path.Clean("/" + name)
+}
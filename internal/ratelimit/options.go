@@ -0,0 +1,31 @@
+package ratelimit
+
+import "net/http"
+
+// RejectedHandler is called with each request rejected by the rate limiter
+type RejectedHandler func(r *http.Request, userKey string)
+
+type Options struct {
+	RejectedHandlers []RejectedHandler
+}
+
+type OptionFunc func(opts *Options)
+
+func NewOptions(funcs ...OptionFunc) *Options {
+	opts := &Options{
+		RejectedHandlers: make([]RejectedHandler, 0),
+	}
+
+	for _, fn := range funcs {
+		fn(opts)
+	}
+
+	return opts
+}
+
+// WithRejectedHandlers appends handlers called with each rejected request
+func WithRejectedHandlers(handlers ...RejectedHandler) OptionFunc {
+	return func(opts *Options) {
+		opts.RejectedHandlers = append(opts.RejectedHandlers, handlers...)
+	}
+}
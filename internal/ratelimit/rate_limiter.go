@@ -14,6 +14,8 @@ type RateLimiter struct {
 	rate  rate.Limit
 	burst int
 	users syncx.Map[string, *rate.Limiter]
+
+	rejectedHandlers []RejectedHandler
 }
 
 type GetUserKeyFunc func(r *http.Request) (string, error)
@@ -32,6 +34,10 @@ func (l *RateLimiter) Middleware(getUserKey GetUserKeyFunc) func(next http.Handl
 			limiter, _ := l.users.LoadOrStore(userKey, rate.NewLimiter(l.rate, l.burst))
 
 			if !limiter.Allow() {
+				for _, h := range l.rejectedHandlers {
+					h(r, userKey)
+				}
+
 				http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
 				return
 			}
@@ -41,9 +47,12 @@ func (l *RateLimiter) Middleware(getUserKey GetUserKeyFunc) func(next http.Handl
 	}
 }
 
-func New(rate rate.Limit, burst int) *RateLimiter {
+func New(rate rate.Limit, burst int, funcs ...OptionFunc) *RateLimiter {
+	opts := NewOptions(funcs...)
+
 	return &RateLimiter{
-		rate:  rate,
-		burst: burst,
+		rate:             rate,
+		burst:            burst,
+		rejectedHandlers: opts.RejectedHandlers,
 	}
 }
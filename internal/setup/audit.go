@@ -0,0 +1,44 @@
+package setup
+
+import (
+	"context"
+
+	"github.com/bornholm/calli/internal/audit"
+	"github.com/bornholm/calli/internal/config"
+	"github.com/pkg/errors"
+)
+
+// NewAuditSinkFromConfig returns the configured audit sinks, or nil
+// if the audit trail is disabled
+var NewAuditSinkFromConfig = createFromConfigOnce(func(ctx context.Context, conf *config.Config) (audit.Sink, error) {
+	sinks := audit.MultiSink{}
+
+	if conf.Audit.Store {
+		st, err := NewStoreFromConfig(ctx, conf)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		sinks = append(sinks, audit.NewStoreSink(st))
+	}
+
+	if conf.Audit.File != "" {
+		fileSink, err := audit.NewFileSink(string(conf.Audit.File))
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not open audit file '%s'", conf.Audit.File)
+		}
+
+		go func() {
+			<-ctx.Done()
+			fileSink.Close()
+		}()
+
+		sinks = append(sinks, fileSink)
+	}
+
+	if len(sinks) == 0 {
+		return nil, nil
+	}
+
+	return sinks, nil
+})
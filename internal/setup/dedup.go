@@ -0,0 +1,20 @@
+package setup
+
+import (
+	"context"
+
+	"github.com/bornholm/calli/internal/config"
+	"github.com/bornholm/calli/pkg/webdav/filesystem"
+	"github.com/bornholm/calli/pkg/webdav/filesystem/dedup"
+)
+
+// NewDedupCollectorFromConfig returns the collector of the
+// deduplicated filesystems, reporting their stats
+var NewDedupCollectorFromConfig = createFromConfigOnce(func(ctx context.Context, conf *config.Config) (*dedup.Collector, error) {
+	c := dedup.NewCollector()
+
+	// Collect the deduplicated filesystems created from now on
+	filesystem.Decorate(c.Decorate)
+
+	return c, nil
+})
@@ -0,0 +1,13 @@
+package setup
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/bornholm/calli/internal/authz/denial"
+	"github.com/bornholm/calli/internal/config"
+)
+
+var NewDenialRecorderFromConfig = createFromConfigOnce(func(ctx context.Context, conf *config.Config) (*denial.Recorder, error) {
+	return denial.NewRecorder(int(conf.Denials.BufferSize), float64(conf.Denials.LogSampleRate), slog.Default()), nil
+})
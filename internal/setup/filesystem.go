@@ -0,0 +1,50 @@
+package setup
+
+import (
+	"context"
+
+	"github.com/bornholm/calli/internal/config"
+	"github.com/bornholm/calli/pkg/webdav/filesystem"
+	"github.com/bornholm/calli/pkg/webdav/filesystem/mount"
+	"github.com/pkg/errors"
+	"golang.org/x/net/webdav"
+)
+
+var NewFileSystemFromConfig = createFromConfigOnce(func(ctx context.Context, conf *config.Config) (webdav.FileSystem, error) {
+	if len(conf.Mounts) == 0 {
+		return nil, errors.New("no mount configured")
+	}
+
+	// The collector must be registered before the metrics decorator wrapping
+	// the filesystems, and both before the filesystems creation
+	if _, err := NewDedupCollectorFromConfig(ctx, conf); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if _, err := NewMetricsFromConfig(ctx, conf); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	mounts := make([]mount.MountOptions, 0, len(conf.Mounts))
+	for _, m := range conf.Mounts {
+		var options any
+		if m.Options != nil {
+			options = m.Options.Data
+		}
+
+		mounts = append(mounts, mount.MountOptions{
+			Path:    string(m.Path),
+			Type:    filesystem.Type(m.Type),
+			Options: options,
+		})
+	}
+
+	fs, err := mount.CreateFileSystemFromOptions(mount.Options{
+		Mounts: mounts,
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return fs, nil
+})
@@ -0,0 +1,68 @@
+package setup
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/bornholm/calli/internal/config"
+	"github.com/bornholm/calli/internal/store"
+	"github.com/bornholm/calli/pkg/log"
+	"github.com/pkg/errors"
+	"golang.org/x/net/webdav"
+)
+
+var NewLockSystemFromConfig = createFromConfigOnce(func(ctx context.Context, conf *config.Config) (webdav.LockSystem, error) {
+	switch string(conf.Lock.Type) {
+	case config.LockTypeMemory:
+		return webdav.NewMemLS(), nil
+
+	case config.LockTypeStore:
+		st, err := NewStoreFromConfig(ctx, conf)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		var holdTimeout time.Duration
+		if conf.Lock.HoldTimeout != nil {
+			holdTimeout = time.Duration(*conf.Lock.HoldTimeout)
+		}
+
+		var maxTimeout time.Duration
+		if conf.Lock.MaxTimeout != nil {
+			maxTimeout = time.Duration(*conf.Lock.MaxTimeout)
+		}
+
+		lockSystem := store.NewLockSystem(st, holdTimeout, maxTimeout)
+
+		// Reclaim the locks left by a previous run
+		if err := lockSystem.DeleteExpiredLocks(ctx, time.Now()); err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		if conf.Lock.SweepInterval != nil && *conf.Lock.SweepInterval > 0 {
+			go sweepExpiredLocks(ctx, lockSystem, time.Duration(*conf.Lock.SweepInterval))
+		}
+
+		return lockSystem, nil
+
+	default:
+		return nil, errors.Errorf("unknown lock system type '%s'", conf.Lock.Type)
+	}
+})
+
+func sweepExpiredLocks(ctx context.Context, lockSystem *store.LockSystem, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := lockSystem.DeleteExpiredLocks(ctx, now); err != nil {
+				slog.ErrorContext(ctx, "could not delete expired locks", log.Error(errors.WithStack(err)))
+			}
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package setup
+
+import (
+	"context"
+
+	"github.com/bornholm/calli/internal/config"
+	"github.com/bornholm/calli/internal/metrics"
+	"github.com/bornholm/calli/pkg/webdav/filesystem"
+)
+
+// NewMetricsFromConfig returns the metrics collector, or nil
+// if the metrics are disabled
+var NewMetricsFromConfig = createFromConfigOnce(func(ctx context.Context, conf *config.Config) (*metrics.Metrics, error) {
+	if !conf.Metrics.Enabled {
+		return nil, nil
+	}
+
+	m := metrics.New()
+
+	// Record the operations of the filesystems created from now on
+	filesystem.Decorate(m.Decorate)
+
+	return m, nil
+})
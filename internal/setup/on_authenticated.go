@@ -3,6 +3,8 @@ package setup
 import (
 	"context"
 	"net/http"
+	"os"
+	"path"
 	"time"
 
 	"github.com/bornholm/calli/internal/authn"
@@ -10,8 +12,10 @@ import (
 	"github.com/bornholm/calli/internal/authz"
 	"github.com/bornholm/calli/internal/config"
 	"github.com/bornholm/calli/internal/store"
+	"github.com/bornholm/calli/internal/syncx"
 	"github.com/pkg/errors"
 	"github.com/rs/xid"
+	"golang.org/x/net/webdav"
 	"zombiezen.com/go/sqlite"
 	"zombiezen.com/go/sqlite/sqlitex"
 )
@@ -22,6 +26,18 @@ func NewOnAuthenticatedFromConfig(ctx context.Context, conf *config.Config) (fun
 		return nil, errors.WithStack(err)
 	}
 
+	var fs webdav.FileSystem
+	if conf.Homes.Enabled {
+		fs, err = NewFileSystemFromConfig(ctx, conf)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	// Last connections recorded by this process, sparing the concurrent
+	// requests of a user the update of their connection date
+	var connections syncx.Map[int64, time.Time]
+
 	return func(r *http.Request, user authn.User) (*http.Request, error) {
 		ctx := r.Context()
 
@@ -37,7 +53,18 @@ func NewOnAuthenticatedFromConfig(ctx context.Context, conf *config.Config) (fun
 			storeUser = typedUser
 		}
 
-		if time.Since(storeUser.ConnectedAt) > time.Minute {
+		connectedAt := storeUser.ConnectedAt
+		if recorded, exists := connections.Load(storeUser.ID); exists && recorded.After(connectedAt) {
+			connectedAt = recorded
+		}
+
+		if time.Since(connectedAt) > time.Minute {
+			if fs != nil {
+				if err := ensureHomeDir(ctx, fs, storeUser.UserHome()); err != nil {
+					return nil, errors.WithStack(err)
+				}
+			}
+
 			st.Do(ctx, func(conn *sqlite.Conn) error {
 				err := sqlitex.Execute(conn, `UPDATE users SET connected_at = ? WHERE id = ?`, &sqlitex.ExecOptions{
 					Args: []any{time.Now().UTC().Unix(), storeUser.ID},
@@ -51,6 +78,8 @@ func NewOnAuthenticatedFromConfig(ctx context.Context, conf *config.Config) (fun
 			if err != nil {
 				return nil, errors.WithStack(err)
 			}
+
+			connections.Store(storeUser.ID, time.Now())
 		}
 
 		ctx = authz.WithContextUser(ctx, storeUser)
@@ -121,3 +150,24 @@ func findOrCreateUserFromOAuth2(ctx context.Context, conf *config.Config, st *st
 
 	return storeUser, nil
 }
+
+// ensureHomeDir creates the given home directory and its parent if they do not exist yet
+func ensureHomeDir(ctx context.Context, fs webdav.FileSystem, home string) error {
+	if home == "" {
+		return nil
+	}
+
+	for _, dir := range []string{path.Dir(home), home} {
+		if _, err := fs.Stat(ctx, dir); err == nil {
+			continue
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return errors.WithStack(err)
+		}
+
+		if err := fs.Mkdir(ctx, dir, os.ModePerm); err != nil && !errors.Is(err, os.ErrExist) {
+			return errors.Wrapf(err, "could not create directory '%s'", dir)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,48 @@
+package setup
+
+import (
+	"context"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/bornholm/calli/internal/authz"
+	"github.com/bornholm/calli/internal/config"
+	"github.com/pkg/errors"
+)
+
+// NewRequestMiddlewareFromConfig returns the middleware exposing
+// the requests metadata to the authorization rules
+var NewRequestMiddlewareFromConfig = createFromConfigOnce(func(ctx context.Context, conf *config.Config) (func(http.Handler) http.Handler, error) {
+	trustedProxies := make([]netip.Prefix, 0, len(conf.HTTP.TrustedProxies))
+
+	for _, p := range conf.HTTP.TrustedProxies {
+		prefix, err := parsePrefix(p)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid trusted proxy '%s'", p)
+		}
+
+		trustedProxies = append(trustedProxies, prefix)
+	}
+
+	return authz.RequestMiddleware(trustedProxies), nil
+})
+
+// parsePrefix parses a network or a single address
+func parsePrefix(s string) (netip.Prefix, error) {
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return netip.Prefix{}, errors.WithStack(err)
+		}
+
+		return prefix.Masked(), nil
+	}
+
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Prefix{}, errors.WithStack(err)
+	}
+
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
@@ -7,12 +7,14 @@ import (
 	"os"
 
 	"github.com/bornholm/calli/internal/admin"
+	"github.com/bornholm/calli/internal/audit"
 	"github.com/bornholm/calli/internal/authn"
 	"github.com/bornholm/calli/internal/authn/basic"
 	"github.com/bornholm/calli/internal/authz"
 	"github.com/bornholm/calli/internal/config"
 	"github.com/bornholm/calli/internal/explorer"
 	"github.com/bornholm/calli/internal/pprof"
+	"github.com/bornholm/calli/internal/quota"
 	"github.com/bornholm/calli/internal/ratelimit"
 	"github.com/bornholm/calli/pkg/log"
 	"github.com/bornholm/calli/pkg/webdav/filesystem"
@@ -29,17 +31,69 @@ func NewHandlerFromConfig(ctx context.Context, conf *config.Config) (http.Handle
 
 	slogMiddleware := sloghttp.New(slog.Default())
 
-	fs, err := filesystem.New(filesystem.Type(conf.Filesystem.Type), conf.Filesystem.Options.Data)
+	fs, err := NewFileSystemFromConfig(ctx, conf)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
 
-	fs = authz.NewFileSystem(fs)
+	metrics, err := NewMetricsFromConfig(ctx, conf)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	auditSink, err := NewAuditSinkFromConfig(ctx, conf)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	denialRecorder, err := NewDenialRecorderFromConfig(ctx, conf)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	decisionHandlers := []authz.DecisionHandler{
+		audit.RecordDecision,
+		denialRecorder.HandleDecision,
+	}
+
+	if metrics != nil {
+		decisionHandlers = append(decisionHandlers, metrics.HandleDecision)
+	}
+
+	store, err := NewStoreFromConfig(ctx, conf)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	// The quotas only apply to the authorized operations
+	fs = quota.NewFileSystem(fs, store)
+
+	// The resources moved to and from the trash are accounted by the quotas
+	trashFs, err := NewTrashFromConfig(ctx, conf, fs)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if trashFs != nil {
+		fs = trashFs
+	}
+
+	fs = authz.NewFileSystem(fs, authz.WithDecisionHandlers(decisionHandlers...))
+
+	if auditSink != nil {
+		fs = audit.NewFileSystem(fs, auditSink)
+	}
+
 	fs = wd.WithLogger(fs, slog.Default())
 
+	lockSystem, err := NewLockSystemFromConfig(ctx, conf)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
 	davHandler := &webdav.Handler{
 		FileSystem: fs,
-		LockSystem: webdav.NewMemLS(),
+		LockSystem: lockSystem,
 		Prefix:     "/dav/",
 		Logger: func(r *http.Request, err error) {
 			if err != nil && !errors.Is(err, os.ErrNotExist) {
@@ -57,11 +111,6 @@ func NewHandlerFromConfig(ctx context.Context, conf *config.Config) (http.Handle
 
 	mux.Handle("/auth/", slogMiddleware(oauth2Handler))
 
-	store, err := NewStoreFromConfig(ctx, conf)
-	if err != nil {
-		return nil, errors.WithStack(err)
-	}
-
 	onAuthenticated, err := NewOnAuthenticatedFromConfig(ctx, conf)
 	if err != nil {
 		return nil, errors.WithStack(err)
@@ -75,7 +124,12 @@ func NewHandlerFromConfig(ctx context.Context, conf *config.Config) (http.Handle
 		authn.WithOnAuthenticated(onAuthenticated),
 	)
 
-	rateLimiter := ratelimit.New(10, 20)
+	rateLimiterOptions := []ratelimit.OptionFunc{}
+	if metrics != nil {
+		rateLimiterOptions = append(rateLimiterOptions, ratelimit.WithRejectedHandlers(metrics.HandleRejected))
+	}
+
+	rateLimiter := ratelimit.New(10, 20, rateLimiterOptions...)
 	rateLimiterMiddleware := rateLimiter.Middleware(func(r *http.Request) (string, error) {
 		user, err := authn.ContextUser(r.Context())
 		if err != nil {
@@ -85,7 +139,17 @@ func NewHandlerFromConfig(ctx context.Context, conf *config.Config) (http.Handle
 		return user.UserProvider() + "-" + user.UserSubject(), nil
 	})
 
-	mux.Handle("/dav/", davAuth(slogMiddleware(rateLimiterMiddleware(davHandler))))
+	requestMiddleware, err := NewRequestMiddlewareFromConfig(ctx, conf)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	dav := rateLimiterMiddleware(requestMiddleware(authz.Middleware(quota.Middleware(filesystem.RequestedPropsMiddleware(davHandler)))))
+	if metrics != nil {
+		dav = metrics.Middleware(dav)
+	}
+
+	mux.Handle("/dav/", davAuth(slogMiddleware(dav)))
 
 	uiAuth := authn.Chain(
 		authn.WithAuthenticators(
@@ -95,12 +159,21 @@ func NewHandlerFromConfig(ctx context.Context, conf *config.Config) (http.Handle
 	)
 
 	// Explorer handler with store for credential regeneration
-	mux.Handle("/", uiAuth(slogMiddleware(explorer.NewHandler(string(conf.HTTP.BaseURL), fs, store))))
+	mux.Handle("/", uiAuth(slogMiddleware(requestMiddleware(authz.Middleware(explorer.NewHandler(string(conf.HTTP.BaseURL), fs, store, trashFs))))))
 
-	adminHandler := admin.NewHandler("/admin", store)
+	dedupCollector, err := NewDedupCollectorFromConfig(ctx, conf)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	adminHandler := admin.NewHandler("/admin", store, denialRecorder, dedupCollector)
 	mux.Handle("/admin/", uiAuth(adminHandler))
 
 	mux.Handle("/pprof/", pprof.NewHandler("/pprof"))
 
+	if metrics != nil {
+		mux.Handle("/metrics", metrics.Handler())
+	}
+
 	return mux, nil
 }
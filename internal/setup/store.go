@@ -3,8 +3,10 @@ package setup
 import (
 	"context"
 
+	"github.com/bornholm/calli/internal/authz"
 	"github.com/bornholm/calli/internal/config"
 	"github.com/bornholm/calli/internal/store"
+	"github.com/dustin/go-humanize"
 	"github.com/pkg/errors"
 )
 
@@ -15,5 +17,46 @@ var NewStoreFromConfig = createFromConfigOnce(func(ctx context.Context, conf *co
 		return nil, errors.WithStack(err)
 	}
 
+	if err := syncGroupsFromConfig(ctx, conf, store); err != nil {
+		return nil, errors.Wrap(err, "could not synchronize groups from configuration")
+	}
+
 	return store, nil
 })
+
+func syncGroupsFromConfig(ctx context.Context, conf *config.Config, st *store.Store) error {
+	groups := make([]*store.Group, 0, len(conf.Auth.Groups))
+
+	for _, g := range conf.Auth.Groups {
+		group := &store.Group{
+			Name:     string(g.Name),
+			Strategy: authz.Strategy(g.Strategy),
+			QuotaDir: string(g.QuotaDir),
+			Rules:    make([]*store.Rule, 0, len(g.Rules)),
+		}
+
+		if g.Quota != "" {
+			quota, err := humanize.ParseBytes(string(g.Quota))
+			if err != nil {
+				return errors.Wrapf(err, "could not parse quota of group '%s'", g.Name)
+			}
+
+			group.Quota = int64(quota)
+		}
+
+		for _, r := range g.Rules {
+			group.Rules = append(group.Rules, &store.Rule{
+				Script: string(r.Script),
+				Effect: authz.Effect(r.Effect),
+			})
+		}
+
+		groups = append(groups, group)
+	}
+
+	if err := st.SyncManagedGroups(ctx, groups, bool(conf.Auth.PruneGroups)); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,66 @@
+package setup
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/bornholm/calli/internal/config"
+	"github.com/bornholm/calli/internal/trash"
+	"github.com/bornholm/calli/pkg/log"
+	"github.com/pkg/errors"
+	"golang.org/x/net/webdav"
+)
+
+// NewTrashFromConfig returns the trash wrapping the given filesystem,
+// or nil if the trash is disabled
+func NewTrashFromConfig(ctx context.Context, conf *config.Config, fs webdav.FileSystem) (*trash.FileSystem, error) {
+	if !conf.Trash.Enabled {
+		return nil, nil
+	}
+
+	st, err := NewStoreFromConfig(ctx, conf)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	// Each mount has its own trash, the resources never leaving their mount
+	mountPoints := make([]string, 0, len(conf.Mounts))
+	for _, m := range conf.Mounts {
+		mountPoints = append(mountPoints, string(m.Path))
+	}
+
+	trashFs := trash.NewFileSystem(fs, st, string(conf.Trash.Dir), mountPoints...)
+
+	var maxAge, purgeInterval time.Duration
+
+	if conf.Trash.MaxAge != nil {
+		maxAge = time.Duration(*conf.Trash.MaxAge)
+	}
+
+	if conf.Trash.PurgeInterval != nil {
+		purgeInterval = time.Duration(*conf.Trash.PurgeInterval)
+	}
+
+	if maxAge > 0 && purgeInterval > 0 {
+		go purgeTrash(ctx, trashFs, maxAge, purgeInterval)
+	}
+
+	return trashFs, nil
+}
+
+func purgeTrash(ctx context.Context, trashFs *trash.FileSystem, maxAge time.Duration, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := trashFs.Purge(ctx, now.Add(-maxAge)); err != nil {
+				slog.ErrorContext(ctx, "could not purge trash", log.Error(errors.WithStack(err)))
+			}
+		}
+	}
+}
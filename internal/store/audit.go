@@ -0,0 +1,206 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+var auditMigrations = []string{
+	`CREATE TABLE IF NOT EXISTS audit_entries (
+		id INTEGER PRIMARY KEY,
+
+		created_at INTEGER NOT NULL,
+
+		subject TEXT,
+		provider TEXT,
+		email TEXT,
+
+		operation TEXT NOT NULL,
+		name TEXT,
+		new_name TEXT,
+		flag INTEGER,
+
+		bytes_read INTEGER NOT NULL DEFAULT 0,
+		bytes_written INTEGER NOT NULL DEFAULT 0,
+
+		decision TEXT,
+		rule TEXT,
+		error TEXT
+	);`,
+	`CREATE INDEX IF NOT EXISTS idx_audit_entries_created_at ON audit_entries(created_at);`,
+	`CREATE INDEX IF NOT EXISTS idx_audit_entries_subject ON audit_entries(subject, provider);`,
+}
+
+// DefaultAuditSearchLimit is the maximum number of entries returned
+// by a search without explicit limit
+const DefaultAuditSearchLimit = 100
+
+type AuditEntry struct {
+	ID int64
+
+	CreatedAt time.Time
+
+	Subject  string
+	Provider string
+	Email    string
+
+	Operation string
+	Name      string
+	NewName   string
+	Flag      int
+
+	BytesRead    int64
+	BytesWritten int64
+
+	Decision string
+	Rule     string
+	Error    string
+}
+
+// AuditQuery filters the audit entries, zero values are ignored
+type AuditQuery struct {
+	// User matches the subject or the email of the entries' user
+	User string
+	// Path matches the entries' paths containing it
+	Path   string
+	Since  time.Time
+	Until  time.Time
+	Limit  int
+	Offset int
+}
+
+// CreateAuditEntry appends an entry to the audit trail
+func (s *Store) CreateAuditEntry(ctx context.Context, entry *AuditEntry) error {
+	err := s.Do(ctx, func(conn *sqlite.Conn) error {
+		createdAt := entry.CreatedAt
+		if createdAt.IsZero() {
+			createdAt = time.Now()
+		}
+
+		query := `
+			INSERT INTO audit_entries (
+				created_at, subject, provider, email, operation, name, new_name, flag,
+				bytes_read, bytes_written, decision, rule, error
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING id
+		`
+
+		err := sqlitex.Execute(conn, query, &sqlitex.ExecOptions{
+			Args: []any{
+				createdAt.UTC().Unix(), entry.Subject, entry.Provider, entry.Email,
+				entry.Operation, entry.Name, entry.NewName, entry.Flag,
+				entry.BytesRead, entry.BytesWritten, entry.Decision, entry.Rule, entry.Error,
+			},
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				entry.ID = stmt.ColumnInt64(0)
+				return nil
+			},
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// SearchAuditEntries returns the audit entries matching the query,
+// most recent first
+func (s *Store) SearchAuditEntries(ctx context.Context, q AuditQuery) ([]*AuditEntry, error) {
+	entries := make([]*AuditEntry, 0)
+
+	err := s.Do(ctx, func(conn *sqlite.Conn) error {
+		conditions := make([]string, 0)
+		args := make([]any, 0)
+
+		if q.User != "" {
+			conditions = append(conditions, "(subject = ? OR email LIKE ? ESCAPE '\\')")
+			args = append(args, q.User, "%"+escapeLike(q.User)+"%")
+		}
+
+		if q.Path != "" {
+			conditions = append(conditions, "(name LIKE ? ESCAPE '\\' OR new_name LIKE ? ESCAPE '\\')")
+			pattern := "%" + escapeLike(q.Path) + "%"
+			args = append(args, pattern, pattern)
+		}
+
+		if !q.Since.IsZero() {
+			conditions = append(conditions, "created_at >= ?")
+			args = append(args, q.Since.UTC().Unix())
+		}
+
+		if !q.Until.IsZero() {
+			conditions = append(conditions, "created_at <= ?")
+			args = append(args, q.Until.UTC().Unix())
+		}
+
+		where := ""
+		if len(conditions) > 0 {
+			where = "WHERE " + strings.Join(conditions, " AND ")
+		}
+
+		limit := q.Limit
+		if limit <= 0 {
+			limit = DefaultAuditSearchLimit
+		}
+
+		args = append(args, limit, q.Offset)
+
+		query := fmt.Sprintf(`
+			SELECT
+				id, created_at, subject, provider, email, operation, name, new_name, flag,
+				bytes_read, bytes_written, decision, rule, error
+			FROM audit_entries %s
+			ORDER BY created_at DESC, id DESC
+			LIMIT ? OFFSET ?
+		`, where)
+
+		err := sqlitex.Execute(conn, query, &sqlitex.ExecOptions{
+			Args: args,
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				entries = append(entries, &AuditEntry{
+					ID:           stmt.ColumnInt64(0),
+					CreatedAt:    time.Unix(stmt.ColumnInt64(1), 0),
+					Subject:      stmt.ColumnText(2),
+					Provider:     stmt.ColumnText(3),
+					Email:        stmt.ColumnText(4),
+					Operation:    stmt.ColumnText(5),
+					Name:         stmt.ColumnText(6),
+					NewName:      stmt.ColumnText(7),
+					Flag:         stmt.ColumnInt(8),
+					BytesRead:    stmt.ColumnInt64(9),
+					BytesWritten: stmt.ColumnInt64(10),
+					Decision:     stmt.ColumnText(11),
+					Rule:         stmt.ColumnText(12),
+					Error:        stmt.ColumnText(13),
+				})
+
+				return nil
+			},
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return entries, nil
+}
+
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -0,0 +1,71 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+func TestAuditEntries(t *testing.T) {
+	ctx := context.Background()
+
+	store := NewStore(filepath.Join(t.TempDir(), "audit.db"))
+
+	start := time.Date(2025, time.March, 1, 12, 0, 0, 0, time.UTC)
+
+	entries := []*AuditEntry{
+		{CreatedAt: start, Subject: "jdoe", Provider: "test", Email: "jdoe@example.net", Operation: "open", Name: "/shared/report.pdf"},
+		{CreatedAt: start.Add(time.Hour), Subject: "jdoe", Provider: "test", Email: "jdoe@example.net", Operation: "rename", Name: "/shared/a", NewName: "/archive/a"},
+		{CreatedAt: start.Add(2 * time.Hour), Subject: "asmith", Provider: "test", Email: "asmith@example.net", Operation: "stat", Name: "/100%_private"},
+	}
+
+	for _, e := range entries {
+		if err := store.CreateAuditEntry(ctx, e); err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+	}
+
+	type testCase struct {
+		Query    AuditQuery
+		Expected []int64
+	}
+
+	testCases := []testCase{
+		{Query: AuditQuery{}, Expected: []int64{3, 2, 1}},
+		{Query: AuditQuery{User: "jdoe"}, Expected: []int64{2, 1}},
+		{Query: AuditQuery{User: "asmith@"}, Expected: []int64{3}},
+		{Query: AuditQuery{Path: "/archive"}, Expected: []int64{2}},
+		{Query: AuditQuery{Path: "100%_"}, Expected: []int64{3}},
+		{Query: AuditQuery{Path: "%"}, Expected: []int64{3}},
+		{Query: AuditQuery{Since: start.Add(time.Hour)}, Expected: []int64{3, 2}},
+		{Query: AuditQuery{Until: start.Add(time.Hour)}, Expected: []int64{2, 1}},
+		{Query: AuditQuery{Limit: 1, Offset: 1}, Expected: []int64{2}},
+	}
+
+	for idx, tc := range testCases {
+		found, err := store.SearchAuditEntries(ctx, tc.Query)
+		if err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		ids := make([]int64, 0, len(found))
+		for _, e := range found {
+			ids = append(ids, e.ID)
+		}
+
+		if e, g := tc.Expected, ids; len(e) != len(g) {
+			t.Errorf("case #%d: expected '%v', got '%v'", idx, e, g)
+			continue
+		}
+
+		for i := range tc.Expected {
+			if e, g := tc.Expected[i], ids[i]; e != g {
+				t.Errorf("case #%d: expected '%v', got '%v'", idx, tc.Expected, ids)
+				break
+			}
+		}
+	}
+}
@@ -41,6 +41,8 @@ func (s *Store) RegenerateBasicPassword(ctx context.Context, userID int64, passw
 
 // Authenticate implements authn.UserProvider.
 func (s *Store) Authenticate(ctx context.Context, username string, password string) (authn.User, error) {
+	generation := s.policies.Generation()
+
 	var user *User
 	err := s.Tx(ctx, func(conn *sqlite.Conn) error {
 		query := fmt.Sprintf("SELECT %s FROM users WHERE basic_username = ? LIMIT 1", userAttributes)
@@ -59,7 +61,42 @@ func (s *Store) Authenticate(ctx context.Context, username string, password stri
 			return errors.WithStack(authn.ErrUnauthenticated)
 		}
 
-		if err := s.joinUserGroups(ctx, conn, user); err != nil {
+		if err := s.joinUserPolicy(ctx, conn, generation, user); err != nil {
+			return errors.WithStack(err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return user, nil
+}
+
+// FindBasicUser implements basic.UserProvider.
+func (s *Store) FindBasicUser(ctx context.Context, username string) (authn.User, error) {
+	generation := s.policies.Generation()
+
+	var user *User
+	err := s.Tx(ctx, func(conn *sqlite.Conn) error {
+		query := fmt.Sprintf("SELECT %s FROM users WHERE basic_username = ? LIMIT 1", userAttributes)
+		err := sqlitex.Execute(conn, query, &sqlitex.ExecOptions{
+			Args: []any{username},
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				user = &User{}
+				return errors.WithStack(s.bindUser(stmt, user))
+			},
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		if user == nil {
+			return errors.WithStack(authn.ErrUnauthenticated)
+		}
+
+		if err := s.joinUserPolicy(ctx, conn, generation, user); err != nil {
 			return errors.WithStack(err)
 		}
 
@@ -72,7 +109,15 @@ func (s *Store) Authenticate(ctx context.Context, username string, password stri
 	return user, nil
 }
 
-var _ basic.UserProvider = &Store{}
+// BasicPasswordHash implements basic.PasswordHasher.
+func (u *User) BasicPasswordHash() []byte {
+	return u.BasicPassword
+}
+
+var (
+	_ basic.UserProvider   = &Store{}
+	_ basic.PasswordHasher = &User{}
+)
 
 func hashPassword(password string) ([]byte, error) {
 	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
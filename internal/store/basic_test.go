@@ -0,0 +1,63 @@
+package store
+
+import (
+	"context"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/bornholm/calli/internal/authn"
+	"github.com/bornholm/calli/internal/authn/basic"
+	"github.com/pkg/errors"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+func TestRegenerateBasicPassword(t *testing.T) {
+	ctx := context.Background()
+
+	store := NewStore(filepath.Join(t.TempDir(), "basic.db"))
+
+	user, err := store.FindOrCreateUser(ctx, "subject", "provider")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	err = store.Do(ctx, func(conn *sqlite.Conn) error {
+		return errors.WithStack(sqlitex.Execute(conn, "UPDATE users SET basic_username = ? WHERE id = ?", &sqlitex.ExecOptions{
+			Args: []any{"jdoe", user.ID},
+		}))
+	})
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	password, err := store.RegenerateBasicPassword(ctx, user.ID, 16)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	authenticator := basic.NewAuthenticator(store)
+
+	authenticate := func(password string) error {
+		r := httptest.NewRequest("PROPFIND", "/", nil)
+		r.SetBasicAuth("jdoe", password)
+
+		_, err := authenticator.Authenticate(httptest.NewRecorder(), r)
+
+		return err
+	}
+
+	if err := authenticate(password); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if _, err := store.RegenerateBasicPassword(ctx, user.ID, 16); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	// The previous password is revoked despite its verification being cached
+	if err := authenticate(password); !errors.Is(err, authn.ErrCancel) {
+		t.Errorf("authenticate with previous password: expected '%v', got '%v'", authn.ErrCancel, err)
+	}
+}
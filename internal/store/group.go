@@ -1,8 +1,25 @@
 package store
 
 import (
+	"context"
 	"fmt"
+	"path"
+	"slices"
+	"strings"
 	"time"
+
+	"github.com/bornholm/calli/internal/authz"
+	"github.com/bornholm/calli/internal/authz/expr"
+	"github.com/pkg/errors"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+var (
+	ErrGroupNotFound = errors.New("group not found")
+	ErrGroupInUse    = errors.New("group is still referenced by users")
+	ErrInvalidGroup  = errors.New("invalid group")
+	ErrGroupManaged  = errors.New("group is managed by configuration")
 )
 
 var groupMigrations = []string{
@@ -25,7 +42,12 @@ var groupMigrations = []string{
 
 var now = time.Now().UTC().Unix()
 
-var repeatableGroupMigrations = []string{
+// seedGroupIDs are the identifiers of the groups created with the store
+var seedGroupIDs = []int64{0, 1}
+
+// seedGroupMigrations are applied once so that the seeded groups
+// can later be modified or deleted
+var seedGroupMigrations = []string{
 	fmt.Sprintf(`INSERT OR IGNORE INTO groups (id, name, created_at, updated_at) VALUES (0, 'read-only', %d, %d);`, now, now),
 	fmt.Sprintf(`INSERT OR IGNORE INTO groups (id, name, created_at, updated_at) VALUES (1, 'read-write', %d, %d);`, now, now),
 	fmt.Sprintf(`INSERT OR IGNORE INTO rules (id, group_id, script, sort_order, created_at, updated_at) VALUES (0, 0, 'operation == OP_OPEN && bitand(flag, O_WRITE) == 0', 0, %d, %d);`, now, now),
@@ -33,6 +55,28 @@ var repeatableGroupMigrations = []string{
 	fmt.Sprintf(`INSERT OR IGNORE INTO rules (id, group_id, script, sort_order, created_at, updated_at) VALUES (2, 1, 'true', 1, %d, %d);`, now, now),
 }
 
+var managedGroupMigrations = []string{
+	`ALTER TABLE groups ADD COLUMN managed BOOLEAN NOT NULL DEFAULT 0;`,
+}
+
+// HomeGroupName is the name of the seeded group restricting
+// its members to their home directory
+const HomeGroupName = "own-home-only"
+
+// homeGroupMigrations seed the home group, unless a group with the same
+// name already exists
+var homeGroupMigrations = []string{
+	fmt.Sprintf(`INSERT OR IGNORE INTO groups (name, created_at, updated_at) VALUES ('%s', %d, %d);`, HomeGroupName, now, now),
+	fmt.Sprintf(`INSERT INTO rules (group_id, script, sort_order, created_at, updated_at)
+		SELECT g.id, r.script, r.sort_order, %d, %d
+		FROM groups g, (
+			SELECT 'home != "" && (operation == OP_RENAME ? inDir(oldName, home) && inDir(newName, home) : inDir(name, home))' AS script, 0 AS sort_order
+			UNION ALL
+			SELECT 'home != "" && operation == OP_STAT && inDir(home, name)', 1
+		) r
+		WHERE g.name = '%s' AND NOT EXISTS (SELECT 1 FROM rules WHERE group_id = g.id);`, now, now, HomeGroupName),
+}
+
 type Group struct {
 	ID int64
 
@@ -41,5 +85,493 @@ type Group struct {
 
 	Name string
 
+	// Managed is true when the group is declared in the configuration
+	// and can not be modified otherwise
+	Managed bool
+
+	// Strategy combines the decisions of the group's rules,
+	// StrategyDenyOverrides if empty
+	Strategy authz.Strategy
+
+	// Quota is the maximum size in bytes of the files under QuotaDir,
+	// unlimited if 0
+	Quota int64
+	// QuotaDir is the directory shared by the members the quota
+	// applies to, each member's home directory if empty
+	QuotaDir string
+
 	Rules []*Rule
 }
+
+func (s *Store) GetGroups(ctx context.Context, groupIDs ...int64) ([]*Group, error) {
+	var groups []*Group
+
+	err := s.Do(ctx, func(conn *sqlite.Conn) error {
+		var query string
+		var args []any
+
+		if len(groupIDs) > 0 {
+			placeholders := make([]string, len(groupIDs))
+			args = make([]any, len(groupIDs))
+
+			for i, id := range groupIDs {
+				placeholders[i] = "?"
+				args[i] = id
+			}
+
+			query = fmt.Sprintf("SELECT %s FROM groups WHERE id IN (%s) ORDER BY id",
+				groupAttributes, strings.Join(placeholders, ", "))
+		} else {
+			query = fmt.Sprintf("SELECT %s FROM groups ORDER BY id", groupAttributes)
+		}
+
+		err := sqlitex.Execute(conn, query, &sqlitex.ExecOptions{
+			Args: args,
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				group := &Group{}
+				bindGroup(stmt, group)
+				groups = append(groups, group)
+				return nil
+			},
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		for _, group := range groups {
+			if err := joinGroupRules(conn, group); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+
+		return nil
+	})
+
+	return groups, errors.WithStack(err)
+}
+
+// CreateGroup creates a new group with its rules, in the given order
+func (s *Store) CreateGroup(ctx context.Context, group *Group) (*Group, error) {
+	defer s.policies.Invalidate()
+
+	if err := validateGroup(group); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var createdGroup *Group
+
+	err := s.Tx(ctx, func(conn *sqlite.Conn) error {
+		query := fmt.Sprintf(`
+			INSERT INTO groups (name, strategy, quota, quota_dir, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?) RETURNING %s
+		`, groupAttributes)
+
+		now := time.Now().UTC().Unix()
+
+		err := sqlitex.Execute(conn, query, &sqlitex.ExecOptions{
+			Args: []any{group.Name, string(group.Strategy), group.Quota, group.QuotaDir, now, now},
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				createdGroup = &Group{}
+				bindGroup(stmt, createdGroup)
+				return nil
+			},
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		if err := saveGroupRules(conn, createdGroup.ID, group.Rules); err != nil {
+			return errors.WithStack(err)
+		}
+
+		if err := joinGroupRules(conn, createdGroup); err != nil {
+			return errors.WithStack(err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return createdGroup, nil
+}
+
+// UpdateGroup updates the group name and replaces its rules, the rules
+// sort order being the order of the given slice
+func (s *Store) UpdateGroup(ctx context.Context, group *Group) (*Group, error) {
+	defer s.policies.Invalidate()
+
+	if err := validateGroup(group); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var updatedGroup *Group
+
+	err := s.Tx(ctx, func(conn *sqlite.Conn) error {
+		managed, err := isGroupManaged(conn, group.ID)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		if managed {
+			return errors.WithStack(ErrGroupManaged)
+		}
+
+		query := fmt.Sprintf(`
+			UPDATE groups SET
+				name = ?,
+				strategy = ?,
+				quota = ?,
+				quota_dir = ?,
+				updated_at = ?
+			WHERE id = ? RETURNING %s
+		`, groupAttributes)
+
+		now := time.Now().UTC().Unix()
+
+		err = sqlitex.Execute(conn, query, &sqlitex.ExecOptions{
+			Args: []any{group.Name, string(group.Strategy), group.Quota, group.QuotaDir, now, group.ID},
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				updatedGroup = &Group{}
+				bindGroup(stmt, updatedGroup)
+				return nil
+			},
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		if updatedGroup == nil {
+			return errors.WithStack(ErrGroupNotFound)
+		}
+
+		if err := saveGroupRules(conn, updatedGroup.ID, group.Rules); err != nil {
+			return errors.WithStack(err)
+		}
+
+		if err := joinGroupRules(conn, updatedGroup); err != nil {
+			return errors.WithStack(err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return updatedGroup, nil
+}
+
+// DeleteGroups deletes the given groups and their rules. Seeded groups
+// can only be deleted once no user references them anymore.
+func (s *Store) DeleteGroups(ctx context.Context, groupIDs ...int64) error {
+	if len(groupIDs) == 0 {
+		return nil
+	}
+
+	defer s.policies.Invalidate()
+
+	return s.Tx(ctx, func(conn *sqlite.Conn) error {
+		for _, id := range groupIDs {
+			managed, err := isGroupManaged(conn, id)
+			if err != nil {
+				return errors.WithStack(err)
+			}
+
+			if managed {
+				return errors.Wrapf(ErrGroupManaged, "group '%d' is managed by configuration", id)
+			}
+
+			if err := assertGroupDeletable(conn, id); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+
+		placeholders := make([]string, len(groupIDs))
+		args := make([]any, len(groupIDs))
+
+		for i, id := range groupIDs {
+			placeholders[i] = "?"
+			args[i] = id
+		}
+
+		query := fmt.Sprintf("DELETE FROM groups WHERE id IN (%s)", strings.Join(placeholders, ", "))
+
+		return errors.WithStack(sqlitex.Execute(conn, query, &sqlitex.ExecOptions{
+			Args: args,
+		}))
+	})
+}
+
+// SyncManagedGroups creates or updates the given groups, identified by their
+// name, and marks them as managed. Previously managed groups which are not
+// part of the given ones are deleted if prune is true or released otherwise.
+func (s *Store) SyncManagedGroups(ctx context.Context, groups []*Group, prune bool) error {
+	defer s.policies.Invalidate()
+
+	for _, g := range groups {
+		if err := validateGroup(g); err != nil {
+			return errors.Wrapf(err, "could not validate group '%s'", g.Name)
+		}
+	}
+
+	return s.Tx(ctx, func(conn *sqlite.Conn) error {
+		now := time.Now().UTC().Unix()
+		names := make([]string, 0, len(groups))
+
+		for _, g := range groups {
+			if slices.Contains(names, g.Name) {
+				return errors.Wrapf(ErrInvalidGroup, "group '%s' is declared more than once", g.Name)
+			}
+
+			names = append(names, g.Name)
+
+			var groupID int64 = -1
+
+			query := `
+				INSERT INTO groups (name, strategy, quota, quota_dir, managed, created_at, updated_at) VALUES (?, ?, ?, ?, 1, ?, ?)
+				ON CONFLICT(name) DO UPDATE SET strategy = excluded.strategy, quota = excluded.quota, quota_dir = excluded.quota_dir,
+					managed = 1, updated_at = excluded.updated_at
+				RETURNING id
+			`
+
+			err := sqlitex.Execute(conn, query, &sqlitex.ExecOptions{
+				Args: []any{g.Name, string(g.Strategy), g.Quota, g.QuotaDir, now, now},
+				ResultFunc: func(stmt *sqlite.Stmt) error {
+					groupID = stmt.ColumnInt64(0)
+					return nil
+				},
+			})
+			if err != nil {
+				return errors.WithStack(err)
+			}
+
+			if err := saveGroupRules(conn, groupID, g.Rules); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+
+		staleIDs := make([]int64, 0)
+
+		err := sqlitex.Execute(conn, "SELECT id, name FROM groups WHERE managed = 1", &sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				if !slices.Contains(names, stmt.ColumnText(1)) {
+					staleIDs = append(staleIDs, stmt.ColumnInt64(0))
+				}
+				return nil
+			},
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		for _, id := range staleIDs {
+			if prune {
+				err := assertGroupDeletable(conn, id)
+				if err != nil && !errors.Is(err, ErrGroupInUse) {
+					return errors.WithStack(err)
+				}
+
+				if err == nil {
+					err := sqlitex.Execute(conn, "DELETE FROM groups WHERE id = ?", &sqlitex.ExecOptions{
+						Args: []any{id},
+					})
+					if err != nil {
+						return errors.WithStack(err)
+					}
+
+					continue
+				}
+
+				// Seeded groups still referenced by users are only released
+			}
+
+			err := sqlitex.Execute(conn, "UPDATE groups SET managed = 0, updated_at = ? WHERE id = ?", &sqlitex.ExecOptions{
+				Args: []any{now, id},
+			})
+			if err != nil {
+				return errors.WithStack(err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// assertGroupDeletable returns ErrGroupInUse if the given group is a seeded
+// group which is still referenced by users
+func assertGroupDeletable(conn *sqlite.Conn, groupID int64) error {
+	if !slices.Contains(seedGroupIDs, groupID) {
+		return nil
+	}
+
+	var references int64
+	err := sqlitex.Execute(conn, "SELECT COUNT(*) FROM users_groups WHERE group_id = ?", &sqlitex.ExecOptions{
+		Args: []any{groupID},
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			references = stmt.ColumnInt64(0)
+			return nil
+		},
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if references > 0 {
+		return errors.Wrapf(ErrGroupInUse, "group '%d' is referenced by %d user(s)", groupID, references)
+	}
+
+	return nil
+}
+
+func isGroupManaged(conn *sqlite.Conn, groupID int64) (bool, error) {
+	managed := false
+
+	err := sqlitex.Execute(conn, "SELECT managed FROM groups WHERE id = ?", &sqlitex.ExecOptions{
+		Args: []any{groupID},
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			managed = stmt.ColumnBool(0)
+			return nil
+		},
+	})
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	return managed, nil
+}
+
+// validateGroup checks the group and normalizes its strategy
+// and its rules effects
+func validateGroup(group *Group) error {
+	if strings.TrimSpace(group.Name) == "" {
+		return errors.Wrap(ErrInvalidGroup, "group name must not be empty")
+	}
+
+	strategy, err := authz.ParseStrategy(string(group.Strategy))
+	if err != nil {
+		return errors.Wrap(ErrInvalidGroup, err.Error())
+	}
+
+	group.Strategy = strategy
+
+	if group.Quota < 0 {
+		return errors.Wrap(ErrInvalidGroup, "quota must not be negative")
+	}
+
+	if dir := strings.TrimSpace(group.QuotaDir); dir != "" {
+		group.QuotaDir = path.Clean("/" + dir)
+	} else {
+		group.QuotaDir = ""
+	}
+
+	for i, r := range group.Rules {
+		if err := expr.Validate(r.Script); err != nil {
+			return errors.Wrapf(ErrInvalidGroup, "rule #%d is invalid: %s", i+1, err.Error())
+		}
+
+		effect, err := authz.ParseEffect(string(r.Effect))
+		if err != nil {
+			return errors.Wrapf(ErrInvalidGroup, "rule #%d is invalid: %s", i+1, err.Error())
+		}
+
+		r.Effect = effect
+	}
+
+	return nil
+}
+
+// saveGroupRules replaces the rules of the given group. Existing rows are
+// reused in order to keep their identifiers stable.
+func saveGroupRules(conn *sqlite.Conn, groupID int64, rules []*Rule) error {
+	existingIDs := make([]int64, 0)
+
+	err := sqlitex.Execute(conn, "SELECT id FROM rules WHERE group_id = ? ORDER BY sort_order, id", &sqlitex.ExecOptions{
+		Args: []any{groupID},
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			existingIDs = append(existingIDs, stmt.ColumnInt64(0))
+			return nil
+		},
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	now := time.Now().UTC().Unix()
+
+	for sortOrder, r := range rules {
+		if sortOrder < len(existingIDs) {
+			query := `UPDATE rules SET script = ?, effect = ?, sort_order = ?, updated_at = ? WHERE id = ?`
+			err := sqlitex.Execute(conn, query, &sqlitex.ExecOptions{
+				Args: []any{r.Script, string(r.Effect), sortOrder, now, existingIDs[sortOrder]},
+			})
+			if err != nil {
+				return errors.WithStack(err)
+			}
+
+			continue
+		}
+
+		query := `INSERT INTO rules (group_id, script, effect, sort_order, created_at, updated_at) VALUES (?, ?, ?, ?, ?, ?)`
+		err := sqlitex.Execute(conn, query, &sqlitex.ExecOptions{
+			Args: []any{groupID, r.Script, string(r.Effect), sortOrder, now, now},
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	for i := len(rules); i < len(existingIDs); i++ {
+		err := sqlitex.Execute(conn, "DELETE FROM rules WHERE id = ?", &sqlitex.ExecOptions{
+			Args: []any{existingIDs[i]},
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+func joinGroupRules(conn *sqlite.Conn, group *Group) error {
+	query := `
+		SELECT id, script, sort_order, created_at, updated_at, effect
+		FROM rules
+		WHERE group_id = ?
+		ORDER BY sort_order, id
+	`
+
+	group.Rules = make([]*Rule, 0)
+
+	err := sqlitex.Execute(conn, query, &sqlitex.ExecOptions{
+		Args: []any{group.ID},
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			group.Rules = append(group.Rules, &Rule{
+				ID:        stmt.ColumnInt64(0),
+				Script:    stmt.ColumnText(1),
+				SortOrder: int(stmt.ColumnInt64(2)),
+				CreatedAt: time.Unix(stmt.ColumnInt64(3), 0),
+				UpdatedAt: time.Unix(stmt.ColumnInt64(4), 0),
+				Effect:    authz.Effect(stmt.ColumnText(5)),
+				Group:     group,
+			})
+			return nil
+		},
+	})
+
+	return errors.WithStack(err)
+}
+
+var groupAttributes = `id, name, created_at, updated_at, managed, strategy, quota, quota_dir`
+
+func bindGroup(stmt *sqlite.Stmt, group *Group) {
+	group.ID = stmt.ColumnInt64(0)
+	group.Name = stmt.ColumnText(1)
+	group.CreatedAt = time.Unix(stmt.ColumnInt64(2), 0)
+	group.UpdatedAt = time.Unix(stmt.ColumnInt64(3), 0)
+	group.Managed = stmt.ColumnBool(4)
+	group.Strategy = authz.Strategy(stmt.ColumnText(5))
+	group.Quota = stmt.ColumnInt64(6)
+	group.QuotaDir = stmt.ColumnText(7)
+}
@@ -0,0 +1,352 @@
+package store
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/bornholm/calli/internal/authz"
+	"github.com/bornholm/calli/internal/quota"
+	"github.com/pkg/errors"
+)
+
+func TestGroups(t *testing.T) {
+	ctx := context.Background()
+
+	store := NewStore(filepath.Join(t.TempDir(), "groups.db"))
+
+	if _, err := store.CreateGroup(ctx, &Group{Name: "invalid", Rules: []*Rule{{Script: "operation =="}}}); !errors.Is(err, ErrInvalidGroup) {
+		t.Fatalf("create invalid group: expected '%v', got '%v'", ErrInvalidGroup, err)
+	}
+
+	group, err := store.CreateGroup(ctx, &Group{
+		Name: "editors",
+		Rules: []*Rule{
+			{Script: "operation == OP_STAT"},
+			{Script: "operation == OP_OPEN"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	group.Rules = []*Rule{group.Rules[1], {Script: "operation == OP_MKDIR"}, group.Rules[0]}
+
+	group, err = store.UpdateGroup(ctx, group)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	expectedScripts := []string{"operation == OP_OPEN", "operation == OP_MKDIR", "operation == OP_STAT"}
+
+	if e, g := len(expectedScripts), len(group.Rules); e != g {
+		t.Fatalf("len(group.Rules): expected '%v', got '%v'", e, g)
+	}
+
+	for i, r := range group.Rules {
+		if e, g := expectedScripts[i], r.Script; e != g {
+			t.Errorf("group.Rules[%d].Script: expected '%v', got '%v'", i, e, g)
+		}
+
+		if e, g := i, r.SortOrder; e != g {
+			t.Errorf("group.Rules[%d].SortOrder: expected '%v', got '%v'", i, e, g)
+		}
+	}
+
+	user, err := store.FindOrCreateUser(ctx, "subject", "provider")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	seeds, err := store.GetGroups(ctx, 0)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	user.groups = seeds
+
+	if _, err := store.UpdateUser(ctx, user); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if err := store.DeleteGroups(ctx, 0); !errors.Is(err, ErrGroupInUse) {
+		t.Fatalf("delete referenced seeded group: expected '%v', got '%v'", ErrGroupInUse, err)
+	}
+
+	if err := store.DeleteGroups(ctx, 1, group.ID); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	groups, err := store.GetGroups(ctx)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	// The referenced 'read-only' and the 'own-home-only' seeded groups remain
+	if e, g := 2, len(groups); e != g {
+		t.Fatalf("len(groups): expected '%v', got '%v'", e, g)
+	}
+}
+
+func TestSyncManagedGroups(t *testing.T) {
+	ctx := context.Background()
+
+	store := NewStore(filepath.Join(t.TempDir(), "groups.db"))
+
+	managed := []*Group{
+		{Name: "read-only", Rules: []*Rule{{Script: "operation == OP_STAT"}}},
+		{Name: "auditors", Rules: []*Rule{{Script: "operation == OP_STAT"}, {Script: "operation == OP_OPEN"}}},
+	}
+
+	if err := store.SyncManagedGroups(ctx, managed, false); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	groups, err := store.GetGroups(ctx)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := 4, len(groups); e != g {
+		t.Fatalf("len(groups): expected '%v', got '%v'", e, g)
+	}
+
+	for _, g := range groups {
+		switch g.Name {
+		case "read-only":
+			if !g.Managed || len(g.Rules) != 1 {
+				t.Errorf("group 'read-only' should be managed with 1 rule, got managed '%v' with %d rule(s)", g.Managed, len(g.Rules))
+			}
+		case "auditors":
+			if !g.Managed || len(g.Rules) != 2 {
+				t.Errorf("group 'auditors' should be managed with 2 rules, got managed '%v' with %d rule(s)", g.Managed, len(g.Rules))
+			}
+		case "read-write":
+			if g.Managed {
+				t.Errorf("group 'read-write' should not be managed")
+			}
+		}
+
+		if g.Name == "auditors" {
+			if _, err := store.UpdateGroup(ctx, g); !errors.Is(err, ErrGroupManaged) {
+				t.Errorf("update managed group: expected '%v', got '%v'", ErrGroupManaged, err)
+			}
+
+			if err := store.DeleteGroups(ctx, g.ID); !errors.Is(err, ErrGroupManaged) {
+				t.Errorf("delete managed group: expected '%v', got '%v'", ErrGroupManaged, err)
+			}
+		}
+	}
+
+	if err := store.SyncManagedGroups(ctx, managed[:1], true); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	groups, err = store.GetGroups(ctx)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := 3, len(groups); e != g {
+		t.Fatalf("len(groups): expected '%v', got '%v'", e, g)
+	}
+}
+
+func TestHomeGroup(t *testing.T) {
+	ctx := context.Background()
+
+	store := NewStore(filepath.Join(t.TempDir(), "groups.db"))
+
+	groups, err := store.GetGroups(ctx)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	idx := slices.IndexFunc(groups, func(g *Group) bool { return g.Name == HomeGroupName })
+	if idx == -1 {
+		t.Fatalf("group '%s' not found", HomeGroupName)
+	}
+
+	user, err := store.FindOrCreateUser(ctx, "jdoe", "test")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	user.SetGroups(groups[idx])
+
+	home := user.UserHome()
+
+	type testCase struct {
+		Operation authz.Operation
+		Env       map[string]any
+		Allowed   bool
+	}
+
+	testCases := []testCase{
+		{Operation: authz.OperationOpen, Env: map[string]any{"name": home + "/notes.txt", "flag": os.O_RDWR}, Allowed: true},
+		{Operation: authz.OperationMkdir, Env: map[string]any{"name": home}, Allowed: true},
+		{Operation: authz.OperationStat, Env: map[string]any{"name": "/home"}, Allowed: true},
+		{Operation: authz.OperationRename, Env: map[string]any{"oldName": home + "/a", "newName": home + "/b"}, Allowed: true},
+		{Operation: authz.OperationOpen, Env: map[string]any{"name": "/home", "flag": os.O_RDONLY}, Allowed: false},
+		{Operation: authz.OperationOpen, Env: map[string]any{"name": home + "/../0/notes.txt", "flag": os.O_RDONLY}, Allowed: false},
+		{Operation: authz.OperationRename, Env: map[string]any{"oldName": home + "/a", "newName": "/shared/a"}, Allowed: false},
+		{Operation: authz.OperationRemove, Env: map[string]any{"name": home + "0"}, Allowed: false},
+	}
+
+	for idx, tc := range testCases {
+		decision := authz.Evaluate(ctx, user, tc.Operation, tc.Env)
+		if err := decision.Err(); err != nil {
+			t.Fatalf("case #%d: %+v", idx, errors.WithStack(err))
+		}
+
+		if e, g := tc.Allowed, decision.Allowed(); e != g {
+			t.Errorf("case #%d (%s %v): expected '%v', got '%v'", idx, tc.Operation, tc.Env, e, g)
+		}
+	}
+}
+
+func TestGroupEffects(t *testing.T) {
+	ctx := context.Background()
+
+	store := NewStore(filepath.Join(t.TempDir(), "groups.db"))
+
+	editors, err := store.CreateGroup(ctx, &Group{
+		Name: "editors",
+		Rules: []*Rule{
+			{Script: "true"},
+			{Script: `inDir(name, "/legal")`, Effect: authz.EffectDeny},
+		},
+	})
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := authz.StrategyDenyOverrides, editors.Strategy; e != g {
+		t.Errorf("editors.Strategy: expected '%v', got '%v'", e, g)
+	}
+
+	if e, g := authz.EffectDeny, editors.Rules[1].Effect; e != g {
+		t.Errorf("editors.Rules[1].Effect: expected '%v', got '%v'", e, g)
+	}
+
+	// The allow rule shadows the deny rule with the first-match strategy
+	lenient, err := store.CreateGroup(ctx, &Group{
+		Name:     "lenient",
+		Strategy: authz.StrategyFirstMatch,
+		Rules:    editors.Rules,
+	})
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if _, err := store.CreateGroup(ctx, &Group{Name: "invalid", Rules: []*Rule{{Script: "true", Effect: "maybe"}}}); !errors.Is(err, ErrInvalidGroup) {
+		t.Fatalf("create group with invalid effect: expected '%v', got '%v'", ErrInvalidGroup, err)
+	}
+
+	type testCase struct {
+		Name    string
+		Groups  []*Group
+		IsAdmin bool
+		Path    string
+		Allowed bool
+	}
+
+	testCases := []testCase{
+		{Name: "deny-overrides/allowed", Groups: []*Group{editors}, Path: "/shared/a.txt", Allowed: true},
+		{Name: "deny-overrides/denied", Groups: []*Group{editors}, Path: "/legal/a.txt", Allowed: false},
+		{Name: "first-match/allowed", Groups: []*Group{lenient}, Path: "/legal/a.txt", Allowed: true},
+		// A deny in any group prevails over the other groups
+		{Name: "groups/denied", Groups: []*Group{lenient, editors}, Path: "/legal/a.txt", Allowed: false},
+		{Name: "admin/denied", Groups: []*Group{editors}, IsAdmin: true, Path: "/legal/a.txt", Allowed: false},
+		{Name: "admin/allowed", IsAdmin: true, Path: "/legal/a.txt", Allowed: true},
+	}
+
+	for _, tc := range testCases {
+		user := &User{ID: 1, IsAdmin: tc.IsAdmin}
+		user.SetGroups(tc.Groups...)
+
+		decision := authz.Evaluate(ctx, user, authz.OperationOpen, map[string]any{"name": tc.Path, "flag": os.O_RDONLY})
+		if err := decision.Err(); err != nil {
+			t.Fatalf("%s: %+v", tc.Name, errors.WithStack(err))
+		}
+
+		if e, g := tc.Allowed, decision.Allowed(); e != g {
+			t.Errorf("%s: expected '%v', got '%v'", tc.Name, e, g)
+		}
+	}
+
+	// Effects and strategies are loaded with the users' groups
+	user, err := store.FindOrCreateUser(ctx, "jdoe", "test")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	user.SetGroups(editors)
+
+	if _, err := store.UpdateUser(ctx, user); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	users, err := store.GetUsers(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	decision := authz.Evaluate(ctx, users[0], authz.OperationOpen, map[string]any{"name": "/legal/a.txt", "flag": os.O_RDONLY})
+	if decision.Allowed() {
+		t.Errorf("stored user: expected operation on '/legal/a.txt' to be denied")
+	}
+}
+
+func TestGroupQuotas(t *testing.T) {
+	ctx := context.Background()
+
+	store := NewStore(filepath.Join(t.TempDir(), "groups.db"))
+
+	if _, err := store.CreateGroup(ctx, &Group{Name: "invalid", Quota: -1}); !errors.Is(err, ErrInvalidGroup) {
+		t.Fatalf("create group with negative quota: expected '%v', got '%v'", ErrInvalidGroup, err)
+	}
+
+	members, err := store.CreateGroup(ctx, &Group{Name: "members", Quota: 100})
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	team, err := store.CreateGroup(ctx, &Group{Name: "team", Quota: 1000, QuotaDir: "shared/team/"})
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := "/shared/team", team.QuotaDir; e != g {
+		t.Errorf("team.QuotaDir: expected '%v', got '%v'", e, g)
+	}
+
+	user, err := store.FindOrCreateUser(ctx, "jdoe", "test")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	user.SetGroups(members, team)
+
+	if _, err := store.UpdateUser(ctx, user); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	users, err := store.GetUsers(ctx, user.ID)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	limits := users[0].QuotaLimits()
+
+	expected := []quota.Limit{
+		{Dir: user.UserHome(), Bytes: 100},
+		{Dir: "/shared/team", Bytes: 1000},
+	}
+
+	if !slices.Equal(expected, limits) {
+		t.Errorf("QuotaLimits(): expected '%v', got '%v'", expected, limits)
+	}
+}
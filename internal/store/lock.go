@@ -0,0 +1,485 @@
+package store
+
+import (
+	"context"
+	"log/slog"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/bornholm/calli/pkg/log"
+	"github.com/pkg/errors"
+	"github.com/rs/xid"
+	"golang.org/x/net/webdav"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+var lockMigrations = []string{
+	`CREATE TABLE IF NOT EXISTS locks (
+		token TEXT PRIMARY KEY,
+		root TEXT NOT NULL,
+		zero_depth BOOLEAN NOT NULL,
+		owner_xml TEXT NOT NULL,
+		duration INTEGER NOT NULL,
+		expires_at INTEGER,
+		held_until INTEGER,
+		created_at INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL
+	);`,
+	`CREATE INDEX IF NOT EXISTS idx_locks_root ON locks(root);`,
+	`CREATE INDEX IF NOT EXISTS idx_locks_expires_at ON locks(expires_at);`,
+}
+
+// DefaultLockHoldTimeout is the maximum duration a lock stays held by a
+// confirmed request. It prevents a lock from being held forever when the
+// process holding it exits before releasing it.
+const DefaultLockHoldTimeout = time.Hour
+
+// DefaultLockMaxTimeout is the maximum duration of a lock. The infinite
+// locks, as the temporary ones created for the requests without lock,
+// expire after it so that they do not outlive a crashed request.
+const DefaultLockMaxTimeout = 24 * time.Hour
+
+// LockSystem implements webdav.LockSystem by persisting the locks in the store,
+// allowing them to survive restarts and to be shared between instances
+type LockSystem struct {
+	store       *Store
+	holdTimeout time.Duration
+	maxTimeout  time.Duration
+}
+
+// Confirm implements webdav.LockSystem.
+func (ls *LockSystem) Confirm(now time.Time, name0 string, name1 string, conditions ...webdav.Condition) (func(), error) {
+	ctx := context.Background()
+
+	var held []string
+
+	err := ls.store.Tx(ctx, func(conn *sqlite.Conn) error {
+		if err := ls.deleteExpiredLocks(conn, now); err != nil {
+			return errors.WithStack(err)
+		}
+
+		locks, err := ls.findAvailableLocks(conn, now, conditions)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		var token0, token1 string
+
+		if name0 != "" {
+			if token0 = lookupLock(locks, slashClean(name0), conditions); token0 == "" {
+				return errors.WithStack(webdav.ErrConfirmationFailed)
+			}
+
+			held = append(held, token0)
+		}
+
+		if name1 != "" {
+			if token1 = lookupLock(locks, slashClean(name1), conditions); token1 == "" {
+				return errors.WithStack(webdav.ErrConfirmationFailed)
+			}
+
+			// Don't hold the same lock twice
+			if token1 != token0 {
+				held = append(held, token1)
+			}
+		}
+
+		heldUntil := now.Add(ls.holdTimeout).UTC().Unix()
+
+		for _, token := range held {
+			err := sqlitex.Execute(conn, `UPDATE locks SET held_until = ? WHERE token = ?`, &sqlitex.ExecOptions{
+				Args: []any{heldUntil, token},
+			})
+			if err != nil {
+				return errors.WithStack(err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, webdav.ErrConfirmationFailed) {
+			return nil, webdav.ErrConfirmationFailed
+		}
+
+		return nil, errors.WithStack(err)
+	}
+
+	release := func() {
+		err := ls.store.Tx(ctx, func(conn *sqlite.Conn) error {
+			for _, token := range held {
+				err := sqlitex.Execute(conn, `UPDATE locks SET held_until = NULL WHERE token = ?`, &sqlitex.ExecOptions{
+					Args: []any{token},
+				})
+				if err != nil {
+					return errors.WithStack(err)
+				}
+			}
+
+			return nil
+		})
+		if err != nil {
+			err = errors.WithStack(err)
+			slog.ErrorContext(ctx, "could not release locks", log.Error(err))
+		}
+	}
+
+	return release, nil
+}
+
+// Create implements webdav.LockSystem.
+func (ls *LockSystem) Create(now time.Time, details webdav.LockDetails) (string, error) {
+	ctx := context.Background()
+
+	details.Root = slashClean(details.Root)
+	token := "urn:calli:lock:" + xid.New().String()
+
+	err := ls.store.Tx(ctx, func(conn *sqlite.Conn) error {
+		if err := ls.deleteExpiredLocks(conn, now); err != nil {
+			return errors.WithStack(err)
+		}
+
+		canCreate, err := canCreateLock(conn, details.Root, details.ZeroDepth)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		if !canCreate {
+			return errors.WithStack(webdav.ErrLocked)
+		}
+
+		timestamp := now.UTC().Unix()
+
+		query := `
+			INSERT INTO locks
+				(token, root, zero_depth, owner_xml, duration, expires_at, created_at, updated_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+		`
+
+		err = sqlitex.Execute(conn, query, &sqlitex.ExecOptions{
+			Args: []any{
+				token, details.Root, details.ZeroDepth, details.OwnerXML,
+				int64(details.Duration), ls.lockExpiry(now, details.Duration),
+				timestamp, timestamp,
+			},
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, webdav.ErrLocked) {
+			return "", webdav.ErrLocked
+		}
+
+		return "", errors.WithStack(err)
+	}
+
+	return token, nil
+}
+
+// Refresh implements webdav.LockSystem.
+func (ls *LockSystem) Refresh(now time.Time, token string, duration time.Duration) (webdav.LockDetails, error) {
+	ctx := context.Background()
+
+	var details webdav.LockDetails
+
+	err := ls.store.Tx(ctx, func(conn *sqlite.Conn) error {
+		if err := ls.deleteExpiredLocks(conn, now); err != nil {
+			return errors.WithStack(err)
+		}
+
+		lock, err := findLock(conn, token)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		if lock.isHeld(now) {
+			return errors.WithStack(webdav.ErrLocked)
+		}
+
+		query := `UPDATE locks SET duration = ?, expires_at = ?, updated_at = ? WHERE token = ?`
+
+		err = sqlitex.Execute(conn, query, &sqlitex.ExecOptions{
+			Args: []any{int64(duration), ls.lockExpiry(now, duration), now.UTC().Unix(), token},
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		details = lock.details
+		details.Duration = duration
+
+		return nil
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, webdav.ErrNoSuchLock):
+			return webdav.LockDetails{}, webdav.ErrNoSuchLock
+		case errors.Is(err, webdav.ErrLocked):
+			return webdav.LockDetails{}, webdav.ErrLocked
+		default:
+			return webdav.LockDetails{}, errors.WithStack(err)
+		}
+	}
+
+	return details, nil
+}
+
+// Unlock implements webdav.LockSystem.
+func (ls *LockSystem) Unlock(now time.Time, token string) error {
+	ctx := context.Background()
+
+	err := ls.store.Tx(ctx, func(conn *sqlite.Conn) error {
+		if err := ls.deleteExpiredLocks(conn, now); err != nil {
+			return errors.WithStack(err)
+		}
+
+		lock, err := findLock(conn, token)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		if lock.isHeld(now) {
+			return errors.WithStack(webdav.ErrLocked)
+		}
+
+		err = sqlitex.Execute(conn, `DELETE FROM locks WHERE token = ?`, &sqlitex.ExecOptions{
+			Args: []any{token},
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, webdav.ErrNoSuchLock):
+			return webdav.ErrNoSuchLock
+		case errors.Is(err, webdav.ErrLocked):
+			return webdav.ErrLocked
+		default:
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// DeleteExpiredLocks removes the locks which expired before the given time
+func (ls *LockSystem) DeleteExpiredLocks(ctx context.Context, now time.Time) error {
+	err := ls.store.Tx(ctx, func(conn *sqlite.Conn) error {
+		return errors.WithStack(ls.deleteExpiredLocks(conn, now))
+	})
+
+	return errors.WithStack(err)
+}
+
+// findAvailableLocks returns the locks identified by the given conditions
+// which are not held by another request
+func (ls *LockSystem) findAvailableLocks(conn *sqlite.Conn, now time.Time, conditions []webdav.Condition) (map[string]*lock, error) {
+	locks := make(map[string]*lock, len(conditions))
+
+	for _, c := range conditions {
+		if c.Token == "" {
+			continue
+		}
+
+		if _, exists := locks[c.Token]; exists {
+			continue
+		}
+
+		lock, err := findLock(conn, c.Token)
+		if err != nil {
+			if errors.Is(err, webdav.ErrNoSuchLock) {
+				continue
+			}
+
+			return nil, errors.WithStack(err)
+		}
+
+		if lock.isHeld(now) {
+			continue
+		}
+
+		locks[c.Token] = lock
+	}
+
+	return locks, nil
+}
+
+func NewLockSystem(store *Store, holdTimeout time.Duration, maxTimeout time.Duration) *LockSystem {
+	if holdTimeout <= 0 {
+		holdTimeout = DefaultLockHoldTimeout
+	}
+
+	if maxTimeout <= 0 {
+		maxTimeout = DefaultLockMaxTimeout
+	}
+
+	return &LockSystem{
+		store:       store,
+		holdTimeout: holdTimeout,
+		maxTimeout:  maxTimeout,
+	}
+}
+
+var _ webdav.LockSystem = &LockSystem{}
+
+type lock struct {
+	token     string
+	details   webdav.LockDetails
+	heldUntil int64
+}
+
+func (l *lock) isHeld(now time.Time) bool {
+	return l.heldUntil > now.UTC().Unix()
+}
+
+func findLock(conn *sqlite.Conn, token string) (*lock, error) {
+	var found *lock
+
+	query := `SELECT token, root, zero_depth, owner_xml, duration, held_until FROM locks WHERE token = ? LIMIT 1`
+
+	err := sqlitex.Execute(conn, query, &sqlitex.ExecOptions{
+		Args: []any{token},
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			found = &lock{
+				token: stmt.ColumnText(0),
+				details: webdav.LockDetails{
+					Root:      stmt.ColumnText(1),
+					ZeroDepth: stmt.ColumnBool(2),
+					OwnerXML:  stmt.ColumnText(3),
+					Duration:  time.Duration(stmt.ColumnInt64(4)),
+				},
+				heldUntil: stmt.ColumnInt64(5),
+			}
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if found == nil {
+		return nil, errors.WithStack(webdav.ErrNoSuchLock)
+	}
+
+	return found, nil
+}
+
+// lookupLock returns the token of the first lock identified by the given
+// conditions which covers the named resource
+func lookupLock(locks map[string]*lock, name string, conditions []webdav.Condition) string {
+	for _, c := range conditions {
+		l, exists := locks[c.Token]
+		if !exists {
+			continue
+		}
+
+		if name == l.details.Root {
+			return l.token
+		}
+
+		if l.details.ZeroDepth {
+			continue
+		}
+
+		if l.details.Root == "/" || strings.HasPrefix(name, l.details.Root+"/") {
+			return l.token
+		}
+	}
+
+	return ""
+}
+
+// canCreateLock checks that the given resource is not already covered by
+// an existing lock and, for infinite depth locks, that none of its
+// descendants are locked
+func canCreateLock(conn *sqlite.Conn, root string, zeroDepth bool) (bool, error) {
+	conflicts := 0
+
+	countConflicts := func(stmt *sqlite.Stmt) error {
+		conflicts += int(stmt.ColumnInt64(0))
+		return nil
+	}
+
+	err := sqlitex.Execute(conn, `SELECT COUNT(*) FROM locks WHERE root = ?`, &sqlitex.ExecOptions{
+		Args:       []any{root},
+		ResultFunc: countConflicts,
+	})
+	if err != nil {
+		return false, errors.WithStack(err)
+	}
+
+	if !zeroDepth {
+		query := `SELECT COUNT(*) FROM locks WHERE ? = '/' OR substr(root, 1, length(?) + 1) = ? || '/'`
+		err := sqlitex.Execute(conn, query, &sqlitex.ExecOptions{
+			Args:       []any{root, root, root},
+			ResultFunc: countConflicts,
+		})
+		if err != nil {
+			return false, errors.WithStack(err)
+		}
+	}
+
+	for parent := root; parent != "/"; {
+		parent = path.Dir(parent)
+
+		err := sqlitex.Execute(conn, `SELECT COUNT(*) FROM locks WHERE root = ? AND zero_depth = 0`, &sqlitex.ExecOptions{
+			Args:       []any{parent},
+			ResultFunc: countConflicts,
+		})
+		if err != nil {
+			return false, errors.WithStack(err)
+		}
+	}
+
+	return conflicts == 0, nil
+}
+
+// deleteExpiredLocks removes the expired locks, and the locks without
+// expiration not refreshed for longer than the maximum timeout, which
+// were stored before their duration was capped
+func (ls *LockSystem) deleteExpiredLocks(conn *sqlite.Conn, now time.Time) error {
+	timestamp := now.UTC().Unix()
+
+	query := `
+		DELETE FROM locks
+		WHERE (
+			(expires_at IS NOT NULL AND expires_at <= ?)
+			OR (expires_at IS NULL AND updated_at <= ?)
+		)
+		AND (held_until IS NULL OR held_until <= ?)
+	`
+
+	err := sqlitex.Execute(conn, query, &sqlitex.ExecOptions{
+		Args: []any{timestamp, now.Add(-ls.maxTimeout).UTC().Unix(), timestamp},
+	})
+
+	return errors.WithStack(err)
+}
+
+// lockExpiry returns the expiration timestamp of a lock created at the
+// given time, the infinite and longer durations being capped to the
+// maximum timeout
+func (ls *LockSystem) lockExpiry(now time.Time, duration time.Duration) int64 {
+	if duration < 0 || duration > ls.maxTimeout {
+		duration = ls.maxTimeout
+	}
+
+	return now.Add(duration).UTC().Unix()
+}
+
+func slashClean(name string) string {
+	if name == "" || name[0] != '/' {
+		name = "/" + name
+	}
+
+	return path.Clean(name)
+}
@@ -0,0 +1,131 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/webdav"
+)
+
+func TestLockSystem(t *testing.T) {
+	ctx := context.Background()
+	uri := filepath.Join(t.TempDir(), "locks.db")
+
+	store := NewStore(uri)
+	if err := store.HealthCheck(ctx); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	ls := NewLockSystem(store, time.Minute, time.Hour)
+	now := time.Now()
+
+	token, err := ls.Create(now, webdav.LockDetails{
+		Root:     "/foo",
+		Duration: time.Minute,
+		OwnerXML: "<D:owner>test</D:owner>",
+	})
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if _, err := ls.Create(now, webdav.LockDetails{Root: "/foo/bar", ZeroDepth: true, Duration: time.Minute}); !errors.Is(err, webdav.ErrLocked) {
+		t.Fatalf("create child lock: expected '%v', got '%v'", webdav.ErrLocked, err)
+	}
+
+	if _, err := ls.Create(now, webdav.LockDetails{Root: "/", Duration: time.Minute}); !errors.Is(err, webdav.ErrLocked) {
+		t.Fatalf("create parent lock: expected '%v', got '%v'", webdav.ErrLocked, err)
+	}
+
+	if _, err := ls.Confirm(now, "/foo/bar", "", webdav.Condition{Token: "unknown"}); !errors.Is(err, webdav.ErrConfirmationFailed) {
+		t.Fatalf("confirm with unknown token: expected '%v', got '%v'", webdav.ErrConfirmationFailed, err)
+	}
+
+	release, err := ls.Confirm(now, "/foo/bar", "", webdav.Condition{Token: token})
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if err := ls.Unlock(now, token); !errors.Is(err, webdav.ErrLocked) {
+		t.Fatalf("unlock held lock: expected '%v', got '%v'", webdav.ErrLocked, err)
+	}
+
+	release()
+
+	// Locks must survive a new store instance
+	store = NewStore(uri)
+	ls = NewLockSystem(store, time.Minute, time.Hour)
+
+	details, err := ls.Refresh(now, token, 2*time.Minute)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := "/foo", details.Root; e != g {
+		t.Errorf("details.Root: expected '%v', got '%v'", e, g)
+	}
+
+	if e, g := "<D:owner>test</D:owner>", details.OwnerXML; e != g {
+		t.Errorf("details.OwnerXML: expected '%v', got '%v'", e, g)
+	}
+
+	if e, g := 2*time.Minute, details.Duration; e != g {
+		t.Errorf("details.Duration: expected '%v', got '%v'", e, g)
+	}
+
+	later := now.Add(3 * time.Minute)
+
+	if _, err := ls.Refresh(later, token, time.Minute); !errors.Is(err, webdav.ErrNoSuchLock) {
+		t.Fatalf("refresh expired lock: expected '%v', got '%v'", webdav.ErrNoSuchLock, err)
+	}
+
+	token, err = ls.Create(later, webdav.LockDetails{Root: "/foo/bar", ZeroDepth: true, Duration: -1})
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if err := ls.Unlock(later, token); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if err := ls.Unlock(later, token); !errors.Is(err, webdav.ErrNoSuchLock) {
+		t.Fatalf("unlock removed lock: expected '%v', got '%v'", webdav.ErrNoSuchLock, err)
+	}
+}
+
+func TestLockSystemStaleInfiniteLock(t *testing.T) {
+	ctx := context.Background()
+	uri := filepath.Join(t.TempDir(), "locks.db")
+
+	store := NewStore(uri)
+	if err := store.HealthCheck(ctx); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	ls := NewLockSystem(store, time.Minute, time.Hour)
+	now := time.Now()
+
+	// As the temporary locks of the requests, never unlocked if the process crashes
+	if _, err := ls.Create(now, webdav.LockDetails{Root: "/foo", Duration: -1}); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if _, err := ls.Create(now.Add(30*time.Minute), webdav.LockDetails{Root: "/foo", Duration: time.Minute}); !errors.Is(err, webdav.ErrLocked) {
+		t.Fatalf("create lock on locked resource: expected '%v', got '%v'", webdav.ErrLocked, err)
+	}
+
+	// A new instance reclaims it once the maximum timeout elapsed
+	ls = NewLockSystem(NewStore(uri), time.Minute, time.Hour)
+
+	later := now.Add(2 * time.Hour)
+
+	if err := ls.DeleteExpiredLocks(ctx, later); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if _, err := ls.Create(later, webdav.LockDetails{Root: "/foo", Duration: time.Minute}); err != nil {
+		t.Fatalf("create lock on reclaimed resource: %+v", errors.WithStack(err))
+	}
+}
@@ -0,0 +1,108 @@
+package store
+
+import (
+	"sync"
+	"time"
+
+	"github.com/bornholm/calli/internal/authz"
+	"github.com/bornholm/calli/internal/authz/expr"
+)
+
+// adminRule grants an admin every operation, unless denied by
+// the rules of their groups
+var adminRule = expr.NewRule("true")
+
+// policy holds the groups of a user along with their compiled rules
+type policy struct {
+	groups []*Group
+	rules  []*authz.Group
+}
+
+func newPolicy(groups []*Group) *policy {
+	rules := make([]*authz.Group, 0, len(groups))
+
+	for _, g := range groups {
+		groupRules := make([]authz.Rule, 0, len(g.Rules))
+		for _, r := range g.Rules {
+			groupRules = append(groupRules, r.authzRule())
+		}
+
+		rules = append(rules, authz.NewGroup(g.Name, g.Strategy, groupRules...))
+	}
+
+	return &policy{
+		groups: groups,
+		rules:  rules,
+	}
+}
+
+// PolicyCacheTTL is the lifetime of a cached policy. The invalidations
+// being local to the process, it bounds the delay after which the changes
+// made by other processes sharing the database apply.
+const PolicyCacheTTL = 30 * time.Second
+
+// policyCache keeps the users' policies between requests. Every change
+// to the groups, their rules or their members invalidates the whole cache.
+type policyCache struct {
+	ttl        time.Duration
+	mutex      sync.RWMutex
+	generation uint64
+	policies   map[int64]cachedPolicy
+}
+
+type cachedPolicy struct {
+	policy  *policy
+	expires time.Time
+}
+
+// Generation returns the current generation of the cache. It must be read
+// before loading a policy from the database, see Store.joinUserPolicy.
+func (c *policyCache) Generation() uint64 {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return c.generation
+}
+
+func (c *policyCache) Load(userID int64) (*policy, bool) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	cached, exists := c.policies[userID]
+	if !exists || !cached.expires.After(time.Now()) {
+		return nil, false
+	}
+
+	return cached.policy, true
+}
+
+// Store caches the given policy unless the cache was invalidated since
+// the given generation, the policy being possibly outdated
+func (c *policyCache) Store(generation uint64, userID int64, p *policy) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+
+	c.policies[userID] = cachedPolicy{
+		policy:  p,
+		expires: time.Now().Add(c.ttl),
+	}
+}
+
+func (c *policyCache) Invalidate() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.generation++
+	clear(c.policies)
+}
+
+func newPolicyCache(ttl time.Duration) *policyCache {
+	return &policyCache{
+		ttl:      ttl,
+		policies: make(map[int64]cachedPolicy),
+	}
+}
@@ -0,0 +1,199 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bornholm/calli/internal/authz"
+	"github.com/pkg/errors"
+)
+
+func TestPolicyCache(t *testing.T) {
+	ctx := context.Background()
+
+	store := NewStore(filepath.Join(t.TempDir(), "policies.db"))
+
+	group, err := store.CreateGroup(ctx, &Group{
+		Name:  "readers",
+		Rules: []*Rule{{Script: "operation == OP_STAT"}},
+	})
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	user, err := store.FindOrCreateUser(ctx, "subject", "provider")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	user.SetGroups(group)
+
+	if _, err := store.UpdateUser(ctx, user); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	assertAllowed := func(operation authz.Operation, expected bool) {
+		t.Helper()
+
+		user, err := store.FindOrCreateUser(ctx, "subject", "provider")
+		if err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		decision := authz.Evaluate(ctx, user, operation, nil)
+		if e, g := expected, decision.Allowed(); e != g {
+			t.Errorf("%s: expected '%v', got '%v'", operation, e, g)
+		}
+	}
+
+	assertAllowed(authz.OperationStat, true)
+	// Served from the cache
+	assertAllowed(authz.OperationStat, true)
+	assertAllowed(authz.OperationMkdir, false)
+
+	group.Rules = append(group.Rules, &Rule{Script: "operation == OP_MKDIR"})
+
+	if _, err := store.UpdateGroup(ctx, group); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	assertAllowed(authz.OperationMkdir, true)
+
+	user.SetGroups()
+
+	if _, err := store.UpdateUser(ctx, user); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	assertAllowed(authz.OperationStat, false)
+}
+
+// TestPolicyCacheReplica checks that the changes made by another
+// process sharing the database apply once the cached policies expire
+func TestPolicyCacheReplica(t *testing.T) {
+	ctx := context.Background()
+
+	uri := filepath.Join(t.TempDir(), "policies.db")
+
+	store := NewStore(uri)
+
+	replica := NewStore(uri)
+	replica.policies = newPolicyCache(100 * time.Millisecond)
+
+	group, err := store.CreateGroup(ctx, &Group{
+		Name:  "readers",
+		Rules: []*Rule{{Script: "operation == OP_STAT"}},
+	})
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	user, err := store.FindOrCreateUser(ctx, "subject", "provider")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	user.SetGroups(group)
+
+	if _, err := store.UpdateUser(ctx, user); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	assertAllowed := func(expected bool) {
+		t.Helper()
+
+		user, err := replica.FindOrCreateUser(ctx, "subject", "provider")
+		if err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		decision := authz.Evaluate(ctx, user, authz.OperationStat, nil)
+		if e, g := expected, decision.Allowed(); e != g {
+			t.Errorf("expected '%v', got '%v'", e, g)
+		}
+	}
+
+	assertAllowed(true)
+
+	user.SetGroups()
+
+	if _, err := store.UpdateUser(ctx, user); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	// Served from the replica's cache
+	assertAllowed(true)
+
+	time.Sleep(150 * time.Millisecond)
+
+	assertAllowed(false)
+}
+
+// BenchmarkUserPolicy loads a user and evaluates its rules for a listing
+// of a directory, as during a PROPFIND request
+func BenchmarkUserPolicy(b *testing.B) {
+	ctx := context.Background()
+
+	store := NewStore(filepath.Join(b.TempDir(), "policies.db"))
+
+	groups := make([]*Group, 0)
+	for i := range 3 {
+		group, err := store.CreateGroup(ctx, &Group{
+			Name: fmt.Sprintf("group-%d", i),
+			Rules: []*Rule{
+				{Script: "operation == OP_OPEN && bitand(flag, O_WRITE) == 0"},
+				{Script: fmt.Sprintf("operation == OP_MKDIR && name startsWith '/group-%d/'", i)},
+				{Script: "operation == OP_REMOVE && name startsWith home", Effect: authz.EffectDeny},
+				{Script: "operation == OP_STAT"},
+			},
+		})
+		if err != nil {
+			b.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		groups = append(groups, group)
+	}
+
+	user, err := store.FindOrCreateUser(ctx, "subject", "provider")
+	if err != nil {
+		b.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	user.SetGroups(groups...)
+
+	if _, err := store.UpdateUser(ctx, user); err != nil {
+		b.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	listing := func(b *testing.B) {
+		user, err := store.FindOrCreateUser(ctx, "subject", "provider")
+		if err != nil {
+			b.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		for i := range 50 {
+			decision := authz.Evaluate(ctx, user, authz.OperationStat, map[string]any{
+				"name": fmt.Sprintf("/group-0/file-%d", i),
+			})
+			if !decision.Allowed() {
+				b.Fatalf("%+v", errors.WithStack(decision.Err()))
+			}
+		}
+	}
+
+	b.Run("uncached", func(b *testing.B) {
+		for b.Loop() {
+			store.policies.Invalidate()
+			listing(b)
+		}
+	})
+
+	b.Run("cached", func(b *testing.B) {
+		for b.Loop() {
+			listing(b)
+		}
+	})
+}
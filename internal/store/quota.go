@@ -0,0 +1,106 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/bornholm/calli/internal/quota"
+	"github.com/pkg/errors"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// quotaMigrations add the groups quota and the usages
+// of the directories with limits
+var quotaMigrations = []string{
+	`ALTER TABLE groups ADD COLUMN quota INTEGER NOT NULL DEFAULT 0;`,
+	`ALTER TABLE groups ADD COLUMN quota_dir TEXT NOT NULL DEFAULT '';`,
+	`CREATE TABLE IF NOT EXISTS quota_usages (
+		dir TEXT PRIMARY KEY,
+		used INTEGER NOT NULL,
+		updated_at INTEGER NOT NULL
+	);`,
+}
+
+// QuotaUsages implements quota.Store.
+func (s *Store) QuotaUsages(ctx context.Context) (map[string]int64, error) {
+	usages := make(map[string]int64)
+
+	err := s.Do(ctx, func(conn *sqlite.Conn) error {
+		return errors.WithStack(sqlitex.Execute(conn, "SELECT dir, used FROM quota_usages", &sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				usages[stmt.ColumnText(0)] = stmt.ColumnInt64(1)
+				return nil
+			},
+		}))
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return usages, nil
+}
+
+// SetQuotaUsage implements quota.Store.
+func (s *Store) SetQuotaUsage(ctx context.Context, dir string, used int64) error {
+	return s.Do(ctx, func(conn *sqlite.Conn) error {
+		query := `
+			INSERT INTO quota_usages (dir, used, updated_at) VALUES (?, ?, ?)
+			ON CONFLICT(dir) DO UPDATE SET used = excluded.used, updated_at = excluded.updated_at
+		`
+
+		return errors.WithStack(sqlitex.Execute(conn, query, &sqlitex.ExecOptions{
+			Args: []any{dir, max(used, 0), time.Now().UTC().Unix()},
+		}))
+	})
+}
+
+// AddQuotaUsage implements quota.Store.
+func (s *Store) AddQuotaUsage(ctx context.Context, delta int64, dirs ...string) error {
+	if len(dirs) == 0 || delta == 0 {
+		return nil
+	}
+
+	placeholders, args := dirsArgs(dirs)
+
+	return s.Do(ctx, func(conn *sqlite.Conn) error {
+		query := fmt.Sprintf("UPDATE quota_usages SET used = MAX(used + ?, 0), updated_at = ? WHERE dir IN (%s)", placeholders)
+
+		return errors.WithStack(sqlitex.Execute(conn, query, &sqlitex.ExecOptions{
+			Args: append([]any{delta, time.Now().UTC().Unix()}, args...),
+		}))
+	})
+}
+
+// DeleteQuotaUsages implements quota.Store.
+func (s *Store) DeleteQuotaUsages(ctx context.Context, dirs ...string) error {
+	if len(dirs) == 0 {
+		return nil
+	}
+
+	placeholders, args := dirsArgs(dirs)
+
+	return s.Do(ctx, func(conn *sqlite.Conn) error {
+		query := fmt.Sprintf("DELETE FROM quota_usages WHERE dir IN (%s)", placeholders)
+
+		return errors.WithStack(sqlitex.Execute(conn, query, &sqlitex.ExecOptions{
+			Args: args,
+		}))
+	})
+}
+
+var _ quota.Store = &Store{}
+
+func dirsArgs(dirs []string) (string, []any) {
+	placeholders := make([]string, len(dirs))
+	args := make([]any, len(dirs))
+
+	for i, dir := range dirs {
+		placeholders[i] = "?"
+		args[i] = dir
+	}
+
+	return strings.Join(placeholders, ", "), args
+}
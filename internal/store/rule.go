@@ -2,6 +2,9 @@ package store
 
 import (
 	"time"
+
+	"github.com/bornholm/calli/internal/authz"
+	"github.com/bornholm/calli/internal/authz/expr"
 )
 
 var ruleMigrations = []string{
@@ -16,6 +19,13 @@ var ruleMigrations = []string{
 	);`,
 }
 
+// effectMigrations add the rules effect and the groups strategy,
+// existing rules keeping their allow-only behavior
+var effectMigrations = []string{
+	`ALTER TABLE rules ADD COLUMN effect TEXT NOT NULL DEFAULT 'allow';`,
+	`ALTER TABLE groups ADD COLUMN strategy TEXT NOT NULL DEFAULT 'deny-overrides';`,
+}
+
 type Rule struct {
 	ID int64
 
@@ -25,5 +35,17 @@ type Rule struct {
 	Script    string
 	SortOrder int
 
+	// Effect is applied when the rule matches, EffectAllow if empty
+	Effect authz.Effect
+
 	Group *Group
 }
+
+func (r *Rule) authzRule() authz.Rule {
+	effect := r.Effect
+	if effect == "" {
+		effect = authz.EffectAllow
+	}
+
+	return expr.NewRuleWithEffect(r.Script, effect)
+}
@@ -2,7 +2,6 @@ package store
 
 import (
 	"context"
-	"strings"
 
 	"github.com/pkg/errors"
 	"zombiezen.com/go/sqlite"
@@ -11,7 +10,8 @@ import (
 )
 
 type Store struct {
-	pool *sqlitemigration.Pool
+	pool     *sqlitemigration.Pool
+	policies *policyCache
 }
 
 var schema = sqlitemigration.Schema{
@@ -19,11 +19,14 @@ var schema = sqlitemigration.Schema{
 		userMigrations,
 		groupMigrations,
 		ruleMigrations,
-	),
-	RepeatableMigration: strings.Join(
-		flatten(
-			repeatableGroupMigrations,
-		), " ",
+		lockMigrations,
+		seedGroupMigrations,
+		managedGroupMigrations,
+		homeGroupMigrations,
+		auditMigrations,
+		effectMigrations,
+		quotaMigrations,
+		trashMigrations,
 	),
 }
 
@@ -74,7 +77,8 @@ func NewStore(uri string) *Store {
 	})
 
 	return &Store{
-		pool: pool,
+		pool:     pool,
+		policies: newPolicyCache(PolicyCacheTTL),
 	}
 }
 
@@ -0,0 +1,167 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/bornholm/calli/internal/trash"
+	"github.com/pkg/errors"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+var trashMigrations = []string{
+	`CREATE TABLE IF NOT EXISTS trash_entries (
+		id INTEGER PRIMARY KEY,
+
+		subject TEXT NOT NULL,
+		provider TEXT NOT NULL,
+
+		path TEXT NOT NULL,
+		trash_path TEXT NOT NULL,
+
+		is_dir INTEGER NOT NULL,
+		size INTEGER NOT NULL,
+		deleted_at INTEGER NOT NULL
+	);`,
+	`CREATE INDEX IF NOT EXISTS idx_trash_entries_user ON trash_entries(subject, provider);`,
+	`CREATE INDEX IF NOT EXISTS idx_trash_entries_deleted_at ON trash_entries(deleted_at);`,
+}
+
+const trashEntryAttributes = "id, subject, provider, path, trash_path, is_dir, size, deleted_at"
+
+// CreateTrashEntry implements trash.Store.
+func (s *Store) CreateTrashEntry(ctx context.Context, entry *trash.Entry) error {
+	err := s.Do(ctx, func(conn *sqlite.Conn) error {
+		deletedAt := entry.DeletedAt
+		if deletedAt.IsZero() {
+			deletedAt = time.Now()
+		}
+
+		query := `
+			INSERT INTO trash_entries (subject, provider, path, trash_path, is_dir, size, deleted_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?) RETURNING id
+		`
+
+		err := sqlitex.Execute(conn, query, &sqlitex.ExecOptions{
+			Args: []any{
+				entry.Subject, entry.Provider, entry.Path, entry.TrashPath,
+				entry.IsDir, entry.Size, deletedAt.UTC().Unix(),
+			},
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				entry.ID = stmt.ColumnInt64(0)
+				return nil
+			},
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// GetTrashEntries implements trash.Store.
+func (s *Store) GetTrashEntries(ctx context.Context, subject string, provider string) ([]*trash.Entry, error) {
+	query := fmt.Sprintf(`
+		SELECT %s FROM trash_entries
+		WHERE subject = ? AND provider = ?
+		ORDER BY deleted_at DESC, id DESC
+	`, trashEntryAttributes)
+
+	entries, err := s.queryTrashEntries(ctx, query, subject, provider)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return entries, nil
+}
+
+// GetTrashEntry implements trash.Store.
+func (s *Store) GetTrashEntry(ctx context.Context, id int64) (*trash.Entry, error) {
+	query := fmt.Sprintf(`SELECT %s FROM trash_entries WHERE id = ?`, trashEntryAttributes)
+
+	entries, err := s.queryTrashEntries(ctx, query, id)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if len(entries) == 0 {
+		return nil, errors.Wrapf(trash.ErrNotFound, "could not find trash entry '%d'", id)
+	}
+
+	return entries[0], nil
+}
+
+// GetExpiredTrashEntries implements trash.Store.
+func (s *Store) GetExpiredTrashEntries(ctx context.Context, before time.Time) ([]*trash.Entry, error) {
+	query := fmt.Sprintf(`
+		SELECT %s FROM trash_entries
+		WHERE deleted_at < ?
+		ORDER BY deleted_at ASC, id ASC
+	`, trashEntryAttributes)
+
+	entries, err := s.queryTrashEntries(ctx, query, before.UTC().Unix())
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return entries, nil
+}
+
+// DeleteTrashEntries implements trash.Store.
+func (s *Store) DeleteTrashEntries(ctx context.Context, ids ...int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return s.Tx(ctx, func(conn *sqlite.Conn) error {
+		for _, id := range ids {
+			err := sqlitex.Execute(conn, "DELETE FROM trash_entries WHERE id = ?", &sqlitex.ExecOptions{
+				Args: []any{id},
+			})
+			if err != nil {
+				return errors.WithStack(err)
+			}
+		}
+
+		return nil
+	})
+}
+
+var _ trash.Store = &Store{}
+
+func (s *Store) queryTrashEntries(ctx context.Context, query string, args ...any) ([]*trash.Entry, error) {
+	entries := make([]*trash.Entry, 0)
+
+	err := s.Do(ctx, func(conn *sqlite.Conn) error {
+		return errors.WithStack(sqlitex.Execute(conn, query, &sqlitex.ExecOptions{
+			Args: args,
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				entries = append(entries, &trash.Entry{
+					ID:        stmt.ColumnInt64(0),
+					Subject:   stmt.ColumnText(1),
+					Provider:  stmt.ColumnText(2),
+					Path:      stmt.ColumnText(3),
+					TrashPath: stmt.ColumnText(4),
+					IsDir:     stmt.ColumnBool(5),
+					Size:      stmt.ColumnInt64(6),
+					DeletedAt: time.Unix(stmt.ColumnInt64(7), 0),
+				})
+
+				return nil
+			},
+		}))
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return entries, nil
+}
@@ -0,0 +1,82 @@
+package store
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bornholm/calli/internal/trash"
+	"github.com/pkg/errors"
+)
+
+func TestTrashEntries(t *testing.T) {
+	ctx := context.Background()
+	uri := filepath.Join(t.TempDir(), "trash.db")
+
+	store := NewStore(uri)
+	if err := store.HealthCheck(ctx); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	now := time.Now()
+
+	entries := []*trash.Entry{
+		{Subject: "jdoe", Provider: "test", Path: "/old.txt", TrashPath: "/.trash/test/jdoe/1", Size: 3, DeletedAt: now.Add(-48 * time.Hour)},
+		{Subject: "jdoe", Provider: "test", Path: "/docs", TrashPath: "/.trash/test/jdoe/2", IsDir: true, DeletedAt: now},
+		{Subject: "other", Provider: "test", Path: "/new.txt", TrashPath: "/.trash/test/other/3", DeletedAt: now},
+	}
+
+	for _, e := range entries {
+		if err := store.CreateTrashEntry(ctx, e); err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+	}
+
+	userEntries, err := store.GetTrashEntries(ctx, "jdoe", "test")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := 2, len(userEntries); e != g {
+		t.Fatalf("len(userEntries): expected '%v', got '%v'", e, g)
+	}
+
+	if e, g := "/docs", userEntries[0].Path; e != g {
+		t.Errorf("userEntries[0].Path: expected '%v', got '%v'", e, g)
+	}
+
+	if !userEntries[0].IsDir {
+		t.Errorf("userEntries[0].IsDir: expected 'true', got 'false'")
+	}
+
+	expired, err := store.GetExpiredTrashEntries(ctx, now.Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := 1, len(expired); e != g {
+		t.Fatalf("len(expired): expected '%v', got '%v'", e, g)
+	}
+
+	if e, g := entries[0].ID, expired[0].ID; e != g {
+		t.Errorf("expired[0].ID: expected '%v', got '%v'", e, g)
+	}
+
+	if err := store.DeleteTrashEntries(ctx, entries[0].ID, entries[1].ID); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if _, err := store.GetTrashEntry(ctx, entries[0].ID); !errors.Is(err, trash.ErrNotFound) {
+		t.Errorf("get deleted entry: expected '%v', got '%v'", trash.ErrNotFound, err)
+	}
+
+	entry, err := store.GetTrashEntry(ctx, entries[2].ID)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := "/.trash/test/other/3", entry.TrashPath; e != g {
+		t.Errorf("entry.TrashPath: expected '%v', got '%v'", e, g)
+	}
+}
@@ -4,11 +4,12 @@ import (
 	"context"
 	"fmt"
 	"slices"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/bornholm/calli/internal/authz"
-	"github.com/bornholm/calli/internal/authz/expr"
+	"github.com/bornholm/calli/internal/quota"
 	"github.com/pkg/errors"
 	"zombiezen.com/go/sqlite"
 	"zombiezen.com/go/sqlite/sqlitex"
@@ -57,48 +58,62 @@ type User struct {
 	BasicPassword []byte
 
 	groups []*Group
+	policy *policy
 }
 
 // Groups implements authz.User.
 func (u *User) FileSystemGroups() []*authz.Group {
-	return slices.Collect(func(yield func(*authz.Group) bool) {
-		for _, g := range u.groups {
-			rules := slices.Collect(func(yield func(authz.Rule) bool) {
-				for _, r := range g.Rules {
-					if !yield(expr.NewRule(r.Script)) {
-						return
-					}
-				}
-			})
-			if !yield(authz.NewGroup(g.Name, rules...)) {
-				return
-			}
-		}
-	})
+	if u.policy != nil {
+		return u.policy.rules
+	}
+
+	return newPolicy(u.groups).rules
 }
 
 // FileSystemRules implements authz.User.
 func (u *User) FileSystemRules() []authz.Rule {
-	rules := make([]authz.Rule, 0)
-
 	if u.IsAdmin {
-		// An admin can access everything on any filesystem
-		rules = append(rules, expr.NewRule("true"))
+		return []authz.Rule{adminRule}
 	}
 
-	groupRules := slices.Collect(func(yield func(authz.Rule) bool) {
-		for _, g := range u.groups {
-			for _, r := range g.Rules {
-				if !yield(expr.NewRule(r.Script)) {
-					return
-				}
-			}
+	return []authz.Rule{}
+}
+
+// QuotaLimits implements quota.User. The most generous limit applies
+// when several groups limit the same directory.
+func (u *User) QuotaLimits() []quota.Limit {
+	limits := make([]quota.Limit, 0)
+
+	for _, g := range u.groups {
+		if g.Quota <= 0 {
+			continue
 		}
-	})
 
-	rules = append(rules, groupRules...)
+		dir := g.QuotaDir
+		if dir == "" {
+			dir = u.UserHome()
+		}
 
-	return rules
+		if dir == "" {
+			continue
+		}
+
+		i := slices.IndexFunc(limits, func(l quota.Limit) bool { return l.Dir == dir })
+		if i == -1 {
+			limits = append(limits, quota.Limit{Dir: dir, Bytes: g.Quota})
+			continue
+		}
+
+		limits[i].Bytes = max(limits[i].Bytes, g.Quota)
+	}
+
+	return limits
+}
+
+// SetGroups replaces the groups the user belongs to
+func (u *User) SetGroups(groups ...*Group) {
+	u.groups = groups
+	u.policy = nil
 }
 
 // Provider implements authn.User.
@@ -111,9 +126,40 @@ func (u *User) UserSubject() string {
 	return u.Subject
 }
 
-var _ authz.User = &User{}
+// UserEmail implements authz.Profile.
+func (u *User) UserEmail() string {
+	return u.Email
+}
+
+// UserNickname implements authz.Profile.
+func (u *User) UserNickname() string {
+	return u.Nickname
+}
+
+// UserBasicUsername implements authz.Profile.
+func (u *User) UserBasicUsername() string {
+	return u.BasicUsername
+}
+
+// UserHome implements authz.Profile.
+func (u *User) UserHome() string {
+	if u.ID == 0 {
+		// The user is not persisted yet
+		return ""
+	}
+
+	return authz.HomeDir(strconv.FormatInt(u.ID, 10))
+}
+
+var (
+	_ authz.User    = &User{}
+	_ authz.Profile = &User{}
+	_ quota.User    = &User{}
+)
 
 func (s *Store) FindOrCreateUser(ctx context.Context, subject, provider string) (*User, error) {
+	generation := s.policies.Generation()
+
 	var user *User
 	err := s.Tx(ctx, func(conn *sqlite.Conn) error {
 		query := fmt.Sprintf(`SELECT %s FROM users WHERE subject = ? AND provider = ? LIMIT 1`, userAttributes)
@@ -129,7 +175,7 @@ func (s *Store) FindOrCreateUser(ctx context.Context, subject, provider string)
 		}
 
 		if user != nil {
-			if err := s.joinUserGroups(ctx, conn, user); err != nil {
+			if err := s.joinUserPolicy(ctx, conn, generation, user); err != nil {
 				return errors.WithStack(err)
 			}
 
@@ -156,7 +202,7 @@ func (s *Store) FindOrCreateUser(ctx context.Context, subject, provider string)
 			return errors.WithStack(err)
 		}
 
-		if err := s.joinUserGroups(ctx, conn, user); err != nil {
+		if err := s.joinUserPolicy(ctx, conn, generation, user); err != nil {
 			return errors.WithStack(err)
 		}
 
@@ -169,70 +215,83 @@ func (s *Store) FindOrCreateUser(ctx context.Context, subject, provider string)
 	return user, nil
 }
 
+// joinUserPolicy joins the user's groups and their compiled rules from
+// the policy cache, loading them from the database on a miss. The given
+// generation must be read before the transaction's first query in order
+// not to cache a policy outdated by a concurrent change.
+func (s *Store) joinUserPolicy(ctx context.Context, conn *sqlite.Conn, generation uint64, user *User) error {
+	if p, exists := s.policies.Load(user.ID); exists {
+		user.groups = p.groups
+		user.policy = p
+		return nil
+	}
+
+	if err := s.joinUserGroups(ctx, conn, user); err != nil {
+		return errors.WithStack(err)
+	}
+
+	p := newPolicy(user.groups)
+	s.policies.Store(generation, user.ID, p)
+
+	user.policy = p
+
+	return nil
+}
+
 func (s *Store) joinUserGroups(ctx context.Context, conn *sqlite.Conn, user *User) error {
-	// Query to fetch groups associated with a user through the users_groups table
+	// Fetch the user's groups and their rules at once, groups
+	// without rules being returned with null rule columns
 	query := `
-		SELECT g.id, g.name, g.created_at, g.updated_at
+		SELECT g.id, g.name, g.created_at, g.updated_at, g.managed, g.strategy, g.quota, g.quota_dir,
+			r.id, r.script, r.sort_order, r.created_at, r.updated_at, r.effect
 		FROM groups g
 		JOIN users_groups ug ON g.id = ug.group_id
+		LEFT JOIN rules r ON r.group_id = g.id
 		WHERE ug.user_id = ?
-		ORDER BY g.id
+		ORDER BY g.id, r.sort_order, r.id
 	`
 
 	user.groups = make([]*Group, 0)
 
-	// Execute the query to fetch groups
+	var group *Group
+
 	err := sqlitex.Execute(conn, query, &sqlitex.ExecOptions{
 		Args: []any{user.ID},
 		ResultFunc: func(stmt *sqlite.Stmt) error {
-			// Create a group from the row
-			group := &Group{
-				ID:        stmt.ColumnInt64(0),
-				Name:      stmt.ColumnText(1),
-				CreatedAt: time.Unix(stmt.ColumnInt64(2), 0),
-				UpdatedAt: time.Unix(stmt.ColumnInt64(3), 0),
-				Rules:     make([]*Rule, 0),
+			if group == nil || group.ID != stmt.ColumnInt64(0) {
+				group = &Group{Rules: make([]*Rule, 0)}
+				bindGroup(stmt, group)
+
+				user.groups = append(user.groups, group)
 			}
 
-			// Fetch rules for this group
-			rulesQuery := `
-				SELECT id, script, sort_order, created_at, updated_at
-				FROM rules
-				WHERE group_id = ?
-				ORDER BY sort_order
-			`
-
-			err := sqlitex.Execute(conn, rulesQuery, &sqlitex.ExecOptions{
-				Args: []any{group.ID},
-				ResultFunc: func(stmt *sqlite.Stmt) error {
-					rule := &Rule{
-						ID:        stmt.ColumnInt64(0),
-						Script:    stmt.ColumnText(1),
-						SortOrder: int(stmt.ColumnInt64(2)),
-						CreatedAt: time.Unix(stmt.ColumnInt64(3), 0),
-						UpdatedAt: time.Unix(stmt.ColumnInt64(4), 0),
-						Group:     group,
-					}
-
-					group.Rules = append(group.Rules, rule)
-					return nil
-				},
-			})
-			if err != nil {
-				return errors.WithStack(err)
+			if stmt.ColumnType(8) == sqlite.TypeNull {
+				return nil
 			}
 
-			// Add the group to the user's groups
-			user.groups = append(user.groups, group)
+			group.Rules = append(group.Rules, &Rule{
+				ID:        stmt.ColumnInt64(8),
+				Script:    stmt.ColumnText(9),
+				SortOrder: int(stmt.ColumnInt64(10)),
+				CreatedAt: time.Unix(stmt.ColumnInt64(11), 0),
+				UpdatedAt: time.Unix(stmt.ColumnInt64(12), 0),
+				Effect:    authz.Effect(stmt.ColumnText(13)),
+				Group:     group,
+			})
 
 			return nil
 		},
 	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
 
-	return errors.WithStack(err)
+	return nil
 }
 
 func (s *Store) UpdateUser(ctx context.Context, user *User) (*User, error) {
+	defer s.policies.Invalidate()
+
 	var updatedUser *User
 
 	err := s.Tx(ctx, func(conn *sqlite.Conn) error {
@@ -303,6 +362,8 @@ func (s *Store) DeleteUsers(ctx context.Context, userIDs ...int64) error {
 		return nil
 	}
 
+	defer s.policies.Invalidate()
+
 	return s.Tx(ctx, func(conn *sqlite.Conn) error {
 		// Build the query with placeholders for each ID
 		placeholders := make([]string, len(userIDs))
@@ -0,0 +1,53 @@
+package trash
+
+import (
+	"encoding/xml"
+	"os"
+
+	"github.com/bornholm/calli/pkg/webdav/filesystem"
+	"golang.org/x/net/webdav"
+)
+
+// File hides the trash from the listing of its parent directory
+type File struct {
+	webdav.File
+	hidden string
+}
+
+// Readdir implements webdav.File.
+func (f *File) Readdir(count int) ([]os.FileInfo, error) {
+	for {
+		infos, err := f.File.Readdir(count)
+
+		visible := make([]os.FileInfo, 0, len(infos))
+		for _, info := range infos {
+			if info.Name() == f.hidden {
+				continue
+			}
+
+			visible = append(visible, info)
+		}
+
+		// Do not return an empty page while entries remain
+		if len(visible) == 0 && len(infos) > 0 && count > 0 && err == nil {
+			continue
+		}
+
+		return visible, err
+	}
+}
+
+// DeadProps implements webdav.DeadPropsHolder.
+func (f *File) DeadProps() (map[xml.Name]webdav.Property, error) {
+	return filesystem.DeadProps(f.File)
+}
+
+// Patch implements webdav.DeadPropsHolder.
+func (f *File) Patch(patches []webdav.Proppatch) ([]webdav.Propstat, error) {
+	return filesystem.Patch(f.File, patches)
+}
+
+var (
+	_ webdav.File            = &File{}
+	_ webdav.DeadPropsHolder = &File{}
+)
@@ -0,0 +1,357 @@
+package trash
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/bornholm/calli/internal/authz"
+	"github.com/bornholm/calli/pkg/log"
+	"github.com/pkg/errors"
+	"golang.org/x/net/webdav"
+)
+
+// FileSystem moves the resources removed by the context's user to their
+// own directory of the trash, hidden from the clients, instead of deleting
+// them. The resources removed without user in the context are deleted.
+// Each mount point has its own trash, the resources never leaving the
+// mount owning them.
+type FileSystem struct {
+	backend webdav.FileSystem
+	store   Store
+	dir     string
+
+	// Mount points of the backend, the longest first
+	mountPoints []string
+}
+
+// Mkdir implements webdav.FileSystem.
+func (f *FileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	if f.hidden(name) {
+		return os.ErrPermission
+	}
+
+	return f.backend.Mkdir(ctx, name, perm)
+}
+
+// OpenFile implements webdav.FileSystem.
+func (f *FileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if f.hidden(name) {
+		return nil, os.ErrNotExist
+	}
+
+	file, err := f.backend.OpenFile(ctx, name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, m := range f.mountPoints {
+		if clean(name) == path.Dir(path.Join(m, f.dir)) {
+			return &File{File: file, hidden: path.Base(f.dir)}, nil
+		}
+	}
+
+	return file, nil
+}
+
+// RemoveAll implements webdav.FileSystem.
+func (f *FileSystem) RemoveAll(ctx context.Context, name string) error {
+	name = clean(name)
+
+	if f.hidden(name) {
+		return os.ErrNotExist
+	}
+
+	user, err := authz.ContextUser(ctx)
+	if err != nil {
+		return f.backend.RemoveAll(ctx, name)
+	}
+
+	trashDir := f.trashDir(name)
+
+	// The trash itself can not be moved to the trash
+	if inDir(trashDir, name) {
+		return errors.Wrapf(os.ErrPermission, "could not remove '%s' containing the trash", name)
+	}
+
+	info, err := f.backend.Stat(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	entry := &Entry{
+		Subject:   user.UserSubject(),
+		Provider:  user.UserProvider(),
+		Path:      name,
+		IsDir:     info.IsDir(),
+		DeletedAt: time.Now(),
+	}
+
+	if !info.IsDir() {
+		entry.Size = info.Size()
+	}
+
+	userDir := path.Join(trashDir, url.PathEscape(entry.Provider), url.PathEscape(entry.Subject))
+
+	if err := f.mkdirAll(ctx, userDir); err != nil {
+		return errors.WithStack(err)
+	}
+
+	entry.TrashPath = path.Join(userDir, randomName())
+
+	if err := f.backend.Rename(ctx, name, entry.TrashPath); err != nil {
+		return errors.Wrapf(err, "could not move '%s' to the trash", name)
+	}
+
+	if err := f.store.CreateTrashEntry(ctx, entry); err != nil {
+		// Put the resource back rather than losing track of it
+		if renameErr := f.backend.Rename(ctx, entry.TrashPath, name); renameErr != nil {
+			slog.ErrorContext(ctx, "could not restore untracked trash entry", log.Error(errors.WithStack(renameErr)), slog.String("path", entry.TrashPath))
+		}
+
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Rename implements webdav.FileSystem.
+func (f *FileSystem) Rename(ctx context.Context, oldName string, newName string) error {
+	if f.hidden(oldName) || f.hidden(newName) {
+		return os.ErrPermission
+	}
+
+	return f.backend.Rename(ctx, oldName, newName)
+}
+
+// Stat implements webdav.FileSystem.
+func (f *FileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	if f.hidden(name) {
+		return nil, os.ErrNotExist
+	}
+
+	return f.backend.Stat(ctx, name)
+}
+
+// Entries returns the trash entries of the context's user, most recent first
+func (f *FileSystem) Entries(ctx context.Context) ([]*Entry, error) {
+	user, err := authz.ContextUser(ctx)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	entries, err := f.store.GetTrashEntries(ctx, user.UserSubject(), user.UserProvider())
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return entries, nil
+}
+
+// Restore moves the given entry of the context's user back to its original
+// path, or to the given one if not empty. The user must be allowed to create
+// the resource and ErrConflict is returned if it already exists.
+func (f *FileSystem) Restore(ctx context.Context, id int64, name string) error {
+	user, err := authz.ContextUser(ctx)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	entry, err := f.entry(ctx, user, id)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if name == "" {
+		name = entry.Path
+	}
+
+	name = clean(name)
+
+	if name == "/" || f.hidden(name) {
+		return errors.Wrapf(os.ErrPermission, "could not restore to '%s'", name)
+	}
+
+	decision := authz.Evaluate(ctx, user, authz.OperationOpen, map[string]any{
+		"name": name,
+		"flag": os.O_WRONLY | os.O_CREATE | os.O_EXCL,
+		"perm": os.ModePerm,
+	})
+	if entry.IsDir {
+		decision = authz.Evaluate(ctx, user, authz.OperationMkdir, map[string]any{
+			"name": name,
+			"perm": os.ModePerm,
+		})
+	}
+
+	if err := decision.Err(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if !decision.Allowed() {
+		return errors.Wrapf(os.ErrPermission, "could not restore to '%s'", name)
+	}
+
+	if _, err := f.backend.Stat(ctx, name); err == nil {
+		return errors.Wrapf(ErrConflict, "'%s' already exists", name)
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return errors.WithStack(err)
+	}
+
+	if _, err := f.backend.Stat(ctx, path.Dir(name)); err != nil {
+		return errors.Wrapf(err, "could not restore to '%s'", name)
+	}
+
+	if err := f.backend.Rename(ctx, entry.TrashPath, name); err != nil {
+		return errors.Wrapf(err, "could not restore '%s' to '%s'", entry.TrashPath, name)
+	}
+
+	if err := f.store.DeleteTrashEntries(ctx, entry.ID); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Empty deletes the trash entries of the context's user
+func (f *FileSystem) Empty(ctx context.Context) error {
+	entries, err := f.Entries(ctx)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := f.delete(ctx, entries); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Purge deletes the trash entries of every user deleted before the given time
+func (f *FileSystem) Purge(ctx context.Context, before time.Time) error {
+	entries, err := f.store.GetExpiredTrashEntries(ctx, before)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := f.delete(ctx, entries); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+func (f *FileSystem) delete(ctx context.Context, entries []*Entry) error {
+	ids := make([]int64, 0, len(entries))
+
+	for _, e := range entries {
+		// Remove the resources outside of the context's user operations
+		if err := f.backend.RemoveAll(context.WithoutCancel(ctx), e.TrashPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return errors.Wrapf(err, "could not remove '%s'", e.TrashPath)
+		}
+
+		ids = append(ids, e.ID)
+	}
+
+	if err := f.store.DeleteTrashEntries(ctx, ids...); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// entry returns the given entry if it belongs to the given user
+func (f *FileSystem) entry(ctx context.Context, user authz.User, id int64) (*Entry, error) {
+	entry, err := f.store.GetTrashEntry(ctx, id)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if entry.Subject != user.UserSubject() || entry.Provider != user.UserProvider() {
+		return nil, errors.Wrapf(ErrNotFound, "could not find trash entry '%d'", id)
+	}
+
+	return entry, nil
+}
+
+// hidden returns true if the named resource belongs to a trash
+func (f *FileSystem) hidden(name string) bool {
+	name = clean(name)
+
+	for _, m := range f.mountPoints {
+		if inDir(name, path.Join(m, f.dir)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// trashDir returns the trash of the mount point owning the named resource
+func (f *FileSystem) trashDir(name string) string {
+	for _, m := range f.mountPoints {
+		if inDir(name, m) {
+			return path.Join(m, f.dir)
+		}
+	}
+
+	return f.dir
+}
+
+func (f *FileSystem) mkdirAll(ctx context.Context, dir string) error {
+	current := "/"
+
+	for _, segment := range strings.Split(strings.Trim(dir, "/"), "/") {
+		current = path.Join(current, segment)
+
+		if err := f.backend.Mkdir(ctx, current, os.ModePerm); err != nil && !errors.Is(err, os.ErrExist) {
+			return errors.Wrapf(err, "could not create directory '%s'", current)
+		}
+	}
+
+	return nil
+}
+
+func randomName() string {
+	buff := make([]byte, 8)
+	rand.Read(buff)
+
+	return hex.EncodeToString(buff)
+}
+
+// NewFileSystem returns a trash keeping the resources removed from the
+// given backend in the given directory of their mount point, the root
+// being the only mount point if none is given
+func NewFileSystem(backend webdav.FileSystem, store Store, dir string, mountPoints ...string) *FileSystem {
+	if dir == "" {
+		dir = DefaultDir
+	}
+
+	points := []string{"/"}
+	for _, m := range mountPoints {
+		if m = clean(m); !slices.Contains(points, m) {
+			points = append(points, m)
+		}
+	}
+
+	// The most specific mount point owns the resources
+	slices.SortStableFunc(points, func(a, b string) int {
+		return len(b) - len(a)
+	})
+
+	return &FileSystem{
+		backend:     backend,
+		store:       store,
+		dir:         clean(dir),
+		mountPoints: points,
+	}
+}
+
+var _ webdav.FileSystem = &FileSystem{}
@@ -0,0 +1,318 @@
+package trash
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bornholm/calli/internal/authz"
+	"github.com/bornholm/calli/pkg/webdav/filesystem/mount"
+	"github.com/pkg/errors"
+	"golang.org/x/net/webdav"
+)
+
+type testRule func(env map[string]any) (bool, error)
+
+func (r testRule) Exec(env map[string]any) (bool, error) { return r(env) }
+func (r testRule) Effect() authz.Effect                  { return authz.EffectAllow }
+
+type testUser struct {
+	subject string
+	rules   []authz.Rule
+}
+
+func (u *testUser) UserSubject() string              { return u.subject }
+func (u *testUser) UserProvider() string             { return "test" }
+func (u *testUser) FileSystemGroups() []*authz.Group { return nil }
+func (u *testUser) FileSystemRules() []authz.Rule    { return u.rules }
+
+var _ authz.User = &testUser{}
+
+type testStore struct {
+	mutex   sync.Mutex
+	entries []*Entry
+	nextID  int64
+}
+
+func (s *testStore) CreateTrashEntry(ctx context.Context, entry *Entry) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.nextID++
+	entry.ID = s.nextID
+
+	s.entries = append(s.entries, entry)
+
+	return nil
+}
+
+func (s *testStore) GetTrashEntries(ctx context.Context, subject string, provider string) ([]*Entry, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entries := make([]*Entry, 0)
+	for _, e := range slices.Backward(s.entries) {
+		if e.Subject == subject && e.Provider == provider {
+			entries = append(entries, e)
+		}
+	}
+
+	return entries, nil
+}
+
+func (s *testStore) GetTrashEntry(ctx context.Context, id int64) (*Entry, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, e := range s.entries {
+		if e.ID == id {
+			return e, nil
+		}
+	}
+
+	return nil, errors.WithStack(ErrNotFound)
+}
+
+func (s *testStore) GetExpiredTrashEntries(ctx context.Context, before time.Time) ([]*Entry, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	entries := make([]*Entry, 0)
+	for _, e := range s.entries {
+		if e.DeletedAt.Before(before) {
+			entries = append(entries, e)
+		}
+	}
+
+	return entries, nil
+}
+
+func (s *testStore) DeleteTrashEntries(ctx context.Context, ids ...int64) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.entries = slices.DeleteFunc(s.entries, func(e *Entry) bool {
+		return slices.Contains(ids, e.ID)
+	})
+
+	return nil
+}
+
+var _ Store = &testStore{}
+
+func TestFileSystem(t *testing.T) {
+	backend := webdav.NewMemFS()
+
+	fs := NewFileSystem(backend, &testStore{}, "")
+
+	allowAll := testRule(func(env map[string]any) (bool, error) { return true, nil })
+
+	ctx := authz.WithContextUser(context.Background(), &testUser{subject: "jdoe", rules: []authz.Rule{allowAll}})
+
+	write := func(name string, content string) {
+		file, err := fs.OpenFile(ctx, name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.ModePerm)
+		if err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		if _, err := io.WriteString(file, content); err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		if err := file.Close(); err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+	}
+
+	entries := func(ctx context.Context) []*Entry {
+		entries, err := fs.Entries(ctx)
+		if err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		return entries
+	}
+
+	if err := fs.Mkdir(ctx, "/docs", os.ModePerm); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	write("/docs/a.txt", "a")
+
+	if err := fs.RemoveAll(ctx, "/docs/a.txt"); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if _, err := fs.Stat(ctx, "/docs/a.txt"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("stat removed file: expected '%v', got '%v'", os.ErrNotExist, err)
+	}
+
+	// The trash is hidden
+	if _, err := fs.Stat(ctx, DefaultDir); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("stat trash: expected '%v', got '%v'", os.ErrNotExist, err)
+	}
+
+	root, err := fs.OpenFile(ctx, "/", os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	infos, err := root.Readdir(-1)
+	root.Close()
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := 1, len(infos); e != g {
+		t.Errorf("len(infos): expected '%v', got '%v'", e, g)
+	}
+
+	// The entries are only visible to their owner
+	other := authz.WithContextUser(context.Background(), &testUser{subject: "other", rules: []authz.Rule{allowAll}})
+
+	if e, g := 0, len(entries(other)); e != g {
+		t.Errorf("len(entries(other)): expected '%v', got '%v'", e, g)
+	}
+
+	trashed := entries(ctx)
+	if e, g := 1, len(trashed); e != g {
+		t.Fatalf("len(entries): expected '%v', got '%v'", e, g)
+	}
+
+	if err := fs.Restore(other, trashed[0].ID, ""); !errors.Is(err, ErrNotFound) {
+		t.Errorf("restore other's entry: expected '%v', got '%v'", ErrNotFound, err)
+	}
+
+	// A new file took the place of the removed one
+	write("/docs/a.txt", "b")
+
+	if err := fs.Restore(ctx, trashed[0].ID, ""); !errors.Is(err, ErrConflict) {
+		t.Fatalf("restore over existing file: expected '%v', got '%v'", ErrConflict, err)
+	}
+
+	denied := authz.WithContextUser(context.Background(), &testUser{subject: "jdoe"})
+
+	if err := fs.Restore(denied, trashed[0].ID, "/docs/c.txt"); !errors.Is(err, os.ErrPermission) {
+		t.Errorf("restore without permission: expected '%v', got '%v'", os.ErrPermission, err)
+	}
+
+	if err := fs.Restore(ctx, trashed[0].ID, "/docs/c.txt"); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if _, err := fs.Stat(ctx, "/docs/c.txt"); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := 0, len(entries(ctx)); e != g {
+		t.Errorf("len(entries): expected '%v', got '%v'", e, g)
+	}
+
+	// Expired entries are permanently deleted
+	if err := fs.RemoveAll(ctx, "/docs"); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	trashed = entries(ctx)
+	if e, g := 1, len(trashed); e != g {
+		t.Fatalf("len(entries): expected '%v', got '%v'", e, g)
+	}
+
+	if err := fs.Purge(ctx, time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := 0, len(entries(ctx)); e != g {
+		t.Errorf("len(entries): expected '%v', got '%v'", e, g)
+	}
+
+	if _, err := backend.Stat(ctx, trashed[0].TrashPath); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("stat purged entry: expected '%v', got '%v'", os.ErrNotExist, err)
+	}
+}
+
+func TestFileSystemMounts(t *testing.T) {
+	docs := webdav.NewMemFS()
+	archive := webdav.NewMemFS()
+
+	// No filesystem is mounted on the root
+	fs := NewFileSystem(mount.NewFileSystem(
+		mount.Mount{Path: "/docs", FileSystem: docs},
+		mount.Mount{Path: "/archive", FileSystem: archive},
+	), &testStore{}, "", "/docs", "/archive")
+
+	allowAll := testRule(func(env map[string]any) (bool, error) { return true, nil })
+
+	ctx := authz.WithContextUser(context.Background(), &testUser{subject: "jdoe", rules: []authz.Rule{allowAll}})
+
+	for _, name := range []string{"/docs/a.txt", "/archive/b.txt"} {
+		file, err := fs.OpenFile(ctx, name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.ModePerm)
+		if err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		if err := file.Close(); err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		if err := fs.RemoveAll(ctx, name); err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+	}
+
+	// Each resource is kept in the trash of its own mount
+	for _, backend := range []webdav.FileSystem{docs, archive} {
+		if _, err := backend.Stat(ctx, DefaultDir); err != nil {
+			t.Errorf("stat mount's trash: %+v", errors.WithStack(err))
+		}
+	}
+
+	entries, err := fs.Entries(ctx)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := 2, len(entries); e != g {
+		t.Fatalf("len(entries): expected '%v', got '%v'", e, g)
+	}
+
+	for _, entry := range entries {
+		if e, g := path.Dir(entry.Path)+DefaultDir, entry.TrashPath; !strings.HasPrefix(g, e+"/") {
+			t.Errorf("trash path of '%s': expected '%v' prefix, got '%v'", entry.Path, e, g)
+		}
+
+		if err := fs.Restore(ctx, entry.ID, ""); err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		if _, err := fs.Stat(ctx, entry.Path); err != nil {
+			t.Errorf("stat restored '%s': %+v", entry.Path, errors.WithStack(err))
+		}
+	}
+
+	// The trashes are hidden
+	if _, err := fs.Stat(ctx, "/docs"+DefaultDir); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("stat trash: expected '%v', got '%v'", os.ErrNotExist, err)
+	}
+
+	dir, err := fs.OpenFile(ctx, "/archive", os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	infos, err := dir.Readdir(-1)
+	dir.Close()
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := 1, len(infos); e != g {
+		t.Errorf("len(infos): expected '%v', got '%v'", e, g)
+	}
+}
@@ -0,0 +1,64 @@
+package trash
+
+import (
+	"context"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	ErrNotFound = errors.New("not found")
+	ErrConflict = errors.New("conflict")
+)
+
+// DefaultDir is the default directory of the trashed resources
+const DefaultDir = "/.trash"
+
+// Entry is a resource moved to the trash
+type Entry struct {
+	ID int64
+
+	// User who deleted the resource
+	Subject  string
+	Provider string
+
+	// Original path of the resource
+	Path string
+	// Path of the resource in the trash
+	TrashPath string
+
+	IsDir     bool
+	Size      int64
+	DeletedAt time.Time
+}
+
+// Store keeps the entries of the trash
+type Store interface {
+	// CreateTrashEntry records the entry, setting its identifier
+	CreateTrashEntry(ctx context.Context, entry *Entry) error
+	// GetTrashEntries returns the entries of the given user, most recent first
+	GetTrashEntries(ctx context.Context, subject string, provider string) ([]*Entry, error)
+	// GetTrashEntry returns the given entry or ErrNotFound
+	GetTrashEntry(ctx context.Context, id int64) (*Entry, error)
+	// GetExpiredTrashEntries returns the entries deleted before the given time
+	GetExpiredTrashEntries(ctx context.Context, before time.Time) ([]*Entry, error)
+	// DeleteTrashEntries deletes the given entries
+	DeleteTrashEntries(ctx context.Context, ids ...int64) error
+}
+
+// inDir returns true if the named resource is the given directory
+// or one of its descendants
+func inDir(name string, dir string) bool {
+	if dir == "/" {
+		return true
+	}
+
+	return name == dir || strings.HasPrefix(name, dir+"/")
+}
+
+func clean(name string) string {
+	return path.Clean("/" + name)
+}
@@ -2,7 +2,12 @@ package all
 
 import (
 	_ "github.com/bornholm/calli/pkg/webdav/filesystem/cor"
+	_ "github.com/bornholm/calli/pkg/webdav/filesystem/dedup"
+	_ "github.com/bornholm/calli/pkg/webdav/filesystem/encrypted"
 	_ "github.com/bornholm/calli/pkg/webdav/filesystem/local"
+	_ "github.com/bornholm/calli/pkg/webdav/filesystem/mount"
+	_ "github.com/bornholm/calli/pkg/webdav/filesystem/props"
 	_ "github.com/bornholm/calli/pkg/webdav/filesystem/s3"
 	_ "github.com/bornholm/calli/pkg/webdav/filesystem/sqlite"
+	_ "github.com/bornholm/calli/pkg/webdav/filesystem/versioned"
 )
@@ -2,14 +2,17 @@ package capped
 
 import (
 	"context"
+	"encoding/xml"
 	"io"
 	"os"
 	"path"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
+	"github.com/bornholm/calli/pkg/webdav/filesystem"
 	"github.com/pkg/errors"
 	"golang.org/x/net/webdav"
 )
@@ -25,6 +28,9 @@ type FileSystem struct {
 	files   map[string]*fileInfo
 	curSize int64
 
+	// Number of files deleted to respect the size limit
+	evictions atomic.Uint64
+
 	// Flag to indicate if initial scan has been done
 	initialized bool
 }
@@ -467,6 +473,8 @@ func (f *FileSystem) ensureSpace(ctx context.Context, name string, additionalSiz
 			continue
 		}
 
+		f.evictions.Add(1)
+
 		// Update tracking after successful removal
 		f.mu.Lock()
 		// Double-check the file is still in our tracking (might have been removed by another operation)
@@ -575,6 +583,24 @@ func (f *File) Write(p []byte) (n int, err error) {
 	return n, err
 }
 
+// Size returns the current tracked size of the files
+func (f *FileSystem) Size() int64 {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+
+	return f.curSize
+}
+
+// MaxSize returns the size limit of the filesystem
+func (f *FileSystem) MaxSize() int64 {
+	return f.maxSize
+}
+
+// Evictions returns the number of files deleted to respect the size limit
+func (f *FileSystem) Evictions() uint64 {
+	return f.evictions.Load()
+}
+
 // NewFileSystem creates a new size-capped filesystem
 func NewFileSystem(fs webdav.FileSystem, maxSize int64) *FileSystem {
 	return &FileSystem{
@@ -585,5 +611,16 @@ func NewFileSystem(fs webdav.FileSystem, maxSize int64) *FileSystem {
 	}
 }
 
+// DeadProps implements webdav.DeadPropsHolder.
+func (f *File) DeadProps() (map[xml.Name]webdav.Property, error) {
+	return filesystem.DeadProps(f.file)
+}
+
+// Patch implements webdav.DeadPropsHolder.
+func (f *File) Patch(patches []webdav.Proppatch) ([]webdav.Propstat, error) {
+	return filesystem.Patch(f.file, patches)
+}
+
 var _ webdav.FileSystem = &FileSystem{}
 var _ webdav.File = &File{}
+var _ webdav.DeadPropsHolder = &File{}
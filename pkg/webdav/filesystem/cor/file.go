@@ -1,13 +1,21 @@
 package cor
 
 import (
+	"context"
+	"encoding/xml"
 	"io/fs"
+	"os"
+	"path"
 
+	"github.com/bornholm/calli/pkg/webdav/filesystem"
+	"github.com/pkg/errors"
 	"golang.org/x/net/webdav"
 )
 
 // File implements webdav.File for the Copy-on-Read filesystem
 type File struct {
+	ctx context.Context
+
 	// The underlying file from either cache or backend
 	file webdav.File
 
@@ -36,7 +44,7 @@ func (f *File) Readdir(count int) ([]fs.FileInfo, error) {
 	// Check if there's a cached directory listing
 	entries, ok := f.fs.getCachedDirectoryListing(f.name)
 	if ok {
-		return entries, nil
+		return f.wrapCachedInfos(entries), nil
 	}
 
 	// Get directory listing from the file
@@ -48,7 +56,7 @@ func (f *File) Readdir(count int) ([]fs.FileInfo, error) {
 	// Cache the directory listing
 	f.fs.cacheDirectoryListing(f.name, entries)
 
-	return entries, nil
+	return f.wrapCachedInfos(entries), nil
 }
 
 // Seek implements webdav.File.
@@ -58,7 +66,27 @@ func (f *File) Seek(offset int64, whence int) (int64, error) {
 
 // Stat implements webdav.File.
 func (f *File) Stat() (fs.FileInfo, error) {
-	return f.file.Stat()
+	info, err := f.file.Stat()
+	if err != nil || !f.fromCache {
+		return info, err
+	}
+
+	return f.fs.wrapCachedInfo(f.name, info), nil
+}
+
+// wrapCachedInfos reports the tags of the backend files
+// for the entries listed from the cache
+func (f *File) wrapCachedInfos(entries []fs.FileInfo) []fs.FileInfo {
+	if !f.fromCache {
+		return entries
+	}
+
+	wrapped := make([]fs.FileInfo, len(entries))
+	for i, e := range entries {
+		wrapped[i] = f.fs.wrapCachedInfo(path.Join(f.name, e.Name()), e)
+	}
+
+	return wrapped
 }
 
 // Write implements webdav.File.
@@ -79,4 +107,40 @@ func (f *File) Write(p []byte) (n int, err error) {
 	return n, nil
 }
 
-var _ webdav.File = &File{}
\ No newline at end of file
+// DeadProps implements webdav.DeadPropsHolder.
+func (f *File) DeadProps() (map[xml.Name]webdav.Property, error) {
+	if !f.fromCache {
+		return filesystem.DeadProps(f.file)
+	}
+
+	// The properties are held by the backend only
+	backendFile, err := f.fs.backend.OpenFile(f.ctx, f.name, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	defer backendFile.Close()
+
+	return filesystem.DeadProps(backendFile)
+}
+
+// Patch implements webdav.DeadPropsHolder.
+func (f *File) Patch(patches []webdav.Proppatch) ([]webdav.Propstat, error) {
+	if !f.fromCache {
+		return filesystem.Patch(f.file, patches)
+	}
+
+	backendFile, err := f.fs.backend.OpenFile(f.ctx, f.name, os.O_RDWR, 0)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	defer backendFile.Close()
+
+	return filesystem.Patch(backendFile, patches)
+}
+
+var (
+	_ webdav.File            = &File{}
+	_ webdav.DeadPropsHolder = &File{}
+)
\ No newline at end of file
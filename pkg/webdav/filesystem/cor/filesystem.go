@@ -2,11 +2,13 @@ package cor
 
 import (
 	"context"
+	"encoding/xml"
 	"io"
 	"os"
 	"path"
 	"sync"
 
+	"github.com/bornholm/calli/pkg/webdav/filesystem"
 	"golang.org/x/net/webdav"
 )
 
@@ -20,6 +22,9 @@ type FileSystem struct {
 
 	// Cache for directory listings using sync.Map for concurrent access
 	dirCache sync.Map // map[string][]os.FileInfo
+
+	// Tags of the backend files copied to the cache
+	tags sync.Map // map[string]backendTags
 }
 
 // Mkdir implements webdav.FileSystem.
@@ -74,6 +79,7 @@ func (f *FileSystem) OpenFile(ctx context.Context, name string, flag int, perm o
 	if err == nil {
 		// File exists in cache, use it
 		return &File{
+			ctx:       ctx,
 			file:      cacheFile,
 			fs:        f,
 			name:      name,
@@ -97,6 +103,7 @@ func (f *FileSystem) OpenFile(ctx context.Context, name string, flag int, perm o
 	if info.IsDir() {
 		// For directories, no special handling needed
 		return &File{
+			ctx:       ctx,
 			file:      backendFile,
 			fs:        f,
 			name:      name,
@@ -108,6 +115,7 @@ func (f *FileSystem) OpenFile(ctx context.Context, name string, flag int, perm o
 	if err := f.copyToCache(ctx, name, backendFile, info); err != nil {
 		// If copying to cache fails, just use the backend file directly
 		return &File{
+			ctx:       ctx,
 			file:      backendFile,
 			fs:        f,
 			name:      name,
@@ -127,6 +135,7 @@ func (f *FileSystem) OpenFile(ctx context.Context, name string, flag int, perm o
 			return nil, err
 		}
 		return &File{
+			ctx:       ctx,
 			file:      backendFile,
 			fs:        f,
 			name:      name,
@@ -135,6 +144,7 @@ func (f *FileSystem) OpenFile(ctx context.Context, name string, flag int, perm o
 	}
 
 	return &File{
+		ctx:       ctx,
 		file:      cacheFile,
 		fs:        f,
 		name:      name,
@@ -153,6 +163,8 @@ func (f *FileSystem) RemoveAll(ctx context.Context, name string) error {
 	// Remove from cache as well (ignore errors)
 	_ = f.cache.RemoveAll(ctx, name)
 
+	f.forgetTags(name)
+
 	// Invalidate parent directory cache
 	f.invalidateDirectoryCache(path.Dir(name))
 
@@ -170,6 +182,9 @@ func (f *FileSystem) Rename(ctx context.Context, oldName string, newName string)
 	// Rename on cache as well (ignore errors)
 	_ = f.cache.Rename(ctx, oldName, newName)
 
+	f.forgetTags(oldName)
+	f.forgetTags(newName)
+
 	// Invalidate parent directory caches for both old and new paths
 	f.invalidateDirectoryCache(path.Dir(oldName))
 	if path.Dir(oldName) != path.Dir(newName) {
@@ -184,7 +199,7 @@ func (f *FileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error)
 	// Try stat from cache first
 	info, err := f.cache.Stat(ctx, name)
 	if err == nil {
-		return info, nil
+		return f.wrapCachedInfo(name, info), nil
 	}
 
 	// If not in cache, get from backend
@@ -254,6 +269,8 @@ func (f *FileSystem) copyToCache(ctx context.Context, name string, backendFile w
 		return err
 	}
 
+	f.rememberTags(ctx, name, info)
+
 	return nil
 }
 
@@ -320,6 +337,8 @@ func (f *writeThroughFile) Close() error {
 	// Invalidate parent directory cache
 	f.fs.invalidateDirectoryCache(path.Dir(f.name))
 
+	f.fs.forgetTags(f.name)
+
 	if backendErr != nil {
 		return backendErr
 	}
@@ -381,5 +400,16 @@ func (f *writeThroughFile) Write(p []byte) (n int, err error) {
 	return n, nil
 }
 
+// DeadProps implements webdav.DeadPropsHolder.
+func (f *writeThroughFile) DeadProps() (map[xml.Name]webdav.Property, error) {
+	return filesystem.DeadProps(f.backendFile)
+}
+
+// Patch implements webdav.DeadPropsHolder.
+func (f *writeThroughFile) Patch(patches []webdav.Proppatch) ([]webdav.Propstat, error) {
+	return filesystem.Patch(f.backendFile, patches)
+}
+
 var _ webdav.File = &writeThroughFile{}
+var _ webdav.DeadPropsHolder = &writeThroughFile{}
 var _ webdav.FileSystem = &FileSystem{}
@@ -0,0 +1,83 @@
+package cor
+
+import (
+	"context"
+	"os"
+	"strings"
+
+	"github.com/bornholm/calli/pkg/webdav/filesystem"
+)
+
+// backendTags are the ETag and content type of a backend file,
+// its cached copy being a different file
+type backendTags struct {
+	etag        string
+	contentType string
+}
+
+// rememberTags records the tags of the given backend file
+func (f *FileSystem) rememberTags(ctx context.Context, name string, info os.FileInfo) {
+	var tags backendTags
+
+	if etag, err := filesystem.ETag(ctx, info); err == nil {
+		tags.etag = etag
+	}
+
+	if contentType, err := filesystem.ContentType(ctx, info); err == nil {
+		tags.contentType = contentType
+	}
+
+	f.tags.Store(name, tags)
+}
+
+// forgetTags removes the tags of the given file and of its descendants
+func (f *FileSystem) forgetTags(name string) {
+	prefix := strings.TrimSuffix(name, "/") + "/"
+
+	f.tags.Range(func(key, value any) bool {
+		if key == name || strings.HasPrefix(key.(string), prefix) {
+			f.tags.Delete(key)
+		}
+
+		return true
+	})
+}
+
+// cachedFileInfo reports the tags of the backend file instead
+// of the ones of its cached copy, when known
+type cachedFileInfo struct {
+	os.FileInfo
+	fs   *FileSystem
+	name string
+}
+
+func (f *FileSystem) wrapCachedInfo(name string, info os.FileInfo) os.FileInfo {
+	return &cachedFileInfo{FileInfo: info, fs: f, name: name}
+}
+
+// ETag implements webdav.ETager.
+func (fi *cachedFileInfo) ETag(ctx context.Context) (string, error) {
+	if tags, ok := fi.tags(); ok && tags.etag != "" {
+		return tags.etag, nil
+	}
+
+	return filesystem.ETag(ctx, fi.FileInfo)
+}
+
+// ContentType implements webdav.ContentTyper.
+func (fi *cachedFileInfo) ContentType(ctx context.Context) (string, error) {
+	if tags, ok := fi.tags(); ok && tags.contentType != "" {
+		return tags.contentType, nil
+	}
+
+	return filesystem.ContentType(ctx, fi.FileInfo)
+}
+
+func (fi *cachedFileInfo) tags() (backendTags, bool) {
+	value, ok := fi.fs.tags.Load(fi.name)
+	if !ok {
+		return backendTags{}, false
+	}
+
+	return value.(backendTags), true
+}
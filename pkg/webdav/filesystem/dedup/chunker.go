@@ -0,0 +1,98 @@
+package dedup
+
+import (
+	"math/bits"
+)
+
+// DefaultChunkSize is the default average size of the chunks
+const DefaultChunkSize = 1024 * 1024
+
+// gear maps the bytes to the random values rolled into the hash of the
+// content. It must never change, the chunks boundaries depending on it.
+var gear [256]uint64
+
+func init() {
+	// splitmix64, with a fixed seed
+	state := uint64(0x63616c6c69)
+
+	for i := range gear {
+		state += 0x9e3779b97f4a7c15
+
+		z := state
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+
+		gear[i] = z ^ (z >> 31)
+	}
+}
+
+// chunker splits the contents into chunks whose boundaries only depend on
+// the bytes preceding them, so that the unchanged parts of a modified
+// content are split into the same chunks. The sizes of the chunks are
+// normalized around their average size, as with FastCDC.
+type chunker struct {
+	minSize int
+	avgSize int
+	maxSize int
+
+	// Masks of the hash matching a boundary below and above the
+	// average size, the first one being harder to match
+	maskBelow uint64
+	maskAbove uint64
+}
+
+// boundary returns the size of the first chunk of the given data,
+// considering its end as a boundary
+func (c *chunker) boundary(data []byte) int {
+	size := len(data)
+	if size <= c.minSize {
+		return size
+	}
+
+	size = min(size, c.maxSize)
+	normal := min(size, c.avgSize)
+
+	var hash uint64
+
+	i := c.minSize
+
+	for ; i < normal; i++ {
+		hash = (hash << 1) + gear[data[i]]
+		if hash&c.maskBelow == 0 {
+			return i + 1
+		}
+	}
+
+	for ; i < size; i++ {
+		hash = (hash << 1) + gear[data[i]]
+		if hash&c.maskAbove == 0 {
+			return i + 1
+		}
+	}
+
+	return size
+}
+
+// newChunker returns a chunker of the given average size, rounded
+// to a power of two, the chunks being 4 times smaller or larger
+func newChunker(avgSize int) *chunker {
+	if avgSize <= 0 {
+		avgSize = DefaultChunkSize
+	}
+
+	// The masks use the high bits of the hash, depending on the 64 last bytes
+	shift := min(max(bits.Len(uint(avgSize))-1, 8), 30)
+
+	return &chunker{
+		minSize:   (1 << shift) / 4,
+		avgSize:   1 << shift,
+		maxSize:   (1 << shift) * 4,
+		maskBelow: mask(shift + 1),
+		maskAbove: mask(shift - 1),
+	}
+}
+
+// mask returns a mask of the given number of high bits
+func mask(ones int) uint64 {
+	return ^uint64(0) << (64 - ones)
+}
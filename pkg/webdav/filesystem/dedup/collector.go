@@ -0,0 +1,69 @@
+package dedup
+
+import (
+	"context"
+	"sync"
+
+	"github.com/bornholm/calli/pkg/webdav/filesystem"
+	"github.com/pkg/errors"
+	"golang.org/x/net/webdav"
+)
+
+// Collector keeps track of the deduplicated filesystems, to report
+// their stats. Its Decorate method should be registered with
+// filesystem.Decorate before the other decorators wrapping them.
+type Collector struct {
+	mutex       sync.RWMutex
+	filesystems []*FileSystem
+}
+
+// Decorate implements filesystem.Decorator, collecting
+// the deduplicated filesystems without wrapping them
+func (c *Collector) Decorate(fsType filesystem.Type, fs webdav.FileSystem) webdav.FileSystem {
+	dedupFs, ok := fs.(*FileSystem)
+	if !ok {
+		return fs
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.filesystems = append(c.filesystems, dedupFs)
+
+	return fs
+}
+
+// Enabled returns true if a deduplicated filesystem has been collected
+func (c *Collector) Enabled() bool {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	return len(c.filesystems) > 0
+}
+
+// Stats returns the sum of the stats of the collected filesystems
+func (c *Collector) Stats(ctx context.Context) (Stats, error) {
+	c.mutex.RLock()
+	defer c.mutex.RUnlock()
+
+	var total Stats
+
+	for _, fs := range c.filesystems {
+		stats, err := fs.Stats(ctx)
+		if err != nil {
+			return Stats{}, errors.WithStack(err)
+		}
+
+		total = total.Add(stats)
+	}
+
+	return total, nil
+}
+
+func NewCollector() *Collector {
+	return &Collector{
+		filesystems: make([]*FileSystem, 0),
+	}
+}
+
+var _ filesystem.Decorator = (&Collector{}).Decorate
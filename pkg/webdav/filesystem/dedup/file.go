@@ -0,0 +1,485 @@
+package dedup
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/xml"
+	"hash"
+	"io"
+	"log/slog"
+	"os"
+	"path"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/bornholm/calli/pkg/log"
+	"github.com/bornholm/calli/pkg/webdav/filesystem"
+	"github.com/bornholm/calli/pkg/webdav/filesystem/props"
+	"github.com/pkg/errors"
+	"golang.org/x/net/webdav"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// File is an opened directory of the deduplicated filesystem
+type File struct {
+	ctx  context.Context
+	fs   *FileSystem
+	info *fileInfo
+
+	// Entries of the directory, listed on the first read
+	entries []os.FileInfo
+	listed  bool
+}
+
+// Close implements webdav.File.
+func (f *File) Close() error {
+	return nil
+}
+
+// Read implements webdav.File.
+func (f *File) Read(p []byte) (int, error) {
+	return 0, &os.PathError{Op: "read", Path: f.info.name, Err: syscall.EISDIR}
+}
+
+// Seek implements webdav.File.
+func (f *File) Seek(offset int64, whence int) (int64, error) {
+	return 0, &os.PathError{Op: "seek", Path: f.info.name, Err: syscall.EISDIR}
+}
+
+// Write implements webdav.File.
+func (f *File) Write(p []byte) (int, error) {
+	return 0, &os.PathError{Op: "write", Path: f.info.name, Err: syscall.EISDIR}
+}
+
+// Readdir implements webdav.File.
+func (f *File) Readdir(count int) ([]os.FileInfo, error) {
+	if !f.info.isDir {
+		return nil, &os.PathError{Op: "readdir", Path: f.info.name, Err: syscall.ENOTDIR}
+	}
+
+	if !f.listed {
+		entries, err := f.list()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		f.entries = entries
+		f.listed = true
+	}
+
+	if count <= 0 {
+		entries := f.entries
+		f.entries = nil
+
+		return entries, nil
+	}
+
+	if len(f.entries) == 0 {
+		return nil, io.EOF
+	}
+
+	entries := f.entries[:min(count, len(f.entries))]
+	f.entries = f.entries[len(entries):]
+
+	return entries, nil
+}
+
+func (f *File) list() ([]os.FileInfo, error) {
+	entries := make([]os.FileInfo, 0)
+	prefix := descendants(f.info.name)
+
+	err := f.fs.do(f.ctx, func(conn *sqlite.Conn) error {
+		return errors.WithStack(sqlitex.Execute(conn, `
+			SELECT path, is_dir, mode, size, mtime, etag FROM files
+			WHERE substr(path, 1, length(?)) = ? AND path != ?
+			AND instr(substr(path, length(?) + 1), '/') = 0
+			ORDER BY path
+		`, &sqlitex.ExecOptions{
+			Args: []any{prefix, prefix, f.info.name, prefix},
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				entries = append(entries, scanFileInfo(stmt))
+				return nil
+			},
+		}))
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return entries, nil
+}
+
+// Stat implements webdav.File.
+func (f *File) Stat() (os.FileInfo, error) {
+	info := *f.info
+	return &info, nil
+}
+
+// DeadProps implements webdav.DeadPropsHolder.
+func (f *File) DeadProps() (map[xml.Name]webdav.Property, error) {
+	var deadProps map[xml.Name]webdav.Property
+
+	err := f.fs.do(f.ctx, func(conn *sqlite.Conn) (err error) {
+		deadProps, err = props.Load(conn, f.info.name)
+		return errors.WithStack(err)
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return deadProps, nil
+}
+
+// Patch implements webdav.DeadPropsHolder.
+func (f *File) Patch(patches []webdav.Proppatch) ([]webdav.Propstat, error) {
+	var propstats []webdav.Propstat
+
+	err := f.fs.do(f.ctx, func(conn *sqlite.Conn) (err error) {
+		propstats, err = props.Patch(conn, f.info.name, patches)
+		return errors.WithStack(err)
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return propstats, nil
+}
+
+var (
+	_ webdav.File            = &File{}
+	_ webdav.DeadPropsHolder = &File{}
+)
+
+// readFile reads the chunks listed by the manifest of a file
+type readFile struct {
+	*File
+
+	refs   []chunkRef
+	offset int64
+
+	// Last loaded chunk
+	chunk []byte
+	index int
+}
+
+// Read implements webdav.File.
+func (f *readFile) Read(p []byte) (int, error) {
+	if f.offset >= f.info.size {
+		return 0, io.EOF
+	}
+
+	index := sort.Search(len(f.refs), func(i int) bool {
+		return f.refs[i].Offset+f.refs[i].Size > f.offset
+	})
+	if index == len(f.refs) {
+		return 0, io.EOF
+	}
+
+	if index != f.index {
+		chunk, err := f.fs.readChunk(f.ctx, f.refs[index], f.chunk)
+		if err != nil {
+			return 0, errors.WithStack(err)
+		}
+
+		f.chunk = chunk
+		f.index = index
+	}
+
+	read := copy(p, f.chunk[f.offset-f.refs[index].Offset:])
+	f.offset += int64(read)
+
+	return read, nil
+}
+
+// Seek implements webdav.File.
+func (f *readFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.info.size
+	default:
+		return 0, errors.Errorf("invalid whence '%d'", whence)
+	}
+
+	if offset < 0 {
+		return 0, errors.Errorf("invalid offset '%d'", offset)
+	}
+
+	f.offset = offset
+
+	return offset, nil
+}
+
+// Write implements webdav.File.
+func (f *readFile) Write(p []byte) (int, error) {
+	return 0, errors.Wrap(filesystem.ErrNotSupported, "the deduplicated files can only be written when created or truncated")
+}
+
+var _ webdav.File = &readFile{}
+
+// writeFile splits the written content into chunks, the manifest of
+// the file being replaced when closing
+type writeFile struct {
+	*File
+
+	hash hash.Hash
+
+	// Pending content, not split yet
+	buf []byte
+
+	refs    []chunkRef
+	written int64
+	err     error
+	closed  bool
+}
+
+// Read implements webdav.File.
+func (f *writeFile) Read(p []byte) (int, error) {
+	return 0, errors.Wrap(filesystem.ErrNotSupported, "the deduplicated files can not be read while written")
+}
+
+// Write implements webdav.File.
+func (f *writeFile) Write(p []byte) (int, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+
+	if f.closed {
+		return 0, os.ErrClosed
+	}
+
+	f.buf = append(f.buf, p...)
+	f.hash.Write(p)
+	f.written += int64(len(p))
+
+	if err := f.split(false); err != nil {
+		f.err = errors.WithStack(err)
+		return 0, f.err
+	}
+
+	return len(p), nil
+}
+
+// Seek implements webdav.File.
+func (f *writeFile) Seek(offset int64, whence int) (int64, error) {
+	if (whence == io.SeekStart && offset == f.written) || (whence != io.SeekStart && offset == 0) {
+		return f.written, nil
+	}
+
+	return 0, errors.Wrap(filesystem.ErrNotSupported, "the deduplicated files are written sequentially")
+}
+
+// Stat implements webdav.File.
+func (f *writeFile) Stat() (os.FileInfo, error) {
+	info := *f.info
+	info.size = f.written
+	info.modTime = time.Now()
+	// The content is only hashed when closing
+	info.etag = ""
+
+	return &info, nil
+}
+
+// Close implements webdav.File.
+func (f *writeFile) Close() error {
+	if f.closed {
+		return nil
+	}
+
+	f.closed = true
+
+	if f.err == nil {
+		f.err = f.split(true)
+	}
+
+	if f.err == nil {
+		f.err = f.commit()
+	}
+
+	if f.err != nil {
+		if err := f.fs.release(f.ctx, refsChunks(f.refs)...); err != nil {
+			slog.ErrorContext(f.ctx, "could not release the chunks written to file", log.Error(errors.WithStack(err)), slog.String("path", f.info.name))
+		}
+
+		return f.err
+	}
+
+	return nil
+}
+
+// split stores the chunks of the pending content, the pending content
+// being split once it reaches the maximum size of a chunk, so that its
+// boundaries do not depend on the size of the writes
+func (f *writeFile) split(last bool) error {
+	start := 0
+
+	for len(f.buf)-start >= f.fs.chunker.maxSize || (last && len(f.buf) > start) {
+		size := f.fs.chunker.boundary(f.buf[start:])
+
+		if err := f.store(f.buf[start : start+size]); err != nil {
+			return errors.WithStack(err)
+		}
+
+		start += size
+	}
+
+	f.buf = append(f.buf[:0], f.buf[start:]...)
+
+	return nil
+}
+
+func (f *writeFile) store(data []byte) error {
+	hash, err := f.fs.acquire(f.ctx, data)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	var offset int64
+	if len(f.refs) > 0 {
+		last := f.refs[len(f.refs)-1]
+		offset = last.Offset + last.Size
+	}
+
+	f.refs = append(f.refs, chunkRef{
+		Offset: offset,
+		Size:   int64(len(data)),
+		Hash:   hash,
+	})
+
+	return nil
+}
+
+// commit replaces the manifest of the file, then
+// releases the chunks of its previous content
+func (f *writeFile) commit() error {
+	name := f.info.name
+	etag := hex.EncodeToString(f.hash.Sum(nil))
+
+	var previous []string
+
+	err := f.fs.do(f.ctx, func(conn *sqlite.Conn) (err error) {
+		defer sqlitex.Save(conn)(&err)
+
+		err = sqlitex.Execute(conn, `
+			UPDATE files SET size = ?, mtime = ?, etag = ?
+			WHERE path = ? AND is_dir = 0
+		`, &sqlitex.ExecOptions{
+			Args: []any{f.written, time.Now().UnixNano(), etag, name},
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		// The file has been removed or renamed while written
+		if conn.Changes() == 0 {
+			return errors.Wrapf(os.ErrNotExist, "could not find file '%s'", name)
+		}
+
+		previous, err = manifestsChunks(conn, name)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		err = sqlitex.Execute(conn, `DELETE FROM manifests WHERE path = ?`, &sqlitex.ExecOptions{
+			Args: []any{name},
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		for position, ref := range f.refs {
+			err = sqlitex.Execute(conn, `
+				INSERT INTO manifests (path, position, offset, size, chunk)
+				VALUES (?, ?, ?, ?, ?)
+			`, &sqlitex.ExecOptions{
+				Args: []any{name, position, ref.Offset, ref.Size, ref.Hash},
+			})
+			if err != nil {
+				return errors.WithStack(err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	// The new chunks are now referenced by the manifest
+	f.refs = nil
+
+	if err := f.fs.release(f.ctx, previous...); err != nil {
+		slog.ErrorContext(f.ctx, "could not release the previous chunks of file", log.Error(errors.WithStack(err)), slog.String("path", name))
+	}
+
+	return nil
+}
+
+var _ webdav.File = &writeFile{}
+
+func refsChunks(refs []chunkRef) []string {
+	hashes := make([]string, 0, len(refs))
+	for _, r := range refs {
+		hashes = append(hashes, r.Hash)
+	}
+
+	return hashes
+}
+
+// fileInfo implements os.FileInfo for a file or directory of the deduplicated filesystem
+type fileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+	isDir   bool
+	etag    string
+}
+
+func scanFileInfo(stmt *sqlite.Stmt) *fileInfo {
+	return &fileInfo{
+		name:    stmt.ColumnText(0),
+		isDir:   stmt.ColumnInt(1) == 1,
+		mode:    os.FileMode(stmt.ColumnInt64(2)),
+		size:    stmt.ColumnInt64(3),
+		modTime: time.Unix(0, stmt.ColumnInt64(4)),
+		etag:    stmt.ColumnText(5),
+	}
+}
+
+func (fi *fileInfo) Name() string       { return path.Base(fi.name) }
+func (fi *fileInfo) Size() int64        { return fi.size }
+func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
+func (fi *fileInfo) IsDir() bool        { return fi.isDir }
+func (fi *fileInfo) Sys() any           { return nil }
+
+func (fi *fileInfo) Mode() os.FileMode {
+	if fi.isDir {
+		return fi.mode | os.ModeDir
+	}
+
+	return fi.mode
+}
+
+// ETag implements webdav.ETager.
+func (fi *fileInfo) ETag(ctx context.Context) (string, error) {
+	if fi.isDir || fi.etag == "" {
+		return "", webdav.ErrNotImplemented
+	}
+
+	return `"` + fi.etag + `"`, nil
+}
+
+// ContentType implements webdav.ContentTyper.
+func (fi *fileInfo) ContentType(ctx context.Context) (string, error) {
+	return filesystem.ContentTypeByExtension(fi.name)
+}
+
+var (
+	_ webdav.ETager       = &fileInfo{}
+	_ webdav.ContentTyper = &fileInfo{}
+)
@@ -0,0 +1,380 @@
+package dedup
+
+import (
+	"context"
+	"crypto/sha256"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bornholm/calli/pkg/webdav/filesystem"
+	"github.com/bornholm/calli/pkg/webdav/filesystem/props"
+	"github.com/pkg/errors"
+	"golang.org/x/net/webdav"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitemigration"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// emptyETag is the hash of the empty contents
+const emptyETag = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// FileSystem splits the files contents into content-defined chunks, each
+// distinct chunk being stored once in the chunks filesystem. The tree and
+// the manifests listing the chunks of the files are kept in SQLite, the
+// renames only updating them.
+type FileSystem struct {
+	pool    *sqlitemigration.Pool
+	chunks  webdav.FileSystem
+	chunker *chunker
+
+	chunkLocks [256]sync.Mutex
+}
+
+// Mkdir implements webdav.FileSystem.
+func (f *FileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	name = cleanPath(name)
+
+	if err := f.checkParent(ctx, name); err != nil {
+		return err
+	}
+
+	if _, err := f.Stat(ctx, name); err == nil {
+		return os.ErrExist
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	err := f.do(ctx, func(conn *sqlite.Conn) error {
+		return errors.WithStack(sqlitex.Execute(conn, `
+			INSERT INTO files (path, is_dir, mode, size, mtime)
+			VALUES (?, 1, ?, 0, ?)
+		`, &sqlitex.ExecOptions{
+			Args: []any{name, uint32(perm), time.Now().UnixNano()},
+		}))
+	})
+
+	return errors.WithStack(err)
+}
+
+// OpenFile implements webdav.FileSystem.
+func (f *FileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	name = cleanPath(name)
+
+	if flag&os.O_APPEND != 0 {
+		return nil, errors.Wrap(filesystem.ErrNotSupported, "the deduplicated files can not be appended")
+	}
+
+	info, err := f.stat(ctx, name)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) || flag&os.O_CREATE == 0 {
+			return nil, err
+		}
+
+		if err := f.checkParent(ctx, name); err != nil {
+			return nil, err
+		}
+
+		info = &fileInfo{
+			name:    name,
+			mode:    perm,
+			modTime: time.Now(),
+			etag:    emptyETag,
+		}
+
+		err = f.do(ctx, func(conn *sqlite.Conn) error {
+			return errors.WithStack(sqlitex.Execute(conn, `
+				INSERT INTO files (path, is_dir, mode, size, mtime, etag)
+				VALUES (?, 0, ?, 0, ?, ?)
+			`, &sqlitex.ExecOptions{
+				Args: []any{name, uint32(perm), info.modTime.UnixNano(), info.etag},
+			}))
+		})
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	file := &File{
+		ctx:  ctx,
+		fs:   f,
+		info: info,
+	}
+
+	writable := flag&(os.O_WRONLY|os.O_RDWR) != 0
+
+	if info.isDir {
+		// PROPPATCH opens the resources with O_RDWR, the writes to a directory failing anyway
+		if writable && flag != os.O_RDWR {
+			return nil, errors.New("cannot write to directory")
+		}
+
+		return file, nil
+	}
+
+	// The files are written from scratch, their previous
+	// content being replaced when closing
+	if writable && (flag&os.O_TRUNC != 0 || info.size == 0) {
+		return &writeFile{
+			File: file,
+			hash: sha256.New(),
+		}, nil
+	}
+
+	refs, err := f.manifest(ctx, name)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &readFile{
+		File:  file,
+		refs:  refs,
+		index: -1,
+	}, nil
+}
+
+// RemoveAll implements webdav.FileSystem. The chunks
+// not referenced anymore are removed afterwards.
+func (f *FileSystem) RemoveAll(ctx context.Context, name string) error {
+	name = cleanPath(name)
+
+	var hashes []string
+
+	err := f.do(ctx, func(conn *sqlite.Conn) (err error) {
+		defer sqlitex.Save(conn)(&err)
+
+		hashes, err = manifestsChunks(conn, name)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		// The root directory is emptied but kept
+		err = sqlitex.Execute(conn, `
+			DELETE FROM files
+			WHERE (path = ? OR substr(path, 1, length(?)) = ?) AND path != '/'
+		`, &sqlitex.ExecOptions{
+			Args: []any{name, descendants(name), descendants(name)},
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		err = sqlitex.Execute(conn, `
+			DELETE FROM manifests
+			WHERE path = ? OR substr(path, 1, length(?)) = ?
+		`, &sqlitex.ExecOptions{
+			Args: []any{name, descendants(name), descendants(name)},
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		// Remove the dead properties as well
+		if err := props.Delete(conn, name); err != nil {
+			return errors.WithStack(err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := f.release(ctx, hashes...); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Rename implements webdav.FileSystem. Only the
+// paths of the tree are updated, not the chunks.
+func (f *FileSystem) Rename(ctx context.Context, oldName string, newName string) error {
+	oldName = cleanPath(oldName)
+	newName = cleanPath(newName)
+
+	if _, err := f.Stat(ctx, oldName); err != nil {
+		return err
+	}
+
+	if _, err := f.Stat(ctx, newName); err == nil {
+		return os.ErrExist
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	if err := f.checkParent(ctx, newName); err != nil {
+		return err
+	}
+
+	err := f.do(ctx, func(conn *sqlite.Conn) (err error) {
+		defer sqlitex.Save(conn)(&err)
+
+		for _, table := range []string{"files", "manifests"} {
+			err = sqlitex.Execute(conn, `
+				UPDATE `+table+` SET path = ? || substr(path, length(?) + 1)
+				WHERE path = ? OR substr(path, 1, length(?)) = ?
+			`, &sqlitex.ExecOptions{
+				Args: []any{newName, oldName, oldName, descendants(oldName), descendants(oldName)},
+			})
+			if err != nil {
+				return errors.WithStack(err)
+			}
+		}
+
+		// Move the dead properties along
+		if err := props.Move(conn, oldName, newName); err != nil {
+			return errors.WithStack(err)
+		}
+
+		return nil
+	})
+
+	return errors.WithStack(err)
+}
+
+// Stat implements webdav.FileSystem.
+func (f *FileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	info, err := f.stat(ctx, cleanPath(name))
+	if err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+func (f *FileSystem) stat(ctx context.Context, name string) (*fileInfo, error) {
+	var info *fileInfo
+
+	err := f.do(ctx, func(conn *sqlite.Conn) error {
+		return errors.WithStack(sqlitex.Execute(conn, `
+			SELECT path, is_dir, mode, size, mtime, etag FROM files
+			WHERE path = ?
+		`, &sqlitex.ExecOptions{
+			Args: []any{name},
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				info = scanFileInfo(stmt)
+				return nil
+			},
+		}))
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	if info == nil {
+		return nil, os.ErrNotExist
+	}
+
+	return info, nil
+}
+
+// checkParent returns os.ErrNotExist if the parent directory
+// of the given path does not exist
+func (f *FileSystem) checkParent(ctx context.Context, name string) error {
+	parent, err := f.stat(ctx, path.Dir(name))
+	if err != nil {
+		return err
+	}
+
+	if !parent.isDir {
+		return os.ErrNotExist
+	}
+
+	return nil
+}
+
+// Stats returns the sizes of the files and of their chunks
+func (f *FileSystem) Stats(ctx context.Context) (Stats, error) {
+	var stats Stats
+
+	err := f.do(ctx, func(conn *sqlite.Conn) error {
+		err := sqlitex.Execute(conn, `SELECT COUNT(*), COALESCE(SUM(size), 0) FROM files WHERE is_dir = 0`, &sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				stats.Files = stmt.ColumnInt64(0)
+				stats.LogicalSize = stmt.ColumnInt64(1)
+				return nil
+			},
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		err = sqlitex.Execute(conn, `SELECT COUNT(*), COALESCE(SUM(size), 0) FROM chunks`, &sqlitex.ExecOptions{
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				stats.Chunks = stmt.ColumnInt64(0)
+				stats.StoredSize = stmt.ColumnInt64(1)
+				return nil
+			},
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return Stats{}, errors.WithStack(err)
+	}
+
+	return stats, nil
+}
+
+// Stats are the sizes of the deduplicated files
+type Stats struct {
+	// Number and total size of the files
+	Files       int64
+	LogicalSize int64
+	// Number and total size of the stored chunks
+	Chunks     int64
+	StoredSize int64
+}
+
+// Ratio returns the ratio of the files size to their stored size
+func (s Stats) Ratio() float64 {
+	if s.StoredSize == 0 {
+		return 1
+	}
+
+	return float64(s.LogicalSize) / float64(s.StoredSize)
+}
+
+// Add returns the sum of the given stats
+func (s Stats) Add(other Stats) Stats {
+	return Stats{
+		Files:       s.Files + other.Files,
+		LogicalSize: s.LogicalSize + other.LogicalSize,
+		Chunks:      s.Chunks + other.Chunks,
+		StoredSize:  s.StoredSize + other.StoredSize,
+	}
+}
+
+// NewFileSystem returns a filesystem storing its tree in the given pool and
+// the chunks in the given filesystem, the chunks being of the given average size
+func NewFileSystem(pool *sqlitemigration.Pool, chunks webdav.FileSystem, chunkSize int) *FileSystem {
+	return &FileSystem{
+		pool:    pool,
+		chunks:  chunks,
+		chunker: newChunker(chunkSize),
+	}
+}
+
+// Helper function to clean and normalize paths
+func cleanPath(name string) string {
+	if name == "" {
+		return "/"
+	}
+
+	name = filepath.ToSlash(filepath.Clean(name))
+
+	if !strings.HasPrefix(name, "/") {
+		name = "/" + name
+	}
+
+	return name
+}
+
+var _ webdav.FileSystem = &FileSystem{}
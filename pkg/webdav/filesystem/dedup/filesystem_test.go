@@ -0,0 +1,211 @@
+package dedup
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bornholm/calli/pkg/webdav/filesystem/testsuite"
+	"github.com/pkg/errors"
+	"golang.org/x/net/webdav"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitemigration"
+)
+
+func TestFileSystem(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	dataDir := filepath.Join(cwd, "testdata/.local")
+	dbPath := filepath.Join(cwd, "testdata/dedup.db")
+
+	for _, p := range []string{dataDir, dbPath} {
+		if err := os.RemoveAll(p); err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+	}
+
+	testsuite.TestFileSystem(t, Type, &Options{
+		Path:      dbPath,
+		Dir:       dataDir,
+		ChunkSize: 64 * 1024,
+	})
+}
+
+func TestDeduplication(t *testing.T) {
+	ctx := context.Background()
+
+	pool := sqlitemigration.NewPool(filepath.Join(t.TempDir(), "dedup.db"), sqlitemigration.Schema{
+		Migrations:          Migrations,
+		RepeatableMigration: `INSERT OR IGNORE INTO files (path, is_dir, mode, size, mtime) VALUES ('/', 1, 493, 0, 0)`,
+	}, sqlitemigration.Options{
+		Flags: sqlite.OpenCreate | sqlite.OpenReadWrite | sqlite.OpenWAL,
+	})
+
+	defer pool.Close()
+
+	chunks := webdav.NewMemFS()
+	fs := NewFileSystem(pool, chunks, 4096)
+
+	content := make([]byte, 256*1024)
+	rand.New(rand.NewSource(1)).Read(content)
+
+	writeAll(t, fs, "/first.bin", content)
+
+	first := checkStats(t, fs, 1)
+
+	// The same content is stored once
+	writeAll(t, fs, "/second.bin", content)
+
+	second := checkStats(t, fs, 2)
+
+	if e, g := first.StoredSize, second.StoredSize; e != g {
+		t.Errorf("stats.StoredSize: expected '%v', got '%v'", e, g)
+	}
+
+	if e, g := 2.0, second.Ratio(); e != g {
+		t.Errorf("stats.Ratio(): expected '%v', got '%v'", e, g)
+	}
+
+	// The chunks following an insertion are shared
+	inserted := append(append(bytes.Clone(content[:100*1024]), []byte("inserted")...), content[100*1024:]...)
+
+	writeAll(t, fs, "/third.bin", inserted)
+
+	third := checkStats(t, fs, 3)
+
+	if e, g := first.StoredSize/2, third.StoredSize-second.StoredSize; g > e {
+		t.Errorf("stored size of the modified content: expected less than '%v', got '%v'", e, g)
+	}
+
+	if e, g := inserted, readAll(t, fs, "/third.bin"); !bytes.Equal(e, g) {
+		t.Errorf("content of /third.bin differs")
+	}
+
+	// The renames keep the chunks
+	if err := fs.Mkdir(ctx, "/dir", os.ModePerm); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if err := fs.Rename(ctx, "/second.bin", "/dir/second.bin"); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := third, checkStats(t, fs, 3); e != g {
+		t.Errorf("stats after rename: expected '%v', got '%v'", e, g)
+	}
+
+	if e, g := content, readAll(t, fs, "/dir/second.bin"); !bytes.Equal(e, g) {
+		t.Errorf("content of /dir/second.bin differs")
+	}
+
+	// The chunks are removed once not referenced anymore
+	for _, name := range []string{"/first.bin", "/dir"} {
+		if err := fs.RemoveAll(ctx, name); err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+	}
+
+	if e, g := inserted, readAll(t, fs, "/third.bin"); !bytes.Equal(e, g) {
+		t.Errorf("content of /third.bin differs")
+	}
+
+	if err := fs.RemoveAll(ctx, "/third.bin"); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := (Stats{}), checkStats(t, fs, 0); e != g {
+		t.Errorf("stats after removal: expected '%v', got '%v'", e, g)
+	}
+
+	dir, err := chunks.OpenFile(ctx, "/", os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	defer dir.Close()
+
+	prefixes, err := dir.Readdir(-1)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	for _, prefix := range prefixes {
+		infos, err := readDir(ctx, chunks, "/"+prefix.Name())
+		if err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		if len(infos) > 0 {
+			t.Errorf("chunks directory '%s' should be empty, got %d chunks", prefix.Name(), len(infos))
+		}
+	}
+}
+
+func checkStats(t *testing.T, fs *FileSystem, files int64) Stats {
+	stats, err := fs.Stats(context.Background())
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := files, stats.Files; e != g {
+		t.Errorf("stats.Files: expected '%v', got '%v'", e, g)
+	}
+
+	return stats
+}
+
+func readDir(ctx context.Context, fs webdav.FileSystem, name string) ([]os.FileInfo, error) {
+	dir, err := fs.OpenFile(ctx, name, os.O_RDONLY, 0)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	defer dir.Close()
+
+	return dir.Readdir(-1)
+}
+
+func readAll(t *testing.T, fs webdav.FileSystem, name string) []byte {
+	file, err := fs.OpenFile(context.Background(), name, os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	return data
+}
+
+func writeAll(t *testing.T, fs webdav.FileSystem, name string, data []byte) {
+	file, err := fs.OpenFile(context.Background(), name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	// Written by small pieces, the chunks not depending on the writes
+	for len(data) > 0 {
+		n := min(len(data), 1000)
+
+		if _, err := file.Write(data[:n]); err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		data = data[n:]
+	}
+
+	if err := file.Close(); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+}
@@ -0,0 +1,82 @@
+package dedup
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/bornholm/calli/pkg/webdav/filesystem"
+	"github.com/bornholm/calli/pkg/webdav/filesystem/local"
+	"github.com/go-viper/mapstructure/v2"
+	"github.com/pkg/errors"
+	"golang.org/x/net/webdav"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitemigration"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+const Type filesystem.Type = "dedup"
+
+func init() {
+	filesystem.Register(Type, CreateFileSystemFromOptions)
+}
+
+type Options struct {
+	// Path of the SQLite database holding the tree and the manifests of the files
+	Path string `mapstructure:"path"`
+	// Directory of the chunks, if no chunks filesystem is given
+	Dir string `mapstructure:"dir"`
+	// Filesystem storing the chunks
+	Chunks FileSystemOptions `mapstructure:"chunks"`
+	// Average size of the chunks in bytes, rounded to a power of two. Defaults to 1MiB.
+	ChunkSize int `mapstructure:"chunkSize"`
+}
+
+type FileSystemOptions struct {
+	Type    filesystem.Type `mapstructure:"type"`
+	Options any             `mapstructure:"options"`
+}
+
+func CreateFileSystemFromOptions(options any) (webdav.FileSystem, error) {
+	opts := Options{}
+
+	if err := mapstructure.Decode(options, &opts); err != nil {
+		return nil, errors.Wrapf(err, "could not parse '%s' filesystem options", Type)
+	}
+
+	chunksOptions := opts.Chunks
+	if chunksOptions.Type == "" {
+		if opts.Dir == "" {
+			return nil, errors.Errorf("no chunks directory nor filesystem given to '%s' filesystem", Type)
+		}
+
+		chunksOptions = FileSystemOptions{
+			Type:    local.Type,
+			Options: local.Options{Dir: opts.Dir},
+		}
+	}
+
+	chunks, err := filesystem.New(chunksOptions.Type, chunksOptions.Options)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not create chunks filesystem '%s'", chunksOptions.Type)
+	}
+
+	schema := sqlitemigration.Schema{
+		Migrations:          Migrations,
+		RepeatableMigration: fmt.Sprintf(`INSERT OR IGNORE INTO files (path, is_dir, mode, size, mtime) VALUES ('/', 1, 493, 0, %d)`, time.Now().UnixNano()),
+	}
+
+	pool := sqlitemigration.NewPool(opts.Path, schema, sqlitemigration.Options{
+		Flags: sqlite.OpenCreate | sqlite.OpenReadWrite | sqlite.OpenWAL,
+		PrepareConn: func(conn *sqlite.Conn) error {
+			return sqlitex.ExecScript(conn, `PRAGMA foreign_keys = ON; PRAGMA auto_vacuum=FULL`)
+		},
+		OnError: func(e error) {
+			log.Println(e)
+		},
+	})
+
+	fs := NewFileSystem(pool, chunks, opts.ChunkSize)
+
+	return fs, nil
+}
@@ -0,0 +1,288 @@
+package dedup
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/bornholm/calli/pkg/webdav/filesystem/props"
+	"github.com/pkg/errors"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+var ErrCorruptedChunk = errors.New("corrupted chunk")
+
+// Migrations create the tables of the files tree, of their manifests
+// listing their chunks and of the chunks
+var Migrations = slices.Concat([]string{
+	`CREATE TABLE IF NOT EXISTS files (
+		path TEXT PRIMARY KEY,
+		is_dir INTEGER NOT NULL,
+		mode INTEGER NOT NULL,
+		size INTEGER NOT NULL,
+		mtime INTEGER NOT NULL, -- Unix nanoseconds
+		etag TEXT NOT NULL DEFAULT ''
+	);`,
+	`CREATE TABLE IF NOT EXISTS manifests (
+		path TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		offset INTEGER NOT NULL,
+		size INTEGER NOT NULL,
+		chunk TEXT NOT NULL,
+		PRIMARY KEY (path, position)
+	);`,
+	// Chunks are referenced by each of their occurrences in the
+	// manifests, and by the files being written
+	`CREATE TABLE IF NOT EXISTS chunks (
+		hash TEXT PRIMARY KEY,
+		size INTEGER NOT NULL,
+		refs INTEGER NOT NULL
+	);`,
+}, props.Migrations)
+
+// chunkRef is an occurrence of a chunk in a file
+type chunkRef struct {
+	Offset int64
+	Size   int64
+	Hash   string
+}
+
+// acquire references the given chunk, storing it first if unknown
+func (f *FileSystem) acquire(ctx context.Context, data []byte) (string, error) {
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+
+	unlock := f.lockChunk(hash)
+	defer unlock()
+
+	acquired := false
+
+	err := f.do(ctx, func(conn *sqlite.Conn) error {
+		err := sqlitex.Execute(conn, `UPDATE chunks SET refs = refs + 1 WHERE hash = ?`, &sqlitex.ExecOptions{
+			Args: []any{hash},
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		acquired = conn.Changes() > 0
+
+		return nil
+	})
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	if acquired {
+		return hash, nil
+	}
+
+	if err := f.writeChunk(ctx, hash, data); err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	err = f.do(ctx, func(conn *sqlite.Conn) error {
+		return errors.WithStack(sqlitex.Execute(conn, `INSERT INTO chunks (hash, size, refs) VALUES (?, ?, 1)`, &sqlitex.ExecOptions{
+			Args: []any{hash, len(data)},
+		}))
+	})
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return hash, nil
+}
+
+// release dereferences the given chunks, deleting the unreferenced ones
+func (f *FileSystem) release(ctx context.Context, hashes ...string) error {
+	// The releases must complete, whether the request is canceled or not
+	ctx = context.WithoutCancel(ctx)
+
+	for _, hash := range hashes {
+		if err := f.releaseChunk(ctx, hash); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+func (f *FileSystem) releaseChunk(ctx context.Context, hash string) error {
+	unlock := f.lockChunk(hash)
+	defer unlock()
+
+	deleted := false
+
+	err := f.do(ctx, func(conn *sqlite.Conn) (err error) {
+		defer sqlitex.Save(conn)(&err)
+
+		err = sqlitex.Execute(conn, `UPDATE chunks SET refs = refs - 1 WHERE hash = ?`, &sqlitex.ExecOptions{
+			Args: []any{hash},
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		err = sqlitex.Execute(conn, `DELETE FROM chunks WHERE hash = ? AND refs <= 0`, &sqlitex.ExecOptions{
+			Args: []any{hash},
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		deleted = conn.Changes() > 0
+
+		return nil
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if !deleted {
+		return nil
+	}
+
+	if err := f.chunks.RemoveAll(ctx, chunkName(hash)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return errors.Wrapf(err, "could not remove chunk '%s'", hash)
+	}
+
+	return nil
+}
+
+// lockChunk serializes the storage and the deletion of the given chunk
+func (f *FileSystem) lockChunk(hash string) func() {
+	lock := &f.chunkLocks[hash[0]]
+	lock.Lock()
+
+	return lock.Unlock
+}
+
+func (f *FileSystem) writeChunk(ctx context.Context, hash string, data []byte) error {
+	if err := f.chunks.Mkdir(ctx, chunkDir(hash), os.ModePerm); err != nil && !errors.Is(err, os.ErrExist) {
+		return errors.Wrapf(err, "could not create chunks directory '%s'", chunkDir(hash))
+	}
+
+	file, err := f.chunks.OpenFile(ctx, chunkName(hash), os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return errors.Wrapf(err, "could not create chunk '%s'", hash)
+	}
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return errors.Wrapf(err, "could not write chunk '%s'", hash)
+	}
+
+	if err := file.Close(); err != nil {
+		return errors.Wrapf(err, "could not write chunk '%s'", hash)
+	}
+
+	return nil
+}
+
+// readChunk reads the given chunk into buf, checking its content
+func (f *FileSystem) readChunk(ctx context.Context, ref chunkRef, buf []byte) ([]byte, error) {
+	file, err := f.chunks.OpenFile(ctx, chunkName(ref.Hash), os.O_RDONLY, 0)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not open chunk '%s'", ref.Hash)
+	}
+
+	defer file.Close()
+
+	if int64(cap(buf)) < ref.Size {
+		buf = make([]byte, ref.Size)
+	}
+
+	buf = buf[:ref.Size]
+
+	if _, err := io.ReadFull(file, buf); err != nil {
+		return nil, errors.Wrapf(err, "could not read chunk '%s'", ref.Hash)
+	}
+
+	if sum := sha256.Sum256(buf); hex.EncodeToString(sum[:]) != ref.Hash {
+		return nil, errors.Wrapf(ErrCorruptedChunk, "unexpected content of chunk '%s'", ref.Hash)
+	}
+
+	return buf, nil
+}
+
+// manifest returns the chunks of the given file
+func (f *FileSystem) manifest(ctx context.Context, name string) ([]chunkRef, error) {
+	refs := make([]chunkRef, 0)
+
+	err := f.do(ctx, func(conn *sqlite.Conn) error {
+		return errors.WithStack(sqlitex.Execute(conn, `SELECT offset, size, chunk FROM manifests WHERE path = ? ORDER BY position`, &sqlitex.ExecOptions{
+			Args: []any{name},
+			ResultFunc: func(stmt *sqlite.Stmt) error {
+				refs = append(refs, chunkRef{
+					Offset: stmt.ColumnInt64(0),
+					Size:   stmt.ColumnInt64(1),
+					Hash:   stmt.ColumnText(2),
+				})
+
+				return nil
+			},
+		}))
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return refs, nil
+}
+
+// manifestsChunks returns the chunks referenced by the manifests
+// of the given path and of its descendants
+func manifestsChunks(conn *sqlite.Conn, name string) ([]string, error) {
+	hashes := make([]string, 0)
+
+	err := sqlitex.Execute(conn, `
+		SELECT chunk FROM manifests
+		WHERE path = ? OR substr(path, 1, length(?)) = ?
+	`, &sqlitex.ExecOptions{
+		Args: []any{name, descendants(name), descendants(name)},
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			hashes = append(hashes, stmt.ColumnText(0))
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return hashes, nil
+}
+
+func (f *FileSystem) do(ctx context.Context, fn func(conn *sqlite.Conn) error) error {
+	conn, err := f.pool.Take(ctx)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer f.pool.Put(conn)
+
+	if err := fn(conn); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// chunkDir returns the directory of the given chunk in the chunks
+// backend, spreading them over 256 directories
+func chunkDir(hash string) string {
+	return "/" + hash[:2]
+}
+
+func chunkName(hash string) string {
+	return chunkDir(hash) + "/" + hash
+}
+
+// descendants returns the prefix of the paths below the given one
+func descendants(name string) string {
+	return strings.TrimSuffix(name, "/") + "/"
+}
@@ -0,0 +1,197 @@
+package encrypted
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"path"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// KeySize is the size in bytes of the encryption keys
+	KeySize = 32
+
+	// Size of the plaintext chunks sealed independently, allowing seeks
+	chunkSize = 64 * 1024
+	// Size of the authentication tag appended to each sealed chunk
+	tagSize = 16
+	// Size of a sealed chunk, the last one of a file being shorter
+	sealedChunkSize = chunkSize + tagSize
+
+	saltSize   = 32
+	nonceSize  = 12
+	headerSize = len(magic) + saltSize
+)
+
+// magic starts the encrypted files, followed by the salt of their key
+const magic = "CALLIEN1"
+
+var (
+	ErrInvalidKey  = errors.New("invalid key")
+	ErrInvalidFile = errors.New("invalid encrypted file")
+	ErrInvalidName = errors.New("invalid encrypted name")
+)
+
+// contentCipher seals the chunks of a file with a key derived from the
+// master key and the file's salt, renewed each time the file is rewritten
+type contentCipher struct {
+	aead cipher.AEAD
+}
+
+// seal appends the given chunk sealed to dst. The nonce is made of the
+// chunk's index and whether it is the last one, so that the chunks can
+// neither be reordered nor the file truncated.
+func (c *contentCipher) seal(dst []byte, chunk []byte, index int64, last bool) []byte {
+	return c.aead.Seal(dst, chunkNonce(index, last), chunk, nil)
+}
+
+// open appends the given sealed chunk decrypted to dst
+func (c *contentCipher) open(dst []byte, sealed []byte, index int64, last bool) ([]byte, error) {
+	chunk, err := c.aead.Open(dst, chunkNonce(index, last), sealed, nil)
+	if err != nil {
+		return nil, errors.Wrapf(ErrInvalidFile, "could not decrypt chunk %d", index)
+	}
+
+	return chunk, nil
+}
+
+func newContentCipher(key []byte, salt []byte) (*contentCipher, error) {
+	fileKey, err := hkdf.Key(sha256.New, key, salt, "calli content", KeySize)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	aead, err := newAEAD(fileKey)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &contentCipher{aead: aead}, nil
+}
+
+func chunkNonce(index int64, last bool) []byte {
+	nonce := make([]byte, nonceSize)
+	binary.BigEndian.PutUint64(nonce, uint64(index))
+
+	if last {
+		nonce[nonceSize-1] = 1
+	}
+
+	return nonce
+}
+
+// plaintextSize returns the size of the content of an encrypted file of
+// the given size. An encrypted file holds at least its header and a sealed
+// last chunk, empty for an empty content, ErrInvalidFile being returned
+// for the sizes no file can have.
+func plaintextSize(size int64) (int64, error) {
+	size -= int64(headerSize)
+	if size < tagSize {
+		return 0, errors.Wrapf(ErrInvalidFile, "unexpected size %d", size+int64(headerSize))
+	}
+
+	if rest := size % sealedChunkSize; rest > 0 && rest < tagSize {
+		return 0, errors.Wrapf(ErrInvalidFile, "unexpected size %d", size+int64(headerSize))
+	}
+
+	chunks := (size + sealedChunkSize - 1) / sealedChunkSize
+
+	return size - chunks*tagSize, nil
+}
+
+// nameCipher encrypts the names deterministically, so that the resources
+// can be found by their name, their nonce being derived from the name
+type nameCipher struct {
+	aead   cipher.AEAD
+	macKey []byte
+}
+
+func (c *nameCipher) encrypt(name string) string {
+	nonce := c.nonce(name)
+	sealed := c.aead.Seal(bytes.Clone(nonce), nonce, []byte(name), nil)
+
+	return base64.RawURLEncoding.EncodeToString(sealed)
+}
+
+func (c *nameCipher) decrypt(encoded string) (string, error) {
+	sealed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < nonceSize+tagSize {
+		return "", errors.Wrapf(ErrInvalidName, "could not decode '%s'", encoded)
+	}
+
+	nonce := sealed[:nonceSize]
+
+	name, err := c.aead.Open(nil, nonce, sealed[nonceSize:], nil)
+	if err != nil || !bytes.Equal(nonce, c.nonce(string(name))) {
+		return "", errors.Wrapf(ErrInvalidName, "could not decrypt '%s'", encoded)
+	}
+
+	return string(name), nil
+}
+
+// encryptPath encrypts each segment of the given path
+func (c *nameCipher) encryptPath(name string) string {
+	name = clean(name)
+	if name == "/" {
+		return name
+	}
+
+	segments := strings.Split(strings.TrimPrefix(name, "/"), "/")
+	for i, s := range segments {
+		segments[i] = c.encrypt(s)
+	}
+
+	return "/" + strings.Join(segments, "/")
+}
+
+func (c *nameCipher) nonce(name string) []byte {
+	mac := hmac.New(sha256.New, c.macKey)
+	mac.Write([]byte(name))
+
+	return mac.Sum(nil)[:nonceSize]
+}
+
+func newNameCipher(key []byte) (*nameCipher, error) {
+	nameKey, err := hkdf.Key(sha256.New, key, nil, "calli names", KeySize)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	macKey, err := hkdf.Key(sha256.New, key, nil, "calli names nonce", KeySize)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	aead, err := newAEAD(nameKey)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &nameCipher{aead: aead, macKey: macKey}, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return aead, nil
+}
+
+func clean(name string) string {
+	return path.Clean("/" + name)
+}
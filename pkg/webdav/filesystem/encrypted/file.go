@@ -0,0 +1,423 @@
+package encrypted
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"os"
+
+	"github.com/bornholm/calli/pkg/webdav/filesystem"
+	"github.com/pkg/errors"
+	"golang.org/x/net/webdav"
+)
+
+// File exposes the plaintext names and sizes of an opened resource
+type File struct {
+	webdav.File
+	fs   *FileSystem
+	name string
+}
+
+// Readdir implements webdav.File.
+func (f *File) Readdir(count int) ([]os.FileInfo, error) {
+	for {
+		infos, err := f.File.Readdir(count)
+
+		visible := make([]os.FileInfo, 0, len(infos))
+		for _, info := range infos {
+			name := info.Name()
+
+			if f.fs.names != nil {
+				// The resources not written through the filesystem are not listed
+				decrypted, decryptErr := f.fs.names.decrypt(name)
+				if decryptErr != nil {
+					continue
+				}
+
+				name = decrypted
+			}
+
+			visible = append(visible, f.fs.fileInfo(info, name))
+		}
+
+		// Do not return an empty page while entries remain
+		if len(visible) == 0 && len(infos) > 0 && count > 0 && err == nil {
+			continue
+		}
+
+		return visible, err
+	}
+}
+
+// Stat implements webdav.File.
+func (f *File) Stat() (os.FileInfo, error) {
+	info, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	return f.fs.fileInfo(info, f.name), nil
+}
+
+// Write implements webdav.File.
+func (f *File) Write(p []byte) (int, error) {
+	return 0, errors.Wrap(filesystem.ErrNotSupported, "the encrypted files can only be written when created or truncated")
+}
+
+// DeadProps implements webdav.DeadPropsHolder.
+func (f *File) DeadProps() (map[xml.Name]webdav.Property, error) {
+	return filesystem.DeadProps(f.File)
+}
+
+// Patch implements webdav.DeadPropsHolder.
+func (f *File) Patch(patches []webdav.Proppatch) ([]webdav.Propstat, error) {
+	return filesystem.Patch(f.File, patches)
+}
+
+var (
+	_ webdav.File            = &File{}
+	_ webdav.DeadPropsHolder = &File{}
+)
+
+// maxSpanChunks is the maximum number of chunks read at once
+const maxSpanChunks = 16
+
+// readFile decrypts the content of an encrypted file, one chunk at a time
+type readFile struct {
+	*File
+
+	cipher *contentCipher
+
+	// Sizes of the encrypted file and of its content
+	backendSize int64
+	size        int64
+
+	// Error of an invalid file, returned by the reads
+	err error
+
+	// Position in the content and in the encrypted file
+	offset   int64
+	position int64
+
+	// Last decrypted chunk
+	chunk      []byte
+	chunkIndex int64
+
+	// Last span of sealed chunks read from the backend
+	span       []byte
+	spanStart  int64
+	spanChunks int64
+}
+
+// Read implements webdav.File.
+func (f *readFile) Read(p []byte) (int, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+
+	if f.offset >= f.size {
+		// The last chunk is checked before reporting the end of the
+		// content, the file having been truncated otherwise
+		var last int64
+		if f.size > 0 {
+			last = (f.size - 1) / chunkSize
+		}
+
+		if err := f.load(last); err != nil {
+			return 0, errors.WithStack(err)
+		}
+
+		return 0, io.EOF
+	}
+
+	index := f.offset / chunkSize
+
+	if err := f.load(index); err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	read := copy(p, f.chunk[f.offset-index*chunkSize:])
+	f.offset += int64(read)
+
+	return read, nil
+}
+
+// Seek implements webdav.File.
+func (f *readFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	case io.SeekEnd:
+		offset += f.size
+	default:
+		return 0, errors.Errorf("invalid whence '%d'", whence)
+	}
+
+	if offset < 0 {
+		return 0, errors.Errorf("invalid offset '%d'", offset)
+	}
+
+	f.offset = offset
+
+	return offset, nil
+}
+
+// load decrypts the chunk at the given index, reading the file's header
+// first if needed. The sequential reads fetch growing spans of chunks, the
+// backends being faster with fewer larger reads.
+func (f *readFile) load(index int64) error {
+	if f.chunkIndex == index {
+		return nil
+	}
+
+	if f.cipher == nil {
+		if err := f.readHeader(); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	start := int64(headerSize) + index*sealedChunkSize
+	length := min(sealedChunkSize, f.backendSize-start)
+
+	if start < f.spanStart || start+length > f.spanStart+int64(len(f.span)) {
+		if index == f.chunkIndex+1 {
+			f.spanChunks = min(max(f.spanChunks*2, 1), maxSpanChunks)
+		} else {
+			f.spanChunks = 1
+		}
+
+		if err := f.readSpan(start, min(f.spanChunks*sealedChunkSize, f.backendSize-start)); err != nil {
+			return errors.Wrapf(err, "could not read chunk %d", index)
+		}
+	}
+
+	sealed := f.span[start-f.spanStart : start-f.spanStart+length]
+
+	chunk, err := f.cipher.open(f.chunk[:0], sealed, index, start+length >= f.backendSize)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	f.chunk = chunk
+	f.chunkIndex = index
+
+	return nil
+}
+
+func (f *readFile) readSpan(start int64, length int64) error {
+	if f.position != start {
+		if _, err := f.File.File.Seek(start, io.SeekStart); err != nil {
+			return errors.WithStack(err)
+		}
+
+		f.position = start
+	}
+
+	if int64(cap(f.span)) < length {
+		f.span = make([]byte, length)
+	}
+
+	f.span = f.span[:length]
+	f.spanStart = start
+
+	read, err := io.ReadFull(f.File.File, f.span)
+	f.position += int64(read)
+	if err != nil {
+		f.span = f.span[:0]
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+func (f *readFile) readHeader() error {
+	if _, err := f.File.File.Seek(0, io.SeekStart); err != nil {
+		return errors.WithStack(err)
+	}
+
+	header := make([]byte, headerSize)
+
+	read, err := io.ReadFull(f.File.File, header)
+	f.position = int64(read)
+	if err != nil {
+		return errors.Wrap(ErrInvalidFile, "could not read header")
+	}
+
+	if string(header[:len(magic)]) != magic {
+		return errors.Wrap(ErrInvalidFile, "unexpected header")
+	}
+
+	cipher, err := newContentCipher(f.fs.key, header[len(magic):])
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	f.cipher = cipher
+
+	return nil
+}
+
+var _ webdav.File = &readFile{}
+
+// writeFile encrypts the content written to a new file
+type writeFile struct {
+	*File
+
+	cipher *contentCipher
+	salt   []byte
+
+	// Pending content of the current chunk
+	buf   []byte
+	index int64
+
+	sealed   []byte
+	written  int64
+	err      error
+	finished bool
+	closed   bool
+}
+
+// Read implements webdav.File.
+func (f *writeFile) Read(p []byte) (int, error) {
+	return 0, errors.Wrap(filesystem.ErrNotSupported, "the encrypted files can not be read while written")
+}
+
+// Write implements webdav.File.
+func (f *writeFile) Write(p []byte) (int, error) {
+	if f.err != nil {
+		return 0, f.err
+	}
+
+	if f.finished {
+		return 0, os.ErrClosed
+	}
+
+	written := 0
+
+	for len(p) > 0 {
+		// The last chunk is only sealed when closing
+		if len(f.buf) == chunkSize {
+			if err := f.flush(false); err != nil {
+				return written, errors.WithStack(err)
+			}
+		}
+
+		n := min(len(p), chunkSize-len(f.buf))
+		f.buf = append(f.buf, p[:n]...)
+		p = p[n:]
+
+		written += n
+		f.written += int64(n)
+	}
+
+	return written, nil
+}
+
+// Seek implements webdav.File.
+func (f *writeFile) Seek(offset int64, whence int) (int64, error) {
+	if (whence == io.SeekStart && offset == f.written) || (whence != io.SeekStart && offset == 0) {
+		return f.written, nil
+	}
+
+	return 0, errors.Wrap(filesystem.ErrNotSupported, "the encrypted files are written sequentially")
+}
+
+// Stat implements webdav.File. As some backends complete the
+// writes when stating the file, the last chunk is sealed first.
+func (f *writeFile) Stat() (os.FileInfo, error) {
+	if err := f.finish(); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	info, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	fi := info.(*fileInfo)
+	fi.size = f.written
+
+	return fi, nil
+}
+
+// Close implements webdav.File.
+func (f *writeFile) Close() error {
+	if f.closed {
+		return nil
+	}
+
+	f.closed = true
+
+	finishErr := f.finish()
+
+	if err := f.File.Close(); err != nil {
+		return err
+	}
+
+	return finishErr
+}
+
+// finish seals the last chunk, the file can not be written anymore
+func (f *writeFile) finish() error {
+	if f.finished {
+		return f.err
+	}
+
+	f.finished = true
+
+	if f.err == nil {
+		f.flush(true)
+	}
+
+	return f.err
+}
+
+func (f *writeFile) flush(last bool) error {
+	if f.index == 0 {
+		header := append([]byte(magic), f.salt...)
+		if _, err := f.File.File.Write(header); err != nil {
+			f.err = errors.WithStack(err)
+			return f.err
+		}
+	}
+
+	f.sealed = f.cipher.seal(f.sealed[:0], f.buf, f.index, last)
+
+	if _, err := f.File.File.Write(f.sealed); err != nil {
+		f.err = errors.WithStack(err)
+		return f.err
+	}
+
+	f.buf = f.buf[:0]
+	f.index++
+
+	return nil
+}
+
+var _ webdav.File = &writeFile{}
+
+type fileInfo struct {
+	os.FileInfo
+	name string
+	size int64
+}
+
+func (fi *fileInfo) Name() string { return fi.name }
+func (fi *fileInfo) Size() int64  { return fi.size }
+
+// ETag implements webdav.ETager.
+func (fi *fileInfo) ETag(ctx context.Context) (string, error) {
+	return filesystem.ETag(ctx, fi.FileInfo)
+}
+
+// ContentType implements webdav.ContentTyper, the content
+// being sniffed if its type is not known by its extension.
+func (fi *fileInfo) ContentType(ctx context.Context) (string, error) {
+	return filesystem.ContentTypeByExtension(fi.name)
+}
+
+var (
+	_ webdav.ETager       = &fileInfo{}
+	_ webdav.ContentTyper = &fileInfo{}
+)
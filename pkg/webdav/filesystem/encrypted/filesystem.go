@@ -0,0 +1,185 @@
+package encrypted
+
+import (
+	"context"
+	"crypto/rand"
+	"os"
+	"path"
+
+	"github.com/bornholm/calli/pkg/webdav/filesystem"
+	"github.com/pkg/errors"
+	"golang.org/x/net/webdav"
+)
+
+// FileSystem encrypts the content of the files of its backend, and
+// optionally their names. The content is sealed by authenticated chunks,
+// the reads seeking to the chunks they need.
+type FileSystem struct {
+	backend webdav.FileSystem
+	key     []byte
+
+	// Cipher of the names, nil if they are not encrypted
+	names *nameCipher
+}
+
+// Mkdir implements webdav.FileSystem.
+func (f *FileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	return f.backend.Mkdir(ctx, f.backendName(name), perm)
+}
+
+// OpenFile implements webdav.FileSystem.
+func (f *FileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if flag&os.O_APPEND != 0 {
+		return nil, errors.WithStack(filesystem.ErrNotSupported)
+	}
+
+	backendName := f.backendName(name)
+
+	// The files are only written from scratch, with a new key
+	fresh := flag&os.O_TRUNC != 0 && flag&(os.O_WRONLY|os.O_RDWR) != 0
+
+	if !fresh && flag&os.O_CREATE != 0 {
+		info, err := f.backend.Stat(ctx, backendName)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			fresh = true
+		case err != nil:
+			return nil, err
+		case flag&os.O_EXCL != 0:
+			return nil, os.ErrExist
+		case !info.IsDir() && info.Size() == 0:
+			fresh = true
+		}
+	}
+
+	if fresh {
+		flag = os.O_WRONLY | os.O_CREATE | os.O_TRUNC | flag&os.O_EXCL
+	} else {
+		// The existing files are never modified in place
+		flag &^= os.O_CREATE | os.O_TRUNC
+	}
+
+	file, err := f.backend.OpenFile(ctx, backendName, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	base := &File{
+		File: file,
+		fs:   f,
+		name: path.Base(clean(name)),
+	}
+
+	if fresh {
+		salt := make([]byte, saltSize)
+		if _, err := rand.Read(salt); err != nil {
+			file.Close()
+			return nil, errors.WithStack(err)
+		}
+
+		cipher, err := newContentCipher(f.key, salt)
+		if err != nil {
+			file.Close()
+			return nil, errors.WithStack(err)
+		}
+
+		return &writeFile{
+			File:   base,
+			cipher: cipher,
+			salt:   salt,
+			buf:    make([]byte, 0, chunkSize),
+		}, nil
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, errors.WithStack(err)
+	}
+
+	if info.IsDir() {
+		return base, nil
+	}
+
+	// The invalid files can still be opened, as to read their
+	// properties, their reads failing
+	size, err := plaintextSize(info.Size())
+
+	return &readFile{
+		File:        base,
+		backendSize: info.Size(),
+		size:        size,
+		err:         err,
+		chunkIndex:  -1,
+	}, nil
+}
+
+// RemoveAll implements webdav.FileSystem.
+func (f *FileSystem) RemoveAll(ctx context.Context, name string) error {
+	return f.backend.RemoveAll(ctx, f.backendName(name))
+}
+
+// Rename implements webdav.FileSystem.
+func (f *FileSystem) Rename(ctx context.Context, oldName string, newName string) error {
+	return f.backend.Rename(ctx, f.backendName(oldName), f.backendName(newName))
+}
+
+// Stat implements webdav.FileSystem.
+func (f *FileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	info, err := f.backend.Stat(ctx, f.backendName(name))
+	if err != nil {
+		return nil, err
+	}
+
+	return f.fileInfo(info, path.Base(clean(name))), nil
+}
+
+// backendName returns the name of the given resource in the backend
+func (f *FileSystem) backendName(name string) string {
+	if f.names == nil {
+		return name
+	}
+
+	return f.names.encryptPath(name)
+}
+
+// fileInfo returns the plaintext file info of the given backend's one
+func (f *FileSystem) fileInfo(info os.FileInfo, name string) *fileInfo {
+	if f.names == nil || name == "/" {
+		name = info.Name()
+	}
+
+	size := info.Size()
+	if !info.IsDir() {
+		// The invalid files are listed as empty, their reads failing
+		size, _ = plaintextSize(size)
+	}
+
+	return &fileInfo{FileInfo: info, name: name, size: size}
+}
+
+// NewFileSystem returns a filesystem encrypting the files of the
+// given backend with the given key of KeySize bytes
+func NewFileSystem(backend webdav.FileSystem, key []byte, encryptNames bool) (*FileSystem, error) {
+	if len(key) != KeySize {
+		return nil, errors.Wrapf(ErrInvalidKey, "expected %d bytes, got %d", KeySize, len(key))
+	}
+
+	fs := &FileSystem{
+		backend: backend,
+		key:     key,
+	}
+
+	if encryptNames {
+		names, err := newNameCipher(key)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		fs.names = names
+	}
+
+	return fs, nil
+}
+
+var _ webdav.FileSystem = &FileSystem{}
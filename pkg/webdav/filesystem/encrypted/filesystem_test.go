@@ -0,0 +1,276 @@
+package encrypted
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bornholm/calli/pkg/webdav/filesystem/local"
+	"github.com/bornholm/calli/pkg/webdav/filesystem/sqlite"
+	"github.com/bornholm/calli/pkg/webdav/filesystem/testsuite"
+	"github.com/pkg/errors"
+	"golang.org/x/net/webdav"
+)
+
+func newTestKey() []byte {
+	key := make([]byte, KeySize)
+	rand.Read(key)
+
+	return key
+}
+
+func TestFileSystem(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	key := base64.StdEncoding.EncodeToString(newTestKey())
+
+	t.Run("Local", func(t *testing.T) {
+		dataDir := filepath.Join(cwd, "testdata/.local")
+
+		if err := os.RemoveAll(dataDir); err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		if err := os.MkdirAll(dataDir, os.ModePerm); err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		testsuite.TestFileSystem(t, Type, &Options{
+			Key:          key,
+			EncryptNames: true,
+			Backend: FileSystemOptions{
+				Type: local.Type,
+				Options: local.Options{
+					Dir: dataDir,
+				},
+			},
+		})
+	})
+
+	t.Run("SQLite", func(t *testing.T) {
+		dbPath := filepath.Join(cwd, "testdata/.sqlite.db")
+
+		if err := os.RemoveAll(dbPath); err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		testsuite.TestFileSystem(t, Type, &Options{
+			Key: key,
+			Backend: FileSystemOptions{
+				Type: sqlite.Type,
+				Options: sqlite.Options{
+					Path: dbPath,
+				},
+			},
+		})
+	})
+}
+
+func TestEncryption(t *testing.T) {
+	ctx := context.Background()
+
+	backend := webdav.NewMemFS()
+	key := newTestKey()
+
+	fs, err := NewFileSystem(backend, key, true)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	content := bytes.Repeat([]byte("0123456789abcdef"), 2*chunkSize/16+100)
+
+	file, err := fs.OpenFile(ctx, "/secret.txt", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if _, err := file.Write(content); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if err := file.Close(); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	info, err := fs.Stat(ctx, "/secret.txt")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := int64(len(content)), info.Size(); e != g {
+		t.Errorf("info.Size(): expected '%v', got '%v'", e, g)
+	}
+
+	// The backend only holds the encrypted name and content
+	if _, err := backend.Stat(ctx, "/secret.txt"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("stat plaintext name: expected '%v', got '%v'", os.ErrNotExist, err)
+	}
+
+	backendName := fs.backendName("/secret.txt")
+
+	encrypted, err := readAll(t, backend, backendName)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if bytes.Contains(encrypted, content[:16]) {
+		t.Errorf("the backend's file should not contain the plaintext content")
+	}
+
+	// The reads seek to the chunks they need
+	file, err = fs.OpenFile(ctx, "/secret.txt", os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	offset := int64(chunkSize - 8)
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	data := make([]byte, 32)
+	if _, err := io.ReadFull(file, data); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := content[offset:offset+32], data; !bytes.Equal(e, g) {
+		t.Errorf("data: expected '%s', got '%s'", e, g)
+	}
+
+	if err := file.Close(); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	dir, err := fs.OpenFile(ctx, "/", os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	infos, err := dir.Readdir(-1)
+	dir.Close()
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := 1, len(infos); e != g {
+		t.Fatalf("len(infos): expected '%v', got '%v'", e, g)
+	}
+
+	if e, g := "secret.txt", infos[0].Name(); e != g {
+		t.Errorf("infos[0].Name(): expected '%v', got '%v'", e, g)
+	}
+
+	// The altered files can not be read
+	alterations := map[string][]byte{
+		"Tampered":  append(bytes.Clone(encrypted[:headerSize+10]), append([]byte{encrypted[headerSize+10] ^ 1}, encrypted[headerSize+11:]...)...),
+		"Truncated": encrypted[:headerSize+sealedChunkSize],
+		// Truncated in the middle of a tag
+		"PartialTag": encrypted[:headerSize+sealedChunkSize+5],
+		// Truncated to what would be an empty content
+		"EmptyContent": encrypted[:headerSize+tagSize],
+		"HeaderOnly":   encrypted[:headerSize],
+		"Empty":        {},
+	}
+
+	for name, altered := range alterations {
+		t.Run(name, func(t *testing.T) {
+			writeAll(t, backend, backendName, altered)
+
+			if _, err := readAll(t, fs, "/secret.txt"); !errors.Is(err, ErrInvalidFile) {
+				t.Errorf("read altered file: expected '%v', got '%v'", ErrInvalidFile, err)
+			}
+		})
+	}
+
+	// Nor with another key
+	writeAll(t, backend, backendName, encrypted)
+
+	other, err := NewFileSystem(backend, newTestKey(), false)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if _, err := readAll(t, other, backendName); !errors.Is(err, ErrInvalidFile) {
+		t.Errorf("read with another key: expected '%v', got '%v'", ErrInvalidFile, err)
+	}
+}
+
+func TestEncryptionEmptyFile(t *testing.T) {
+	ctx := context.Background()
+
+	backend := webdav.NewMemFS()
+
+	fs, err := NewFileSystem(backend, newTestKey(), false)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	writeAll(t, fs, "/empty.txt", nil)
+
+	data, err := readAll(t, fs, "/empty.txt")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := 0, len(data); e != g {
+		t.Errorf("len(data): expected '%v', got '%v'", e, g)
+	}
+
+	info, err := fs.Stat(ctx, "/empty.txt")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := int64(0), info.Size(); e != g {
+		t.Errorf("info.Size(): expected '%v', got '%v'", e, g)
+	}
+
+	encrypted, err := readAll(t, backend, "/empty.txt")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	// The sealed empty chunk is checked as well
+	tampered := bytes.Clone(encrypted)
+	tampered[len(tampered)-1] ^= 1
+
+	writeAll(t, backend, "/empty.txt", tampered)
+
+	if _, err := readAll(t, fs, "/empty.txt"); !errors.Is(err, ErrInvalidFile) {
+		t.Errorf("read tampered empty file: expected '%v', got '%v'", ErrInvalidFile, err)
+	}
+}
+
+func readAll(t *testing.T, fs webdav.FileSystem, name string) ([]byte, error) {
+	file, err := fs.OpenFile(context.Background(), name, os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	defer file.Close()
+
+	return io.ReadAll(file)
+}
+
+func writeAll(t *testing.T, fs webdav.FileSystem, name string, data []byte) {
+	file, err := fs.OpenFile(context.Background(), name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if _, err := file.Write(data); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if err := file.Close(); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+}
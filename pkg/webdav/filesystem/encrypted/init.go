@@ -0,0 +1,75 @@
+package encrypted
+
+import (
+	"encoding/base64"
+	"os"
+	"strings"
+
+	"github.com/bornholm/calli/pkg/webdav/filesystem"
+	"github.com/go-viper/mapstructure/v2"
+	"github.com/pkg/errors"
+	"golang.org/x/net/webdav"
+)
+
+const (
+	Type filesystem.Type = "encrypted"
+)
+
+func init() {
+	filesystem.Register(Type, CreateFileSystemFromOptions)
+}
+
+type Options struct {
+	// Base64 encoded key of 32 bytes, i.e. generated with 'openssl rand -base64 32'
+	Key string `mapstructure:"key"`
+	// Path of the file holding the base64 encoded key, if no key is given
+	KeyFile string `mapstructure:"keyFile"`
+	// Encrypt the names of the files and directories too
+	EncryptNames bool              `mapstructure:"encryptNames"`
+	Backend      FileSystemOptions `mapstructure:"backend"`
+}
+
+type FileSystemOptions struct {
+	Type    filesystem.Type `mapstructure:"type"`
+	Options any             `mapstructure:"options"`
+}
+
+func CreateFileSystemFromOptions(options any) (webdav.FileSystem, error) {
+	opts := Options{}
+
+	if err := mapstructure.Decode(options, &opts); err != nil {
+		return nil, errors.Wrapf(err, "could not parse '%s' filesystem options", Type)
+	}
+
+	encodedKey := opts.Key
+
+	if encodedKey == "" && opts.KeyFile != "" {
+		data, err := os.ReadFile(opts.KeyFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not read key file '%s'", opts.KeyFile)
+		}
+
+		encodedKey = string(data)
+	}
+
+	if encodedKey == "" {
+		return nil, errors.Wrapf(ErrInvalidKey, "no key given to '%s' filesystem", Type)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(strings.TrimSpace(encodedKey))
+	if err != nil {
+		return nil, errors.Wrap(ErrInvalidKey, "could not decode key")
+	}
+
+	backend, err := filesystem.New(opts.Backend.Type, opts.Backend.Options)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not create backend filesystem '%s'", opts.Backend.Type)
+	}
+
+	fs, err := NewFileSystem(backend, key, opts.EncryptNames)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not create '%s' filesystem", Type)
+	}
+
+	return fs, nil
+}
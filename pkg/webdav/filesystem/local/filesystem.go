@@ -0,0 +1,106 @@
+package local
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/bornholm/calli/pkg/webdav/filesystem"
+	"golang.org/x/net/webdav"
+)
+
+// FileSystem exposes a local directory, its file infos
+// providing their ETag and content type
+type FileSystem struct {
+	dir webdav.Dir
+}
+
+// Mkdir implements webdav.FileSystem.
+func (f *FileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	return f.dir.Mkdir(ctx, name, perm)
+}
+
+// OpenFile implements webdav.FileSystem.
+func (f *FileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	file, err := f.dir.OpenFile(ctx, name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	return &File{File: file}, nil
+}
+
+// RemoveAll implements webdav.FileSystem.
+func (f *FileSystem) RemoveAll(ctx context.Context, name string) error {
+	return f.dir.RemoveAll(ctx, name)
+}
+
+// Rename implements webdav.FileSystem.
+func (f *FileSystem) Rename(ctx context.Context, oldName string, newName string) error {
+	return f.dir.Rename(ctx, oldName, newName)
+}
+
+// Stat implements webdav.FileSystem.
+func (f *FileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	info, err := f.dir.Stat(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileInfo{info}, nil
+}
+
+func NewFileSystem(dir string) *FileSystem {
+	return &FileSystem{
+		dir: webdav.Dir(dir),
+	}
+}
+
+var _ webdav.FileSystem = &FileSystem{}
+
+// File wraps the file infos of an opened local file
+type File struct {
+	webdav.File
+}
+
+// Readdir implements webdav.File.
+func (f *File) Readdir(count int) ([]os.FileInfo, error) {
+	infos, err := f.File.Readdir(count)
+
+	for i, info := range infos {
+		infos[i] = &fileInfo{info}
+	}
+
+	return infos, err
+}
+
+// Stat implements webdav.File.
+func (f *File) Stat() (os.FileInfo, error) {
+	info, err := f.File.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileInfo{info}, nil
+}
+
+var _ webdav.File = &File{}
+
+type fileInfo struct {
+	os.FileInfo
+}
+
+// ETag implements webdav.ETager.
+func (fi *fileInfo) ETag(ctx context.Context) (string, error) {
+	return fmt.Sprintf(`"%x-%x"`, fi.ModTime().UnixNano(), fi.Size()), nil
+}
+
+// ContentType implements webdav.ContentTyper.
+func (fi *fileInfo) ContentType(ctx context.Context) (string, error) {
+	return filesystem.ContentTypeByExtension(fi.Name())
+}
+
+var (
+	_ webdav.ETager       = &fileInfo{}
+	_ webdav.ContentTyper = &fileInfo{}
+)
@@ -30,7 +30,7 @@ func CreateFileSystemFromOptions(options any) (webdav.FileSystem, error) {
 		return nil, errors.Wrapf(err, "could not create directory '%s'", opts.Dir)
 	}
 
-	fs := webdav.Dir(opts.Dir)
+	fs := NewFileSystem(opts.Dir)
 
 	return fs, nil
 }
@@ -0,0 +1,246 @@
+package mount
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"syscall"
+	"time"
+
+	"github.com/bornholm/calli/pkg/webdav/filesystem"
+	"github.com/pkg/errors"
+	"golang.org/x/net/webdav"
+)
+
+// virtualDir is a read-only directory materializing a mount point (or one
+// of its ancestors) which is not backed by any existing directory
+type virtualDir struct {
+	ctx     context.Context
+	fs      *FileSystem
+	name    string
+	backend webdav.File
+	entries *dirEntries
+}
+
+// Close implements webdav.File.
+func (d *virtualDir) Close() error {
+	if d.backend != nil {
+		return d.backend.Close()
+	}
+
+	return nil
+}
+
+// Read implements webdav.File.
+func (d *virtualDir) Read(p []byte) (n int, err error) {
+	return 0, &os.PathError{Op: "read", Path: d.name, Err: syscall.EISDIR}
+}
+
+// Readdir implements webdav.File.
+func (d *virtualDir) Readdir(count int) ([]fs.FileInfo, error) {
+	if d.entries == nil {
+		var backendEntries []fs.FileInfo
+		if d.backend != nil {
+			entries, err := d.backend.Readdir(0)
+			if err != nil && !errors.Is(err, io.EOF) {
+				return nil, errors.WithStack(err)
+			}
+
+			backendEntries = entries
+		}
+
+		entries, err := d.fs.mergeChildMounts(d.ctx, d.name, backendEntries)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		d.entries = entries
+	}
+
+	return d.entries.Next(count)
+}
+
+// Seek implements webdav.File.
+func (d *virtualDir) Seek(offset int64, whence int) (int64, error) {
+	return 0, &os.PathError{Op: "seek", Path: d.name, Err: syscall.EISDIR}
+}
+
+// Stat implements webdav.File.
+func (d *virtualDir) Stat() (fs.FileInfo, error) {
+	info := &virtualDirInfo{name: path.Base(d.name)}
+
+	if d.backend != nil {
+		backendInfo, err := d.backend.Stat()
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		info.modTime = backendInfo.ModTime()
+	}
+
+	return info, nil
+}
+
+// Write implements webdav.File.
+func (d *virtualDir) Write(p []byte) (n int, err error) {
+	return 0, &os.PathError{Op: "write", Path: d.name, Err: syscall.EISDIR}
+}
+
+var _ webdav.File = &virtualDir{}
+
+// mountedDir is a backend directory having at least one mount point
+// attached below it
+type mountedDir struct {
+	webdav.File
+	ctx     context.Context
+	fs      *FileSystem
+	name    string
+	entries *dirEntries
+}
+
+// Readdir implements webdav.File.
+func (d *mountedDir) Readdir(count int) ([]fs.FileInfo, error) {
+	if d.entries == nil {
+		backendEntries, err := d.File.Readdir(0)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, errors.WithStack(err)
+		}
+
+		entries, err := d.fs.mergeChildMounts(d.ctx, d.name, backendEntries)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		d.entries = entries
+	}
+
+	return d.entries.Next(count)
+}
+
+// Stat implements webdav.File.
+func (d *mountedDir) Stat() (fs.FileInfo, error) {
+	info, err := d.File.Stat()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return &virtualDirInfo{name: path.Base(d.name), modTime: info.ModTime()}, nil
+}
+
+// DeadProps implements webdav.DeadPropsHolder.
+func (d *mountedDir) DeadProps() (map[xml.Name]webdav.Property, error) {
+	return filesystem.DeadProps(d.File)
+}
+
+// Patch implements webdav.DeadPropsHolder.
+func (d *mountedDir) Patch(patches []webdav.Proppatch) ([]webdav.Propstat, error) {
+	return filesystem.Patch(d.File, patches)
+}
+
+var (
+	_ webdav.File            = &mountedDir{}
+	_ webdav.DeadPropsHolder = &mountedDir{}
+)
+
+// mergeChildMounts adds the child mount points of the given directory to
+// the given entries, mount points shadowing entries with the same name
+func (f *FileSystem) mergeChildMounts(ctx context.Context, name string, entries []fs.FileInfo) (*dirEntries, error) {
+	children := f.childMounts(name)
+
+	shadowed := make(map[string]struct{}, len(children))
+	for _, c := range children {
+		shadowed[c] = struct{}{}
+	}
+
+	merged := make([]fs.FileInfo, 0, len(entries)+len(children))
+
+	for _, e := range entries {
+		if _, exists := shadowed[e.Name()]; exists {
+			continue
+		}
+
+		merged = append(merged, e)
+	}
+
+	for _, c := range children {
+		info, err := f.Stat(ctx, path.Join(name, c))
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		merged = append(merged, info)
+	}
+
+	sort.Slice(merged, func(i, j int) bool {
+		return merged[i].Name() < merged[j].Name()
+	})
+
+	return &dirEntries{entries: merged}, nil
+}
+
+type dirEntries struct {
+	entries []fs.FileInfo
+	offset  int
+}
+
+func (d *dirEntries) Next(count int) ([]fs.FileInfo, error) {
+	remaining := d.entries[d.offset:]
+
+	if count <= 0 {
+		d.offset = len(d.entries)
+		return remaining, nil
+	}
+
+	if len(remaining) == 0 {
+		return nil, io.EOF
+	}
+
+	if count > len(remaining) {
+		count = len(remaining)
+	}
+
+	d.offset += count
+
+	return remaining[:count], nil
+}
+
+type virtualDirInfo struct {
+	name    string
+	modTime time.Time
+}
+
+// IsDir implements fs.FileInfo.
+func (i *virtualDirInfo) IsDir() bool {
+	return true
+}
+
+// ModTime implements fs.FileInfo.
+func (i *virtualDirInfo) ModTime() time.Time {
+	return i.modTime
+}
+
+// Mode implements fs.FileInfo.
+func (i *virtualDirInfo) Mode() fs.FileMode {
+	return os.ModeDir | 0755
+}
+
+// Name implements fs.FileInfo.
+func (i *virtualDirInfo) Name() string {
+	return i.name
+}
+
+// Size implements fs.FileInfo.
+func (i *virtualDirInfo) Size() int64 {
+	return 0
+}
+
+// Sys implements fs.FileInfo.
+func (i *virtualDirInfo) Sys() any {
+	return nil
+}
+
+var _ fs.FileInfo = &virtualDirInfo{}
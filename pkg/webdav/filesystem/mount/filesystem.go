@@ -0,0 +1,339 @@
+package mount
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/webdav"
+)
+
+// Mount associates a path prefix with a backend filesystem
+type Mount struct {
+	Path       string
+	FileSystem webdav.FileSystem
+}
+
+// FileSystem implements webdav.FileSystem by routing each operation
+// to the mounted backend owning the longest matching path prefix.
+// Mount points that are not backed by a filesystem mounted on a parent
+// prefix are exposed as virtual read-only directories.
+type FileSystem struct {
+	mounts []Mount
+}
+
+// Mkdir implements webdav.FileSystem.
+func (f *FileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	name = clean(name)
+
+	if f.isVirtualDir(name) {
+		return os.ErrExist
+	}
+
+	mount, rel, ok := f.resolve(name)
+	if !ok {
+		return os.ErrNotExist
+	}
+
+	return mount.FileSystem.Mkdir(ctx, rel, perm)
+}
+
+// OpenFile implements webdav.FileSystem.
+func (f *FileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	name = clean(name)
+
+	mount, rel, ok := f.resolve(name)
+
+	if !ok || (f.isVirtualDir(name) && !f.isMountPoint(name)) {
+		if !f.isVirtualDir(name) {
+			return nil, os.ErrNotExist
+		}
+
+		if flag&(os.O_WRONLY|os.O_RDWR|os.O_APPEND|os.O_CREATE|os.O_TRUNC) != 0 {
+			return nil, &os.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+		}
+
+		var backend webdav.File
+		if ok {
+			file, err := mount.FileSystem.OpenFile(ctx, rel, flag, perm)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return nil, err
+			}
+
+			backend = file
+		}
+
+		return &virtualDir{
+			ctx:     ctx,
+			fs:      f,
+			name:    name,
+			backend: backend,
+		}, nil
+	}
+
+	file, err := mount.FileSystem.OpenFile(ctx, rel, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	if f.hasChildMounts(name) {
+		return &mountedDir{
+			File: file,
+			ctx:  ctx,
+			fs:   f,
+			name: name,
+		}, nil
+	}
+
+	return file, nil
+}
+
+// RemoveAll implements webdav.FileSystem.
+func (f *FileSystem) RemoveAll(ctx context.Context, name string) error {
+	name = clean(name)
+
+	if f.isVirtualDir(name) {
+		return os.ErrPermission
+	}
+
+	mount, rel, ok := f.resolve(name)
+	if !ok {
+		return os.ErrNotExist
+	}
+
+	return mount.FileSystem.RemoveAll(ctx, rel)
+}
+
+// Rename implements webdav.FileSystem.
+func (f *FileSystem) Rename(ctx context.Context, oldName string, newName string) error {
+	oldName = clean(oldName)
+	newName = clean(newName)
+
+	if f.isVirtualDir(oldName) || f.isVirtualDir(newName) {
+		return os.ErrPermission
+	}
+
+	oldMount, oldRel, ok := f.resolve(oldName)
+	if !ok {
+		return os.ErrNotExist
+	}
+
+	newMount, newRel, ok := f.resolve(newName)
+	if !ok {
+		return os.ErrNotExist
+	}
+
+	if oldMount.Path == newMount.Path {
+		return oldMount.FileSystem.Rename(ctx, oldRel, newRel)
+	}
+
+	// Backends can not rename across each other, fallback on copy then delete
+	if err := copyAll(ctx, oldMount.FileSystem, oldRel, newMount.FileSystem, newRel); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := oldMount.FileSystem.RemoveAll(ctx, oldRel); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Stat implements webdav.FileSystem.
+func (f *FileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	name = clean(name)
+
+	mount, rel, ok := f.resolve(name)
+	if ok {
+		info, err := mount.FileSystem.Stat(ctx, rel)
+		if err == nil {
+			// Backends do not know the name of their own root
+			if f.isMountPoint(name) {
+				return &virtualDirInfo{name: path.Base(name), modTime: info.ModTime()}, nil
+			}
+
+			return info, nil
+		}
+
+		if !errors.Is(err, os.ErrNotExist) || !f.isVirtualDir(name) {
+			return nil, err
+		}
+	}
+
+	if f.isVirtualDir(name) {
+		return &virtualDirInfo{name: path.Base(name)}, nil
+	}
+
+	return nil, os.ErrNotExist
+}
+
+// resolve returns the mount owning the given path and the path
+// relative to this mount's root
+func (f *FileSystem) resolve(name string) (Mount, string, bool) {
+	for _, m := range f.mounts {
+		if m.Path == "/" {
+			return m, name, true
+		}
+
+		if name == m.Path {
+			return m, "/", true
+		}
+
+		if strings.HasPrefix(name, m.Path+"/") {
+			return m, strings.TrimPrefix(name, m.Path), true
+		}
+	}
+
+	return Mount{}, "", false
+}
+
+// isMountPoint returns true if a mount is attached to the given path
+func (f *FileSystem) isMountPoint(name string) bool {
+	for _, m := range f.mounts {
+		if m.Path == name && name != "/" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isVirtualDir returns true if the given path is a mount point
+// or one of its ancestors
+func (f *FileSystem) isVirtualDir(name string) bool {
+	if name == "/" {
+		return true
+	}
+
+	for _, m := range f.mounts {
+		if m.Path == name || strings.HasPrefix(m.Path, name+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// hasChildMounts returns true if at least one mount is attached below
+// the given path
+func (f *FileSystem) hasChildMounts(name string) bool {
+	return len(f.childMounts(name)) > 0
+}
+
+// childMounts returns the names of the direct children of the given path
+// that are mount points or ancestors of mount points
+func (f *FileSystem) childMounts(name string) []string {
+	prefix := name
+	if prefix != "/" {
+		prefix += "/"
+	}
+
+	seen := map[string]struct{}{}
+	children := make([]string, 0)
+
+	for _, m := range f.mounts {
+		if m.Path == "/" || !strings.HasPrefix(m.Path, prefix) {
+			continue
+		}
+
+		child, _, _ := strings.Cut(strings.TrimPrefix(m.Path, prefix), "/")
+		if _, exists := seen[child]; exists {
+			continue
+		}
+
+		seen[child] = struct{}{}
+		children = append(children, child)
+	}
+
+	sort.Strings(children)
+
+	return children
+}
+
+// NewFileSystem creates a new filesystem multiplexing the given mounts
+func NewFileSystem(mounts ...Mount) *FileSystem {
+	sorted := make([]Mount, 0, len(mounts))
+	for _, m := range mounts {
+		sorted = append(sorted, Mount{
+			Path:       clean(m.Path),
+			FileSystem: m.FileSystem,
+		})
+	}
+
+	// Longest prefixes first, the root mount always comes last
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return len(sorted[i].Path) > len(sorted[j].Path)
+	})
+
+	return &FileSystem{
+		mounts: sorted,
+	}
+}
+
+var _ webdav.FileSystem = &FileSystem{}
+
+func clean(name string) string {
+	name = path.Clean("/" + name)
+	return name
+}
+
+// copyAll recursively copies the given file or directory between two filesystems
+func copyAll(ctx context.Context, srcFs webdav.FileSystem, src string, dstFs webdav.FileSystem, dst string) error {
+	info, err := srcFs.Stat(ctx, src)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if info.IsDir() {
+		if err := dstFs.Mkdir(ctx, dst, info.Mode().Perm()|os.ModeDir); err != nil && !errors.Is(err, os.ErrExist) {
+			return errors.WithStack(err)
+		}
+
+		dir, err := srcFs.OpenFile(ctx, src, os.O_RDONLY, 0)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		children, err := dir.Readdir(-1)
+		dir.Close()
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		for _, c := range children {
+			if err := copyAll(ctx, srcFs, path.Join(src, c.Name()), dstFs, path.Join(dst, c.Name())); err != nil {
+				return errors.WithStack(err)
+			}
+		}
+
+		return nil
+	}
+
+	srcFile, err := srcFs.OpenFile(ctx, src, os.O_RDONLY, 0)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer srcFile.Close()
+
+	dstFile, err := dstFs.OpenFile(ctx, dst, os.O_RDWR|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if _, err := io.Copy(dstFile, srcFile); err != nil {
+		dstFile.Close()
+		return errors.WithStack(err)
+	}
+
+	if err := dstFile.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
@@ -0,0 +1,139 @@
+package mount
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bornholm/calli/pkg/webdav/filesystem/local"
+	"github.com/bornholm/calli/pkg/webdav/filesystem/testsuite"
+	"github.com/pkg/errors"
+)
+
+func TestFileSystem(t *testing.T) {
+	rootDir := createDataDir(t, "testdata/.local/root")
+	mountedDir := createDataDir(t, "testdata/.local/mounted")
+
+	testsuite.TestFileSystem(t, Type, &Options{
+		Mounts: []MountOptions{
+			{
+				Path: "/",
+				Type: local.Type,
+				Options: local.Options{
+					Dir: rootDir,
+				},
+			},
+			{
+				Path: "/mounted/data",
+				Type: local.Type,
+				Options: local.Options{
+					Dir: mountedDir,
+				},
+			},
+		},
+	})
+}
+
+func TestCrossMountRename(t *testing.T) {
+	ctx := context.Background()
+
+	fs, err := CreateFileSystemFromOptions(&Options{
+		Mounts: []MountOptions{
+			{
+				Path:    "/first",
+				Type:    local.Type,
+				Options: local.Options{Dir: createDataDir(t, "testdata/.local/first")},
+			},
+			{
+				Path:    "/second",
+				Type:    local.Type,
+				Options: local.Options{Dir: createDataDir(t, "testdata/.local/second")},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	root, err := fs.OpenFile(ctx, "/", os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	entries, err := root.Readdir(0)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := 2, len(entries); e != g {
+		t.Fatalf("len(entries): expected '%v', got '%v'", e, g)
+	}
+
+	if err := fs.Mkdir(ctx, "/first/dir", os.ModePerm); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	file, err := fs.OpenFile(ctx, "/first/dir/file.txt", os.O_CREATE|os.O_RDWR, os.ModePerm)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	data := []byte("cross mount rename")
+
+	if _, err := file.Write(data); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if err := file.Close(); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if err := fs.Rename(ctx, "/first/dir", "/second/dir"); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if _, err := fs.Stat(ctx, "/first/dir"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatalf("stat '/first/dir': expected '%v', got '%v'", os.ErrNotExist, err)
+	}
+
+	file, err = fs.OpenFile(ctx, "/second/dir/file.txt", os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	defer file.Close()
+
+	content, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := string(data), string(content); e != g {
+		t.Fatalf("content: expected '%v', got '%v'", e, g)
+	}
+
+	if err := fs.RemoveAll(ctx, "/second"); !errors.Is(err, os.ErrPermission) {
+		t.Fatalf("remove mount point: expected '%v', got '%v'", os.ErrPermission, err)
+	}
+}
+
+func createDataDir(t *testing.T, dir string) string {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	dataDir := filepath.Join(cwd, dir)
+
+	if err := os.RemoveAll(dataDir); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if err := os.MkdirAll(dataDir, os.ModePerm); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	return dataDir
+}
@@ -0,0 +1,69 @@
+package mount
+
+import (
+	"github.com/bornholm/calli/pkg/webdav/filesystem"
+	"github.com/go-viper/mapstructure/v2"
+	"github.com/pkg/errors"
+	"golang.org/x/net/webdav"
+)
+
+const (
+	Type filesystem.Type = "mount"
+)
+
+func init() {
+	filesystem.Register(Type, CreateFileSystemFromOptions)
+}
+
+type Options struct {
+	Mounts []MountOptions `mapstructure:"mounts"`
+}
+
+type MountOptions struct {
+	Path    string          `mapstructure:"path"`
+	Type    filesystem.Type `mapstructure:"type"`
+	Options any             `mapstructure:"options"`
+}
+
+func CreateFileSystemFromOptions(options any) (webdav.FileSystem, error) {
+	opts := Options{}
+
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		Metadata:   nil,
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(mapstructure.StringToTimeDurationHookFunc()),
+		Result:     &opts,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not create '%s' filesystem options decoder", Type)
+	}
+
+	if err := decoder.Decode(options); err != nil {
+		return nil, errors.Wrapf(err, "could not parse '%s' filesystem options", Type)
+	}
+
+	mounts := make([]Mount, 0, len(opts.Mounts))
+	seen := map[string]struct{}{}
+
+	for _, m := range opts.Mounts {
+		path := clean(m.Path)
+		if _, exists := seen[path]; exists {
+			return nil, errors.Errorf("duplicate mount path '%s'", path)
+		}
+
+		seen[path] = struct{}{}
+
+		fs, err := filesystem.New(m.Type, m.Options)
+		if err != nil {
+			return nil, errors.Wrapf(err, "could not create filesystem '%s' mounted on '%s'", m.Type, path)
+		}
+
+		mounts = append(mounts, Mount{
+			Path:       path,
+			FileSystem: fs,
+		})
+	}
+
+	fs := NewFileSystem(mounts...)
+
+	return fs, nil
+}
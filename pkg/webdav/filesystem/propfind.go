@@ -0,0 +1,90 @@
+package filesystem
+
+import (
+	"bytes"
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+)
+
+// maxPropfindSize is the size of the PROPFIND bodies read to find
+// the requested properties, the larger ones requesting them all
+const maxPropfindSize = 64 << 10
+
+type contextKey string
+
+const contextKeyRequestedProps contextKey = "requestedProps"
+
+// requestedProps are the properties named by a request
+type requestedProps struct {
+	all   bool
+	names map[xml.Name]struct{}
+}
+
+// RequestedPropsMiddleware records the properties named by each request,
+// allowing the files to compute their live properties only when a
+// PROPFIND requests them, see PropRequested
+func RequestedPropsMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		props := &requestedProps{
+			names: make(map[xml.Name]struct{}),
+		}
+
+		if r.Method == "PROPFIND" && r.Body != nil {
+			data, err := io.ReadAll(io.LimitReader(r.Body, maxPropfindSize))
+
+			// The body is read again by the handler
+			r.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(data), r.Body), r.Body}
+
+			if err != nil || len(data) == maxPropfindSize || !props.parse(data) {
+				props.all = true
+			}
+		}
+
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKeyRequestedProps, props)))
+	})
+}
+
+// parse collects the names of the elements of the given PROPFIND body,
+// returning false if it can not be decoded
+func (p *requestedProps) parse(data []byte) bool {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+
+	for {
+		token, err := decoder.Token()
+		if err != nil {
+			return err == io.EOF
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok {
+			continue
+		}
+
+		// The names of all the properties are listed
+		if start.Name == (xml.Name{Space: "DAV:", Local: "propname"}) {
+			p.all = true
+		}
+
+		p.names[start.Name] = struct{}{}
+	}
+}
+
+// PropRequested returns true if the given property is named by the
+// request of the given context. As per RFC 4918, the properties defined
+// by other specifications are not returned by an allprop PROPFIND. If the
+// request is unknown, all properties are considered requested.
+func PropRequested(ctx context.Context, name xml.Name) bool {
+	props, ok := ctx.Value(contextKeyRequestedProps).(*requestedProps)
+	if !ok || props.all {
+		return true
+	}
+
+	_, requested := props.names[name]
+
+	return requested
+}
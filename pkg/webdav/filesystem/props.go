@@ -0,0 +1,93 @@
+package filesystem
+
+import (
+	"encoding/xml"
+	"net/http"
+	"slices"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/webdav"
+)
+
+// DeadProps returns the dead properties of the given file,
+// nil if it does not hold any
+func DeadProps(file webdav.File) (map[xml.Name]webdav.Property, error) {
+	holder, ok := file.(webdav.DeadPropsHolder)
+	if !ok {
+		return nil, nil
+	}
+
+	props, err := holder.DeadProps()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return props, nil
+}
+
+// Patch patches the dead properties of the given file. As with
+// webdav.Handler, all patches are forbidden if the file does not
+// hold dead properties.
+func Patch(file webdav.File, patches []webdav.Proppatch) ([]webdav.Propstat, error) {
+	holder, ok := file.(webdav.DeadPropsHolder)
+	if !ok {
+		pstat := webdav.Propstat{Status: http.StatusForbidden}
+		for _, patch := range patches {
+			for _, p := range patch.Props {
+				pstat.Props = append(pstat.Props, webdav.Property{XMLName: p.XMLName})
+			}
+		}
+
+		return []webdav.Propstat{pstat}, nil
+	}
+
+	propstats, err := holder.Patch(patches)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return propstats, nil
+}
+
+// PatchProtected patches the dead properties of the given file unless
+// one of the protected properties is patched, all patches then failing
+func PatchProtected(file webdav.File, patches []webdav.Proppatch, protected ...xml.Name) ([]webdav.Propstat, error) {
+	patchesProtected := false
+	for _, patch := range patches {
+		for _, p := range patch.Props {
+			if slices.Contains(protected, p.XMLName) {
+				patchesProtected = true
+			}
+		}
+	}
+
+	if !patchesProtected {
+		return Patch(file, patches)
+	}
+
+	// Patching is atomic, the other properties are not patched either
+	forbidden := webdav.Propstat{
+		Status:   http.StatusForbidden,
+		XMLError: `<D:cannot-modify-protected-property xmlns:D="DAV:"/>`,
+	}
+	failed := webdav.Propstat{
+		Status: webdav.StatusFailedDependency,
+	}
+
+	for _, patch := range patches {
+		for _, p := range patch.Props {
+			if slices.Contains(protected, p.XMLName) {
+				forbidden.Props = append(forbidden.Props, webdav.Property{XMLName: p.XMLName})
+			} else {
+				failed.Props = append(failed.Props, webdav.Property{XMLName: p.XMLName})
+			}
+		}
+	}
+
+	propstats := []webdav.Propstat{forbidden}
+	if len(failed.Props) > 0 {
+		propstats = append(propstats, failed)
+	}
+
+	return propstats, nil
+}
@@ -0,0 +1,144 @@
+package props
+
+import (
+	"context"
+	"encoding/xml"
+	"os"
+	"path"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/webdav"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitemigration"
+)
+
+// FileSystem keeps the dead properties of the backend's resources
+// in a SQLite database, following them when renamed or removed
+type FileSystem struct {
+	backend webdav.FileSystem
+	pool    *sqlitemigration.Pool
+}
+
+// Mkdir implements webdav.FileSystem.
+func (f *FileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	return f.backend.Mkdir(ctx, name, perm)
+}
+
+// OpenFile implements webdav.FileSystem.
+func (f *FileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	// PROPPATCH opens the resources for writing, which the backends may
+	// refuse for the directories, the properties being held here
+	if flag == os.O_RDWR {
+		flag = os.O_RDONLY
+	}
+
+	file, err := f.backend.OpenFile(ctx, name, flag, perm)
+	if err != nil {
+		return nil, err
+	}
+
+	return &File{
+		File: file,
+		ctx:  ctx,
+		fs:   f,
+		name: clean(name),
+	}, nil
+}
+
+// RemoveAll implements webdav.FileSystem.
+func (f *FileSystem) RemoveAll(ctx context.Context, name string) error {
+	if err := f.backend.RemoveAll(ctx, name); err != nil {
+		return err
+	}
+
+	return f.do(ctx, func(conn *sqlite.Conn) error {
+		return errors.WithStack(Delete(conn, clean(name)))
+	})
+}
+
+// Rename implements webdav.FileSystem.
+func (f *FileSystem) Rename(ctx context.Context, oldName string, newName string) error {
+	if err := f.backend.Rename(ctx, oldName, newName); err != nil {
+		return err
+	}
+
+	return f.do(ctx, func(conn *sqlite.Conn) error {
+		return errors.WithStack(Move(conn, clean(oldName), clean(newName)))
+	})
+}
+
+// Stat implements webdav.FileSystem.
+func (f *FileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	return f.backend.Stat(ctx, name)
+}
+
+func (f *FileSystem) do(ctx context.Context, fn func(conn *sqlite.Conn) error) error {
+	conn, err := f.pool.Take(ctx)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer f.pool.Put(conn)
+
+	if err := fn(conn); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+func NewFileSystem(backend webdav.FileSystem, pool *sqlitemigration.Pool) *FileSystem {
+	return &FileSystem{
+		backend: backend,
+		pool:    pool,
+	}
+}
+
+var _ webdav.FileSystem = &FileSystem{}
+
+// File exposes the dead properties of the opened resource
+type File struct {
+	webdav.File
+	ctx  context.Context
+	fs   *FileSystem
+	name string
+}
+
+// DeadProps implements webdav.DeadPropsHolder.
+func (f *File) DeadProps() (map[xml.Name]webdav.Property, error) {
+	var props map[xml.Name]webdav.Property
+
+	err := f.fs.do(f.ctx, func(conn *sqlite.Conn) (err error) {
+		props, err = Load(conn, f.name)
+		return errors.WithStack(err)
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return props, nil
+}
+
+// Patch implements webdav.DeadPropsHolder.
+func (f *File) Patch(patches []webdav.Proppatch) ([]webdav.Propstat, error) {
+	var propstats []webdav.Propstat
+
+	err := f.fs.do(f.ctx, func(conn *sqlite.Conn) (err error) {
+		propstats, err = Patch(conn, f.name, patches)
+		return errors.WithStack(err)
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return propstats, nil
+}
+
+var (
+	_ webdav.File            = &File{}
+	_ webdav.DeadPropsHolder = &File{}
+)
+
+func clean(name string) string {
+	return path.Clean("/" + name)
+}
@@ -0,0 +1,41 @@
+package props
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bornholm/calli/pkg/webdav/filesystem/local"
+	"github.com/bornholm/calli/pkg/webdav/filesystem/testsuite"
+	"github.com/pkg/errors"
+)
+
+func TestFileSystem(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	dataDir := filepath.Join(cwd, "testdata/.local")
+	dbPath := filepath.Join(cwd, "testdata/props.db")
+
+	for _, p := range []string{dataDir, dbPath, dbPath + "-wal", dbPath + "-shm"} {
+		if err := os.RemoveAll(p); err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+	}
+
+	if err := os.MkdirAll(dataDir, os.ModePerm); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	testsuite.TestFileSystem(t, Type, &Options{
+		Path: dbPath,
+		Backend: FileSystemOptions{
+			Type: local.Type,
+			Options: local.Options{
+				Dir: dataDir,
+			},
+		},
+	})
+}
@@ -0,0 +1,53 @@
+package props
+
+import (
+	"log"
+
+	"github.com/bornholm/calli/pkg/webdav/filesystem"
+	"github.com/go-viper/mapstructure/v2"
+	"github.com/pkg/errors"
+	"golang.org/x/net/webdav"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitemigration"
+)
+
+const Type filesystem.Type = "props"
+
+func init() {
+	filesystem.Register(Type, CreateFileSystemFromOptions)
+}
+
+type Options struct {
+	// Path is the path of the SQLite database holding the properties
+	Path    string            `mapstructure:"path"`
+	Backend FileSystemOptions `mapstructure:"backend"`
+}
+
+type FileSystemOptions struct {
+	Type    filesystem.Type `mapstructure:"type"`
+	Options any             `mapstructure:"options"`
+}
+
+func CreateFileSystemFromOptions(options any) (webdav.FileSystem, error) {
+	opts := Options{}
+
+	if err := mapstructure.Decode(options, &opts); err != nil {
+		return nil, errors.Wrapf(err, "could not parse '%s' filesystem options", Type)
+	}
+
+	backend, err := filesystem.New(opts.Backend.Type, opts.Backend.Options)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not create backend filesystem '%s'", opts.Backend.Type)
+	}
+
+	pool := sqlitemigration.NewPool(opts.Path, sqlitemigration.Schema{Migrations: Migrations}, sqlitemigration.Options{
+		Flags: sqlite.OpenCreate | sqlite.OpenReadWrite | sqlite.OpenWAL,
+		OnError: func(e error) {
+			log.Println(e)
+		},
+	})
+
+	fs := NewFileSystem(backend, pool)
+
+	return fs, nil
+}
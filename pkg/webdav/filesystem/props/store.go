@@ -0,0 +1,153 @@
+package props
+
+import (
+	"encoding/xml"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/webdav"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitex"
+)
+
+// Migrations create the table holding the dead properties, the functions
+// of this package expecting it to be named 'properties'
+var Migrations = []string{
+	`CREATE TABLE IF NOT EXISTS properties (
+		path TEXT NOT NULL,
+		namespace TEXT NOT NULL,
+		name TEXT NOT NULL,
+		lang TEXT NOT NULL,
+		inner_xml BLOB NOT NULL,
+		PRIMARY KEY (path, namespace, name)
+	);`,
+}
+
+// Load returns the dead properties of the given path
+func Load(conn *sqlite.Conn, name string) (map[xml.Name]webdav.Property, error) {
+	props := make(map[xml.Name]webdav.Property)
+
+	err := sqlitex.Execute(conn, `SELECT namespace, name, lang, inner_xml FROM properties WHERE path = ?`, &sqlitex.ExecOptions{
+		Args: []any{name},
+		ResultFunc: func(stmt *sqlite.Stmt) error {
+			prop := webdav.Property{
+				XMLName:  xml.Name{Space: stmt.ColumnText(0), Local: stmt.ColumnText(1)},
+				Lang:     stmt.ColumnText(2),
+				InnerXML: make([]byte, stmt.ColumnLen(3)),
+			}
+
+			stmt.ColumnBytes(3, prop.InnerXML)
+
+			props[prop.XMLName] = prop
+
+			return nil
+		},
+	})
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return props, nil
+}
+
+// Patch applies the given patches to the dead properties of the given
+// path, all of them or none
+func Patch(conn *sqlite.Conn, name string, patches []webdav.Proppatch) (propstats []webdav.Propstat, err error) {
+	defer sqlitex.Save(conn)(&err)
+
+	pstat := webdav.Propstat{Status: http.StatusOK}
+
+	for _, patch := range patches {
+		for _, p := range patch.Props {
+			pstat.Props = append(pstat.Props, webdav.Property{XMLName: p.XMLName})
+
+			if patch.Remove {
+				err := sqlitex.Execute(conn, `DELETE FROM properties WHERE path = ? AND namespace = ? AND name = ?`, &sqlitex.ExecOptions{
+					Args: []any{name, p.XMLName.Space, p.XMLName.Local},
+				})
+				if err != nil {
+					return nil, errors.WithStack(err)
+				}
+
+				continue
+			}
+
+			err := sqlitex.Execute(conn, `INSERT OR REPLACE INTO properties (path, namespace, name, lang, inner_xml) VALUES (?, ?, ?, ?, ?)`, &sqlitex.ExecOptions{
+				Args: []any{name, p.XMLName.Space, p.XMLName.Local, p.Lang, p.InnerXML},
+			})
+			if err != nil {
+				return nil, errors.WithStack(err)
+			}
+		}
+	}
+
+	return []webdav.Propstat{pstat}, nil
+}
+
+// Replace replaces the dead properties of the given path by the given
+// ones, keeping the ones of its descendants
+func Replace(conn *sqlite.Conn, name string, props map[xml.Name]webdav.Property) (err error) {
+	defer sqlitex.Save(conn)(&err)
+
+	err = sqlitex.Execute(conn, `DELETE FROM properties WHERE path = ?`, &sqlitex.ExecOptions{
+		Args: []any{name},
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, p := range props {
+		err := sqlitex.Execute(conn, `INSERT INTO properties (path, namespace, name, lang, inner_xml) VALUES (?, ?, ?, ?, ?)`, &sqlitex.ExecOptions{
+			Args: []any{name, p.XMLName.Space, p.XMLName.Local, p.Lang, p.InnerXML},
+		})
+		if err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// Move moves the dead properties of the given path and of its
+// descendants, replacing the ones of the destination
+func Move(conn *sqlite.Conn, oldName, newName string) (err error) {
+	defer sqlitex.Save(conn)(&err)
+
+	if err := Delete(conn, newName); err != nil {
+		return errors.WithStack(err)
+	}
+
+	err = sqlitex.Execute(conn, `
+		UPDATE properties SET path = ? || substr(path, length(?) + 1)
+		WHERE path = ? OR substr(path, 1, length(?)) = ?
+	`, &sqlitex.ExecOptions{
+		Args: []any{newName, oldName, oldName, descendants(oldName), descendants(oldName)},
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Delete deletes the dead properties of the given path
+// and of its descendants
+func Delete(conn *sqlite.Conn, name string) error {
+	err := sqlitex.Execute(conn, `
+		DELETE FROM properties
+		WHERE path = ? OR substr(path, 1, length(?)) = ?
+	`, &sqlitex.ExecOptions{
+		Args: []any{name, descendants(name), descendants(name)},
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// descendants returns the prefix of the paths below the given one
+func descendants(name string) string {
+	return strings.TrimSuffix(name, "/") + "/"
+}
@@ -16,10 +16,21 @@ type Factory func(options any) (webdav.FileSystem, error)
 
 var factories = make(map[Type]Factory, 0)
 
+// Decorator wraps a filesystem created by New
+type Decorator func(fsType Type, fs webdav.FileSystem) webdav.FileSystem
+
+var decorators = make([]Decorator, 0)
+
 func Register(fsType Type, factory Factory) {
 	factories[fsType] = factory
 }
 
+// Decorate registers decorators applied to every filesystem
+// subsequently created by New, including nested ones
+func Decorate(funcs ...Decorator) {
+	decorators = append(decorators, funcs...)
+}
+
 func Registered() []Type {
 	types := make([]Type, 0, len(factories))
 	for t := range factories {
@@ -39,5 +50,9 @@ func New(fsType Type, options any) (webdav.FileSystem, error) {
 		return nil, errors.WithStack(err)
 	}
 
+	for _, decorate := range decorators {
+		fs = decorate(fsType, fs)
+	}
+
 	return fs, nil
 }
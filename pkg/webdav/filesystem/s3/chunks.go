@@ -0,0 +1,129 @@
+package s3
+
+import (
+	"container/list"
+	"sync"
+)
+
+// chunkKey identifies a chunk of a version of an object
+type chunkKey struct {
+	Key   string
+	ETag  string
+	Index int64
+}
+
+// chunk is a chunk of an object, being fetched until done is closed
+type chunk struct {
+	key  chunkKey
+	done chan struct{}
+	data []byte
+	err  error
+}
+
+// chunkCache keeps the recently read chunks of the objects in the limit
+// of its size, the readers of a chunk being fetched waiting for it
+type chunkCache struct {
+	maxSize int64
+
+	mutex   sync.Mutex
+	size    int64
+	order   *list.List // Most recently used first
+	entries map[chunkKey]*list.Element
+}
+
+// Load returns the chunk with the given key, its caller being
+// responsible for fetching it and calling Complete if created
+func (c *chunkCache) Load(key chunkKey) (*chunk, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if elem, exists := c.entries[key]; exists {
+		c.order.MoveToFront(elem)
+		return elem.Value.(*chunk), false
+	}
+
+	ch := &chunk{
+		key:  key,
+		done: make(chan struct{}),
+	}
+
+	c.entries[key] = c.order.PushFront(ch)
+
+	return ch, true
+}
+
+// Complete records the result of the fetch of the chunk, the chunks
+// which could not be fetched being dropped
+func (c *chunkCache) Complete(ch *chunk, data []byte, err error) {
+	if err != nil {
+		data = nil
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	ch.data = data
+	ch.err = err
+	close(ch.done)
+
+	elem, exists := c.entries[ch.key]
+	if !exists || elem.Value != ch {
+		return
+	}
+
+	if err != nil {
+		c.remove(elem)
+		return
+	}
+
+	c.size += int64(len(data))
+	c.evict()
+}
+
+// Store adds a chunk fetched outside of the cache
+func (c *chunkCache) Store(key chunkKey, data []byte) {
+	ch, created := c.Load(key)
+	if !created {
+		return
+	}
+
+	c.Complete(ch, data, nil)
+}
+
+// evict removes the least recently used chunks exceeding the size
+func (c *chunkCache) evict() {
+	for c.size > c.maxSize {
+		elem := c.order.Back()
+		if elem == nil {
+			return
+		}
+
+		c.remove(elem)
+	}
+}
+
+func (c *chunkCache) remove(elem *list.Element) {
+	ch := elem.Value.(*chunk)
+
+	c.order.Remove(elem)
+	delete(c.entries, ch.key)
+
+	select {
+	case <-ch.done:
+		c.size -= int64(len(ch.data))
+	default:
+		// Being fetched, its size is not accounted yet
+	}
+}
+
+func newChunkCache(maxSize int64) *chunkCache {
+	if maxSize <= 0 {
+		maxSize = defaultReadCacheSize
+	}
+
+	return &chunkCache{
+		maxSize: maxSize,
+		order:   list.New(),
+		entries: make(map[chunkKey]*list.Element),
+	}
+}
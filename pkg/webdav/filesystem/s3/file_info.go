@@ -1,13 +1,16 @@
 package s3
 
 import (
+	"context"
 	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
 	"time"
 
+	"github.com/bornholm/calli/pkg/webdav/filesystem"
 	"github.com/minio/minio-go/v7"
+	"golang.org/x/net/webdav"
 )
 
 type FileInfo struct {
@@ -17,6 +20,9 @@ type FileInfo struct {
 	name    string
 	size    int64
 	sys     any
+
+	etag        string
+	contentType string
 }
 
 // IsDir implements fs.FileInfo.
@@ -49,7 +55,30 @@ func (f *FileInfo) Sys() any {
 	return f.sys
 }
 
-var _ os.FileInfo = &FileInfo{}
+// ETag implements webdav.ETager.
+func (f *FileInfo) ETag(ctx context.Context) (string, error) {
+	if f.isDir || f.etag == "" {
+		return "", webdav.ErrNotImplemented
+	}
+
+	return `"` + strings.Trim(f.etag, `"`) + `"`, nil
+}
+
+// ContentType implements webdav.ContentTyper.
+func (f *FileInfo) ContentType(ctx context.Context) (string, error) {
+	// The objects uploaded without content type are given this one
+	if f.contentType == "" || f.contentType == "application/octet-stream" {
+		return filesystem.ContentTypeByExtension(f.name)
+	}
+
+	return f.contentType, nil
+}
+
+var (
+	_ os.FileInfo         = &FileInfo{}
+	_ webdav.ETager       = &FileInfo{}
+	_ webdav.ContentTyper = &FileInfo{}
+)
 
 func FromObjectInfo(info minio.ObjectInfo) *FileInfo {
 	base := filepath.Base(info.Key)
@@ -72,5 +101,8 @@ func FromObjectInfo(info minio.ObjectInfo) *FileInfo {
 		name:    base,
 		size:    size,
 		sys:     nil,
+
+		etag:        info.ETag,
+		contentType: info.ContentType,
 	}
 }
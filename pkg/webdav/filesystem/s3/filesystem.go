@@ -3,14 +3,19 @@ package s3
 import (
 	"bytes"
 	"context"
+	"mime"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
 
 	"github.com/bornholm/calli/pkg/webdav/filesystem"
+	"github.com/bornholm/calli/pkg/webdav/filesystem/props"
 	"github.com/minio/minio-go/v7"
 	"github.com/pkg/errors"
 	"golang.org/x/net/webdav"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitemigration"
 )
 
 const (
@@ -20,10 +25,22 @@ const (
 
 // FileSystemConfig contains configuration options for the S3 filesystem
 type FileSystemConfig struct {
-	// This controls the maximum concurrent uploads
-	MaxFiles int
-	// This controls the maximum disk space used for temporary files
-	MaxTotalTempSize int64
+	// Initial size of the parts of the multipart uploads, 10MB by default,
+	// doubled every 1000 parts
+	PartSize int
+	// Number of parts uploaded concurrently for each file
+	UploadConcurrency int
+	// Size of the chunks fetched by the range requests, 4MB by default
+	ChunkSize int
+	// Number of chunks fetched ahead of the sequential reads, 2 by default,
+	// none if negative
+	ReadAhead int
+	// Size of the recently read chunks kept in memory, 64MB by default
+	ReadCacheSize int
+	// Database holding the dead properties which can not be kept in the
+	// metadata of the objects, those of the multipart ones and the ones
+	// larger than 2KB, refused if nil
+	Props *sqlitemigration.Pool
 }
 
 // FileSystem implements the webdav.FileSystem interface for S3 storage
@@ -31,6 +48,7 @@ type FileSystem struct {
 	client *minio.Client
 	bucket string
 	config FileSystemConfig
+	chunks *chunkCache
 }
 
 // Mkdir implements webdav.FileSystem.
@@ -47,7 +65,7 @@ func (f *FileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) e
 
 	keepDirFile := strings.Trim(filepath.Clean(prefix+keepDirFile), separator)
 
-	if _, err := f.client.PutObject(ctx, f.bucket, keepDirFile, bytes.NewBufferString(""), -1, minio.PutObjectOptions{}); err != nil {
+	if _, err := f.client.PutObject(ctx, f.bucket, keepDirFile, bytes.NewReader(nil), 0, minio.PutObjectOptions{}); err != nil {
 		return errors.WithStack(err)
 	}
 
@@ -62,22 +80,15 @@ func (f *FileSystem) OpenFile(ctx context.Context, name string, flag int, perm o
 		return nil, errors.WithStack(filesystem.ErrNotSupported)
 	}
 
-	// Configure options for file uploads
-	maxFiles := defaultMaxFiles
-	var maxTotalTempSize int64 = defaultMaxTotalSize
-
-	if f.config.MaxFiles > 0 {
-		maxFiles = f.config.MaxFiles
-	}
-
-	if f.config.MaxTotalTempSize > 0 {
-		maxTotalTempSize = f.config.MaxTotalTempSize
+	// PROPPATCH opens the resources with this flag only, which
+	// would otherwise replace the object with an empty one
+	if flag == os.O_RDWR {
+		flag = os.O_RDONLY
 	}
 
-	// Create file with temp file-based buffering
 	file, err := NewFile(ctx, f.client, f.bucket, name, flag, minio.PutObjectOptions{
-		ConcurrentStreamParts: true,
-	}, maxFiles, maxTotalTempSize)
+		ContentType: mime.TypeByExtension(path.Ext(name)),
+	}, f.config, f.chunks)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
 			return nil, os.ErrNotExist
@@ -112,33 +123,29 @@ func (f *FileSystem) RemoveAll(ctx context.Context, name string) error {
 	}
 
 	if stat.IsDir() {
-		fileInfos, err := readdir(ctx, f.client, f.bucket, name, -1)
+		objects, err := listTree(ctx, f.client, f.bucket, name)
 		if err != nil {
-			if errors.Is(err, os.ErrNotExist) {
-				return nil
-			}
-
 			return errors.WithStack(err)
 		}
 
-		for _, fi := range fileInfos {
-			path := filepath.Join(name, fi.Name())
-
-			if err := f.client.RemoveObject(ctx, f.bucket, path, minio.RemoveObjectOptions{
-				ForceDelete: true,
-			}); err != nil {
-				return errors.WithStack(err)
-			}
-		}
-	} else {
-		if err := f.client.RemoveObject(ctx, f.bucket, name, minio.RemoveObjectOptions{
-			ForceDelete: true,
-		}); err != nil {
+		if err := removeTree(ctx, f.client, f.bucket, name, objects); err != nil {
 			return errors.WithStack(err)
 		}
+
+		return f.doProps(ctx, func(conn *sqlite.Conn) error {
+			return errors.WithStack(props.Delete(conn, propsPath(name)))
+		})
 	}
 
-	return nil
+	if err := f.client.RemoveObject(ctx, f.bucket, name, minio.RemoveObjectOptions{
+		ForceDelete: true,
+	}); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return f.doProps(ctx, func(conn *sqlite.Conn) error {
+		return errors.WithStack(props.Delete(conn, propsPath(name)))
+	})
 }
 
 // Rename implements webdav.FileSystem.
@@ -149,17 +156,26 @@ func (f *FileSystem) Rename(ctx context.Context, oldName string, newName string)
 	oldName = clean(oldName)
 	newName = clean(newName)
 
-	dest := minio.CopyDestOptions{
-		Bucket: f.bucket,
-		Object: newName,
+	stat, err := f.Stat(ctx, oldName)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return os.ErrNotExist
+		}
+
+		return errors.WithStack(err)
 	}
 
-	src := minio.CopySrcOptions{
-		Bucket: f.bucket,
-		Object: oldName,
+	if stat.IsDir() {
+		if err := f.renameDir(ctx, oldName, newName); err != nil {
+			return errors.WithStack(err)
+		}
+
+		return f.doProps(ctx, func(conn *sqlite.Conn) error {
+			return errors.WithStack(props.Move(conn, propsPath(oldName), propsPath(newName)))
+		})
 	}
 
-	if _, err := f.client.CopyObject(ctx, dest, src); err != nil {
+	if err := copyObject(ctx, f.client, f.bucket, oldName, newName, stat.Size()); err != nil {
 		return errors.WithStack(err)
 	}
 
@@ -169,6 +185,35 @@ func (f *FileSystem) Rename(ctx context.Context, oldName string, newName string)
 		return errors.WithStack(err)
 	}
 
+	return f.doProps(ctx, func(conn *sqlite.Conn) error {
+		return errors.WithStack(props.Move(conn, propsPath(oldName), propsPath(newName)))
+	})
+}
+
+// renameDir copies all the objects of the directory under the new
+// name before removing them
+func (f *FileSystem) renameDir(ctx context.Context, oldName string, newName string) error {
+	if oldName == separator {
+		return errors.WithStack(os.ErrPermission)
+	}
+
+	if strings.HasPrefix(treePrefix(newName), treePrefix(oldName)) {
+		return errors.Errorf("could not move '%s' into itself", oldName)
+	}
+
+	objects, err := listTree(ctx, f.client, f.bucket, oldName)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := copyTree(ctx, f.client, f.bucket, oldName, newName, objects); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := removeTree(ctx, f.client, f.bucket, oldName, objects); err != nil {
+		return errors.WithStack(err)
+	}
+
 	return nil
 }
 
@@ -191,13 +236,30 @@ func (f *FileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error)
 	return fileInfo, nil
 }
 
+// doProps runs the given function with a connection to the database of
+// the dead properties, if any
+func (f *FileSystem) doProps(ctx context.Context, fn func(conn *sqlite.Conn) error) error {
+	if f.config.Props == nil {
+		return nil
+	}
+
+	conn, err := f.config.Props.Take(ctx)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer f.config.Props.Put(conn)
+
+	if err := fn(conn); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
 // NewFileSystem creates a new S3 filesystem with the given client and bucket
 func NewFileSystem(client *minio.Client, bucket string) *FileSystem {
-	return &FileSystem{
-		client: client,
-		bucket: bucket,
-		config: FileSystemConfig{},
-	}
+	return NewFileSystemWithConfig(client, bucket, FileSystemConfig{})
 }
 
 // NewFileSystemWithConfig creates a new S3 filesystem with custom configuration
@@ -206,6 +268,7 @@ func NewFileSystemWithConfig(client *minio.Client, bucket string, config FileSys
 		client: client,
 		bucket: bucket,
 		config: config,
+		chunks: newChunkCache(int64(config.ReadCacheSize)),
 	}
 }
 
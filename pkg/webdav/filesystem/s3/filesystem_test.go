@@ -1,65 +1,762 @@
 package s3
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/bornholm/calli/pkg/webdav/filesystem/encrypted"
+	"github.com/bornholm/calli/pkg/webdav/filesystem/props"
 	"github.com/bornholm/calli/pkg/webdav/filesystem/testsuite"
+	"github.com/johannesboyne/gofakes3"
+	"github.com/johannesboyne/gofakes3/backend/s3mem"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 	"github.com/pkg/errors"
-	"github.com/testcontainers/testcontainers-go"
-	testminio "github.com/testcontainers/testcontainers-go/modules/minio"
+	"golang.org/x/net/webdav"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitemigration"
 )
 
+const (
+	fakeUsername = "fakeusername"
+	fakePassword = "fakepassword"
+	bucketName   = "webdav"
+)
+
+// newFakeS3 starts an in-process S3 server with an empty bucket
+func newFakeS3(t *testing.T, middlewares ...func(http.Handler) http.Handler) (string, *minio.Client) {
+	handler := adaptRequests(gofakes3.New(s3mem.New()).Server())
+	for _, middleware := range middlewares {
+		handler = middleware(handler)
+	}
+
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	u, err := url.Parse(server.URL)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	client, err := minio.New(u.Host, &minio.Options{
+		Creds:        credentials.NewStaticV4(fakeUsername, fakePassword, ""),
+		Secure:       false,
+		BucketLookup: minio.BucketLookupPath,
+	})
+	if err != nil {
+		t.Fatalf("failed to create minio client: %+v", errors.WithStack(err))
+	}
+
+	if err := client.MakeBucket(context.Background(), bucketName, minio.MakeBucketOptions{}); err != nil {
+		t.Fatalf("failed to create bucket: %+v", errors.WithStack(err))
+	}
+
+	return u.Host, client
+}
+
+// adaptRequests adapts the requests to the fake, which requires their
+// length and only decodes the streaming signature of the objects
+func adaptRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		streaming := strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-")
+
+		if r.ContentLength >= 0 && !streaming {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		var body bytes.Buffer
+
+		if streaming {
+			if err := decodeChunks(&body, r.Body); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			r.Header.Del("X-Amz-Content-Sha256")
+		} else if _, err := io.Copy(&body, r.Body); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		r.Body = io.NopCloser(&body)
+		r.ContentLength = int64(body.Len())
+		r.TransferEncoding = nil
+		r.Header.Set("Content-Length", strconv.Itoa(body.Len()))
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// multipartETags reports the objects with the given suffix as multipart
+// ones, the fake computing the ETags of all the objects as single part ones
+func multipartETags(suffix string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !strings.HasSuffix(r.URL.Path, suffix) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			writer := &multipartETagWriter{ResponseWriter: w}
+			next.ServeHTTP(writer, r)
+
+			// The headers of the responses without body
+			writer.markETag()
+		})
+	}
+}
+
+type multipartETagWriter struct {
+	http.ResponseWriter
+	marked bool
+}
+
+func (w *multipartETagWriter) markETag() {
+	if w.marked {
+		return
+	}
+
+	w.marked = true
+
+	if etag := w.Header().Get("ETag"); etag != "" {
+		w.Header().Set("ETag", strings.TrimSuffix(etag, `"`)+`-2"`)
+	}
+}
+
+func (w *multipartETagWriter) WriteHeader(code int) {
+	w.markETag()
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *multipartETagWriter) Write(data []byte) (int, error) {
+	w.markETag()
+	return w.ResponseWriter.Write(data)
+}
+
+// copyParts emulates the copies of the parts, which the fake does not
+// support, with the uploads of the copied ranges of their source
+func copyParts(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		source := r.Header.Get("X-Amz-Copy-Source")
+		if r.Method != http.MethodPut || source == "" || !r.URL.Query().Has("uploadId") {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		sourcePath, err := url.PathUnescape(source)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		get := httptest.NewRequestWithContext(r.Context(), http.MethodGet, "/"+strings.TrimPrefix(sourcePath, "/"), nil)
+		get.Header.Set("Range", r.Header.Get("X-Amz-Copy-Source-Range"))
+
+		rangeRes := httptest.NewRecorder()
+		next.ServeHTTP(rangeRes, get)
+
+		if rangeRes.Code != http.StatusOK && rangeRes.Code != http.StatusPartialContent {
+			http.Error(w, rangeRes.Body.String(), rangeRes.Code)
+			return
+		}
+
+		data := rangeRes.Body.Bytes()
+
+		put := r.Clone(r.Context())
+		put.Body = io.NopCloser(bytes.NewReader(data))
+		put.ContentLength = int64(len(data))
+		put.Header.Set("Content-Length", strconv.Itoa(len(data)))
+
+		for name := range put.Header {
+			if strings.HasPrefix(name, "X-Amz-Copy-Source") {
+				put.Header.Del(name)
+			}
+		}
+
+		partRes := httptest.NewRecorder()
+		next.ServeHTTP(partRes, put)
+
+		if partRes.Code != http.StatusOK {
+			http.Error(w, partRes.Body.String(), partRes.Code)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/xml")
+
+		result := struct {
+			XMLName      xml.Name `xml:"CopyPartResult"`
+			ETag         string   `xml:"ETag"`
+			LastModified string   `xml:"LastModified"`
+		}{
+			ETag:         partRes.Header().Get("ETag"),
+			LastModified: time.Now().UTC().Format("2006-01-02T15:04:05.000Z"),
+		}
+
+		if err := xml.NewEncoder(w).Encode(result); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// decodeChunks decodes a body sent with the streaming signature
+func decodeChunks(w io.Writer, r io.Reader) error {
+	reader := bufio.NewReader(r)
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		hexSize, _, _ := strings.Cut(strings.TrimSpace(line), ";")
+
+		size, err := strconv.ParseInt(hexSize, 16, 64)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		if size == 0 {
+			return nil
+		}
+
+		if _, err := io.CopyN(w, reader, size); err != nil {
+			return errors.WithStack(err)
+		}
+
+		// Trailing CRLF of the chunk
+		if _, err := reader.Discard(2); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+}
+
 func TestFileSystem(t *testing.T) {
+	endpoint, _ := newFakeS3(t)
+
+	testsuite.TestFileSystem(t, Type, &Options{
+		Endpoint:        endpoint,
+		User:            fakeUsername,
+		Secret:          fakePassword,
+		Bucket:          bucketName,
+		BucketLookup:    "path",
+		StaleUploadsAge: -1,
+	})
+}
+
+func TestEncryptedFileSystem(t *testing.T) {
+	endpoint, _ := newFakeS3(t)
+
+	key := make([]byte, encrypted.KeySize)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	testsuite.TestFileSystem(t, encrypted.Type, &encrypted.Options{
+		Key:          base64.StdEncoding.EncodeToString(key),
+		EncryptNames: true,
+		Backend: encrypted.FileSystemOptions{
+			Type: Type,
+			Options: &Options{
+				Endpoint:        endpoint,
+				User:            fakeUsername,
+				Secret:          fakePassword,
+				Bucket:          bucketName,
+				BucketLookup:    "path",
+				StaleUploadsAge: -1,
+			},
+		},
+	})
+}
+
+func TestCopyInParts(t *testing.T) {
+	ctx := context.Background()
+	endpoint, client := newFakeS3(t, copyParts)
+
+	previous := maxCopySize
+	maxCopySize = minPartSize
+	t.Cleanup(func() { maxCopySize = previous })
+
+	testsuite.TestFileSystem(t, Type, &Options{
+		Endpoint:        endpoint,
+		User:            fakeUsername,
+		Secret:          fakePassword,
+		Bucket:          bucketName,
+		BucketLookup:    "path",
+		StaleUploadsAge: -1,
+	})
+
+	data := make([]byte, 2*minPartSize+1024)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if _, err := client.PutObject(ctx, bucketName, "video.bin", bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{
+		ContentType:        "video/mp4",
+		ContentDisposition: "attachment",
+		UserMetadata:       map[string]string{"Origin": "camera"},
+	}); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	fs := NewFileSystem(client, bucketName)
+
+	if err := fs.Rename(ctx, "/video.bin", "/renamed.bin"); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	info, err := client.StatObject(ctx, bucketName, "renamed.bin", minio.StatObjectOptions{})
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := int64(len(data)), info.Size; e != g {
+		t.Errorf("size: expected '%v', got '%v'", e, g)
+	}
+
+	if e, g := "video/mp4", info.ContentType; e != g {
+		t.Errorf("content type: expected '%v', got '%v'", e, g)
+	}
+
+	if e, g := "attachment", info.Metadata.Get("Content-Disposition"); e != g {
+		t.Errorf("content disposition: expected '%v', got '%v'", e, g)
+	}
+
+	if e, g := "camera", info.UserMetadata["Origin"]; e != g {
+		t.Errorf("user metadata: expected '%v', got '%v'", e, g)
+	}
+}
+
+func TestMultipartUpload(t *testing.T) {
 	ctx := context.Background()
+	_, client := newFakeS3(t)
+
+	fs := NewFileSystemWithConfig(client, bucketName, FileSystemConfig{
+		PartSize:          minPartSize,
+		UploadConcurrency: 2,
+	})
+
+	data := make([]byte, 2*minPartSize+1024)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
 
-	const (
-		minioUsername = "miniousername"
-		minioPassword = "miniopassword"
-	)
-
-	minioContainer, err := testminio.Run(
-		ctx, "minio/minio:RELEASE.2024-01-16T16-07-38Z",
-		testminio.WithUsername(minioUsername),
-		testminio.WithPassword(minioPassword),
-	)
-	defer func() {
-		if err := testcontainers.TerminateContainer(minioContainer); err != nil {
-			t.Fatalf("failed to terminate container: %+v", errors.WithStack(err))
-		}
-	}()
+	file, err := fs.OpenFile(ctx, "/large.bin", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
 	if err != nil {
-		t.Fatalf("failed to start container: %+v", errors.WithStack(err))
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	// Written in chunks not aligned with the parts
+	for chunk := range slices.Chunk(data, 1000*1000) {
+		if _, err := file.Write(chunk); err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+	}
+
+	if err := file.Close(); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	obj, err := client.GetObject(ctx, bucketName, "large.bin", minio.GetObjectOptions{})
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	defer obj.Close()
+
+	uploaded, err := io.ReadAll(obj)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if !bytes.Equal(data, uploaded) {
+		t.Errorf("uploaded data: expected %d bytes, got %d different bytes", len(data), len(uploaded))
+	}
+
+	// No temporary objects are left in the bucket
+	for obj := range client.ListObjects(ctx, bucketName, minio.ListObjectsOptions{Recursive: true}) {
+		if obj.Err != nil {
+			t.Fatalf("%+v", errors.WithStack(obj.Err))
+		}
+
+		if obj.Key != "large.bin" {
+			t.Errorf("unexpected object '%s'", obj.Key)
+		}
+	}
+
+	for upload := range client.ListIncompleteUploads(ctx, bucketName, "", true) {
+		t.Errorf("unexpected incomplete upload of '%s'", upload.Key)
+	}
+}
+
+func TestSweepUploads(t *testing.T) {
+	ctx := context.Background()
+	_, client := newFakeS3(t)
+
+	core := minio.Core{Client: client}
+
+	if _, err := core.NewMultipartUpload(ctx, bucketName, "interrupted.bin", minio.PutObjectOptions{}); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
 	}
 
-	endpoint, err := minioContainer.ConnectionString(ctx)
+	if _, err := client.PutObject(ctx, bucketName, legacyPartPrefix+"interrupted.bin/0", bytes.NewReader([]byte("part")), 4, minio.PutObjectOptions{}); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	// Uploads more recent than the given time are kept
+	if err := SweepUploads(ctx, client, bucketName, time.Now().Add(-time.Hour)); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := 1, countIncompleteUploads(t, client); e != g {
+		t.Errorf("incomplete uploads: expected '%v', got '%v'", e, g)
+	}
+
+	if err := SweepUploads(ctx, client, bucketName, time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := 0, countIncompleteUploads(t, client); e != g {
+		t.Errorf("incomplete uploads: expected '%v', got '%v'", e, g)
+	}
+
+	for obj := range client.ListObjects(ctx, bucketName, minio.ListObjectsOptions{Prefix: legacyPartPrefix, Recursive: true}) {
+		t.Errorf("unexpected part object '%s'", obj.Key)
+	}
+}
+
+func TestRangedReads(t *testing.T) {
+	ctx := context.Background()
+	endpoint, client := newFakeS3(t)
+
+	const chunkSize = 1024
+
+	data := make([]byte, 3*chunkSize+512)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if _, err := client.PutObject(ctx, bucketName, "video.bin", bytes.NewReader(data), int64(len(data)), minio.PutObjectOptions{}); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	transport := &countingTransport{RoundTripper: http.DefaultTransport}
+
+	countedClient, err := minio.New(endpoint, &minio.Options{
+		Creds:        credentials.NewStaticV4(fakeUsername, fakePassword, ""),
+		Secure:       false,
+		BucketLookup: minio.BucketLookupPath,
+		// Spares the lookup of the bucket location
+		Region:    "us-east-1",
+		Transport: transport,
+	})
 	if err != nil {
-		t.Fatalf("could not retrieve connection string: %+v", errors.WithStack(err))
+		t.Fatalf("%+v", errors.WithStack(err))
 	}
 
-	client, err := minio.New(endpoint, &minio.Options{
-		Creds:  credentials.NewStaticV4(minioUsername, minioPassword, ""),
-		Secure: false,
+	fs := NewFileSystemWithConfig(countedClient, bucketName, FileSystemConfig{
+		ChunkSize: chunkSize,
+		ReadAhead: -1,
 	})
+
+	file, err := fs.OpenFile(ctx, "/video.bin", os.O_RDONLY, 0)
 	if err != nil {
-		t.Fatalf("failed to create minio client: %+v", errors.WithStack(err))
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	defer file.Close()
+
+	readAt := func(offset int64, size int) {
+		t.Helper()
+
+		if _, err := file.Seek(offset, io.SeekStart); err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		buff := make([]byte, size)
+		if _, err := io.ReadFull(file, buff); err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		if !bytes.Equal(data[offset:offset+int64(size)], buff) {
+			t.Errorf("data at offset %d differs", offset)
+		}
 	}
 
-	const (
-		bucketName = "webdav"
-	)
+	// Spans the two last chunks
+	readAt(2*chunkSize+500, 1000)
 
-	if err := client.MakeBucket(ctx, bucketName, minio.MakeBucketOptions{}); err != nil {
-		t.Fatalf("failed to create minio bucket: %+v", errors.WithStack(err))
+	if e, g := int64(2), transport.requests.Load(); e != g {
+		t.Errorf("requests: expected '%v', got '%v'", e, g)
 	}
 
-	testsuite.TestFileSystem(t, Type, &Options{
-		Endpoint:     endpoint,
-		User:         minioUsername,
-		Secret:       minioPassword,
-		Bucket:       bucketName,
-		BucketLookup: "path",
+	info, err := file.Stat()
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := int64(len(data)), info.Size(); e != g {
+		t.Errorf("size: expected '%v', got '%v'", e, g)
+	}
+
+	// The cached chunks and the fetched object info are reused
+	readAt(2*chunkSize, 100)
+	readAt(3*chunkSize+500, 12)
+
+	if e, g := int64(2), transport.requests.Load(); e != g {
+		t.Errorf("requests: expected '%v', got '%v'", e, g)
+	}
+
+	readAt(0, len(data))
+
+	if e, g := int64(4), transport.requests.Load(); e != g {
+		t.Errorf("requests: expected '%v', got '%v'", e, g)
+	}
+
+	end, err := file.Seek(0, io.SeekEnd)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := int64(len(data)), end; e != g {
+		t.Errorf("end: expected '%v', got '%v'", e, g)
+	}
+
+	if n, err := file.Read(make([]byte, 1)); n != 0 || !errors.Is(err, io.EOF) {
+		t.Errorf("read at end: expected '0, %v', got '%d, %v'", io.EOF, n, err)
+	}
+}
+
+type countingTransport struct {
+	http.RoundTripper
+	requests atomic.Int64
+}
+
+func (t *countingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	t.requests.Add(1)
+	return t.RoundTripper.RoundTrip(r)
+}
+
+func countIncompleteUploads(t *testing.T, client *minio.Client) int {
+	count := 0
+	for upload := range client.ListIncompleteUploads(context.Background(), bucketName, "", true) {
+		if upload.Err != nil {
+			t.Fatalf("%+v", errors.WithStack(upload.Err))
+		}
+
+		count++
+	}
+
+	return count
+}
+
+func TestPropsFallback(t *testing.T) {
+	ctx := context.Background()
+	_, client := newFakeS3(t, multipartETags("/large.bin"))
+
+	pool := sqlitemigration.NewPool(filepath.Join(t.TempDir(), "props.db"), sqlitemigration.Schema{Migrations: props.Migrations}, sqlitemigration.Options{
+		Flags: sqlite.OpenCreate | sqlite.OpenReadWrite | sqlite.OpenWAL,
 	})
+	t.Cleanup(func() { pool.Close() })
+
+	config := FileSystemConfig{
+		PartSize: minPartSize,
+	}
+
+	noPropsFs := NewFileSystemWithConfig(client, bucketName, config)
+
+	config.Props = pool
+	fs := NewFileSystemWithConfig(client, bucketName, config)
+
+	write := func(name string, size int) {
+		t.Helper()
+
+		file, err := fs.OpenFile(ctx, name, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+		if err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		if _, err := file.Write(make([]byte, size)); err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		if err := file.Close(); err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+	}
+
+	patch := func(fs *FileSystem, name string, value string, remove bool) int {
+		t.Helper()
+
+		file, err := fs.OpenFile(ctx, name, os.O_RDWR, 0)
+		if err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		defer file.Close()
+
+		propstats, err := file.(webdav.DeadPropsHolder).Patch([]webdav.Proppatch{{
+			Remove: remove,
+			Props:  []webdav.Property{{XMLName: xml.Name{Space: "urn:calli:test", Local: "color"}, InnerXML: []byte(value)}},
+		}})
+		if err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		return propstats[0].Status
+	}
+
+	color := func(name string) string {
+		t.Helper()
+
+		file, err := fs.OpenFile(ctx, name, os.O_RDONLY, 0)
+		if err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		defer file.Close()
+
+		deadProps, err := file.(webdav.DeadPropsHolder).DeadProps()
+		if err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		return string(deadProps[xml.Name{Space: "urn:calli:test", Local: "color"}].InnerXML)
+	}
+
+	statObject := func(key string) minio.ObjectInfo {
+		t.Helper()
+
+		info, err := client.StatObject(ctx, bucketName, key, minio.StatObjectOptions{})
+		if err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		return info
+	}
+
+	// The multipart objects are left untouched
+	write("/large.bin", 10)
+
+	before := statObject("large.bin")
+
+	if e, g := http.StatusInsufficientStorage, patch(noPropsFs, "/large.bin", "blue", false); e != g {
+		t.Errorf("status without database: expected '%v', got '%v'", e, g)
+	}
+
+	if e, g := http.StatusOK, patch(fs, "/large.bin", "blue", false); e != g {
+		t.Errorf("status: expected '%v', got '%v'", e, g)
+	}
+
+	after := statObject("large.bin")
+
+	if e, g := before.ETag, after.ETag; e != g {
+		t.Errorf("etag: expected '%v', got '%v'", e, g)
+	}
+
+	if e, g := before.LastModified, after.LastModified; !e.Equal(g) {
+		t.Errorf("last modified: expected '%v', got '%v'", e, g)
+	}
+
+	if e, g := "blue", color("/large.bin"); e != g {
+		t.Errorf("color: expected '%v', got '%v'", e, g)
+	}
+
+	if err := fs.Rename(ctx, "/large.bin", "/moved.bin"); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := "blue", color("/moved.bin"); e != g {
+		t.Errorf("color after rename: expected '%v', got '%v'", e, g)
+	}
+
+	// The properties larger than the metadata are moved to the database
+	write("/small.txt", 10)
+
+	if e, g := http.StatusOK, patch(fs, "/small.txt", "red", false); e != g {
+		t.Errorf("status: expected '%v', got '%v'", e, g)
+	}
+
+	if statObject("small.txt").UserMetadata[propsMetadata] == "" {
+		t.Errorf("expected the properties in the metadata")
+	}
+
+	large := strings.Repeat("x", 2*maxPropsSize)
+
+	if e, g := http.StatusOK, patch(fs, "/small.txt", large, false); e != g {
+		t.Errorf("status: expected '%v', got '%v'", e, g)
+	}
+
+	if value := statObject("small.txt").UserMetadata[propsMetadata]; value != "" {
+		t.Errorf("expected no properties in the metadata, got '%s'", value)
+	}
+
+	if e, g := large, color("/small.txt"); e != g {
+		t.Errorf("color: expected %d bytes, got '%v'", len(e), g)
+	}
+
+	if e, g := http.StatusOK, patch(fs, "/small.txt", "", true); e != g {
+		t.Errorf("status: expected '%v', got '%v'", e, g)
+	}
+
+	if e, g := "", color("/small.txt"); e != g {
+		t.Errorf("color after removal: expected '%v', got '%v'", e, g)
+	}
+
+	if err := fs.RemoveAll(ctx, "/moved.bin"); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	write("/moved.bin", 10)
+
+	if e, g := "", color("/moved.bin"); e != g {
+		t.Errorf("color after removal: expected '%v', got '%v'", e, g)
+	}
+}
+
+func TestPartSizeGrowth(t *testing.T) {
+	type testCase struct {
+		Uploaded int
+		Expected int
+	}
+
+	testCases := []testCase{
+		{Uploaded: 0, Expected: defaultPartSize},
+		{Uploaded: partsPerGrowth - 1, Expected: defaultPartSize},
+		{Uploaded: partsPerGrowth, Expected: 2 * defaultPartSize},
+		{Uploaded: 3*partsPerGrowth + 1, Expected: 8 * defaultPartSize},
+		{Uploaded: maxParts - 1, Expected: maxPartSize},
+	}
+
+	for _, tc := range testCases {
+		if e, g := tc.Expected, partSizeAt(defaultPartSize, tc.Uploaded); e != g {
+			t.Errorf("size after %d parts: expected '%v', got '%v'", tc.Uploaded, e, g)
+		}
+	}
+
+	// The parts of an upload hold the largest objects allowed by S3
+	total := int64(0)
+	for uploaded := range maxParts {
+		total += int64(partSizeAt(defaultPartSize, uploaded))
+	}
+
+	if maxObjectSize := int64(5) << 40; total < maxObjectSize {
+		t.Errorf("total size: expected at least '%v', got '%v'", maxObjectSize, total)
+	}
 }
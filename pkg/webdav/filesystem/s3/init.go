@@ -1,14 +1,21 @@
 package s3
 
 import (
+	"context"
+	"log/slog"
 	"os"
+	"time"
 
+	"github.com/bornholm/calli/pkg/log"
 	"github.com/bornholm/calli/pkg/webdav/filesystem"
+	"github.com/bornholm/calli/pkg/webdav/filesystem/props"
 	"github.com/go-viper/mapstructure/v2"
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
 	"github.com/pkg/errors"
 	"golang.org/x/net/webdav"
+	"zombiezen.com/go/sqlite"
+	"zombiezen.com/go/sqlite/sqlitemigration"
 )
 
 const Type filesystem.Type = "s3"
@@ -28,15 +35,46 @@ type Options struct {
 	BucketLookup string `mapstructure:"bucketLookup" yaml:"bucketLookup"`
 	// Enable/disable HTTP tracing in the console
 	Trace bool `mapstructure:"trace" yaml:"trace"`
+	// Initial size in bytes of the parts of the multipart uploads, between 5MB and 5GB (default 10MB),
+	// doubled every 1000 parts so that the 10000 parts allowed by S3 hold 1023000 times this size
+	PartSize int `mapstructure:"partSize" yaml:"partSize"`
+	// Number of parts uploaded concurrently for each file (default 4)
+	UploadConcurrency int `mapstructure:"uploadConcurrency" yaml:"uploadConcurrency"`
+	// Size in bytes of the chunks fetched by the range requests (default 4MB)
+	ChunkSize int `mapstructure:"chunkSize" yaml:"chunkSize"`
+	// Number of chunks fetched ahead of the sequential reads (default 2), negative to disable
+	ReadAhead int `mapstructure:"readAhead" yaml:"readAhead"`
+	// Size in bytes of the recently read chunks kept in memory (default 64MB)
+	ReadCacheSize int `mapstructure:"readCacheSize" yaml:"readCacheSize"`
+	// Age of the unfinished multipart uploads aborted at startup (default 24h), negative to keep them
+	StaleUploadsAge time.Duration `mapstructure:"staleUploadsAge" yaml:"staleUploadsAge"`
+	// Path of the SQLite database holding the dead properties which can not be kept in the metadata
+	// of the objects, those of the multipart ones and the ones larger than 2KB, refused if empty
+	PropsPath string `mapstructure:"propsPath" yaml:"propsPath"`
 }
 
+const defaultStaleUploadsAge = 24 * time.Hour
+
 func CreateFileSystemFromOptions(options any) (webdav.FileSystem, error) {
 	opts := Options{}
 
-	if err := mapstructure.Decode(options, &opts); err != nil {
+	decoder, err := mapstructure.NewDecoder(&mapstructure.DecoderConfig{
+		Metadata:   nil,
+		DecodeHook: mapstructure.ComposeDecodeHookFunc(mapstructure.StringToTimeDurationHookFunc()),
+		Result:     &opts,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not create '%s' filesystem options decoder", Type)
+	}
+
+	if err := decoder.Decode(options); err != nil {
 		return nil, errors.Wrapf(err, "could not parse '%s' filesystem options", Type)
 	}
 
+	if opts.PartSize != 0 && (opts.PartSize < minPartSize || opts.PartSize > maxPartSize) {
+		return nil, errors.Errorf("part size must be between %d and %d bytes, got %d", minPartSize, maxPartSize, opts.PartSize)
+	}
+
 	creds := credentials.NewStaticV4(opts.User, opts.Secret, opts.Token)
 
 	minioOpts := &minio.Options{
@@ -63,7 +101,39 @@ func CreateFileSystemFromOptions(options any) (webdav.FileSystem, error) {
 		client.TraceOn(os.Stdout)
 	}
 
-	fs := NewFileSystem(client, opts.Bucket)
+	staleUploadsAge := opts.StaleUploadsAge
+	if staleUploadsAge == 0 {
+		staleUploadsAge = defaultStaleUploadsAge
+	}
+
+	if staleUploadsAge > 0 {
+		go func() {
+			ctx := context.Background()
+
+			if err := SweepUploads(ctx, client, opts.Bucket, time.Now().Add(-staleUploadsAge)); err != nil {
+				slog.ErrorContext(ctx, "could not sweep the stale uploads", log.Error(errors.WithStack(err)), slog.String("bucket", opts.Bucket))
+			}
+		}()
+	}
+
+	var pool *sqlitemigration.Pool
+	if opts.PropsPath != "" {
+		pool = sqlitemigration.NewPool(opts.PropsPath, sqlitemigration.Schema{Migrations: props.Migrations}, sqlitemigration.Options{
+			Flags: sqlite.OpenCreate | sqlite.OpenReadWrite | sqlite.OpenWAL,
+			OnError: func(e error) {
+				slog.Error("could not open the properties database", log.Error(errors.WithStack(e)), slog.String("path", opts.PropsPath))
+			},
+		})
+	}
+
+	fs := NewFileSystemWithConfig(client, opts.Bucket, FileSystemConfig{
+		PartSize:          opts.PartSize,
+		UploadConcurrency: opts.UploadConcurrency,
+		ChunkSize:         opts.ChunkSize,
+		ReadAhead:         opts.ReadAhead,
+		ReadCacheSize:     opts.ReadCacheSize,
+		Props:             pool,
+	})
 
 	return fs, nil
 }
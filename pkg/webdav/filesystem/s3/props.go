@@ -0,0 +1,298 @@
+package s3
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"encoding/xml"
+	"maps"
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bornholm/calli/pkg/webdav/filesystem/props"
+	"github.com/minio/minio-go/v7"
+	"github.com/pkg/errors"
+	"golang.org/x/net/webdav"
+	"zombiezen.com/go/sqlite"
+)
+
+const (
+	// propsMetadata is the user metadata holding the dead properties
+	propsMetadata = "Dav-Props"
+	// maxPropsSize is the maximum size of the encoded dead properties,
+	// the user metadata of an object being limited to 2KB
+	maxPropsSize = 2000
+)
+
+type deadProp struct {
+	Space    string `json:"s"`
+	Local    string `json:"l"`
+	Lang     string `json:"g,omitempty"`
+	InnerXML []byte `json:"x"`
+}
+
+// DeadProps implements webdav.DeadPropsHolder.
+func (f *File) DeadProps() (map[xml.Name]webdav.Property, error) {
+	_, info, exists, err := f.propsObject()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	deadProps, err := f.loadProps(info, exists)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return deadProps, nil
+}
+
+// Patch implements webdav.DeadPropsHolder.
+func (f *File) Patch(patches []webdav.Proppatch) ([]webdav.Propstat, error) {
+	key, info, exists, err := f.propsObject()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	deadProps, err := f.loadProps(info, exists)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	pstat := webdav.Propstat{Status: http.StatusOK}
+
+	for _, patch := range patches {
+		for _, p := range patch.Props {
+			pstat.Props = append(pstat.Props, webdav.Property{XMLName: p.XMLName})
+
+			if patch.Remove {
+				delete(deadProps, p.XMLName)
+				continue
+			}
+
+			deadProps[p.XMLName] = p
+		}
+	}
+
+	value, err := encodeProps(deadProps)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	inMetadata := (!exists || holdsProps(info)) && len(value) <= maxPropsSize
+
+	if !inMetadata {
+		if f.props == nil {
+			pstat.Status = http.StatusInsufficientStorage
+			return []webdav.Propstat{pstat}, nil
+		}
+
+		err := f.doProps(func(conn *sqlite.Conn) error {
+			return errors.WithStack(props.Replace(conn, propsPath(f.key), deadProps))
+		})
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		// The properties previously held by the metadata are dropped
+		value = ""
+	}
+
+	if exists && holdsProps(info) && value != info.UserMetadata[propsMetadata] {
+		if err := f.replaceMetadata(key, info, value); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	if !exists && inMetadata {
+		// The marker of an implicit directory
+		if _, err := f.client.PutObject(f.ctx, f.bucket, key, strings.NewReader(""), 0, minio.PutObjectOptions{
+			UserMetadata: map[string]string{propsMetadata: value},
+		}); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	if inMetadata && f.props != nil {
+		err := f.doProps(func(conn *sqlite.Conn) error {
+			return errors.WithStack(props.Replace(conn, propsPath(f.key), nil))
+		})
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	return []webdav.Propstat{pstat}, nil
+}
+
+// loadProps returns the dead properties held by the metadata of the
+// given object and by the database
+func (f *File) loadProps(info minio.ObjectInfo, exists bool) (map[xml.Name]webdav.Property, error) {
+	deadProps := map[xml.Name]webdav.Property{}
+
+	if f.props != nil {
+		err := f.doProps(func(conn *sqlite.Conn) (err error) {
+			deadProps, err = props.Load(conn, propsPath(f.key))
+			return errors.WithStack(err)
+		})
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	if !exists || !holdsProps(info) {
+		return deadProps, nil
+	}
+
+	metadataProps, err := decodeProps(info.UserMetadata[propsMetadata])
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	maps.Copy(deadProps, metadataProps)
+
+	return deadProps, nil
+}
+
+// replaceMetadata copies the given object onto itself to replace its
+// dead properties, keeping its other metadata and headers
+func (f *File) replaceMetadata(key string, info minio.ObjectInfo, value string) error {
+	metadata := objectMetadata(info)
+
+	// Emptied rather than removed, some servers keeping the metadata
+	// missing from the copies
+	metadata[propsMetadata] = value
+
+	dst := minio.CopyDestOptions{
+		Bucket:          f.bucket,
+		Object:          key,
+		UserMetadata:    metadata,
+		ReplaceMetadata: true,
+	}
+
+	src := minio.CopySrcOptions{
+		Bucket: f.bucket,
+		Object: key,
+	}
+
+	if _, err := f.client.CopyObject(f.ctx, dst, src); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+func (f *File) doProps(fn func(conn *sqlite.Conn) error) error {
+	conn, err := f.props.Take(f.ctx)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer f.props.Put(conn)
+
+	if err := fn(conn); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// propsObject returns the object holding the dead properties, if any
+func (f *File) propsObject() (string, minio.ObjectInfo, bool, error) {
+	key, err := f.propsKey()
+	if err != nil {
+		return "", minio.ObjectInfo{}, false, errors.WithStack(err)
+	}
+
+	info, err := f.client.StatObject(f.ctx, f.bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return key, minio.ObjectInfo{}, false, nil
+		}
+
+		return "", minio.ObjectInfo{}, false, errors.WithStack(err)
+	}
+
+	return key, info, true, nil
+}
+
+// holdsProps returns true if the metadata of the given object can hold
+// its dead properties. Replacing them copies the object onto itself,
+// which would change the ETag of the multipart ones, those being
+// identified by its suffix, and fail above 5GB.
+func holdsProps(info minio.ObjectInfo) bool {
+	return !strings.Contains(info.ETag, "-")
+}
+
+// propsPath returns the path of the dead properties of the given key
+// in the database
+func propsPath(key string) string {
+	return path.Clean(separator + key)
+}
+
+// propsKey returns the key of the object holding the dead properties,
+// the marker of the directories holding theirs
+func (f *File) propsKey() (string, error) {
+	info, err := stat(f.ctx, f.client, f.bucket, f.key)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	key := strings.Trim(f.key, separator)
+
+	if !info.IsDir() {
+		return key, nil
+	}
+
+	return strings.Trim(filepath.Join(key, keepDirFile), separator), nil
+}
+
+func decodeProps(value string) (map[xml.Name]webdav.Property, error) {
+	deadProps := map[xml.Name]webdav.Property{}
+
+	if value == "" {
+		return deadProps, nil
+	}
+
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	var entries []deadProp
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	for _, p := range entries {
+		name := xml.Name{Space: p.Space, Local: p.Local}
+		deadProps[name] = webdav.Property{XMLName: name, Lang: p.Lang, InnerXML: p.InnerXML}
+	}
+
+	return deadProps, nil
+}
+
+func encodeProps(deadProps map[xml.Name]webdav.Property) (string, error) {
+	if len(deadProps) == 0 {
+		return "", nil
+	}
+
+	entries := make([]deadProp, 0, len(deadProps))
+	for _, p := range deadProps {
+		entries = append(entries, deadProp{
+			Space:    p.XMLName.Space,
+			Local:    p.XMLName.Local,
+			Lang:     p.Lang,
+			InnerXML: p.InnerXML,
+		})
+	}
+
+	data, err := json.Marshal(entries)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+var _ webdav.DeadPropsHolder = &File{}
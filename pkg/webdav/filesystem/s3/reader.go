@@ -0,0 +1,314 @@
+package s3
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/pkg/errors"
+)
+
+// Default settings of the ranged reads
+const (
+	defaultChunkSize     = 4 * 1024 * 1024  // 4 MB fetched by each range request
+	defaultReadAhead     = 2                // Chunks fetched ahead of the sequential reads
+	defaultReadCacheSize = 64 * 1024 * 1024 // 64 MB of recently read chunks kept in memory
+)
+
+// reader reads an object with range requests of fixed size chunks,
+// fetching the next ones ahead once the reads are sequential. The object
+// info is taken from the first response, sparing a HEAD request.
+type reader struct {
+	ctx    context.Context
+	client *minio.Client
+	bucket string
+	key    string
+
+	chunkSize int64
+	readAhead int
+	chunks    *chunkCache
+
+	// Known once the object has been fetched or stated
+	info   *FileInfo
+	offset int64
+	// Index of the last chunk read, -1 before the first read
+	last int64
+}
+
+// Read implements io.Reader.
+func (r *reader) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	if r.info != nil && r.offset >= r.info.size {
+		return 0, io.EOF
+	}
+
+	index := r.offset / r.chunkSize
+
+	data, err := r.chunk(index)
+	if err != nil {
+		return 0, errors.WithStack(err)
+	}
+
+	start := r.offset - index*r.chunkSize
+	if start >= int64(len(data)) {
+		return 0, io.EOF
+	}
+
+	n := copy(p, data[start:])
+	r.offset += int64(n)
+
+	// The read-ahead starts once the reads cross a chunk, sparing
+	// the requests of a few bytes
+	if r.last != -1 && index == r.last+1 {
+		r.prefetch(index)
+	}
+
+	r.last = index
+
+	return n, nil
+}
+
+// Seek implements io.Seeker.
+func (r *reader) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		info, err := r.stat()
+		if err != nil {
+			return 0, errors.WithStack(err)
+		}
+
+		offset += info.Size()
+	default:
+		return 0, errors.Errorf("invalid whence '%d'", whence)
+	}
+
+	if offset < 0 {
+		return 0, errors.Errorf("negative position '%d'", offset)
+	}
+
+	r.offset = offset
+
+	return offset, nil
+}
+
+// stat returns the info of the object, stating it only if
+// it has not been fetched yet
+func (r *reader) stat() (os.FileInfo, error) {
+	if r.info != nil {
+		return r.info, nil
+	}
+
+	info, err := stat(r.ctx, r.client, r.bucket, r.key)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, os.ErrNotExist
+		}
+
+		return nil, errors.WithStack(err)
+	}
+
+	if fileInfo, ok := info.(*FileInfo); ok && !fileInfo.isDir {
+		r.info = fileInfo
+	}
+
+	return info, nil
+}
+
+// chunk returns the data of the chunk with the given index
+func (r *reader) chunk(index int64) ([]byte, error) {
+	// The first response provides the version of the object
+	if r.info == nil {
+		return r.fetchFirst(index)
+	}
+
+	// The chunks of an object without ETag could be of another version
+	if r.info.etag == "" {
+		data, _, err := r.get(index, "")
+		return data, err
+	}
+
+	// A chunk fetched by a closed reader is fetched again
+	for attempt := 0; ; attempt++ {
+		ch, created := r.chunks.Load(r.chunkKey(index))
+		if created {
+			data, _, err := r.get(index, r.info.etag)
+			r.chunks.Complete(ch, data, err)
+		}
+
+		select {
+		case <-ch.done:
+		case <-r.ctx.Done():
+			return nil, errors.WithStack(r.ctx.Err())
+		}
+
+		if ch.err != nil && !created && attempt == 0 {
+			continue
+		}
+
+		return ch.data, ch.err
+	}
+}
+
+// fetchFirst fetches the chunk with the given index, recording the
+// object info of the response
+func (r *reader) fetchFirst(index int64) ([]byte, error) {
+	data, info, err := r.get(index, "")
+	if err != nil {
+		// The object is shorter than the offset, or empty
+		if minio.ToErrorResponse(errors.Cause(err)).Code == "InvalidRange" {
+			if _, err := r.stat(); err != nil {
+				return nil, errors.WithStack(err)
+			}
+
+			return nil, nil
+		}
+
+		return nil, errors.WithStack(err)
+	}
+
+	r.info = info
+
+	if info.etag != "" {
+		r.chunks.Store(r.chunkKey(index), data)
+	}
+
+	return data, nil
+}
+
+// prefetch fetches in the background the chunks following
+// the one with the given index
+func (r *reader) prefetch(index int64) {
+	etag := r.info.etag
+	if etag == "" {
+		return
+	}
+
+	for i := index + 1; i <= index+int64(r.readAhead); i++ {
+		if i*r.chunkSize >= r.info.size {
+			return
+		}
+
+		ch, created := r.chunks.Load(r.chunkKey(i))
+		if !created {
+			continue
+		}
+
+		go func() {
+			data, _, err := r.get(i, etag)
+			r.chunks.Complete(ch, data, err)
+		}()
+	}
+}
+
+// get fetches the chunk with the given index of the version of the
+// object with the given ETag, or of its current version if empty
+func (r *reader) get(index int64, etag string) ([]byte, *FileInfo, error) {
+	opts := minio.GetObjectOptions{}
+
+	start := index * r.chunkSize
+	if err := opts.SetRange(start, start+r.chunkSize-1); err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+
+	if etag != "" {
+		if err := opts.SetMatchETag(etag); err != nil {
+			return nil, nil, errors.WithStack(err)
+		}
+	}
+
+	core := minio.Core{Client: r.client}
+
+	body, objInfo, header, err := core.GetObject(r.ctx, r.bucket, r.key, opts)
+	if err != nil {
+		errRes := minio.ToErrorResponse(err)
+
+		switch {
+		case errRes.Code == "NoSuchKey":
+			return nil, nil, errors.WithStack(os.ErrNotExist)
+		case errRes.StatusCode == http.StatusPreconditionFailed:
+			return nil, nil, errors.Wrapf(err, "object '%s' changed while being read", r.key)
+		}
+
+		return nil, nil, errors.WithStack(err)
+	}
+
+	defer body.Close()
+
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return nil, nil, errors.WithStack(err)
+	}
+
+	info := &FileInfo{
+		isDir:   false,
+		modTime: objInfo.LastModified,
+		mode:    defaultFileMode,
+		name:    filepath.Base(r.key),
+		size:    objectSize(header, objInfo.Size),
+
+		etag:        objInfo.ETag,
+		contentType: objInfo.ContentType,
+	}
+
+	return data, info, nil
+}
+
+func (r *reader) chunkKey(index int64) chunkKey {
+	return chunkKey{
+		Key:   r.key,
+		ETag:  r.info.etag,
+		Index: index,
+	}
+}
+
+// objectSize returns the size of the whole object from
+// the Content-Range header of a range response
+func objectSize(header http.Header, size int64) int64 {
+	_, total, found := strings.Cut(header.Get("Content-Range"), "/")
+	if !found {
+		return size
+	}
+
+	parsed, err := strconv.ParseInt(total, 10, 64)
+	if err != nil {
+		return size
+	}
+
+	return parsed
+}
+
+func newReader(ctx context.Context, client *minio.Client, bucket, key string, chunks *chunkCache, chunkSize int, readAhead int) *reader {
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+
+	if readAhead == 0 {
+		readAhead = defaultReadAhead
+	}
+
+	if readAhead < 0 {
+		readAhead = 0
+	}
+
+	return &reader{
+		ctx:       ctx,
+		client:    client,
+		bucket:    bucket,
+		key:       key,
+		chunkSize: int64(chunkSize),
+		readAhead: readAhead,
+		chunks:    chunks,
+		last:      -1,
+	}
+}
@@ -0,0 +1,72 @@
+package s3
+
+import (
+	"context"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/pkg/errors"
+)
+
+// legacyPartPrefix is the prefix of the parts objects
+// uploaded by the previous versions
+const legacyPartPrefix = ".parts/"
+
+// SweepUploads aborts the multipart uploads initiated before the given
+// time, left behind by interrupted uploads, and removes the parts objects
+// left behind by the previous versions
+func SweepUploads(ctx context.Context, client *minio.Client, bucket string, before time.Time) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	core := minio.Core{Client: client}
+
+	for upload := range client.ListIncompleteUploads(ctx, bucket, "", true) {
+		if upload.Err != nil {
+			return errors.WithStack(upload.Err)
+		}
+
+		if !upload.Initiated.Before(before) {
+			continue
+		}
+
+		if err := core.AbortMultipartUpload(ctx, bucket, upload.Key, upload.UploadID); err != nil {
+			return errors.Wrapf(err, "could not abort upload of '%s'", upload.Key)
+		}
+	}
+
+	parts := make(chan minio.ObjectInfo)
+
+	var listErr error
+
+	go func() {
+		defer close(parts)
+
+		for obj := range client.ListObjects(ctx, bucket, minio.ListObjectsOptions{Prefix: legacyPartPrefix, Recursive: true}) {
+			if obj.Err != nil {
+				listErr = errors.WithStack(obj.Err)
+				return
+			}
+
+			if !obj.LastModified.Before(before) {
+				continue
+			}
+
+			select {
+			case parts <- obj:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	for err := range client.RemoveObjects(ctx, bucket, parts, minio.RemoveObjectsOptions{}) {
+		return errors.Wrapf(err.Err, "could not remove part object '%s'", err.ObjectName)
+	}
+
+	if listErr != nil {
+		return errors.WithStack(listErr)
+	}
+
+	return nil
+}
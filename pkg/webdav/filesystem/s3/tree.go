@@ -0,0 +1,247 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/pkg/errors"
+)
+
+// Objects copied concurrently when renaming a directory
+const defaultCopyConcurrency = 8
+
+// Failures detailed by the message of a PartialError
+const maxReportedFailures = 5
+
+// maxCopySize is the size of the largest objects copied at once, the
+// larger ones being copied in parts (S3 limit)
+var maxCopySize int64 = maxPartSize
+
+// copiedHeaders are the headers of the objects restored on the copies
+// replacing their metadata and on the ones made in parts
+var copiedHeaders = []string{
+	"Content-Type",
+	"Content-Encoding",
+	"Content-Disposition",
+	"Content-Language",
+	"Cache-Control",
+	"Expires",
+}
+
+// PartialError reports the objects of a directory which could not be
+// copied or removed, the others having been processed
+type PartialError struct {
+	Op     string
+	Name   string
+	Total  int
+	Failed map[string]error
+}
+
+// Error implements error.
+func (e *PartialError) Error() string {
+	keys := make([]string, 0, len(e.Failed))
+	for key := range e.Failed {
+		keys = append(keys, key)
+	}
+
+	slices.Sort(keys)
+
+	var sb strings.Builder
+
+	fmt.Fprintf(&sb, "could not %s %d of %d objects of '%s'", e.Op, len(keys), e.Total, e.Name)
+
+	for i, key := range keys {
+		if i == maxReportedFailures {
+			fmt.Fprintf(&sb, "; and %d more", len(keys)-i)
+			break
+		}
+
+		fmt.Fprintf(&sb, "; '%s': %v", key, e.Failed[key])
+	}
+
+	return sb.String()
+}
+
+// listTree returns all the objects under the given directory
+func listTree(ctx context.Context, client *minio.Client, bucket string, name string) ([]minio.ObjectInfo, error) {
+	opts := minio.ListObjectsOptions{
+		Prefix:    treePrefix(name),
+		Recursive: true,
+	}
+
+	var objects []minio.ObjectInfo
+
+	for obj := range client.ListObjects(ctx, bucket, opts) {
+		if obj.Err != nil {
+			return nil, errors.WithStack(obj.Err)
+		}
+
+		objects = append(objects, obj)
+	}
+
+	return objects, nil
+}
+
+// copyTree copies the given objects under the new directory, removing
+// the copies already made if any object could not be copied
+func copyTree(ctx context.Context, client *minio.Client, bucket string, oldName string, newName string, objects []minio.ObjectInfo) error {
+	oldPrefix := treePrefix(oldName)
+	newPrefix := treePrefix(newName)
+
+	var (
+		mu     sync.Mutex
+		copied []minio.ObjectInfo
+		failed = map[string]error{}
+	)
+
+	slots := make(chan struct{}, defaultCopyConcurrency)
+
+	var wg sync.WaitGroup
+
+	for _, obj := range objects {
+		target := newPrefix + strings.TrimPrefix(obj.Key, oldPrefix)
+
+		slots <- struct{}{}
+		wg.Add(1)
+
+		go func() {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+
+			err := copyObject(ctx, client, bucket, obj.Key, target, obj.Size)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				failed[obj.Key] = err
+				return
+			}
+
+			copied = append(copied, minio.ObjectInfo{Key: target})
+		}()
+	}
+
+	wg.Wait()
+
+	if len(failed) == 0 {
+		return nil
+	}
+
+	// The copies are removed even if the request has been canceled
+	_ = removeTree(context.WithoutCancel(ctx), client, bucket, newName, copied)
+
+	return errors.WithStack(&PartialError{
+		Op:     "copy",
+		Name:   oldName,
+		Total:  len(objects),
+		Failed: failed,
+	})
+}
+
+// copyObject copies the given object under the target key, in parts
+// if it is larger than maxCopySize
+func copyObject(ctx context.Context, client *minio.Client, bucket string, key string, target string, size int64) error {
+	dest := minio.CopyDestOptions{
+		Bucket: bucket,
+		Object: target,
+	}
+
+	src := minio.CopySrcOptions{
+		Bucket: bucket,
+		Object: key,
+	}
+
+	if size <= maxCopySize {
+		if _, err := client.CopyObject(ctx, dest, src); err != nil {
+			return errors.WithStack(err)
+		}
+
+		return nil
+	}
+
+	info, err := client.StatObject(ctx, bucket, key, minio.StatObjectOptions{})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	dest.UserMetadata = objectMetadata(info)
+	dest.ReplaceMetadata = true
+
+	// The whole object as a range, which ComposeObject splits in parts
+	src.MatchETag = info.ETag
+	src.MatchRange = true
+	src.Start = 0
+	src.End = info.Size - 1
+
+	if _, err := client.ComposeObject(ctx, dest, src); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// objectMetadata returns the user metadata and the copied headers of
+// the given object
+func objectMetadata(info minio.ObjectInfo) map[string]string {
+	metadata := make(map[string]string, len(info.UserMetadata)+len(copiedHeaders))
+
+	maps.Copy(metadata, info.UserMetadata)
+
+	for _, header := range copiedHeaders {
+		if value := info.Metadata.Get(header); value != "" {
+			metadata[header] = value
+		}
+	}
+
+	return metadata
+}
+
+// removeTree removes the given objects of the directory in batches
+func removeTree(ctx context.Context, client *minio.Client, bucket string, name string, objects []minio.ObjectInfo) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	removed := make(chan minio.ObjectInfo)
+
+	go func() {
+		defer close(removed)
+
+		for _, obj := range objects {
+			select {
+			case removed <- minio.ObjectInfo{Key: obj.Key}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	failed := map[string]error{}
+
+	for err := range client.RemoveObjects(ctx, bucket, removed, minio.RemoveObjectsOptions{}) {
+		failed[err.ObjectName] = err.Err
+	}
+
+	if len(failed) == 0 {
+		return nil
+	}
+
+	return errors.WithStack(&PartialError{
+		Op:     "remove",
+		Name:   name,
+		Total:  len(objects),
+		Failed: failed,
+	})
+}
+
+// treePrefix returns the prefix of the objects under the given directory
+func treePrefix(name string) string {
+	return strings.Trim(name, separator) + separator
+}
@@ -0,0 +1,255 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"slices"
+	"sync"
+	"sync/atomic"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/pkg/errors"
+)
+
+// Default settings of the multipart uploads
+const (
+	defaultPartSize          = 10 * 1024 * 1024       // 10 MB per part
+	minPartSize              = 5 * 1024 * 1024        // Minimum size of a part but the last one (S3 limit)
+	maxPartSize              = 5 * 1024 * 1024 * 1024 // Maximum size of a part (S3 limit)
+	maxParts                 = 10000                  // Maximum number of parts (S3 limit)
+	partsPerGrowth           = 1000                   // Parts uploaded before doubling their size
+	defaultUploadConcurrency = 4                      // Parts uploaded concurrently for each file
+)
+
+// upload streams the written data to S3, with a multipart upload
+// once more than a part has been written. The parts are uploaded
+// concurrently, the writes blocking while all uploaders are busy.
+// The size of the written data being unknown, the size of the parts
+// doubles every partsPerGrowth parts, so that the maxParts parts hold
+// 1023000 times the initial part size, more than the 5TB objects allowed
+// by S3 with the default one.
+type upload struct {
+	ctx    context.Context
+	client *minio.Client
+	bucket string
+	key    string
+	opts   minio.PutObjectOptions
+
+	partSize int
+	buffer   []byte
+
+	uploadID   string
+	partNumber int
+	slots      chan struct{}
+	wg         sync.WaitGroup
+
+	mu    sync.Mutex // Protects parts and err
+	parts []minio.CompletePart
+	err   error
+
+	closed atomic.Bool
+}
+
+// Write implements io.Writer.
+func (u *upload) Write(p []byte) (int, error) {
+	if u.closed.Load() {
+		return 0, os.ErrClosed
+	}
+
+	if err := u.failure(); err != nil {
+		return 0, err
+	}
+
+	written := 0
+
+	for len(p) > 0 {
+		partSize := u.nextPartSize()
+
+		n := min(len(p), partSize-len(u.buffer))
+
+		u.buffer = append(u.buffer, p[:n]...)
+		p = p[n:]
+		written += n
+
+		if len(u.buffer) < partSize {
+			continue
+		}
+
+		if err := u.uploadPart(); err != nil {
+			u.fail(err)
+			return written, errors.WithStack(err)
+		}
+	}
+
+	return written, nil
+}
+
+// Close completes the upload, aborting it on failure
+func (u *upload) Close() error {
+	if u.closed.Swap(true) {
+		return nil
+	}
+
+	// The data written so far is incomplete
+	if err := u.failure(); err != nil {
+		u.abort()
+		return errors.WithStack(err)
+	}
+
+	// Small files are put at once
+	if u.uploadID == "" {
+		_, err := u.client.PutObject(u.ctx, u.bucket, u.key, bytes.NewReader(u.buffer), int64(len(u.buffer)), u.opts)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		return nil
+	}
+
+	if len(u.buffer) > 0 {
+		if err := u.uploadPart(); err != nil {
+			u.abort()
+			return errors.WithStack(err)
+		}
+	}
+
+	u.wg.Wait()
+
+	if err := u.failure(); err != nil {
+		u.abort()
+		return errors.WithStack(err)
+	}
+
+	slices.SortFunc(u.parts, func(a, b minio.CompletePart) int {
+		return a.PartNumber - b.PartNumber
+	})
+
+	core := minio.Core{Client: u.client}
+
+	if _, err := core.CompleteMultipartUpload(u.ctx, u.bucket, u.key, u.uploadID, u.parts, u.opts); err != nil {
+		u.abort()
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// uploadPart uploads the buffered data as the next part, initiating
+// the multipart upload first if needed
+func (u *upload) uploadPart() error {
+	core := minio.Core{Client: u.client}
+
+	if u.uploadID == "" {
+		uploadID, err := core.NewMultipartUpload(u.ctx, u.bucket, u.key, u.opts)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		u.uploadID = uploadID
+	}
+
+	if u.partNumber >= maxParts {
+		return errors.Errorf("file exceeds the maximum number of parts (%d)", maxParts)
+	}
+
+	u.partNumber++
+
+	partNumber := u.partNumber
+	data := u.buffer
+
+	// The buffer is owned by the uploader from now on
+	u.buffer = make([]byte, 0, u.nextPartSize())
+
+	u.slots <- struct{}{}
+	u.wg.Add(1)
+
+	go func() {
+		defer func() {
+			<-u.slots
+			u.wg.Done()
+		}()
+
+		part, err := core.PutObjectPart(u.ctx, u.bucket, u.key, u.uploadID, partNumber, bytes.NewReader(data), int64(len(data)), minio.PutObjectPartOptions{})
+
+		if err != nil {
+			u.fail(errors.Wrapf(err, "could not upload part %d", partNumber))
+			return
+		}
+
+		u.mu.Lock()
+		defer u.mu.Unlock()
+
+		u.parts = append(u.parts, minio.CompletePart{PartNumber: partNumber, ETag: part.ETag})
+	}()
+
+	return nil
+}
+
+// nextPartSize returns the size of the part being buffered, doubled
+// every partsPerGrowth parts
+func (u *upload) nextPartSize() int {
+	return partSizeAt(u.partSize, u.partNumber)
+}
+
+// partSizeAt returns the size of the part following the given number
+// of uploaded parts
+func partSizeAt(partSize int, uploaded int) int {
+	growth := min(uploaded/partsPerGrowth, maxParts/partsPerGrowth)
+
+	return min(partSize<<growth, maxPartSize)
+}
+
+// fail records the first error of the upload
+func (u *upload) fail(err error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.err == nil {
+		u.err = err
+	}
+}
+
+func (u *upload) failure() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return u.err
+}
+
+// abort aborts the multipart upload, discarding its parts
+func (u *upload) abort() {
+	u.wg.Wait()
+
+	if u.uploadID == "" {
+		return
+	}
+
+	// The upload is aborted even if the request has been canceled
+	ctx := context.WithoutCancel(u.ctx)
+
+	core := minio.Core{Client: u.client}
+
+	_ = core.AbortMultipartUpload(ctx, u.bucket, u.key, u.uploadID)
+}
+
+func newUpload(ctx context.Context, client *minio.Client, bucket, key string, opts minio.PutObjectOptions, partSize int, concurrency int) *upload {
+	if partSize <= 0 {
+		partSize = defaultPartSize
+	}
+
+	if concurrency <= 0 {
+		concurrency = defaultUploadConcurrency
+	}
+
+	return &upload{
+		ctx:      ctx,
+		client:   client,
+		bucket:   bucket,
+		key:      key,
+		opts:     opts,
+		partSize: partSize,
+		buffer:   make([]byte, 0, min(partSize, 64*1024)),
+		slots:    make(chan struct{}, concurrency),
+	}
+}
@@ -101,6 +101,9 @@ func stat(ctx context.Context, client *minio.Client, bucket string, name string)
 		mode:    defaultFileMode,
 		name:    filepath.Base(name),
 		size:    stat.Size,
+
+		etag:        stat.ETag,
+		contentType: stat.ContentType,
 	}, nil
 }
 
@@ -2,6 +2,9 @@ package sqlite
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
 	"io"
 	"os"
 	"path/filepath"
@@ -9,12 +12,16 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/bornholm/calli/pkg/webdav/filesystem/props"
 	"github.com/pkg/errors"
 	"golang.org/x/net/webdav"
 	"zombiezen.com/go/sqlite"
 	"zombiezen.com/go/sqlite/sqlitex"
 )
 
+// emptyETag is the hash of the empty contents
+const emptyETag = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
 // File represents an open file in the SQLite filesystem
 type File struct {
 	ctx     context.Context
@@ -25,6 +32,7 @@ type File struct {
 	size    int64
 	modTime time.Time
 	mode    os.FileMode
+	etag    string
 	offset  int64
 
 	temp *os.File
@@ -200,7 +208,7 @@ func (f *File) Readdir(count int) ([]os.FileInfo, error) {
 
 	// Improved query to better filter direct children
 	err = sqlitex.Execute(conn, `
-		SELECT path, is_dir, mode, size, mtime FROM files 
+		SELECT path, is_dir, mode, size, mtime, etag FROM files 
 		WHERE path LIKE ? AND path != ?
 	`, &sqlitex.ExecOptions{
 		Args: []interface{}{prefix + "%", f.name},
@@ -219,6 +227,7 @@ func (f *File) Readdir(count int) ([]os.FileInfo, error) {
 				mode:    os.FileMode(stmt.ColumnInt64(2)),
 				size:    stmt.ColumnInt64(3),
 				modTime: time.Unix(stmt.ColumnInt64(4), 0),
+				etag:    stmt.ColumnText(5),
 			}
 			entries = append(entries, info)
 			return nil
@@ -240,6 +249,7 @@ func (f *File) Stat() (os.FileInfo, error) {
 		mode:    f.mode,
 		modTime: f.modTime,
 		isDir:   f.isDir,
+		etag:    f.etag,
 	}, nil
 }
 
@@ -331,26 +341,34 @@ func (f *File) moveTempFileToBlob() error {
 			return errors.WithStack(err)
 		}
 
-		err = sqlitex.Execute(conn, `
-			UPDATE files SET size = ? WHERE path = ?
-		`, &sqlitex.ExecOptions{
-			Args: []any{stat.Size(), f.name},
-		})
+		blob, err := conn.OpenBlob("", "file_contents", "content", rowID, true)
 		if err != nil {
 			return errors.WithStack(err)
 		}
 
-		blob, err := conn.OpenBlob("", "file_contents", "content", rowID, true)
-		if err != nil {
+		defer blob.Close()
+
+		// The contents are hashed as they are copied
+		hash := sha256.New()
+
+		if _, err := io.Copy(blob, io.TeeReader(file, hash)); err != nil {
 			return errors.WithStack(err)
 		}
 
-		defer blob.Close()
+		etag := hex.EncodeToString(hash.Sum(nil))
 
-		if _, err := io.Copy(blob, file); err != nil {
+		err = sqlitex.Execute(conn, `
+			UPDATE files SET size = ?, etag = ? WHERE path = ?
+		`, &sqlitex.ExecOptions{
+			Args: []any{stat.Size(), etag, f.name},
+		})
+		if err != nil {
 			return errors.WithStack(err)
 		}
 
+		f.size = stat.Size()
+		f.etag = etag
+
 		return nil
 	})
 	if err != nil {
@@ -371,9 +389,9 @@ func (f *File) truncate() error {
 
 	// Update file size to 0
 	err = sqlitex.Execute(conn, `
-		UPDATE files SET size = 0, mtime = ? WHERE path = ?
+		UPDATE files SET size = 0, mtime = ?, etag = ? WHERE path = ?
 	`, &sqlitex.ExecOptions{
-		Args: []interface{}{time.Now().Unix(), f.name},
+		Args: []interface{}{time.Now().Unix(), emptyETag, f.name},
 	})
 	if err != nil {
 		return errors.WithStack(err)
@@ -392,11 +410,47 @@ func (f *File) truncate() error {
 	// Update file info
 	f.size = 0
 	f.modTime = time.Now()
+	f.etag = emptyETag
 
 	return nil
 }
 
-var _ webdav.File = &File{}
+var (
+	_ webdav.File            = &File{}
+	_ webdav.DeadPropsHolder = &File{}
+)
+
+// DeadProps implements webdav.DeadPropsHolder.
+func (f *File) DeadProps() (map[xml.Name]webdav.Property, error) {
+	conn, err := f.fs.pool.Take(f.ctx)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer f.fs.pool.Put(conn)
+
+	deadProps, err := props.Load(conn, f.name)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return deadProps, nil
+}
+
+// Patch implements webdav.DeadPropsHolder.
+func (f *File) Patch(patches []webdav.Proppatch) ([]webdav.Propstat, error) {
+	conn, err := f.fs.pool.Take(f.ctx)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer f.fs.pool.Put(conn)
+
+	propstats, err := props.Patch(conn, f.name, patches)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	return propstats, nil
+}
 
 func withSave(conn *sqlite.Conn, fn func() error) (err error) {
 	defer sqlitex.Save(conn)(&err)
@@ -8,6 +8,8 @@ import (
 	"strings"
 	"time"
 
+	"github.com/bornholm/calli/pkg/webdav/filesystem"
+	"github.com/bornholm/calli/pkg/webdav/filesystem/props"
 	"github.com/pkg/errors"
 	"golang.org/x/net/webdav"
 	"zombiezen.com/go/sqlite"
@@ -26,6 +28,7 @@ type fileInfo struct {
 	mode    os.FileMode
 	modTime time.Time
 	isDir   bool
+	etag    string
 }
 
 func (fi *fileInfo) Name() string       { return path.Base(fi.name) }
@@ -35,6 +38,26 @@ func (fi *fileInfo) ModTime() time.Time { return fi.modTime }
 func (fi *fileInfo) IsDir() bool        { return fi.isDir }
 func (fi *fileInfo) Sys() interface{}   { return nil }
 
+// ETag implements webdav.ETager.
+func (fi *fileInfo) ETag(ctx context.Context) (string, error) {
+	// Files written before the contents were hashed do not have one
+	if fi.isDir || fi.etag == "" {
+		return "", webdav.ErrNotImplemented
+	}
+
+	return `"` + fi.etag + `"`, nil
+}
+
+// ContentType implements webdav.ContentTyper.
+func (fi *fileInfo) ContentType(ctx context.Context) (string, error) {
+	return filesystem.ContentTypeByExtension(fi.name)
+}
+
+var (
+	_ webdav.ETager       = &fileInfo{}
+	_ webdav.ContentTyper = &fileInfo{}
+)
+
 // Mkdir implements webdav.FileSystem.
 func (f *FileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
 	name = cleanPath(name)
@@ -109,10 +132,10 @@ func (f *FileSystem) OpenFile(ctx context.Context, name string, flag int, perm o
 			defer f.pool.Put(conn)
 
 			err = sqlitex.Execute(conn, `
-				INSERT INTO files (path, is_dir, mode, size, mtime)
-				VALUES (?, 0, ?, 0, ?)
+				INSERT INTO files (path, is_dir, mode, size, mtime, etag)
+				VALUES (?, 0, ?, 0, ?, ?)
 			`, &sqlitex.ExecOptions{
-				Args: []interface{}{name, uint32(perm), time.Now().Unix()},
+				Args: []interface{}{name, uint32(perm), time.Now().Unix(), emptyETag},
 			})
 			if err != nil {
 				return nil, errors.WithStack(err)
@@ -139,8 +162,9 @@ func (f *FileSystem) OpenFile(ctx context.Context, name string, flag int, perm o
 		}
 	}
 
-	// Check if trying to open a directory with write flags
-	if info.IsDir() && flag&(os.O_WRONLY|os.O_RDWR) != 0 {
+	// Check if trying to open a directory with write flags. PROPPATCH opens
+	// the resources with O_RDWR, the writes to a directory failing anyway.
+	if info.IsDir() && flag&(os.O_WRONLY|os.O_RDWR) != 0 && flag != os.O_RDWR {
 		return nil, errors.New("cannot write to directory")
 	}
 
@@ -154,6 +178,7 @@ func (f *FileSystem) OpenFile(ctx context.Context, name string, flag int, perm o
 		size:    info.Size(),
 		modTime: info.ModTime(),
 		mode:    info.Mode(),
+		etag:    info.(*fileInfo).etag,
 		offset:  0,
 	}
 
@@ -239,6 +264,13 @@ func (f *FileSystem) RemoveAll(ctx context.Context, name string) error {
 				return errors.WithStack(err)
 			}
 		}
+
+		// Remove the dead properties as well
+		err = props.Delete(conn, name)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
 		return nil
 	}()
 
@@ -375,6 +407,12 @@ func (f *FileSystem) Rename(ctx context.Context, oldName string, newName string)
 			}
 		}
 
+		// Move the dead properties along
+		err = props.Move(conn, oldName, newName)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
 		return nil
 	}()
 
@@ -395,10 +433,11 @@ func (f *FileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error)
 	var mode uint32
 	var size int64
 	var mtime int64
+	var etag string
 	var found bool
 
 	err = sqlitex.Execute(conn, `
-		SELECT is_dir, mode, size, mtime FROM files 
+		SELECT is_dir, mode, size, mtime, etag FROM files 
 		WHERE path = ?
 	`, &sqlitex.ExecOptions{
 		Args: []interface{}{name},
@@ -407,6 +446,7 @@ func (f *FileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error)
 			mode = uint32(stmt.ColumnInt64(1))
 			size = stmt.ColumnInt64(2)
 			mtime = stmt.ColumnInt64(3)
+			etag = stmt.ColumnText(4)
 			found = true
 			return nil
 		},
@@ -427,6 +467,7 @@ func (f *FileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error)
 		mode:    os.FileMode(mode),
 		modTime: time.Unix(mtime, 0),
 		isDir:   isDir == 1,
+		etag:    etag,
 	}
 
 	return info, nil
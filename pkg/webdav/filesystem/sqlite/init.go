@@ -3,9 +3,11 @@ package sqlite
 import (
 	"fmt"
 	"log"
+	"slices"
 	"time"
 
 	"github.com/bornholm/calli/pkg/webdav/filesystem"
+	"github.com/bornholm/calli/pkg/webdav/filesystem/props"
 	"github.com/go-viper/mapstructure/v2"
 	"github.com/pkg/errors"
 	"golang.org/x/net/webdav"
@@ -32,7 +34,7 @@ func CreateFileSystemFromOptions(options any) (webdav.FileSystem, error) {
 	}
 
 	schema := sqlitemigration.Schema{
-		Migrations: []string{
+		Migrations: slices.Concat([]string{
 			`CREATE TABLE IF NOT EXISTS files (
 					path TEXT PRIMARY KEY,     -- File path (used as unique identifier)
 					is_dir INTEGER NOT NULL,   -- 1 if directory, 0 if file
@@ -47,7 +49,10 @@ func CreateFileSystemFromOptions(options any) (webdav.FileSystem, error) {
 					content BLOB              -- File content
 				);
 			`,
-		},
+		}, props.Migrations, []string{
+			// Hash of the files contents, empty for the directories
+			`ALTER TABLE files ADD COLUMN etag TEXT NOT NULL DEFAULT '';`,
+		}),
 		RepeatableMigration: fmt.Sprintf(`INSERT OR IGNORE INTO files (path, is_dir, mode, size, mtime) VALUES ('/', 1, 493, 0, %d)`, time.Now().Unix()),
 	}
 
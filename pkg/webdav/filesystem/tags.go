@@ -0,0 +1,44 @@
+package filesystem
+
+import (
+	"context"
+	"mime"
+	"os"
+	"path"
+
+	"golang.org/x/net/webdav"
+)
+
+// ETag returns the ETag of the given file info, webdav.ErrNotImplemented
+// if it does not provide one
+func ETag(ctx context.Context, info os.FileInfo) (string, error) {
+	etager, ok := info.(webdav.ETager)
+	if !ok {
+		return "", webdav.ErrNotImplemented
+	}
+
+	return etager.ETag(ctx)
+}
+
+// ContentType returns the content type of the given file info,
+// webdav.ErrNotImplemented if it does not provide one
+func ContentType(ctx context.Context, info os.FileInfo) (string, error) {
+	typer, ok := info.(webdav.ContentTyper)
+	if !ok {
+		return "", webdav.ErrNotImplemented
+	}
+
+	return typer.ContentType(ctx)
+}
+
+// ContentTypeByExtension returns the content type associated with the
+// extension of the given name, webdav.ErrNotImplemented if unknown, the
+// content being sniffed then
+func ContentTypeByExtension(name string) (string, error) {
+	contentType := mime.TypeByExtension(path.Ext(name))
+	if contentType == "" {
+		return "", webdav.ErrNotImplemented
+	}
+
+	return contentType, nil
+}
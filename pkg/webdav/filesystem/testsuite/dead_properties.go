@@ -0,0 +1,139 @@
+package testsuite
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+
+	"github.com/bornholm/calli/pkg/webdav/filesystem"
+	"github.com/pkg/errors"
+	"golang.org/x/net/webdav"
+)
+
+// DeadProperties tests the PROPPATCH round-trips of the dead properties
+// and their consistency when the resources are renamed or removed
+func DeadProperties(ctx context.Context, fs webdav.FileSystem) error {
+	if err := fs.Mkdir(ctx, "Test", os.ModePerm); err != nil && !errors.Is(err, os.ErrExist) {
+		return errors.WithStack(err)
+	}
+
+	dir := "/Test/DeadProperties"
+
+	if err := fs.Mkdir(ctx, dir, os.ModePerm); err != nil {
+		return errors.WithStack(err)
+	}
+
+	file, err := fs.OpenFile(ctx, dir+"/props.txt", os.O_CREATE|os.O_RDWR, os.ModePerm)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := file.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	handler := &webdav.Handler{
+		FileSystem: fs,
+		LockSystem: webdav.NewMemLS(),
+	}
+
+	serve := func(method, name, body string) (int, string) {
+		r := httptest.NewRequestWithContext(ctx, method, name, strings.NewReader(body))
+		r.Header.Set("Depth", "0")
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		return w.Code, w.Body.String()
+	}
+
+	proppatch := func(name, body string) error {
+		code, res := serve("PROPPATCH", name, `<?xml version="1.0"?><propertyupdate xmlns="DAV:" xmlns:T="urn:calli:test">`+body+`</propertyupdate>`)
+		// Decorated backends without dead properties forbid every patch
+		if code == http.StatusMultiStatus && strings.Contains(res, "403 Forbidden") && !strings.Contains(res, "200 OK") {
+			return errors.Wrap(filesystem.ErrNotSupported, "dead properties are not supported")
+		}
+
+		if code != http.StatusMultiStatus || !strings.Contains(res, "200 OK") || strings.Contains(res, "403 Forbidden") {
+			return errors.Errorf("PROPPATCH %s: unexpected response '%d' '%s'", name, code, res)
+		}
+
+		return nil
+	}
+
+	propfind := func(name string) (string, error) {
+		code, res := serve("PROPFIND", name, `<?xml version="1.0"?><propfind xmlns="DAV:" xmlns:T="urn:calli:test"><prop><T:color/><T:shape/></prop></propfind>`)
+		if code != http.StatusMultiStatus {
+			return "", errors.Errorf("PROPFIND %s: unexpected response '%d' '%s'", name, code, res)
+		}
+
+		return res, nil
+	}
+
+	if err := proppatch(dir+"/props.txt", `<set><prop><T:color>blue</T:color><T:shape>round</T:shape></prop></set><remove><prop><T:shape/></prop></remove>`); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := proppatch(dir, `<set><prop><T:color>green</T:color></prop></set>`); err != nil {
+		return errors.WithStack(err)
+	}
+
+	res, err := propfind(dir + "/props.txt")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if !strings.Contains(res, "blue") || strings.Contains(res, "round") {
+		return errors.Errorf("PROPFIND %s: expected color 'blue' without shape, got '%s'", dir+"/props.txt", res)
+	}
+
+	res, err = propfind(dir)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if !strings.Contains(res, "green") {
+		return errors.Errorf("PROPFIND %s: expected color 'green', got '%s'", dir, res)
+	}
+
+	// The properties follow the renamed resource
+	if err := fs.Rename(ctx, dir+"/props.txt", dir+"/renamed.txt"); err != nil {
+		return errors.WithStack(err)
+	}
+
+	res, err = propfind(dir + "/renamed.txt")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if !strings.Contains(res, "blue") {
+		return errors.Errorf("PROPFIND %s: expected color 'blue' after rename, got '%s'", dir+"/renamed.txt", res)
+	}
+
+	// The properties are removed with the resource
+	if err := fs.RemoveAll(ctx, dir+"/renamed.txt"); err != nil {
+		return errors.WithStack(err)
+	}
+
+	file, err = fs.OpenFile(ctx, dir+"/renamed.txt", os.O_CREATE|os.O_RDWR, os.ModePerm)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := file.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	res, err = propfind(dir + "/renamed.txt")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if strings.Contains(res, "blue") {
+		return errors.Errorf("PROPFIND %s: expected no color after removal, got '%s'", dir+"/renamed.txt", res)
+	}
+
+	return nil
+}
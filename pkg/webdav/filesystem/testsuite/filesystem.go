@@ -54,6 +54,26 @@ var filesystemTestCases = []filesystemTestCase{
 		Name: "RecursiveDirectory",
 		Run:  RecursiveDirectory,
 	},
+	{
+		Name: "RenameTree",
+		Run:  RenameTree,
+	},
+	{
+		Name: "RemoveTree",
+		Run:  RemoveTree,
+	},
+	{
+		Name: "RenameLargeFile",
+		Run:  RenameLargeFile,
+	},
+	{
+		Name: "DeadProperties",
+		Run:  DeadProperties,
+	},
+	{
+		Name: "Tags",
+		Run:  Tags,
+	},
 }
 
 func TestFileSystem(t *testing.T, fsType filesystem.Type, opts any) {
@@ -75,6 +95,10 @@ func TestFileSystem(t *testing.T, fsType filesystem.Type, opts any) {
 			defer cancel()
 
 			if err := tc.Run(ctx, fs); err != nil {
+				if errors.Is(err, filesystem.ErrNotSupported) {
+					t.Skipf("%v", err)
+				}
+
 				t.Errorf("%+v", errors.WithStack(err))
 			}
 		})
@@ -0,0 +1,86 @@
+package testsuite
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"slices"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/webdav"
+)
+
+// largeFileSize is larger than two parts of 5MB, the minimum size
+// of the parts of the S3 multipart uploads and copies
+const largeFileSize = 2*5*1024*1024 + 1024
+
+// RenameLargeFile tests the renaming of a file spanning several parts,
+// by itself and with its directory
+func RenameLargeFile(ctx context.Context, fs webdav.FileSystem) error {
+	if err := fs.Mkdir(ctx, "Test", os.ModePerm); err != nil && !errors.Is(err, os.ErrExist) {
+		return errors.WithStack(err)
+	}
+
+	base := "/Test/RenameLargeFile"
+
+	if err := fs.Mkdir(ctx, base, os.ModePerm); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := fs.Mkdir(ctx, base+"/source", os.ModePerm); err != nil {
+		return errors.WithStack(err)
+	}
+
+	data := make([]byte, largeFileSize)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+
+	file, err := fs.OpenFile(ctx, base+"/source/large.bin", os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	// Written in chunks, as sent by the clients
+	for chunk := range slices.Chunk(data, 32*1024) {
+		if _, err := file.Write(chunk); err != nil {
+			defer file.Close()
+			return errors.WithStack(err)
+		}
+	}
+
+	if err := file.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := fs.Rename(ctx, base+"/source/large.bin", base+"/source/renamed.bin"); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := fs.Rename(ctx, base+"/source", base+"/target"); err != nil {
+		return errors.WithStack(err)
+	}
+
+	file, err = fs.OpenFile(ctx, base+"/target/renamed.bin", os.O_RDONLY, os.ModePerm)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer file.Close()
+
+	expectedSHA, err := shasum(bytes.NewReader(data))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	renamedSHA, err := shasum(file)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if e, g := expectedSHA, renamedSHA; e != g {
+		return errors.Errorf("sha256: expected '%s', got '%s'", e, g)
+	}
+
+	return nil
+}
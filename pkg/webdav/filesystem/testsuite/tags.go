@@ -0,0 +1,96 @@
+package testsuite
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+
+	"github.com/bornholm/calli/pkg/webdav/filesystem"
+	"github.com/pkg/errors"
+	"golang.org/x/net/webdav"
+)
+
+// Tags tests the ETags and content types reported by the file infos
+// and their use by the conditional requests
+func Tags(ctx context.Context, fs webdav.FileSystem) error {
+	if err := fs.Mkdir(ctx, "Test", os.ModePerm); err != nil && !errors.Is(err, os.ErrExist) {
+		return errors.WithStack(err)
+	}
+
+	dir := "/Test/Tags"
+
+	if err := fs.Mkdir(ctx, dir, os.ModePerm); err != nil {
+		return errors.WithStack(err)
+	}
+
+	name := dir + "/tags.html"
+
+	handler := &webdav.Handler{
+		FileSystem: fs,
+		LockSystem: webdav.NewMemLS(),
+	}
+
+	serve := func(method string, body string, header http.Header) *httptest.ResponseRecorder {
+		r := httptest.NewRequestWithContext(ctx, method, name, strings.NewReader(body))
+		for k, v := range header {
+			r.Header[k] = v
+		}
+
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, r)
+
+		return w
+	}
+
+	if w := serve(http.MethodPut, "first", nil); w.Code != http.StatusCreated {
+		return errors.Errorf("PUT %s: unexpected status '%d'", name, w.Code)
+	}
+
+	info, err := fs.Stat(ctx, name)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	etag, err := filesystem.ETag(ctx, info)
+	if errors.Is(err, webdav.ErrNotImplemented) {
+		return errors.Wrap(filesystem.ErrNotSupported, "etags are not supported")
+	}
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	contentType, err := filesystem.ContentType(ctx, info)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if !strings.HasPrefix(contentType, "text/html") {
+		return errors.Errorf("content type: expected 'text/html', got '%s'", contentType)
+	}
+
+	w := serve(http.MethodGet, "", nil)
+	if w.Code != http.StatusOK {
+		return errors.Errorf("GET %s: unexpected status '%d'", name, w.Code)
+	}
+
+	if e, g := etag, w.Header().Get("ETag"); e != g {
+		return errors.Errorf("GET %s: expected etag '%s', got '%s'", name, e, g)
+	}
+
+	if w := serve(http.MethodGet, "", http.Header{"If-None-Match": {etag}}); w.Code != http.StatusNotModified {
+		return errors.Errorf("GET %s with If-None-Match: expected status '%d', got '%d'", name, http.StatusNotModified, w.Code)
+	}
+
+	// Same size, the contents only differ
+	if w := serve(http.MethodPut, "other", nil); w.Code != http.StatusCreated {
+		return errors.Errorf("PUT %s: unexpected status '%d'", name, w.Code)
+	}
+
+	if w := serve(http.MethodGet, "", http.Header{"If-Match": {etag}}); w.Code != http.StatusPreconditionFailed {
+		return errors.Errorf("GET %s with stale If-Match: expected status '%d', got '%d'", name, http.StatusPreconditionFailed, w.Code)
+	}
+
+	return nil
+}
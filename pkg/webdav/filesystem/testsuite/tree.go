@@ -0,0 +1,157 @@
+package testsuite
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/webdav"
+)
+
+// treeFiles are the files of the nested trees
+var treeFiles = []string{
+	"file1.txt",
+	"level1/file2.txt",
+	"level1/level2/file3.txt",
+	"level1/level2/level3/file4.txt",
+	"other/file5.txt",
+}
+
+// RenameTree tests the renaming of a nested directory tree
+func RenameTree(ctx context.Context, fs webdav.FileSystem) error {
+	if err := fs.Mkdir(ctx, "Test", os.ModePerm); err != nil && !errors.Is(err, os.ErrExist) {
+		return errors.WithStack(err)
+	}
+
+	base := "/Test/RenameTree"
+
+	if err := fs.Mkdir(ctx, base, os.ModePerm); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := createTree(ctx, fs, base+"/source"); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := fs.Rename(ctx, base+"/source", base+"/target"); err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, name := range treeFiles {
+		if err := checkTreeFile(ctx, fs, base+"/target", name); err != nil {
+			return errors.WithStack(err)
+		}
+
+		if _, err := fs.Stat(ctx, path.Join(base, "source", name)); !errors.Is(err, os.ErrNotExist) {
+			return errors.Errorf("stat '%s' after rename: expected '%v', got '%v'", path.Join(base, "source", name), os.ErrNotExist, err)
+		}
+	}
+
+	if _, err := fs.Stat(ctx, base+"/source"); !errors.Is(err, os.ErrNotExist) {
+		return errors.Errorf("stat '%s' after rename: expected '%v', got '%v'", base+"/source", os.ErrNotExist, err)
+	}
+
+	info, err := fs.Stat(ctx, base+"/target/level1/level2")
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if !info.IsDir() {
+		return errors.Errorf("expected '%s' to be a directory", base+"/target/level1/level2")
+	}
+
+	return nil
+}
+
+// RemoveTree tests the removal of a nested directory tree
+func RemoveTree(ctx context.Context, fs webdav.FileSystem) error {
+	if err := fs.Mkdir(ctx, "Test", os.ModePerm); err != nil && !errors.Is(err, os.ErrExist) {
+		return errors.WithStack(err)
+	}
+
+	base := "/Test/RemoveTree"
+
+	if err := fs.Mkdir(ctx, base, os.ModePerm); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := createTree(ctx, fs, base+"/removed"); err != nil {
+		return errors.WithStack(err)
+	}
+
+	// A sibling sharing the prefix of the removed tree
+	if err := createTree(ctx, fs, base+"/removed-sibling"); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := fs.RemoveAll(ctx, base+"/removed"); err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, name := range append([]string{"", "level1", "level1/level2"}, treeFiles...) {
+		if _, err := fs.Stat(ctx, path.Join(base, "removed", name)); !errors.Is(err, os.ErrNotExist) {
+			return errors.Errorf("stat '%s' after removal: expected '%v', got '%v'", path.Join(base, "removed", name), os.ErrNotExist, err)
+		}
+	}
+
+	for _, name := range treeFiles {
+		if err := checkTreeFile(ctx, fs, base+"/removed-sibling", name); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// createTree creates the nested tree under the given directory,
+// each file containing its name
+func createTree(ctx context.Context, fs webdav.FileSystem, root string) error {
+	dirs := []string{"", "level1", "level1/level2", "level1/level2/level3", "other"}
+
+	for _, dir := range dirs {
+		if err := fs.Mkdir(ctx, path.Join(root, dir), os.ModePerm); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	for _, name := range treeFiles {
+		file, err := fs.OpenFile(ctx, path.Join(root, name), os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.ModePerm)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+
+		if _, err := io.WriteString(file, name); err != nil {
+			file.Close()
+			return errors.WithStack(err)
+		}
+
+		if err := file.Close(); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+
+	return nil
+}
+
+// checkTreeFile checks the content of the given file of a tree
+func checkTreeFile(ctx context.Context, fs webdav.FileSystem, root string, name string) error {
+	file, err := fs.OpenFile(ctx, path.Join(root, name), os.O_RDONLY, 0)
+	if err != nil {
+		return errors.Wrapf(err, "could not open '%s'", path.Join(root, name))
+	}
+
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if e, g := name, string(data); e != g {
+		return errors.Errorf("content of '%s': expected '%s', got '%s'", path.Join(root, name), e, g)
+	}
+
+	return nil
+}
@@ -0,0 +1,52 @@
+package versioned
+
+import (
+	"encoding/xml"
+	"os"
+
+	"github.com/bornholm/calli/pkg/webdav/filesystem"
+	"golang.org/x/net/webdav"
+)
+
+// File hides the revisions directories from the listings
+type File struct {
+	webdav.File
+}
+
+// Readdir implements webdav.File.
+func (f *File) Readdir(count int) ([]os.FileInfo, error) {
+	for {
+		infos, err := f.File.Readdir(count)
+
+		visible := make([]os.FileInfo, 0, len(infos))
+		for _, info := range infos {
+			if info.Name() == DirName {
+				continue
+			}
+
+			visible = append(visible, info)
+		}
+
+		// Do not return an empty page while entries remain
+		if len(visible) == 0 && len(infos) > 0 && count > 0 && err == nil {
+			continue
+		}
+
+		return visible, err
+	}
+}
+
+// DeadProps implements webdav.DeadPropsHolder.
+func (f *File) DeadProps() (map[xml.Name]webdav.Property, error) {
+	return filesystem.DeadProps(f.File)
+}
+
+// Patch implements webdav.DeadPropsHolder.
+func (f *File) Patch(patches []webdav.Proppatch) ([]webdav.Propstat, error) {
+	return filesystem.Patch(f.File, patches)
+}
+
+var (
+	_ webdav.File            = &File{}
+	_ webdav.DeadPropsHolder = &File{}
+)
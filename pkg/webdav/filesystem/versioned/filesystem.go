@@ -0,0 +1,303 @@
+package versioned
+
+import (
+	"context"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/webdav"
+)
+
+// FileSystem keeps the previous revisions of the files truncated or
+// removed from its backend, and of the removed directories, by moving
+// them to the hidden DirName directory of their parent
+type FileSystem struct {
+	backend webdav.FileSystem
+
+	// Number of revisions kept for each resource, unlimited if 0
+	maxVersions int
+
+	// Duration the revisions are kept for, unlimited if 0
+	maxAge time.Duration
+}
+
+// Mkdir implements webdav.FileSystem.
+func (f *FileSystem) Mkdir(ctx context.Context, name string, perm os.FileMode) error {
+	if IsVersion(name) {
+		return errors.Wrapf(os.ErrPermission, "could not create '%s' in the revisions", name)
+	}
+
+	return f.backend.Mkdir(ctx, name, perm)
+}
+
+// OpenFile implements webdav.FileSystem. The
+// revisions can only be opened for reading.
+func (f *FileSystem) OpenFile(ctx context.Context, name string, flag int, perm os.FileMode) (webdav.File, error) {
+	if IsVersion(name) && flag&(os.O_WRONLY|os.O_RDWR|os.O_CREATE|os.O_TRUNC|os.O_APPEND) != 0 {
+		return nil, errors.Wrapf(os.ErrPermission, "could not write revision '%s'", name)
+	}
+
+	var kept string
+
+	if flag&os.O_TRUNC != 0 && !IsVersion(name) {
+		version, err := f.keep(ctx, name, false)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+
+		if version != "" {
+			// The truncated file has been moved away
+			flag |= os.O_CREATE
+			kept = version
+		}
+	}
+
+	if path.Base(path.Dir(name)) == DirName {
+		// The expired revisions are never listed
+		if err := f.prune(ctx, name); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, errors.WithStack(err)
+		}
+	}
+
+	file, err := f.backend.OpenFile(ctx, name, flag, perm)
+	if err != nil {
+		if kept != "" {
+			// Put the file back, as if the truncation did not happen
+			if renameErr := f.backend.Rename(ctx, kept, name); renameErr != nil {
+				return nil, errors.Wrapf(err, "could not restore '%s' after failed opening: %+v", name, renameErr)
+			}
+		}
+
+		return nil, err
+	}
+
+	return &File{File: file}, nil
+}
+
+// RemoveAll implements webdav.FileSystem. The revisions are
+// only removed once expired.
+func (f *FileSystem) RemoveAll(ctx context.Context, name string) error {
+	if IsVersion(name) {
+		return errors.Wrapf(os.ErrPermission, "could not remove revision '%s'", name)
+	}
+
+	if path.Clean("/"+name) == "/" {
+		return f.backend.RemoveAll(ctx, name)
+	}
+
+	version, err := f.keep(ctx, name, true)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if version != "" {
+		return nil
+	}
+
+	return f.backend.RemoveAll(ctx, name)
+}
+
+// Rename implements webdav.FileSystem. The replaced resource is kept
+// as a revision and the revisions of the renamed one follow it. A
+// revision can be moved out of the revisions, as when restoring a
+// directory, but nothing can be moved into them.
+func (f *FileSystem) Rename(ctx context.Context, oldName string, newName string) error {
+	if IsVersion(newName) {
+		return errors.Wrapf(os.ErrPermission, "could not rename '%s' to revision '%s'", oldName, newName)
+	}
+
+	if IsVersion(oldName) {
+		return f.backend.Rename(ctx, oldName, newName)
+	}
+
+	if _, err := f.backend.Stat(ctx, oldName); err != nil {
+		return err
+	}
+
+	kept, err := f.keep(ctx, newName, true)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := f.backend.Rename(ctx, oldName, newName); err != nil {
+		if kept != "" {
+			// Put the replaced resource back, as if the rename did not happen
+			if restoreErr := f.backend.Rename(ctx, kept, newName); restoreErr != nil {
+				return errors.Wrapf(err, "could not restore '%s' after failed rename: %+v", newName, restoreErr)
+			}
+		}
+
+		return err
+	}
+
+	if err := f.moveVersions(ctx, oldName, newName); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Stat implements webdav.FileSystem.
+func (f *FileSystem) Stat(ctx context.Context, name string) (os.FileInfo, error) {
+	return f.backend.Stat(ctx, name)
+}
+
+// keep moves the named resource to its revisions and returns the name
+// of the new revision, or an empty string if there is nothing to keep.
+// The empty files are not kept, nor the directories unless withDirs is true.
+func (f *FileSystem) keep(ctx context.Context, name string, withDirs bool) (string, error) {
+	info, err := f.backend.Stat(ctx, name)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return "", nil
+		}
+
+		return "", errors.WithStack(err)
+	}
+
+	if (info.IsDir() && !withDirs) || (!info.IsDir() && info.Size() == 0) {
+		return "", nil
+	}
+
+	dir := versionsDir(name)
+
+	for _, d := range []string{path.Dir(dir), dir} {
+		if err := f.backend.Mkdir(ctx, d, os.ModePerm); err != nil && !errors.Is(err, os.ErrExist) {
+			return "", errors.Wrapf(err, "could not create versions directory '%s'", d)
+		}
+	}
+
+	version := path.Join(dir, newVersionID(time.Now()))
+
+	if err := f.backend.Rename(ctx, name, version); err != nil {
+		return "", errors.Wrapf(err, "could not keep revision of '%s'", name)
+	}
+
+	if err := f.prune(ctx, dir); err != nil {
+		return "", errors.WithStack(err)
+	}
+
+	return version, nil
+}
+
+// moveVersions moves the revisions of the renamed resource to the ones
+// of its new name, merging them with the existing ones if any
+func (f *FileSystem) moveVersions(ctx context.Context, oldName string, newName string) error {
+	src := versionsDir(oldName)
+	dst := versionsDir(newName)
+
+	if _, err := f.backend.Stat(ctx, src); err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+
+		return errors.WithStack(err)
+	}
+
+	if err := f.backend.Mkdir(ctx, path.Dir(dst), os.ModePerm); err != nil && !errors.Is(err, os.ErrExist) {
+		return errors.Wrapf(err, "could not create versions directory '%s'", path.Dir(dst))
+	}
+
+	if _, err := f.backend.Stat(ctx, dst); err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			return errors.WithStack(err)
+		}
+
+		if err := f.backend.Rename(ctx, src, dst); err != nil {
+			return errors.Wrapf(err, "could not move revisions of '%s'", oldName)
+		}
+
+		return nil
+	}
+
+	file, err := f.backend.OpenFile(ctx, src, os.O_RDONLY, 0)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	infos, err := file.Readdir(-1)
+	file.Close()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	for _, info := range infos {
+		if err := f.backend.Rename(ctx, path.Join(src, info.Name()), path.Join(dst, info.Name())); err != nil {
+			return errors.Wrapf(err, "could not move revision '%s' of '%s'", info.Name(), oldName)
+		}
+	}
+
+	if err := f.backend.RemoveAll(ctx, src); err != nil {
+		return errors.WithStack(err)
+	}
+
+	if err := f.prune(ctx, dst); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// prune removes the revisions of the given directory exceeding
+// the number of revisions to keep, or kept for too long
+func (f *FileSystem) prune(ctx context.Context, dir string) error {
+	if f.maxVersions <= 0 && f.maxAge <= 0 {
+		return nil
+	}
+
+	file, err := f.backend.OpenFile(ctx, dir, os.O_RDONLY, 0)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	infos, err := file.Readdir(-1)
+	file.Close()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	ids := make([]string, 0, len(infos))
+	for _, info := range infos {
+		ids = append(ids, info.Name())
+	}
+
+	// Most recent first
+	slices.SortFunc(ids, func(a, b string) int {
+		return strings.Compare(b, a)
+	})
+
+	kept := 0
+
+	for _, id := range ids {
+		t, err := parseVersionID(id)
+		if err != nil {
+			continue
+		}
+
+		expired := (f.maxVersions > 0 && kept >= f.maxVersions) || (f.maxAge > 0 && time.Since(t) > f.maxAge)
+		if !expired {
+			kept++
+			continue
+		}
+
+		if err := f.backend.RemoveAll(ctx, path.Join(dir, id)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return errors.Wrapf(err, "could not remove expired revision '%s'", id)
+		}
+	}
+
+	return nil
+}
+
+func NewFileSystem(backend webdav.FileSystem, maxVersions int, maxAge time.Duration) *FileSystem {
+	return &FileSystem{
+		backend:     backend,
+		maxVersions: maxVersions,
+		maxAge:      maxAge,
+	}
+}
+
+var _ webdav.FileSystem = &FileSystem{}
@@ -0,0 +1,343 @@
+package versioned
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/bornholm/calli/pkg/webdav/filesystem/local"
+	"github.com/bornholm/calli/pkg/webdav/filesystem/testsuite"
+	"github.com/pkg/errors"
+	"golang.org/x/net/webdav"
+)
+
+func TestFileSystem(t *testing.T) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	dataDir := filepath.Join(cwd, "testdata/.local")
+
+	if err := os.RemoveAll(dataDir); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if err := os.MkdirAll(dataDir, os.ModePerm); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	testsuite.TestFileSystem(t, Type, &Options{
+		MaxVersions: 3,
+		Backend: FileSystemOptions{
+			Type: local.Type,
+			Options: local.Options{
+				Dir: dataDir,
+			},
+		},
+	})
+}
+
+func TestVersions(t *testing.T) {
+	ctx := context.Background()
+
+	fs := NewFileSystem(webdav.NewMemFS(), 2, 0)
+
+	write := func(name string, content string) {
+		file, err := fs.OpenFile(ctx, name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.ModePerm)
+		if err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		if _, err := io.WriteString(file, content); err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		if err := file.Close(); err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+	}
+
+	read := func(name string) string {
+		file, err := fs.OpenFile(ctx, name, os.O_RDONLY, 0)
+		if err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		defer file.Close()
+
+		data, err := io.ReadAll(file)
+		if err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		return string(data)
+	}
+
+	for _, content := range []string{"v1", "v2", "v3", "v4"} {
+		write("/notes.txt", content)
+	}
+
+	versions, err := Versions(ctx, fs, "/notes.txt")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	// The oldest revision has been pruned
+	if e, g := 2, len(versions); e != g {
+		t.Fatalf("len(versions): expected '%v', got '%v'", e, g)
+	}
+
+	if e, g := "v3", read(versions[0].Name); e != g {
+		t.Errorf("versions[0]: expected '%v', got '%v'", e, g)
+	}
+
+	if err := Restore(ctx, fs, "/notes.txt", versions[1].ID); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := "v2", read("/notes.txt"); e != g {
+		t.Errorf("restored file: expected '%v', got '%v'", e, g)
+	}
+
+	versions, err = Versions(ctx, fs, "/notes.txt")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	// The content replaced by the restoration is kept
+	if e, g := "v4", read(versions[0].Name); e != g {
+		t.Errorf("versions[0]: expected '%v', got '%v'", e, g)
+	}
+
+	if err := Restore(ctx, fs, "/notes.txt", "../../notes.txt"); !errors.Is(err, ErrInvalidVersion) {
+		t.Errorf("restore invalid version: expected '%v', got '%v'", ErrInvalidVersion, err)
+	}
+
+	// Removed directories are kept as a whole
+	if err := fs.Mkdir(ctx, "/docs", os.ModePerm); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	write("/docs/a.txt", "a")
+
+	if err := fs.RemoveAll(ctx, "/docs"); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	versions, err = Versions(ctx, fs, "/docs")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := 1, len(versions); e != g {
+		t.Fatalf("len(versions): expected '%v', got '%v'", e, g)
+	}
+
+	if err := Restore(ctx, fs, "/docs", versions[0].ID); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := "a", read("/docs/a.txt"); e != g {
+		t.Errorf("restored directory: expected '%v', got '%v'", e, g)
+	}
+
+	// Revisions are hidden from the listings
+	root, err := fs.OpenFile(ctx, "/", os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	defer root.Close()
+
+	infos, err := root.Readdir(-1)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	for _, info := range infos {
+		if info.Name() == DirName {
+			t.Errorf("'%s' should not be listed", DirName)
+		}
+	}
+}
+
+func TestVersionsReadOnly(t *testing.T) {
+	ctx := context.Background()
+
+	fs := NewFileSystem(webdav.NewMemFS(), 0, 0)
+
+	handler := &webdav.Handler{
+		FileSystem: fs,
+		LockSystem: webdav.NewMemLS(),
+	}
+
+	serve := func(method string, target string, body string, headers ...string) int {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+
+		res := httptest.NewRecorder()
+
+		handler.ServeHTTP(res, req)
+
+		return res.Code
+	}
+
+	for _, content := range []string{"v1", "v2"} {
+		if code := serve(http.MethodPut, "/notes.txt", content); code >= http.StatusBadRequest {
+			t.Fatalf("PUT: unexpected status %d", code)
+		}
+	}
+
+	versions, err := Versions(ctx, fs, "/notes.txt")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := 1, len(versions); e != g {
+		t.Fatalf("len(versions): expected '%v', got '%v'", e, g)
+	}
+
+	if code := serve(http.MethodDelete, versions[0].Name, ""); code < http.StatusBadRequest {
+		t.Errorf("DELETE revision: unexpected status %d", code)
+	}
+
+	if code := serve(http.MethodDelete, "/"+DirName, ""); code < http.StatusBadRequest {
+		t.Errorf("DELETE revisions: unexpected status %d", code)
+	}
+
+	if code := serve(http.MethodPut, versions[0].Name, "forged"); code < http.StatusBadRequest {
+		t.Errorf("PUT revision: unexpected status %d", code)
+	}
+
+	if code := serve(http.MethodPut, "/"+DirName+"/notes.txt/20000101T000000.000000000Z", "forged"); code < http.StatusBadRequest {
+		t.Errorf("PUT new revision: unexpected status %d", code)
+	}
+
+	if code := serve("MKCOL", "/"+DirName+"/docs", ""); code < http.StatusBadRequest {
+		t.Errorf("MKCOL in revisions: unexpected status %d", code)
+	}
+
+	if code := serve("MOVE", "/notes.txt", "", "Destination", "/"+DirName+"/notes.txt/20000101T000000.000000000Z"); code < http.StatusBadRequest {
+		t.Errorf("MOVE to revisions: unexpected status %d", code)
+	}
+
+	versions, err = Versions(ctx, fs, "/notes.txt")
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := 1, len(versions); e != g {
+		t.Fatalf("len(versions): expected '%v', got '%v'", e, g)
+	}
+
+	file, err := fs.OpenFile(ctx, versions[0].Name, os.O_RDONLY, 0)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	defer file.Close()
+
+	data, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := "v1", string(data); e != g {
+		t.Errorf("revision: expected '%v', got '%v'", e, g)
+	}
+}
+
+func TestRenameVersions(t *testing.T) {
+	ctx := context.Background()
+
+	fs := NewFileSystem(webdav.NewMemFS(), 0, 0)
+
+	handler := &webdav.Handler{
+		FileSystem: fs,
+		LockSystem: webdav.NewMemLS(),
+	}
+
+	serve := func(method string, target string, body string, headers ...string) int {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+
+		res := httptest.NewRecorder()
+
+		handler.ServeHTTP(res, req)
+
+		return res.Code
+	}
+
+	contents := func(name string) []string {
+		versions, err := Versions(ctx, fs, name)
+		if err != nil {
+			t.Fatalf("%+v", errors.WithStack(err))
+		}
+
+		contents := make([]string, 0, len(versions))
+
+		for _, v := range versions {
+			file, err := fs.OpenFile(ctx, v.Name, os.O_RDONLY, 0)
+			if err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			data, err := io.ReadAll(file)
+			file.Close()
+			if err != nil {
+				t.Fatalf("%+v", errors.WithStack(err))
+			}
+
+			contents = append(contents, string(data))
+		}
+
+		return contents
+	}
+
+	for _, content := range []string{"a1", "a2"} {
+		if code := serve(http.MethodPut, "/a.txt", content); code >= http.StatusBadRequest {
+			t.Fatalf("PUT: unexpected status %d", code)
+		}
+	}
+
+	if code := serve(http.MethodPut, "/b.txt", "b1"); code >= http.StatusBadRequest {
+		t.Fatalf("PUT: unexpected status %d", code)
+	}
+
+	if code := serve("MOVE", "/a.txt", "", "Destination", "/b.txt", "Overwrite", "T"); code >= http.StatusBadRequest {
+		t.Fatalf("MOVE: unexpected status %d", code)
+	}
+
+	// The history follows the moved file, along with the replaced content
+	if e, g := []string{"b1", "a1"}, contents("/b.txt"); !slices.Equal(e, g) {
+		t.Errorf("revisions of '/b.txt': expected '%v', got '%v'", e, g)
+	}
+
+	if e, g := 0, len(contents("/a.txt")); e != g {
+		t.Errorf("revisions of '/a.txt': expected '%v', got '%v'", e, g)
+	}
+
+	// The replaced file is kept by a direct rename as well
+	if code := serve(http.MethodPut, "/c.txt", "c1"); code >= http.StatusBadRequest {
+		t.Fatalf("PUT: unexpected status %d", code)
+	}
+
+	if err := fs.Rename(ctx, "/c.txt", "/b.txt"); err != nil {
+		t.Fatalf("%+v", errors.WithStack(err))
+	}
+
+	if e, g := []string{"a2", "b1", "a1"}, contents("/b.txt"); !slices.Equal(e, g) {
+		t.Errorf("revisions of '/b.txt': expected '%v', got '%v'", e, g)
+	}
+}
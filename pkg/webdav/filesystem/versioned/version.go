@@ -0,0 +1,193 @@
+package versioned
+
+import (
+	"context"
+	"io"
+	"os"
+	"path"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"golang.org/x/net/webdav"
+)
+
+// DirName is the name of the hidden directories keeping
+// the previous revisions of their siblings
+const DirName = ".versions"
+
+// idLayout formats the revisions identifiers, sortable and
+// of constant length
+const idLayout = "20060102T150405.000000000Z"
+
+var ErrInvalidVersion = errors.New("invalid version")
+
+// Version is a previous revision of a file, or of a removed directory
+type Version struct {
+	ID    string
+	Name  string
+	Time  time.Time // Time at which the revision was replaced or removed
+	Size  int64
+	IsDir bool
+}
+
+// Versions returns the revisions of the named resource kept in the
+// given filesystem, the most recent first
+func Versions(ctx context.Context, fs webdav.FileSystem, name string) ([]Version, error) {
+	dir := versionsDir(name)
+
+	file, err := fs.OpenFile(ctx, dir, os.O_RDONLY, 0)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []Version{}, nil
+		}
+
+		return nil, errors.WithStack(err)
+	}
+
+	defer file.Close()
+
+	infos, err := file.Readdir(-1)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	versions := make([]Version, 0, len(infos))
+
+	for _, info := range infos {
+		t, err := parseVersionID(info.Name())
+		if err != nil {
+			continue
+		}
+
+		versions = append(versions, Version{
+			ID:    info.Name(),
+			Name:  path.Join(dir, info.Name()),
+			Time:  t,
+			Size:  info.Size(),
+			IsDir: info.IsDir(),
+		})
+	}
+
+	slices.SortFunc(versions, func(a, b Version) int {
+		return strings.Compare(b.ID, a.ID)
+	})
+
+	return versions, nil
+}
+
+// Restore restores the given revision of the named resource. A file's
+// content is copied back, its current content being kept as a new revision
+// by the versioned filesystems, whereas a directory is moved back if the
+// named resource does not exist.
+func Restore(ctx context.Context, fs webdav.FileSystem, name string, id string) error {
+	if _, err := parseVersionID(id); err != nil {
+		return errors.WithStack(err)
+	}
+
+	version := path.Join(versionsDir(name), id)
+
+	info, err := fs.Stat(ctx, version)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if info.IsDir() {
+		if _, err := fs.Stat(ctx, name); err == nil {
+			return errors.Wrapf(os.ErrExist, "could not restore directory '%s'", name)
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return errors.WithStack(err)
+		}
+
+		if err := fs.Rename(ctx, version, name); err != nil {
+			return errors.WithStack(err)
+		}
+
+		return nil
+	}
+
+	src, err := fs.OpenFile(ctx, version, os.O_RDONLY, 0)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	defer src.Close()
+
+	dst, err := fs.OpenFile(ctx, name, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, os.ModePerm)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return errors.Wrapf(err, "could not restore file '%s'", name)
+	}
+
+	if err := dst.Close(); err != nil {
+		return errors.WithStack(err)
+	}
+
+	return nil
+}
+
+// Removed returns the names of the resources of the given directory
+// which have revisions but do not exist anymore
+func Removed(ctx context.Context, fs webdav.FileSystem, dir string) ([]string, error) {
+	file, err := fs.OpenFile(ctx, path.Join(dir, DirName), os.O_RDONLY, 0)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return []string{}, nil
+		}
+
+		return nil, errors.WithStack(err)
+	}
+
+	defer file.Close()
+
+	infos, err := file.Readdir(-1)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	removed := make([]string, 0)
+
+	for _, info := range infos {
+		if _, err := fs.Stat(ctx, path.Join(dir, info.Name())); err == nil {
+			continue
+		} else if !errors.Is(err, os.ErrNotExist) {
+			return nil, errors.WithStack(err)
+		}
+
+		removed = append(removed, info.Name())
+	}
+
+	slices.Sort(removed)
+
+	return removed, nil
+}
+
+// IsVersion returns true if the named resource belongs to the
+// revisions of another resource
+func IsVersion(name string) bool {
+	return slices.Contains(strings.Split(name, "/"), DirName)
+}
+
+// versionsDir returns the directory keeping the
+// revisions of the named resource
+func versionsDir(name string) string {
+	return path.Join(path.Dir(name), DirName, path.Base(name))
+}
+
+func newVersionID(t time.Time) string {
+	return t.UTC().Format(idLayout)
+}
+
+func parseVersionID(id string) (time.Time, error) {
+	t, err := time.Parse(idLayout, id)
+	if err != nil {
+		return time.Time{}, errors.Wrapf(ErrInvalidVersion, "could not parse version '%s'", id)
+	}
+
+	return t, nil
+}